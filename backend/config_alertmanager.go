@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// amConfig is an alertmanager.yml
+type amConfig struct {
+	Global       *amGlobal        `yaml:"global,omitempty"`
+	Route        *amRoute         `yaml:"route"`
+	InhibitRules []*amInhibitRule `yaml:"inhibit_rules,omitempty"`
+	Receivers    []*amReceiver    `yaml:"receivers"`
+}
+
+type amGlobal struct {
+	ResolveTimeout   string `json:"resolve_timeout" yaml:"resolve_timeout,omitempty"`
+	SMTPSmarthost    string `json:"smtp_smarthost" yaml:"smtp_smarthost,omitempty"`
+	SMTPFrom         string `json:"smtp_from" yaml:"smtp_from,omitempty"`
+	SMTPAuthUsername string `json:"smtp_auth_username" yaml:"smtp_auth_username,omitempty"`
+	SMTPAuthPassword string `json:"smtp_auth_password" yaml:"smtp_auth_password,omitempty"`
+	SMTPRequireTLS   *bool  `json:"smtp_require_tls" yaml:"smtp_require_tls,omitempty"`
+}
+
+type amRoute struct {
+	Receiver       string     `yaml:"receiver,omitempty"`
+	GroupBy        []string   `yaml:"group_by,omitempty"`
+	Matchers       []string   `yaml:"matchers,omitempty"`
+	Continue       bool       `yaml:"continue,omitempty"`
+	GroupWait      string     `yaml:"group_wait,omitempty"`
+	GroupInterval  string     `yaml:"group_interval,omitempty"`
+	RepeatInterval string     `yaml:"repeat_interval,omitempty"`
+	Routes         []*amRoute `yaml:"routes,omitempty"`
+}
+
+type amInhibitRule struct {
+	SourceMatchers []string `yaml:"source_matchers"`
+	TargetMatchers []string `yaml:"target_matchers"`
+	Equal          []string `yaml:"equal,omitempty"`
+}
+
+type amReceiver struct {
+	Name           string             `yaml:"name"`
+	WebhookConfigs []*amWebhookConfig `yaml:"webhook_configs,omitempty"`
+	EmailConfigs   []*amEmailConfig   `yaml:"email_configs,omitempty"`
+	SlackConfigs   []*amSlackConfig   `yaml:"slack_configs,omitempty"`
+}
+
+type amWebhookConfig struct {
+	URL          string `yaml:"url"`
+	SendResolved *bool  `yaml:"send_resolved,omitempty"`
+}
+
+type amEmailConfig struct {
+	To           string `yaml:"to"`
+	SendResolved *bool  `yaml:"send_resolved,omitempty"`
+}
+
+type amSlackConfig struct {
+	APIURL       string `yaml:"api_url"`
+	Channel      string `yaml:"channel,omitempty"`
+	Title        string `yaml:"title,omitempty"`
+	Text         string `yaml:"text,omitempty"`
+	SendResolved *bool  `yaml:"send_resolved,omitempty"`
+}
+
+// alertmanagerOptions is the structured request of the alertmanager
+// generator
+type alertmanagerOptions struct {
+	Global          *amGlobal                   `json:"global"`
+	GroupBy         []string                    `json:"group_by"`
+	GroupWait       string                      `json:"group_wait"`
+	GroupInterval   string                      `json:"group_interval"`
+	RepeatInterval  string                      `json:"repeat_interval"`
+	DefaultReceiver string                      `json:"default_receiver"`
+	Receivers       []*alertmanagerReceiverSpec `json:"receivers"`
+	Routes          []*alertmanagerRouteSpec    `json:"routes"`
+	InhibitRules    []*alertmanagerInhibitSpec  `json:"inhibit_rules"`
+	// SeverityInhibit mutes warning and info alerts while a critical (or
+	// warning) alert fires for the same alertname and instance
+	SeverityInhibit bool `json:"severity_inhibit"`
+}
+
+// alertmanagerReceiverSpec is a receiver of type webhook, email or slack
+// (a Slack-format incoming webhook, also accepted by Mattermost and others)
+type alertmanagerReceiverSpec struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	URL          string `json:"url"`
+	To           string `json:"to"`
+	Channel      string `json:"channel"`
+	Title        string `json:"title"`
+	Text         string `json:"text"`
+	SendResolved *bool  `json:"send_resolved"`
+}
+
+// alertmanagerRouteSpec matches alerts by device group, severity and vendor
+// labels, plus any other labels in Matchers
+type alertmanagerRouteSpec struct {
+	Receiver       string                   `json:"receiver"`
+	Group          string                   `json:"group"`
+	Severity       string                   `json:"severity"`
+	Vendor         string                   `json:"vendor"`
+	Matchers       map[string]string        `json:"matchers"`
+	GroupBy        []string                 `json:"group_by"`
+	Continue       bool                     `json:"continue"`
+	GroupWait      string                   `json:"group_wait"`
+	GroupInterval  string                   `json:"group_interval"`
+	RepeatInterval string                   `json:"repeat_interval"`
+	Routes         []*alertmanagerRouteSpec `json:"routes"`
+}
+
+type alertmanagerInhibitSpec struct {
+	Source map[string]string `json:"source"`
+	Target map[string]string `json:"target"`
+	Equal  []string          `json:"equal"`
+}
+
+// generateAlertmanagerConfig builds and validates alertmanager.yml from the
+// structured options; targets are not used
+func generateAlertmanagerConfig(name string, targets []string, options map[string]interface{}) (*generatedConfig, error) {
+	opts := alertmanagerOptions{
+		GroupBy:         []string{"alertname", "group", "severity"},
+		GroupWait:       "30s",
+		GroupInterval:   "5m",
+		RepeatInterval:  "4h",
+		SeverityInhibit: true,
+	}
+	if err := decodeConfigOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if len(opts.Receivers) == 0 {
+		return nil, fmt.Errorf("at least one receiver is required")
+	}
+	if opts.DefaultReceiver == "" {
+		opts.DefaultReceiver = opts.Receivers[0].Name
+	}
+
+	out := &amConfig{
+		Global: opts.Global,
+		Route: &amRoute{
+			Receiver:       opts.DefaultReceiver,
+			GroupBy:        opts.GroupBy,
+			GroupWait:      opts.GroupWait,
+			GroupInterval:  opts.GroupInterval,
+			RepeatInterval: opts.RepeatInterval,
+		},
+	}
+	for _, spec := range opts.Receivers {
+		receiver, err := spec.receiver()
+		if err != nil {
+			return nil, err
+		}
+		out.Receivers = append(out.Receivers, receiver)
+	}
+	for _, spec := range opts.Routes {
+		out.Route.Routes = append(out.Route.Routes, spec.route())
+	}
+	if opts.SeverityInhibit {
+		out.InhibitRules = append(out.InhibitRules,
+			&amInhibitRule{SourceMatchers: []string{`severity="critical"`}, TargetMatchers: []string{`severity=~"warning|info"`}, Equal: []string{"alertname", "instance"}},
+			&amInhibitRule{SourceMatchers: []string{`severity="warning"`}, TargetMatchers: []string{`severity="info"`}, Equal: []string{"alertname", "instance"}},
+		)
+	}
+	for _, spec := range opts.InhibitRules {
+		if spec == nil || len(spec.Source) == 0 || len(spec.Target) == 0 {
+			return nil, fmt.Errorf("inhibit rules need source and target matchers")
+		}
+		out.InhibitRules = append(out.InhibitRules, &amInhibitRule{
+			SourceMatchers: amMatchers(spec.Source),
+			TargetMatchers: amMatchers(spec.Target),
+			Equal:          spec.Equal,
+		})
+	}
+
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	content, err := marshalConfigYAML(out)
+	if err != nil {
+		return nil, err
+	}
+	// The stored file must read back into the same structure
+	var check amConfig
+	if err := yaml.Unmarshal([]byte(content), &check); err != nil {
+		return nil, fmt.Errorf("generated config does not parse: %v", err)
+	}
+	return &generatedConfig{
+		Content:     content,
+		Description: fmt.Sprintf("alertmanager config with %d receivers and %d routes", len(out.Receivers), len(out.Route.Routes)),
+	}, nil
+}
+
+func (s *alertmanagerReceiverSpec) receiver() (*amReceiver, error) {
+	if s == nil {
+		return nil, fmt.Errorf("receiver is empty")
+	}
+	receiver := &amReceiver{Name: s.Name}
+	switch s.Type {
+	case "webhook":
+		receiver.WebhookConfigs = []*amWebhookConfig{{URL: s.URL, SendResolved: s.SendResolved}}
+	case "email":
+		receiver.EmailConfigs = []*amEmailConfig{{To: s.To, SendResolved: s.SendResolved}}
+	case "slack":
+		receiver.SlackConfigs = []*amSlackConfig{{
+			APIURL:       s.URL,
+			Channel:      s.Channel,
+			Title:        s.Title,
+			Text:         s.Text,
+			SendResolved: s.SendResolved,
+		}}
+		if receiver.SlackConfigs[0].Text == "" {
+			receiver.SlackConfigs[0].Text = `{{ range .Alerts }}{{ .Annotations.summary }}{{ "\n" }}{{ end }}`
+		}
+	default:
+		return nil, fmt.Errorf("receiver %s: unknown type %q (webhook, email, slack)", s.Name, s.Type)
+	}
+	return receiver, nil
+}
+
+func (s *alertmanagerRouteSpec) route() *amRoute {
+	if s == nil {
+		return &amRoute{}
+	}
+	labels := make(map[string]string, len(s.Matchers)+3)
+	for label, value := range s.Matchers {
+		labels[label] = value
+	}
+	for label, value := range map[string]string{"group": s.Group, "severity": s.Severity, "vendor": s.Vendor} {
+		if value != "" {
+			labels[label] = value
+		}
+	}
+	route := &amRoute{
+		Receiver:       s.Receiver,
+		GroupBy:        s.GroupBy,
+		Matchers:       amMatchers(labels),
+		Continue:       s.Continue,
+		GroupWait:      s.GroupWait,
+		GroupInterval:  s.GroupInterval,
+		RepeatInterval: s.RepeatInterval,
+	}
+	for _, child := range s.Routes {
+		route.Routes = append(route.Routes, child.route())
+	}
+	return route
+}
+
+// amMatchers renders equality matchers in label order
+func amMatchers(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	matchers := make([]string, 0, len(names))
+	for _, name := range names {
+		matchers = append(matchers, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return matchers
+}
+
+// Validate applies the checks alertmanager runs when loading its config
+func (c *amConfig) Validate() error {
+	receivers := make(map[string]bool)
+	hasEmail := false
+	for _, receiver := range c.Receivers {
+		if receiver.Name == "" {
+			return fmt.Errorf("receiver name is required")
+		}
+		if receivers[receiver.Name] {
+			return fmt.Errorf("receiver %s is defined twice", receiver.Name)
+		}
+		receivers[receiver.Name] = true
+		for _, webhook := range receiver.WebhookConfigs {
+			if err := validateAlertURL(webhook.URL); err != nil {
+				return fmt.Errorf("receiver %s: %v", receiver.Name, err)
+			}
+		}
+		for _, slack := range receiver.SlackConfigs {
+			if err := validateAlertURL(slack.APIURL); err != nil {
+				return fmt.Errorf("receiver %s: %v", receiver.Name, err)
+			}
+		}
+		for _, email := range receiver.EmailConfigs {
+			if _, err := mail.ParseAddressList(email.To); err != nil {
+				return fmt.Errorf("receiver %s: invalid email address %q", receiver.Name, email.To)
+			}
+			hasEmail = true
+		}
+	}
+	if hasEmail {
+		if c.Global == nil || c.Global.SMTPSmarthost == "" || c.Global.SMTPFrom == "" {
+			return fmt.Errorf("email receivers need global smtp_smarthost and smtp_from")
+		}
+		if _, err := mail.ParseAddress(c.Global.SMTPFrom); err != nil {
+			return fmt.Errorf("invalid smtp_from %q", c.Global.SMTPFrom)
+		}
+	}
+	if c.Global != nil && c.Global.ResolveTimeout != "" {
+		if _, err := parsePromDuration(c.Global.ResolveTimeout); err != nil {
+			return fmt.Errorf("invalid resolve_timeout %q", c.Global.ResolveTimeout)
+		}
+	}
+
+	if c.Route.Receiver == "" {
+		return fmt.Errorf("the root route needs a receiver")
+	}
+	var checkRoute func(route *amRoute, depth int) error
+	checkRoute = func(route *amRoute, depth int) error {
+		if route.Receiver != "" && !receivers[route.Receiver] {
+			return fmt.Errorf("route uses undefined receiver %q", route.Receiver)
+		}
+		if depth > 0 && len(route.Matchers) == 0 {
+			return fmt.Errorf("route to %s matches nothing: set group, severity, vendor or matchers", route.Receiver)
+		}
+		for _, interval := range []string{route.GroupWait, route.GroupInterval, route.RepeatInterval} {
+			if interval == "" {
+				continue
+			}
+			if _, err := parsePromDuration(interval); err != nil {
+				return err
+			}
+		}
+		for _, label := range route.GroupBy {
+			if label != "..." && !promLabelNameRe.MatchString(label) {
+				return fmt.Errorf("invalid group_by label %q", label)
+			}
+		}
+		for _, child := range route.Routes {
+			if err := checkRoute(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := checkRoute(c.Route, 0); err != nil {
+		return err
+	}
+
+	for _, rule := range c.InhibitRules {
+		for _, label := range rule.Equal {
+			if !promLabelNameRe.MatchString(label) {
+				return fmt.Errorf("invalid inhibit equal label %q", label)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAlertURL requires an absolute http(s) URL
+func validateAlertURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %q", raw)
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"snmp-monitor-pro/snmp"
+)
+
+// categrafSNMPConfig is the conf/input.snmp/snmp.toml of categraf
+type categrafSNMPConfig struct {
+	Interval  int                     `toml:"interval,omitempty"`
+	Instances []*categrafSNMPInstance `toml:"instances"`
+}
+
+type categrafSNMPInstance struct {
+	Labels         map[string]string    `toml:"labels,omitempty"`
+	Agents         []string             `toml:"agents"`
+	AgentHostTag   string               `toml:"agent_host_tag,omitempty"`
+	Version        int                  `toml:"version"`
+	Community      string               `toml:"community,omitempty"`
+	SecName        string               `toml:"sec_name,omitempty"`
+	SecLevel       string               `toml:"sec_level,omitempty"`
+	AuthProtocol   string               `toml:"auth_protocol,omitempty"`
+	AuthPassword   string               `toml:"auth_password,omitempty"`
+	PrivProtocol   string               `toml:"priv_protocol,omitempty"`
+	PrivPassword   string               `toml:"priv_password,omitempty"`
+	Timeout        string               `toml:"timeout,omitempty"`
+	Retries        int                  `toml:"retries,omitempty"`
+	MaxRepetitions int                  `toml:"max_repetitions,omitempty"`
+	Fields         []*categrafSNMPField `toml:"field,omitempty"`
+	Tables         []*categrafSNMPTable `toml:"table,omitempty"`
+}
+
+type categrafSNMPField struct {
+	Name       string `toml:"name"`
+	OID        string `toml:"oid"`
+	IsTag      bool   `toml:"is_tag,omitempty"`
+	Conversion string `toml:"conversion,omitempty"`
+}
+
+type categrafSNMPTable struct {
+	Name        string               `toml:"name"`
+	OID         string               `toml:"oid"`
+	IndexAsTag  bool                 `toml:"index_as_tag,omitempty"`
+	InheritTags []string             `toml:"inherit_tags,omitempty"`
+	Fields      []*categrafSNMPField `toml:"field"`
+}
+
+// categrafSNMPOptions are the request options of the categraf generator.
+// Objects are MIB modules, tables, entries, columns, scalars or subtrees,
+// by name, MODULE::name or numeric OID.
+type categrafSNMPOptions struct {
+	Objects        []string `json:"objects"`
+	Interval       int      `json:"interval"` // seconds
+	Timeout        string   `json:"timeout"`
+	Retries        int      `json:"retries"`
+	MaxRepetitions int      `json:"max_repetitions"`
+	AgentHostTag   string   `json:"agent_host_tag"`
+}
+
+// generateCategrafConfig builds the categraf SNMP input for the devices in
+// targets (IDs, IPs or names; all devices when empty). Devices sharing
+// credentials (community or SNMPv3 user) and group are polled by one
+// instance.
+func generateCategrafConfig(name string, targets []string, options map[string]interface{}) (*generatedConfig, error) {
+	opts := categrafSNMPOptions{AgentHostTag: "ident"}
+	if err := decodeConfigOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if len(opts.Objects) == 0 {
+		return nil, fmt.Errorf("options.objects must list the MIB objects to collect")
+	}
+	if opts.Interval < 0 || opts.Retries < 0 || opts.MaxRepetitions < 0 {
+		return nil, fmt.Errorf("interval, retries and max_repetitions must not be negative")
+	}
+	if opts.Timeout != "" {
+		if _, err := time.ParseDuration(opts.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout %q", opts.Timeout)
+		}
+	}
+
+	devices, err := loadConfigDevices(targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no devices to poll")
+	}
+
+	tree, err := loadMIBTree()
+	if err != nil {
+		return nil, err
+	}
+	g := &categrafGenerator{tree: tree}
+	fields, tables, err := g.collect(opts.Objects)
+	if err != nil {
+		return nil, err
+	}
+
+	out := categrafSNMPConfig{Interval: opts.Interval}
+	instances := make(map[string]*categrafSNMPInstance)
+	// Users with the same name, level and protocols but other passphrases
+	// read them from numbered variables
+	userSecrets := make(map[string][][2]string)
+	polled := 0
+	for _, device := range devices {
+		version, err := snmpVersionNumber(device.SNMPVersion)
+		if err != nil {
+			g.warnf("skipped device %s: %v", device.Name, err)
+			continue
+		}
+		credentials := categrafSNMPInstance{Version: version, Community: device.Community}
+		if version == 3 {
+			security, err := deviceSecurity(device)
+			if err != nil {
+				g.warnf("skipped device %s: %v", device.Name, err)
+				continue
+			}
+			credentials = categrafSNMPInstance{
+				Version:      version,
+				SecName:      security.UserName,
+				SecLevel:     security.Level.String(),
+				AuthProtocol: strings.ReplaceAll(string(security.AuthProtocol), "-", ""),
+				PrivProtocol: strings.ReplaceAll(string(security.PrivProtocol), "-", ""),
+			}
+			name := snmpV3AuthName(security)
+			secrets := [2]string{security.AuthPassphrase, security.PrivPassphrase}
+			seen := userSecrets[name]
+			index := 0
+			for index < len(seen) && seen[index] != secrets {
+				index++
+			}
+			if index == len(seen) {
+				userSecrets[name] = append(seen, secrets)
+			}
+			if index > 0 {
+				name += "_" + strconv.Itoa(index+1)
+			}
+			var env []string
+			if security.Level >= snmp.AuthNoPriv {
+				var variable string
+				variable, credentials.AuthPassword = secretEnv("categraf", name, "auth_password")
+				env = append(env, variable)
+			}
+			if security.Level == snmp.AuthPriv {
+				var variable string
+				variable, credentials.PrivPassword = secretEnv("categraf", name, "priv_password")
+				env = append(env, variable)
+			}
+			if len(env) > 0 && index == len(seen) {
+				g.warnf("SNMPv3 user %s of device %s: set %s to its passphrases in the environment of categraf", security.UserName, device.Name, strings.Join(env, " and "))
+			}
+		}
+		port := device.SNMPPort
+		if port == 0 {
+			port = 161
+		}
+		key := fmt.Sprintf("%+v\x00%s", credentials, device.GroupName)
+		instance := instances[key]
+		if instance == nil {
+			instance = &credentials
+			instance.AgentHostTag = opts.AgentHostTag
+			instance.Timeout = opts.Timeout
+			instance.Retries = opts.Retries
+			instance.MaxRepetitions = opts.MaxRepetitions
+			instance.Fields = fields
+			instance.Tables = tables
+			if device.GroupName != "" {
+				instance.Labels = map[string]string{"group": device.GroupName}
+			}
+			instances[key] = instance
+			out.Instances = append(out.Instances, instance)
+		}
+		instance.Agents = append(instance.Agents, fmt.Sprintf("udp://%s:%d", device.IP, port))
+		polled++
+	}
+	if len(out.Instances) == 0 {
+		return nil, fmt.Errorf("none of the devices can be polled: %s", strings.Join(g.warnings, "; "))
+	}
+
+	content, err := toml.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return &generatedConfig{
+		Content:     string(content),
+		Description: fmt.Sprintf("categraf SNMP input for %d devices with %d fields and %d tables", polled, len(fields), len(tables)),
+		Warnings:    g.warnings,
+	}, nil
+}
+
+// loadConfigDevices returns the devices named by targets, matched by ID, IP
+// or name, or every device when targets is empty
+func loadConfigDevices(targets []string) ([]Device, error) {
+	var devices []Device
+	if len(targets) == 0 {
+		if err := db.Order("id").Find(&devices).Error; err != nil {
+			return nil, err
+		}
+		return devices, nil
+	}
+	for _, target := range targets {
+		var device Device
+		query := db.Where("ip = ? OR name = ?", target, target)
+		if id, err := strconv.ParseUint(target, 10, 64); err == nil {
+			query = db.Where("id = ?", id)
+		}
+		if err := query.First(&device).Error; err != nil {
+			return nil, fmt.Errorf("device %q not found", target)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// snmpVersionNumber converts Device.SNMPVersion to the protocol version
+func snmpVersionNumber(version string) (int, error) {
+	switch strings.ToLower(version) {
+	case "v1", "1":
+		return 1, nil
+	case "", "v2c", "v2", "2c", "2":
+		return 2, nil
+	case "v3", "3":
+		return 3, nil
+	}
+	return 0, fmt.Errorf("unknown SNMP version %q", version)
+}
+
+// categrafGenerator turns MIB objects into categraf fields and tables
+type categrafGenerator struct {
+	tree     *mibTree
+	warnings []string
+}
+
+func (g *categrafGenerator) warnf(format string, args ...interface{}) {
+	g.warnings = append(g.warnings, fmt.Sprintf(format, args...))
+}
+
+// collect expands the requested objects and splits them into scalar fields
+// and tables. Tables are named after the MIB table and carry their INDEX
+// objects as tags.
+func (g *categrafGenerator) collect(refs []string) ([]*categrafSNMPField, []*categrafSNMPTable, error) {
+	objects := make(map[string]*mibTreeNode)
+	for _, ref := range refs {
+		var nodes []*mibTreeNode
+		if n := g.tree.Lookup(ref); n != nil {
+			nodes = g.tree.Subtree(n.OID)
+		} else if oid := strings.TrimPrefix(strings.TrimSpace(ref), "."); isNumericOID(oid) {
+			nodes = g.tree.Subtree(oid)
+		} else if module := g.tree.resolver.Module(ref); module != nil {
+			for _, node := range module.Nodes {
+				if n := g.tree.byName[module.Name+"::"+node.Name]; n != nil {
+					nodes = append(nodes, n)
+				}
+			}
+		} else {
+			return nil, nil, fmt.Errorf("unknown MIB object or module %q", ref)
+		}
+		found := false
+		for _, n := range nodes {
+			if n.IsAccessible() {
+				objects[n.OID] = n
+				found = true
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("%s has no readable objects", ref)
+		}
+	}
+
+	nodes := make([]*mibTreeNode, 0, len(objects))
+	for _, n := range objects {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return oidSortKey(nodes[i].OID) < oidSortKey(nodes[j].OID)
+	})
+
+	var fields []*categrafSNMPField
+	var tables []*categrafSNMPTable
+	tableByOID := make(map[string]*categrafSNMPTable)
+	for _, n := range nodes {
+		entry := g.tree.Entry(n)
+		if entry == nil {
+			if field := g.field(n, "."+n.OID+".0"); field != nil {
+				fields = append(fields, field)
+			}
+			continue
+		}
+		tableOID := parentOID(entry.OID)
+		table := tableByOID[tableOID]
+		if table == nil {
+			table = g.table(entry)
+			if table == nil {
+				continue
+			}
+			tableByOID[tableOID] = table
+			tables = append(tables, table)
+		}
+		if table.hasField(n.OID) {
+			continue
+		}
+		if field := g.field(n, "."+n.OID); field != nil {
+			table.Fields = append(table.Fields, field)
+		}
+	}
+
+	// Scalar tags such as sysName label every table row too
+	var tags []string
+	for _, field := range fields {
+		if field.IsTag {
+			tags = append(tags, field.Name)
+		}
+	}
+	for _, table := range tables {
+		table.InheritTags = tags
+	}
+	return fields, tables, nil
+}
+
+// table starts the table of a conceptual row. Readable INDEX objects shared
+// with the row become tag fields; otherwise the index suffix is the tag.
+func (g *categrafGenerator) table(entry *mibTreeNode) *categrafSNMPTable {
+	indexes, _ := g.tree.Indexes(entry)
+	if len(indexes) == 0 {
+		g.warnf("skipped the columns of %s: its INDEX cannot be resolved", entry.Name)
+		return nil
+	}
+	name := entry.Name
+	if tableNode := g.tree.byOID[parentOID(entry.OID)]; tableNode != nil {
+		name = tableNode.Name
+	}
+	table := &categrafSNMPTable{Name: metricName(name), OID: "." + parentOID(entry.OID)}
+
+	for _, index := range indexes {
+		if !index.IsAccessible() || !g.sameIndexes(index, indexes) {
+			table.IndexAsTag = true
+			table.Fields = nil
+			return table
+		}
+	}
+	for _, index := range indexes {
+		if field := g.field(index, "."+index.OID); field != nil {
+			field.IsTag = true
+			table.Fields = append(table.Fields, field)
+		}
+	}
+	return table
+}
+
+// sameIndexes reports whether the column index is indexed like indexes, so
+// that its rows line up with the table's
+func (g *categrafGenerator) sameIndexes(index *mibTreeNode, indexes []*mibTreeNode) bool {
+	entry := g.tree.Entry(index)
+	if entry == nil {
+		return false
+	}
+	own, _ := g.tree.Indexes(entry)
+	if len(own) != len(indexes) {
+		return false
+	}
+	for i := range own {
+		if own[i].OID != indexes[i].OID {
+			return false
+		}
+	}
+	return true
+}
+
+// field maps an object to a categraf field. Numbers are values; strings and
+// addresses are tags, as categraf only keeps numeric values.
+func (g *categrafGenerator) field(n *mibTreeNode, oid string) *categrafSNMPField {
+	field := &categrafSNMPField{Name: metricName(n.Name), OID: oid}
+	switch g.tree.BaseType(n) {
+	case "Counter", "Counter32", "Counter64", "Gauge", "Gauge32", "Unsigned32", "TimeTicks", "Integer32", "INTEGER":
+	case "IpAddress", "NetworkAddress":
+		field.IsTag = true
+		field.Conversion = "ipaddr"
+	case "OCTET STRING", "Opaque", "OBJECT IDENTIFIER":
+		field.IsTag = true
+		for _, typ := range g.tree.TypeChain(n) {
+			if typ.DisplayHint != "" {
+				if typ.DisplayHint == "1x:" {
+					field.Conversion = "hwaddr"
+				}
+				break
+			}
+		}
+	default:
+		g.warnf("skipped %s: unsupported syntax", n.Name)
+		return nil
+	}
+	return field
+}
+
+func (t *categrafSNMPTable) hasField(oid string) bool {
+	for _, field := range t.Fields {
+		if field.OID == "."+oid {
+			return true
+		}
+	}
+	return false
+}
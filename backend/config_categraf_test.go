@@ -0,0 +1,171 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestGenerateCategrafConfig(t *testing.T) {
+	openTestDB(t)
+	loadTestMIBTree(t)
+	for _, device := range []Device{
+		{Name: "sw1", IP: "10.0.0.1", SNMPVersion: "v2c", Community: "public", SNMPPort: 161, GroupName: "core"},
+		{Name: "sw2", IP: "10.0.0.2", SNMPVersion: "v2c", Community: "public", SNMPPort: 1161, GroupName: "core"},
+		{Name: "sw3", IP: "10.0.0.3", SNMPVersion: "v1", Community: "private", SNMPPort: 161},
+		{Name: "sw4", IP: "10.0.0.4", SNMPVersion: "v9", Community: "public", SNMPPort: 161},
+	} {
+		if err := db.Create(&device).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type wantTable struct {
+		oid        string
+		indexAsTag bool
+		fields     string // name:oid[:tag][:conversion], comma separated
+	}
+	tests := []struct {
+		name    string
+		targets []string
+		objects []interface{}
+		fields  string
+		tables  map[string]wantTable
+		inherit []string
+		err     string
+	}{
+		{
+			name:    "scalars",
+			objects: []interface{}{"sysUpTime", "SNMPv2-MIB::sysName"},
+			fields:  "sysUpTime:.1.3.6.1.2.1.1.3.0,sysName:.1.3.6.1.2.1.1.5.0:tag",
+		},
+		{
+			name:    "table with its index as a tag field",
+			objects: []interface{}{"ifDescr", "ifPhysAddress", "ifInOctets", "sysName"},
+			fields:  "sysName:.1.3.6.1.2.1.1.5.0:tag",
+			tables: map[string]wantTable{"ifTable": {oid: ".1.3.6.1.2.1.2.2",
+				fields: "ifIndex:.1.3.6.1.2.1.2.2.1.1:tag,ifDescr:.1.3.6.1.2.1.2.2.1.2:tag,ifPhysAddress:.1.3.6.1.2.1.2.2.1.6:tag:hwaddr,ifInOctets:.1.3.6.1.2.1.2.2.1.10"}},
+			inherit: []string{"sysName"},
+		},
+		{
+			name:    "augmenting table shares the index of its base table",
+			objects: []interface{}{"ifHCInOctets"},
+			tables: map[string]wantTable{"ifXTable": {oid: ".1.3.6.1.2.1.31.1.1",
+				fields: "ifIndex:.1.3.6.1.2.1.2.2.1.1:tag,ifHCInOctets:.1.3.6.1.2.1.31.1.1.1.6"}},
+		},
+		{
+			name:    "not-accessible index becomes the index tag",
+			objects: []interface{}{"1.3.6.1.2.1.4.34.1.3"},
+			tables: map[string]wantTable{"ipAddressTable": {oid: ".1.3.6.1.2.1.4.34", indexAsTag: true,
+				fields: "ipAddressIfIndex:.1.3.6.1.2.1.4.34.1.3"}},
+		},
+		{
+			name:    "IpAddress column",
+			objects: []interface{}{"ipAdEntNetMask"},
+			tables: map[string]wantTable{"ipAddrTable": {oid: ".1.3.6.1.2.1.4.20",
+				fields: "ipAdEntAddr:.1.3.6.1.2.1.4.20.1.1:tag:ipaddr,ipAdEntNetMask:.1.3.6.1.2.1.4.20.1.3:tag:ipaddr"}},
+		},
+		{name: "no objects", err: "options.objects must list the MIB objects"},
+		{name: "unknown object", objects: []interface{}{"noSuchObject"}, err: `unknown MIB object or module "noSuchObject"`},
+		{name: "object without readable objects", objects: []interface{}{"ifEntry", "snmpTraps"}, err: "snmpTraps has no readable objects"},
+		{name: "unknown device", targets: []string{"sw9"}, objects: []interface{}{"sysName"}, err: `device "sw9" not found`},
+		{name: "only unpollable devices", targets: []string{"sw4"}, objects: []interface{}{"sysName"}, err: "none of the devices can be polled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := map[string]interface{}{}
+			if tt.objects != nil {
+				options["objects"] = tt.objects
+			}
+			generated, err := generateCategrafConfig("categraf", tt.targets, options)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("generateCategrafConfig() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out categrafSNMPConfig
+			if err := toml.Unmarshal([]byte(generated.Content), &out); err != nil {
+				t.Fatal(err)
+			}
+			instance := out.Instances[0]
+			if got := categrafFieldList(instance.Fields); got != tt.fields {
+				t.Errorf("fields %s, want %s", got, tt.fields)
+			}
+			tables := make(map[string]wantTable)
+			for _, table := range instance.Tables {
+				tables[table.Name] = wantTable{table.OID, table.IndexAsTag, categrafFieldList(table.Fields)}
+				if !reflect.DeepEqual(table.InheritTags, tt.inherit) {
+					t.Errorf("table %s inherits %v, want %v", table.Name, table.InheritTags, tt.inherit)
+				}
+			}
+			if len(tables) != 0 || len(tt.tables) != 0 {
+				if !reflect.DeepEqual(tables, tt.tables) {
+					t.Errorf("tables %+v, want %+v", tables, tt.tables)
+				}
+			}
+		})
+	}
+
+	// Devices with the same credentials and group share an instance
+	generated, err := generateCategrafConfig("categraf", nil, map[string]interface{}{
+		"objects": []interface{}{"sysUpTime"}, "interval": 60, "timeout": "5s", "retries": 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out categrafSNMPConfig
+	if err := toml.Unmarshal([]byte(generated.Content), &out); err != nil {
+		t.Fatal(err)
+	}
+	var instances []string
+	for _, instance := range out.Instances {
+		instances = append(instances, strings.Join([]string{
+			strings.Join(instance.Agents, " "), instance.Community, instance.Labels["group"],
+			instance.AgentHostTag, instance.Timeout, strings.Repeat("r", instance.Retries),
+		}, "|"))
+		if instance.Version == 1 && instance.Community != "private" {
+			t.Errorf("v1 instance %+v", instance)
+		}
+	}
+	want := []string{
+		"udp://10.0.0.1:161 udp://10.0.0.2:1161|public|core|ident|5s|rr",
+		"udp://10.0.0.3:161|private||ident|5s|rr",
+	}
+	if out.Interval != 60 || !reflect.DeepEqual(instances, want) {
+		t.Fatalf("interval %d, instances %q; want 60, %q", out.Interval, instances, want)
+	}
+	if len(generated.Warnings) != 1 || !strings.Contains(generated.Warnings[0], "skipped device sw4") {
+		t.Fatalf("warnings = %q, want sw4 skipped", generated.Warnings)
+	}
+
+	for _, options := range []map[string]interface{}{
+		{"objects": []interface{}{"sysName"}, "retries": -1},
+		{"objects": []interface{}{"sysName"}, "timeout": "soon"},
+	} {
+		if _, err := generateCategrafConfig("categraf", nil, options); err == nil {
+			t.Errorf("generateCategrafConfig(%v) accepted invalid options", options)
+		}
+	}
+}
+
+// categrafFieldList renders fields as name:oid[:tag][:conversion]
+func categrafFieldList(fields []*categrafSNMPField) string {
+	var list []string
+	for _, field := range fields {
+		s := field.Name + ":" + field.OID
+		if field.IsTag {
+			s += ":tag"
+		}
+		if field.Conversion != "" {
+			s += ":" + field.Conversion
+		}
+		list = append(list, s)
+	}
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configGenerators are the config types generateConfig can build
+var configGenerators = map[string]func(name string, targets []string, options map[string]interface{}) (*generatedConfig, error){
+	"snmp_exporter": generateSNMPExporterConfig,
+	"categraf":      generateCategrafConfig,
+	"prometheus":    generatePrometheusConfig,
+	"vmagent":       generateVMAgentConfig,
+	"vmalert":       generateAlertRules,
+	"alertmanager":  generateAlertmanagerConfig,
+	"grafana":       generateGrafanaConfig,
+}
+
+// configTypes returns the config types of configGenerators in order
+func configTypes() []string {
+	types := make([]string, 0, len(configGenerators))
+	for configType := range configGenerators {
+		types = append(types, configType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// generatedConfig is the output of a config generator
+type generatedConfig struct {
+	Content     string
+	Description string
+	// Files, when set, replace Content: each is saved as its own config
+	// named after the request name and the file key
+	Files map[string]string
+	// Extra is returned next to the saved config, e.g. the generator input
+	Extra    map[string]interface{}
+	Warnings []string
+}
+
+var metricNameRe = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// decodeConfigOptions converts the free-form request options into v
+func decodeConfigOptions(options map[string]interface{}, v interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid options: %v", err)
+	}
+	return nil
+}
+
+// marshalConfigYAML renders v as YAML indented by two spaces
+func marshalConfigYAML(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	encoder.Close()
+	return buf.String(), nil
+}
+
+// metricName makes a MIB name usable as a metric or label name
+func metricName(name string) string {
+	name = metricNameRe.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// saveGeneratedConfig stores content as a draft Config, replacing the
+// content of an existing config with the same name and type
+func saveGeneratedConfig(name, configType, content, description string) (*Config, error) {
+	var config Config
+	err := db.Where("name = ? AND type = ?", name, configType).First(&config).Error
+	if err == nil {
+		config.Content = content
+		config.Description = description
+		config.Status = "draft"
+		config.UpdatedAt = time.Now()
+		if err := db.Save(&config).Error; err != nil {
+			return nil, err
+		}
+		return &config, nil
+	}
+
+	config = Config{
+		Name:        name,
+		Type:        configType,
+		Content:     content,
+		Description: description,
+		Status:      "draft",
+		CreatedBy:   "generator",
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if err := db.Create(&config).Error; err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// grafanaDatasources is provisioning/datasources/*.yml
+type grafanaDatasources struct {
+	APIVersion  int                  `yaml:"apiVersion"`
+	Datasources []*grafanaDatasource `yaml:"datasources"`
+}
+
+type grafanaDatasource struct {
+	Name      string            `yaml:"name"`
+	UID       string            `yaml:"uid"`
+	Type      string            `yaml:"type"`
+	Access    string            `yaml:"access"`
+	URL       string            `yaml:"url"`
+	IsDefault bool              `yaml:"isDefault"`
+	JSONData  map[string]string `yaml:"jsonData,omitempty"`
+}
+
+// grafanaDashboardProviders is provisioning/dashboards/*.yml
+type grafanaDashboardProviders struct {
+	APIVersion int                         `yaml:"apiVersion"`
+	Providers  []*grafanaDashboardProvider `yaml:"providers"`
+}
+
+type grafanaDashboardProvider struct {
+	Name                  string            `yaml:"name"`
+	Folder                string            `yaml:"folder"`
+	Type                  string            `yaml:"type"`
+	DisableDeletion       bool              `yaml:"disableDeletion"`
+	UpdateIntervalSeconds int               `yaml:"updateIntervalSeconds"`
+	AllowUIUpdates        bool              `yaml:"allowUiUpdates"`
+	Options               map[string]string `yaml:"options"`
+}
+
+type grafanaDashboard struct {
+	UID           string            `json:"uid"`
+	Title         string            `json:"title"`
+	Tags          []string          `json:"tags"`
+	Timezone      string            `json:"timezone"`
+	SchemaVersion int               `json:"schemaVersion"`
+	Version       int               `json:"version"`
+	Refresh       string            `json:"refresh"`
+	Time          map[string]string `json:"time"`
+	Templating    struct {
+		List []map[string]interface{} `json:"list"`
+	} `json:"templating"`
+	Panels []*grafanaPanel `json:"panels"`
+}
+
+type grafanaPanel struct {
+	ID          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	GridPos     map[string]int         `json:"gridPos"`
+	Datasource  map[string]string      `json:"datasource"`
+	Targets     []grafanaTarget        `json:"targets"`
+	FieldConfig map[string]interface{} `json:"fieldConfig"`
+}
+
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+// grafanaPanelPreset is a curated panel. $sel in the queries is replaced by
+// the dashboard's device selector; Objects must all be in the MIB store.
+type grafanaPanelPreset struct {
+	Title   string
+	Type    string
+	Unit    string
+	Objects []string
+	Queries []grafanaTarget
+}
+
+var grafanaPanelPresets = map[string]grafanaPanelPreset{
+	"uptime": {
+		Title: "Uptime", Type: "stat", Unit: "s", Objects: []string{"sysUpTime"},
+		Queries: []grafanaTarget{{Expr: `sysUpTime{$sel} / 100`, LegendFormat: "{{instance}}"}},
+	},
+	"interface_traffic": {
+		Title: "Interface traffic", Type: "timeseries", Unit: "bps", Objects: []string{"ifHCInOctets", "ifHCOutOctets"},
+		Queries: []grafanaTarget{
+			{Expr: `rate(ifHCInOctets{$sel}[$__rate_interval]) * 8`, LegendFormat: "{{instance}} {{ifIndex}} in"},
+			{Expr: `-rate(ifHCOutOctets{$sel}[$__rate_interval]) * 8`, LegendFormat: "{{instance}} {{ifIndex}} out"},
+		},
+	},
+	"interface_errors": {
+		Title: "Interface errors", Type: "timeseries", Unit: "pps", Objects: []string{"ifInErrors", "ifOutErrors"},
+		Queries: []grafanaTarget{
+			{Expr: `rate(ifInErrors{$sel}[$__rate_interval])`, LegendFormat: "{{instance}} {{ifIndex}} in"},
+			{Expr: `rate(ifOutErrors{$sel}[$__rate_interval])`, LegendFormat: "{{instance}} {{ifIndex}} out"},
+		},
+	},
+	"interface_status": {
+		Title: "Interface status", Type: "state-timeline", Objects: []string{"ifOperStatus"},
+		Queries: []grafanaTarget{{Expr: `ifOperStatus{$sel}`, LegendFormat: "{{instance}} {{ifIndex}}"}},
+	},
+	"cpu": {
+		Title: "CPU load", Type: "timeseries", Unit: "percent", Objects: []string{"hrProcessorLoad"},
+		Queries: []grafanaTarget{{Expr: `avg by (instance) (hrProcessorLoad{$sel})`, LegendFormat: "{{instance}}"}},
+	},
+	"memory": {
+		Title: "Storage and memory used", Type: "timeseries", Unit: "percent", Objects: []string{"hrStorageUsed", "hrStorageSize"},
+		Queries: []grafanaTarget{{Expr: `100 * hrStorageUsed{$sel} / (hrStorageSize{$sel} > 0)`, LegendFormat: "{{instance}} {{hrStorageIndex}}"}},
+	},
+}
+
+// grafanaDefaultPanels are the panels of a device type dashboard when the
+// request does not list them; "" is the fallback for network gear
+var grafanaDefaultPanels = map[string][]string{
+	"server": {"uptime", "cpu", "memory", "interface_traffic", "interface_errors"},
+	"":       {"uptime", "interface_traffic", "interface_errors", "interface_status"},
+}
+
+// grafanaOptions are the request options of the grafana generator. Panels
+// maps a device type to preset names or MIB objects to chart.
+type grafanaOptions struct {
+	DatasourceURL  string              `json:"datasource_url"`
+	DashboardsPath string              `json:"dashboards_path"`
+	Folder         string              `json:"folder"`
+	DeviceTypes    []string            `json:"device_types"`
+	Panels         map[string][]string `json:"panels"`
+}
+
+// generateGrafanaConfig produces datasource and dashboard provisioning plus
+// one dashboard per device type, each saved as its own config
+func generateGrafanaConfig(name string, targets []string, options map[string]interface{}) (*generatedConfig, error) {
+	opts := grafanaOptions{
+		DashboardsPath: "/var/lib/grafana/dashboards/snmp-monitor",
+		Folder:         "SNMP Monitor",
+	}
+	if err := decodeConfigOptions(options, &opts); err != nil {
+		return nil, err
+	}
+
+	datasources, err := grafanaDatasourceList(opts.DatasourceURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.DeviceTypes) == 0 {
+		if err := db.Model(&Device{}).Distinct().Where("type <> ''").Order("type").Pluck("type", &opts.DeviceTypes).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.DeviceTypes) == 0 {
+		return nil, fmt.Errorf("no device types: add devices or set options.device_types")
+	}
+
+	tree, err := loadMIBTree()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	content, err := marshalConfigYAML(datasources)
+	if err != nil {
+		return nil, err
+	}
+	files["datasources"] = content
+	content, err = marshalConfigYAML(grafanaDashboardProviders{
+		APIVersion: 1,
+		Providers: []*grafanaDashboardProvider{{
+			Name:                  "snmp-monitor",
+			Folder:                opts.Folder,
+			Type:                  "file",
+			UpdateIntervalSeconds: 30,
+			AllowUIUpdates:        true,
+			Options:               map[string]string{"path": opts.DashboardsPath},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	files["dashboards"] = content
+
+	var warnings []string
+	for _, deviceType := range opts.DeviceTypes {
+		panels := opts.Panels[deviceType]
+		if len(panels) == 0 {
+			panels = grafanaDefaultPanels[deviceType]
+		}
+		if len(panels) == 0 {
+			panels = grafanaDefaultPanels[""]
+		}
+		dashboard, skipped, err := grafanaDeviceDashboard(tree, deviceType, panels)
+		if err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, skipped...)
+		data, err := json.MarshalIndent(dashboard, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		files["dashboard-"+metricName(deviceType)] = string(data)
+	}
+
+	return &generatedConfig{
+		Files:       files,
+		Description: fmt.Sprintf("grafana provisioning with %d datasources and %d device type dashboards", len(datasources.Datasources), len(opts.DeviceTypes)),
+		Warnings:    warnings,
+	}, nil
+}
+
+// grafanaDatasourceList points at url, or at every host running vmselect or
+// single-node VictoriaMetrics; the first one is the default
+func grafanaDatasourceList(url string) (*grafanaDatasources, error) {
+	list := &grafanaDatasources{APIVersion: 1}
+	add := func(name, url string) {
+		list.Datasources = append(list.Datasources, &grafanaDatasource{
+			Name:      name,
+			UID:       metricName(strings.ToLower(name)),
+			Type:      "prometheus",
+			Access:    "proxy",
+			URL:       url,
+			IsDefault: len(list.Datasources) == 0,
+			JSONData:  map[string]string{"httpMethod": "POST"},
+		})
+	}
+	if url != "" {
+		if err := validateAlertURL(url); err != nil {
+			return nil, err
+		}
+		add("VictoriaMetrics", url)
+		return list, nil
+	}
+
+	var hosts []Host
+	if err := db.Order("id").Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		if hostHasComponent(host, "vmselect") {
+			add("vmselect "+host.Name, fmt.Sprintf("http://%s:8481/select/0/prometheus", host.IP))
+		}
+		if hostHasComponent(host, "victoriametrics") {
+			add("VictoriaMetrics "+host.Name, fmt.Sprintf("http://%s:8428", host.IP))
+		}
+	}
+	if len(list.Datasources) == 0 {
+		return nil, fmt.Errorf("no host runs vmselect or victoriametrics: set options.datasource_url")
+	}
+	return list, nil
+}
+
+// grafanaDeviceDashboard lays out the panels of a device type dashboard,
+// two per row. Names that are not presets are charted as MIB objects.
+func grafanaDeviceDashboard(tree *mibTree, deviceType string, panels []string) (*grafanaDashboard, []string, error) {
+	title := deviceType
+	if title != "" {
+		title = strings.ToUpper(title[:1]) + title[1:]
+	}
+	dashboard := &grafanaDashboard{
+		UID:           "snmp-" + metricName(deviceType),
+		Title:         "SNMP / " + title,
+		Tags:          []string{"snmp", deviceType},
+		Timezone:      "browser",
+		SchemaVersion: 39,
+		Version:       1,
+		Refresh:       "1m",
+		Time:          map[string]string{"from": "now-6h", "to": "now"},
+	}
+	dashboard.Templating.List = []map[string]interface{}{
+		{"name": "datasource", "type": "datasource", "query": "prometheus", "label": "Datasource"},
+		{
+			"name": "instance", "type": "query", "label": "Device",
+			"datasource": map[string]string{"type": "prometheus", "uid": "${datasource}"},
+			"query":      fmt.Sprintf(`label_values(up{device_type=%q}, instance)`, deviceType),
+			"multi":      true, "includeAll": true, "refresh": 2,
+		},
+	}
+	selector := fmt.Sprintf(`device_type=%q,instance=~"$instance"`, deviceType)
+
+	var skipped []string
+	for _, key := range panels {
+		var panel *grafanaPanel
+		if preset, ok := grafanaPanelPresets[key]; ok {
+			missing := ""
+			for _, object := range preset.Objects {
+				if n := tree.Lookup(object); n == nil || !n.IsAccessible() {
+					missing = object
+					break
+				}
+			}
+			if missing != "" {
+				skipped = append(skipped, fmt.Sprintf("%s: skipped panel %s, %s is not in the MIB store", deviceType, key, missing))
+				continue
+			}
+			panel = &grafanaPanel{Type: preset.Type, Title: preset.Title}
+			for _, query := range preset.Queries {
+				query.Expr = strings.ReplaceAll(query.Expr, "$sel", selector)
+				panel.Targets = append(panel.Targets, query)
+			}
+			panel.FieldConfig = grafanaFieldConfig(preset.Unit, nil)
+			if len(preset.Objects) == 1 {
+				if n := tree.Lookup(preset.Objects[0]); n != nil {
+					panel.FieldConfig = grafanaFieldConfig(preset.Unit, tree.EffectiveSyntax(n).Enums)
+				}
+			}
+		} else {
+			n := tree.Lookup(key)
+			if n == nil || !n.IsAccessible() {
+				return nil, nil, fmt.Errorf("%s: %q is neither a panel preset nor a readable MIB object", deviceType, key)
+			}
+			panel = grafanaObjectPanel(tree, n, selector)
+		}
+		index := len(dashboard.Panels)
+		panel.ID = index + 1
+		panel.GridPos = map[string]int{"h": 8, "w": 12, "x": (index % 2) * 12, "y": (index / 2) * 8}
+		panel.Datasource = map[string]string{"type": "prometheus", "uid": "${datasource}"}
+		for i := range panel.Targets {
+			panel.Targets[i].RefID = string(rune('A' + i))
+		}
+		dashboard.Panels = append(dashboard.Panels, panel)
+	}
+	return dashboard, skipped, nil
+}
+
+// grafanaObjectPanel charts a single MIB object as exported by
+// snmp_exporter: counters as rates, enumerations as states
+func grafanaObjectPanel(tree *mibTree, n *mibTreeNode, selector string) *grafanaPanel {
+	name := metricName(n.Name)
+	legend := "{{instance}}"
+	if entry := tree.Entry(n); entry != nil {
+		indexes, _ := tree.Indexes(entry)
+		for _, index := range indexes {
+			legend += " {{" + metricName(index.Name) + "}}"
+		}
+	}
+	description := strings.Join(strings.Fields(n.Description), " ")
+	description = strings.TrimSuffix(strings.SplitN(description, ". ", 2)[0], ".")
+	panel := &grafanaPanel{Type: "timeseries", Title: n.Name, Description: description}
+
+	expr := fmt.Sprintf("%s{%s}", name, selector)
+	unit := ""
+	enums := tree.EffectiveSyntax(n).Enums
+	switch tree.BaseType(n) {
+	case "Counter", "Counter32", "Counter64":
+		expr = fmt.Sprintf("rate(%s[$__rate_interval])", expr)
+		if strings.Contains(strings.ToLower(n.Name), "octets") {
+			expr += " * 8"
+			unit = "bps"
+		}
+		enums = nil
+	case "TimeTicks":
+		expr += " / 100"
+		unit = "s"
+	}
+	if len(enums) > 0 {
+		panel.Type = "state-timeline"
+	}
+	panel.Targets = []grafanaTarget{{Expr: expr, LegendFormat: legend}}
+	panel.FieldConfig = grafanaFieldConfig(unit, enums)
+	return panel
+}
+
+// grafanaFieldConfig sets the unit and maps enumeration values to labels
+func grafanaFieldConfig(unit string, enums []MIBEnum) map[string]interface{} {
+	defaults := map[string]interface{}{}
+	if unit != "" {
+		defaults["unit"] = unit
+	}
+	if len(enums) > 0 {
+		values := make(map[string]interface{}, len(enums))
+		sorted := append([]MIBEnum(nil), enums...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Value < sorted[j].Value })
+		for i, enum := range sorted {
+			values[strconv.FormatInt(enum.Value, 10)] = map[string]interface{}{"text": enum.Label, "index": i}
+		}
+		defaults["mappings"] = []map[string]interface{}{{"type": "value", "options": values}}
+	}
+	return map[string]interface{}{"defaults": defaults, "overrides": []interface{}{}}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGrafanaDeviceDashboard(t *testing.T) {
+	openTestDB(t)
+	tree := loadTestMIBTree(t)
+	grafanaPanelPresets["vendor_temperature"] = grafanaPanelPreset{
+		Title: "Temperature", Type: "timeseries", Unit: "celsius", Objects: []string{"vendorTemperature"},
+		Queries: []grafanaTarget{{Expr: `vendorTemperature{$sel}`}},
+	}
+	t.Cleanup(func() { delete(grafanaPanelPresets, "vendor_temperature") })
+
+	type wantPanel struct {
+		typ    string
+		title  string
+		exprs  string // target expressions, separated by " ; "
+		legend string // legend of the first target
+		unit   string
+		enum1  string // text mapped to value 1
+	}
+	selector := `device_type="switch",instance=~"$instance"`
+	tests := []struct {
+		name    string
+		panels  []string
+		want    []wantPanel
+		skipped []string
+		err     string
+	}{
+		{
+			name:   "presets",
+			panels: []string{"uptime", "interface_traffic", "interface_status"},
+			want: []wantPanel{
+				{typ: "stat", title: "Uptime", exprs: "sysUpTime{" + selector + "} / 100", legend: "{{instance}}", unit: "s"},
+				{typ: "timeseries", title: "Interface traffic",
+					exprs:  "rate(ifHCInOctets{" + selector + "}[$__rate_interval]) * 8 ; -rate(ifHCOutOctets{" + selector + "}[$__rate_interval]) * 8",
+					legend: "{{instance}} {{ifIndex}} in", unit: "bps"},
+				{typ: "state-timeline", title: "Interface status", exprs: "ifOperStatus{" + selector + "}", legend: "{{instance}} {{ifIndex}}", enum1: "up"},
+			},
+		},
+		{
+			name:   "MIB objects",
+			panels: []string{"ifInOctets", "ifInDiscards", "ifAdminStatus", "sysUpTime", "hrStorageUsed"},
+			want: []wantPanel{
+				{typ: "timeseries", title: "ifInOctets", exprs: "rate(ifInOctets{" + selector + "}[$__rate_interval]) * 8", legend: "{{instance}} {{ifIndex}}", unit: "bps"},
+				{typ: "timeseries", title: "ifInDiscards", exprs: "rate(ifInDiscards{" + selector + "}[$__rate_interval])", legend: "{{instance}} {{ifIndex}}"},
+				{typ: "state-timeline", title: "ifAdminStatus", exprs: "ifAdminStatus{" + selector + "}", legend: "{{instance}} {{ifIndex}}", enum1: "up"},
+				{typ: "timeseries", title: "sysUpTime", exprs: "sysUpTime{" + selector + "} / 100", legend: "{{instance}}", unit: "s"},
+				{typ: "timeseries", title: "hrStorageUsed", exprs: "hrStorageUsed{" + selector + "}", legend: "{{instance}} {{hrStorageIndex}}"},
+			},
+		},
+		{
+			name:   "preset of an object missing from the MIB store",
+			panels: []string{"vendor_temperature", "uptime"},
+			want: []wantPanel{
+				{typ: "stat", title: "Uptime", exprs: "sysUpTime{" + selector + "} / 100", legend: "{{instance}}", unit: "s"},
+			},
+			skipped: []string{"switch: skipped panel vendor_temperature, vendorTemperature is not in the MIB store"},
+		},
+		{name: "unknown panel", panels: []string{"uptime", "latency"}, err: `"latency" is neither a panel preset nor a readable MIB object`},
+		{name: "object that cannot be read", panels: []string{"ifEntry"}, err: `"ifEntry" is neither a panel preset nor a readable MIB object`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dashboard, skipped, err := grafanaDeviceDashboard(tree, "switch", tt.panels)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("grafanaDeviceDashboard() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(skipped, tt.skipped) {
+				t.Errorf("skipped %q, want %q", skipped, tt.skipped)
+			}
+			if dashboard.UID != "snmp-switch" || dashboard.Title != "SNMP / Switch" {
+				t.Errorf("dashboard %s %q", dashboard.UID, dashboard.Title)
+			}
+			var got []wantPanel
+			for i, panel := range dashboard.Panels {
+				var exprs []string
+				for j, target := range panel.Targets {
+					exprs = append(exprs, target.Expr)
+					if target.RefID != string(rune('A'+j)) {
+						t.Errorf("panel %s target %d has refId %s", panel.Title, j, target.RefID)
+					}
+				}
+				defaults := panel.FieldConfig["defaults"].(map[string]interface{})
+				unit, _ := defaults["unit"].(string)
+				enum1 := ""
+				if mappings, ok := defaults["mappings"].([]map[string]interface{}); ok {
+					options := mappings[0]["options"].(map[string]interface{})
+					enum1 = options["1"].(map[string]interface{})["text"].(string)
+				}
+				got = append(got, wantPanel{panel.Type, panel.Title, strings.Join(exprs, " ; "), panel.Targets[0].LegendFormat, unit, enum1})
+
+				// Two panels per row, numbered from 1
+				wantPos := map[string]int{"h": 8, "w": 12, "x": (i % 2) * 12, "y": (i / 2) * 8}
+				if panel.ID != i+1 || !reflect.DeepEqual(panel.GridPos, wantPos) {
+					t.Errorf("panel %s: id %d at %v, want %d at %v", panel.Title, panel.ID, panel.GridPos, i+1, wantPos)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("panels\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateGrafanaConfig(t *testing.T) {
+	openTestDB(t)
+	loadTestMIBTree(t)
+
+	if _, err := generateGrafanaConfig("grafana", nil, map[string]interface{}{"datasource_url": "http://vm:8428"}); err == nil ||
+		!strings.Contains(err.Error(), "no device types") {
+		t.Fatalf("generateGrafanaConfig() without devices = %v", err)
+	}
+	if _, err := generateGrafanaConfig("grafana", nil, map[string]interface{}{"device_types": []interface{}{"switch"}}); err == nil ||
+		!strings.Contains(err.Error(), "set options.datasource_url") {
+		t.Fatalf("generateGrafanaConfig() without datasources = %v", err)
+	}
+
+	for _, device := range []Device{
+		{Name: "srv1", IP: "10.0.0.1", Type: "server"},
+		{Name: "sw1", IP: "10.0.0.2", Type: "switch"},
+		{Name: "sw2", IP: "10.0.0.3", Type: "switch"},
+	} {
+		if err := db.Create(&device).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	generated, err := generateGrafanaConfig("grafana", nil, map[string]interface{}{
+		"datasource_url": "http://vm:8428",
+		"panels":         map[string]interface{}{"switch": []interface{}{"uptime", "ifInErrors"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for file := range generated.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	if want := []string{"dashboard-server", "dashboard-switch", "dashboards", "datasources"}; !reflect.DeepEqual(files, want) {
+		t.Fatalf("files %v, want %v", files, want)
+	}
+	if len(generated.Warnings) != 0 {
+		t.Errorf("warnings %q", generated.Warnings)
+	}
+
+	panels := map[string][]string{}
+	for _, deviceType := range []string{"server", "switch"} {
+		var dashboard grafanaDashboard
+		if err := json.Unmarshal([]byte(generated.Files["dashboard-"+deviceType]), &dashboard); err != nil {
+			t.Fatal(err)
+		}
+		for _, panel := range dashboard.Panels {
+			panels[deviceType] = append(panels[deviceType], panel.Title)
+		}
+	}
+	want := map[string][]string{
+		"server": {"Uptime", "CPU load", "Storage and memory used", "Interface traffic", "Interface errors"},
+		"switch": {"Uptime", "ifInErrors"},
+	}
+	if !reflect.DeepEqual(panels, want) {
+		t.Fatalf("panels %v, want %v", panels, want)
+	}
+	if !strings.Contains(generated.Files["datasources"], "url: http://vm:8428") {
+		t.Errorf("datasources:\n%s", generated.Files["datasources"])
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// promRuleFile is a Prometheus rule file as loaded by vmalert -rule
+type promRuleFile struct {
+	Groups []*promRuleGroup `yaml:"groups"`
+}
+
+type promRuleGroup struct {
+	Name     string      `yaml:"name"`
+	Interval string      `yaml:"interval,omitempty"`
+	Rules    []*promRule `yaml:"rules"`
+}
+
+type promRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// alertRuleTemplate is a built-in rule added to every device group. $group
+// in Expr is replaced by the group label matcher.
+type alertRuleTemplate struct {
+	Alert    string
+	Expr     string
+	For      string
+	Severity string
+	Summary  string
+}
+
+// alertRuleTemplates are the rules options.templates can pick from
+var alertRuleTemplates = map[string]alertRuleTemplate{
+	"device_down": {
+		Alert: "DeviceDown", Expr: `up{job=~"snmp.*",$group} == 0`, For: "2m", Severity: "critical",
+		Summary: "SNMP device {{ $labels.instance }} is not responding",
+	},
+	"interface_down": {
+		Alert: "InterfaceDown", Expr: `ifOperStatus{$group} == 2 and on(instance, ifIndex) ifAdminStatus{$group} == 1`, For: "5m", Severity: "warning",
+		Summary: "Interface {{ $labels.ifIndex }} on {{ $labels.instance }} is down",
+	},
+	"interface_errors": {
+		Alert: "InterfaceErrors", Expr: `rate(ifInErrors{$group}[5m]) + rate(ifOutErrors{$group}[5m]) > 1`, For: "10m", Severity: "warning",
+		Summary: "Interface {{ $labels.ifIndex }} on {{ $labels.instance }} has errors",
+	},
+	"interface_saturation": {
+		Alert: "InterfaceSaturation", Expr: `rate(ifHCInOctets{$group}[5m]) * 8 > on(instance, ifIndex) ifHighSpeed{$group} * 1e6 * 0.9 and on(instance, ifIndex) ifHighSpeed{$group} > 0`, For: "15m", Severity: "warning",
+		Summary: "Interface {{ $labels.ifIndex }} on {{ $labels.instance }} is above 90% inbound",
+	},
+	"snmp_scrape_slow": {
+		Alert: "SNMPScrapeSlow", Expr: `snmp_scrape_duration_seconds{$group} > 20`, For: "15m", Severity: "info",
+		Summary: "Walking {{ $labels.instance }} takes {{ $value }}s",
+	},
+	"node_down": {
+		Alert: "HostDown", Expr: `up{job="node",$group} == 0`, For: "2m", Severity: "critical",
+		Summary: "Host {{ $labels.instance }} is down",
+	},
+}
+
+// alertRuleOptions are the request options of the vmalert generator
+type alertRuleOptions struct {
+	Split     string   `json:"split"` // single (one config) or group (one config per device group)
+	For       string   `json:"for"`
+	Interval  string   `json:"interval"`
+	Templates []string `json:"templates"`
+	Alerts    []uint   `json:"alerts"` // alert IDs, all definitions when empty
+}
+
+var (
+	promThresholdRe = regexp.MustCompile(`^(==|!=|>=|<=|>|<)?\s*(-?[0-9.eE+-]+)$`)
+	promSelectorRe  = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{(.*)\})?$`)
+	promLabelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// generateAlertRules builds vmalert rules from the Alert rows that carry a
+// Metric, plus the chosen templates. Rules are grouped by the GroupName of
+// the alert's device; alerts without a device go to "default".
+func generateAlertRules(name string, targets []string, options map[string]interface{}) (*generatedConfig, error) {
+	opts := alertRuleOptions{Split: "single", For: "5m"}
+	if err := decodeConfigOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Split != "single" && opts.Split != "group" {
+		return nil, fmt.Errorf("split must be single or group")
+	}
+	for _, interval := range []string{opts.For, opts.Interval} {
+		if interval == "" {
+			continue
+		}
+		if _, err := parsePromDuration(interval); err != nil {
+			return nil, err
+		}
+	}
+	for _, template := range opts.Templates {
+		if _, ok := alertRuleTemplates[template]; !ok {
+			return nil, fmt.Errorf("unknown rule template %q", template)
+		}
+	}
+
+	var alerts []Alert
+	query := db.Preload("Device").Where("metric <> '' AND status <> ?", "silenced")
+	if len(opts.Alerts) > 0 {
+		query = query.Where("id IN ?", opts.Alerts)
+	}
+	if err := query.Order("id").Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	var groupNames []string
+	if err := db.Model(&Device{}).Distinct().Where("group_name <> ''").Pluck("group_name", &groupNames).Error; err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	groups := make(map[string]*promRuleGroup)
+	group := func(deviceGroup string) *promRuleGroup {
+		key := deviceGroup
+		if key == "" {
+			key = "default"
+		}
+		if groups[key] == nil {
+			groups[key] = &promRuleGroup{Name: name + "-" + key, Interval: opts.Interval, Rules: []*promRule{}}
+		}
+		return groups[key]
+	}
+	for _, alert := range alerts {
+		rule, err := alertRule(alert, opts.For)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("skipped alert %d (%s): %v", alert.ID, alert.Name, err))
+			continue
+		}
+		g := group("")
+		if alert.DeviceID != nil {
+			g = group(alert.Device.GroupName)
+		}
+		g.Rules = append(g.Rules, rule)
+	}
+
+	// Templates are instantiated per device group, plus once for the
+	// devices without a group
+	if len(opts.Templates) > 0 {
+		templateGroups := append([]string{""}, groupNames...)
+		sort.Strings(opts.Templates)
+		for _, deviceGroup := range templateGroups {
+			for _, key := range opts.Templates {
+				template := alertRuleTemplates[key]
+				labels := map[string]string{"severity": template.Severity}
+				if deviceGroup != "" {
+					labels["group"] = deviceGroup
+				}
+				group(deviceGroup).Rules = append(group(deviceGroup).Rules, &promRule{
+					Alert:       template.Alert,
+					Expr:        strings.ReplaceAll(template.Expr, "$group", fmt.Sprintf("group=%q", deviceGroup)),
+					For:         template.For,
+					Labels:      labels,
+					Annotations: map[string]string{"summary": template.Summary},
+				})
+			}
+		}
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no alert definitions with a metric and no templates selected")
+	}
+
+	keys := make([]string, 0, len(groups))
+	rules := 0
+	for key, g := range groups {
+		for _, rule := range g.Rules {
+			if err := rule.Validate(); err != nil {
+				return nil, fmt.Errorf("rule %s in group %s: %v", rule.Alert, g.Name, err)
+			}
+		}
+		keys = append(keys, key)
+		rules += len(g.Rules)
+	}
+	sort.Strings(keys)
+
+	generated := &generatedConfig{
+		Description: fmt.Sprintf("vmalert rules: %d rules in %d groups", rules, len(groups)),
+		Warnings:    warnings,
+	}
+	if opts.Split == "group" {
+		generated.Files = make(map[string]string, len(keys))
+		for _, key := range keys {
+			content, err := marshalConfigYAML(promRuleFile{Groups: []*promRuleGroup{groups[key]}})
+			if err != nil {
+				return nil, err
+			}
+			generated.Files[key] = content
+		}
+		return generated, nil
+	}
+	file := promRuleFile{}
+	for _, key := range keys {
+		file.Groups = append(file.Groups, groups[key])
+	}
+	content, err := marshalConfigYAML(file)
+	if err != nil {
+		return nil, err
+	}
+	generated.Content = content
+	return generated, nil
+}
+
+// alertRule turns an alert definition into a rule. A Metric containing a
+// comparison is used as the whole expression; otherwise Threshold (e.g.
+// "90", "> 90", "== 0") is applied to it. Alerts bound to a device only
+// match that device's instance, so their comparisons must be a selector
+// against a number.
+func alertRule(alert Alert, defaultFor string) (*promRule, error) {
+	expr := strings.TrimSpace(alert.Metric)
+	thresholded := false
+	if i := promComparisonIndex(expr); i >= 0 {
+		if alert.DeviceID != nil {
+			// Any other operand could bring in the series of other devices
+			m := promThresholdRe.FindStringSubmatch(strings.TrimSpace(expr[i:]))
+			if m == nil {
+				return nil, fmt.Errorf("metric %q does not compare a selector with a number and cannot be limited to a device", alert.Metric)
+			}
+			selector, err := deviceSelector(strings.TrimSpace(expr[:i]), alert)
+			if err != nil {
+				return nil, err
+			}
+			expr = fmt.Sprintf("%s %s %s", selector, m[1], m[2])
+		}
+	} else {
+		m := promThresholdRe.FindStringSubmatch(strings.TrimSpace(alert.Threshold))
+		if m == nil {
+			return nil, fmt.Errorf("invalid threshold %q", alert.Threshold)
+		}
+		op := m[1]
+		if op == "" {
+			op = ">"
+		}
+		if alert.DeviceID != nil {
+			var err error
+			if expr, err = deviceSelector(expr, alert); err != nil {
+				return nil, err
+			}
+		}
+		expr = fmt.Sprintf("%s %s %s", expr, op, m[2])
+		thresholded = true
+	}
+
+	severity := alert.Severity
+	if severity == "" {
+		severity = "warning"
+	}
+	labels := map[string]string{"severity": severity, "alert_id": fmt.Sprint(alert.ID)}
+	if alert.DeviceID != nil {
+		labels["device"] = alert.Device.Name
+		if alert.Device.GroupName != "" {
+			labels["group"] = alert.Device.GroupName
+		}
+		if alert.Device.Vendor != "" {
+			labels["vendor"] = alert.Device.Vendor
+		}
+	}
+	description := alert.Description
+	if description == "" {
+		description = fmt.Sprintf("%s is {{ $value }}", alert.Metric)
+		if threshold := strings.TrimSpace(alert.Threshold); threshold != "" && thresholded {
+			description += fmt.Sprintf(" (threshold %s)", threshold)
+		}
+	}
+	return &promRule{
+		Alert:  alert.Name,
+		Expr:   expr,
+		For:    defaultFor,
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("%s on {{ $labels.instance }}", alert.Name),
+			"description": description,
+		},
+	}, nil
+}
+
+// deviceSelector adds the instance matcher of the alert's device to a plain
+// selector such as ifOperStatus{ifIndex="1"}
+func deviceSelector(selector string, alert Alert) (string, error) {
+	m := promSelectorRe.FindStringSubmatch(selector)
+	if m == nil {
+		return "", fmt.Errorf("metric %q is not a plain selector and cannot be limited to a device", alert.Metric)
+	}
+	matchers := fmt.Sprintf("instance=%q", snmpScrapeTarget(alert.Device))
+	if strings.TrimSpace(m[3]) != "" {
+		matchers = m[3] + "," + matchers
+	}
+	return m[1] + "{" + matchers + "}", nil
+}
+
+// promComparisonIndex returns the offset of the first comparison operator
+// of a PromQL expression, ignoring label matchers and strings, or -1
+func promComparisonIndex(expr string) int {
+	depth := 0
+	for i := 0; i < len(expr); i++ {
+		switch ch := expr[i]; ch {
+		case '"', '\'', '`':
+			for i++; i < len(expr) && expr[i] != ch; i++ {
+				if expr[i] == '\\' && ch != '`' {
+					i++
+				}
+			}
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '<', '>':
+			if depth == 0 {
+				return i
+			}
+		case '=', '!':
+			if depth == 0 && i+1 < len(expr) && expr[i+1] == '=' {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Validate checks what vmalert rejects when loading a rule: empty names,
+// unbalanced expressions, bad durations and label names
+func (r *promRule) Validate() error {
+	if strings.TrimSpace(r.Alert) == "" {
+		return fmt.Errorf("alert name is empty")
+	}
+	if strings.TrimSpace(r.Expr) == "" {
+		return fmt.Errorf("expr is empty")
+	}
+	if r.For != "" {
+		if _, err := parsePromDuration(r.For); err != nil {
+			return fmt.Errorf("invalid for %q", r.For)
+		}
+	}
+	for label := range r.Labels {
+		if !promLabelNameRe.MatchString(label) {
+			return fmt.Errorf("invalid label name %q", label)
+		}
+	}
+
+	var stack []byte
+	closing := map[byte]byte{')': '(', ']': '[', '}': '{'}
+	for i := 0; i < len(r.Expr); i++ {
+		switch ch := r.Expr[i]; ch {
+		case '"', '\'', '`':
+			end := i + 1
+			for end < len(r.Expr) && r.Expr[end] != ch {
+				if r.Expr[end] == '\\' && ch != '`' {
+					end++
+				}
+				end++
+			}
+			if end >= len(r.Expr) {
+				return fmt.Errorf("unterminated string in expr")
+			}
+			i = end
+		case '(', '[', '{':
+			stack = append(stack, ch)
+		case ')', ']', '}':
+			if len(stack) == 0 || stack[len(stack)-1] != closing[ch] {
+				return fmt.Errorf("unbalanced %q in expr", ch)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed %q in expr", stack[len(stack)-1])
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAlertRuleDeviceScope(t *testing.T) {
+	deviceID := uint(7)
+	device := Device{ID: deviceID, Name: "core-sw1", IP: "10.0.0.1", SNMPPort: 1161}
+	tests := []struct {
+		name      string
+		metric    string
+		threshold string
+		device    bool
+		expr      string
+		err       string
+	}{
+		{"threshold", "ifInErrors", "> 10", false, "ifInErrors > 10", ""},
+		{"bare threshold", "ifInErrors", "10", false, "ifInErrors > 10", ""},
+		{"comparison", `ifOperStatus{ifIndex="1"} == 2`, "", false, `ifOperStatus{ifIndex="1"} == 2`, ""},
+		{"device threshold", "ifInErrors", "> 10", true, `ifInErrors{instance="10.0.0.1:1161"} > 10`, ""},
+		{"device threshold with matchers", `ifInErrors{ifIndex="1"}`, "> 10", true, `ifInErrors{ifIndex="1",instance="10.0.0.1:1161"} > 10`, ""},
+		{"device comparison", "ifOperStatus == 2", "", true, `ifOperStatus{instance="10.0.0.1:1161"} == 2`, ""},
+		{"device comparison with matchers", `ifOperStatus{ifIndex="1"}>=2`, "", true, `ifOperStatus{ifIndex="1",instance="10.0.0.1:1161"} >= 2`, ""},
+		{"device comparison of a function", "rate(ifInErrors[5m]) > 1", "", true, "", "cannot be limited to a device"},
+		{"device comparison joined with another series", "ifOperStatus == 2 or up == 0", "", true, "", "cannot be limited to a device"},
+		{"device comparison of two series", "ifInOctets > ifOutOctets", "", true, "", "cannot be limited to a device"},
+		{"device threshold of a function", "rate(ifInErrors[5m])", "> 1", true, "", "cannot be limited to a device"},
+		{"invalid threshold", "ifInErrors", "high", false, "", "invalid threshold"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := Alert{ID: 1, Name: "Test", Metric: tt.metric, Threshold: tt.threshold}
+			if tt.device {
+				alert.DeviceID, alert.Device = &deviceID, device
+			}
+			rule, err := alertRule(alert, "5m")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("alertRule() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("alertRule() error = %v", err)
+			}
+			if rule.Expr != tt.expr {
+				t.Errorf("expr = %s, want %s", rule.Expr, tt.expr)
+			}
+			if tt.device && rule.Labels["device"] != device.Name {
+				t.Errorf("device label = %q, want %q", rule.Labels["device"], device.Name)
+			}
+		})
+	}
+}
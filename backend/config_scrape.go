@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// promConfig is a prometheus.yml, also read by vmagent -promscrape.config
+type promConfig struct {
+	Global        promGlobal          `yaml:"global"`
+	RemoteWrite   []promRemoteWrite   `yaml:"remote_write,omitempty"`
+	ScrapeConfigs []*promScrapeConfig `yaml:"scrape_configs"`
+}
+
+type promGlobal struct {
+	ScrapeInterval     string            `yaml:"scrape_interval,omitempty"`
+	ScrapeTimeout      string            `yaml:"scrape_timeout,omitempty"`
+	EvaluationInterval string            `yaml:"evaluation_interval,omitempty"`
+	ExternalLabels     map[string]string `yaml:"external_labels,omitempty"`
+}
+
+type promRemoteWrite struct {
+	URL string `yaml:"url"`
+}
+
+type promScrapeConfig struct {
+	JobName        string               `yaml:"job_name"`
+	ScrapeInterval string               `yaml:"scrape_interval,omitempty"`
+	ScrapeTimeout  string               `yaml:"scrape_timeout,omitempty"`
+	MetricsPath    string               `yaml:"metrics_path,omitempty"`
+	Params         map[string][]string  `yaml:"params,omitempty"`
+	StaticConfigs  []*promStaticConfig  `yaml:"static_configs"`
+	RelabelConfigs []*promRelabelConfig `yaml:"relabel_configs,omitempty"`
+}
+
+type promStaticConfig struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels,omitempty"`
+}
+
+type promRelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+}
+
+// scrapeConfigOptions are the request options of the prometheus and
+// vmagent generators. Intervals are Prometheus durations.
+type scrapeConfigOptions struct {
+	ScrapeInterval   string            `json:"scrape_interval"`
+	ScrapeTimeout    string            `json:"scrape_timeout"`
+	SNMPInterval     string            `json:"snmp_interval"`
+	NodeInterval     string            `json:"node_interval"`
+	ExternalLabels   map[string]string `json:"external_labels"`
+	SNMPExporter     string            `json:"snmp_exporter"` // host:port, defaults to a host running snmp-exporter
+	SNMPModules      []string          `json:"snmp_modules"`
+	SNMPAuth         string            `json:"snmp_auth"`
+	SNMPAuths        map[string]string `json:"snmp_auths"` // community to snmp_exporter auth; v3 devices use their own
+	NodeExporterPort int               `json:"node_exporter_port"`
+	RemoteWrite      []string          `json:"remote_write"` // prometheus only; vmagent takes -remoteWrite.url
+}
+
+func (o *scrapeConfigOptions) Validate() error {
+	for _, interval := range []string{o.ScrapeInterval, o.ScrapeTimeout, o.SNMPInterval, o.NodeInterval} {
+		if interval == "" {
+			continue
+		}
+		if _, err := parsePromDuration(interval); err != nil {
+			return err
+		}
+	}
+	if o.NodeExporterPort < 0 || o.NodeExporterPort > 65535 {
+		return fmt.Errorf("invalid node_exporter_port %d", o.NodeExporterPort)
+	}
+	return nil
+}
+
+// promDurationRe matches a Prometheus duration such as 1d12h or 30s: integer
+// amounts of units from years down to milliseconds, largest first
+var promDurationRe = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)w)?(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?(?:(\d+)ms)?$`)
+
+// promDurationUnits are the units of the promDurationRe groups. A day is 24
+// hours and a year 365 days, as Prometheus counts them.
+var promDurationUnits = []time.Duration{
+	365 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second, time.Millisecond,
+}
+
+// parsePromDuration parses a duration the way Prometheus, vmalert and
+// Alertmanager read their configuration, which unlike time.ParseDuration
+// accepts d, w and y but no fractions or mixed order
+func parsePromDuration(s string) (time.Duration, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	match := promDurationRe.FindStringSubmatch(s)
+	if s == "" || match == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var d time.Duration
+	for i, unit := range promDurationUnits {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(match[i+1], 10, 64)
+		if err != nil || time.Duration(n) > (1<<63-1-d)/unit {
+			return 0, fmt.Errorf("duration %q is out of range", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+func generatePrometheusConfig(name string, targets []string, options map[string]interface{}) (*generatedConfig, error) {
+	return generateScrapeConfig("prometheus", targets, options)
+}
+
+func generateVMAgentConfig(name string, targets []string, options map[string]interface{}) (*generatedConfig, error) {
+	return generateScrapeConfig("vmagent", targets, options)
+}
+
+// generateScrapeConfig builds scrape_configs from the inventory: one
+// snmp_exporter job per auth for the devices in targets (all devices when
+// empty) and a node_exporter job for the hosts that have it installed
+func generateScrapeConfig(configType string, targets []string, options map[string]interface{}) (*generatedConfig, error) {
+	opts := scrapeConfigOptions{
+		ScrapeInterval:   "15s",
+		SNMPModules:      []string{"if_mib"},
+		SNMPAuth:         "public_v2",
+		NodeExporterPort: 9100,
+	}
+	if err := decodeConfigOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	devices, err := loadConfigDevices(targets)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []Host
+	if err := db.Order("id").Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+
+	out := promConfig{
+		Global: promGlobal{
+			ScrapeInterval: opts.ScrapeInterval,
+			ScrapeTimeout:  opts.ScrapeTimeout,
+			ExternalLabels: opts.ExternalLabels,
+		},
+		ScrapeConfigs: []*promScrapeConfig{},
+	}
+	if configType == "prometheus" {
+		out.Global.EvaluationInterval = opts.ScrapeInterval
+		for _, url := range opts.RemoteWrite {
+			out.RemoteWrite = append(out.RemoteWrite, promRemoteWrite{URL: url})
+		}
+	}
+
+	var warnings []string
+	if len(devices) > 0 {
+		exporter := opts.SNMPExporter
+		if exporter == "" {
+			exporter = "127.0.0.1:9116"
+			if host := findComponentHost(hosts, "snmp-exporter"); host != nil {
+				exporter = fmt.Sprintf("%s:9116", host.IP)
+			} else {
+				warnings = append(warnings, "no host has snmp-exporter installed, using "+exporter)
+			}
+		}
+
+		// Devices are split into jobs by auth and into static configs by
+		// group. v1 and v2c devices are mapped by community, v3 devices use
+		// the auth of their credentials in the generated snmp.yml.
+		v3Names, _, v3Warnings, err := snmpExporterV3Auths(devices)
+		if err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, v3Warnings...)
+		byAuth := make(map[string][]Device)
+		for _, device := range devices {
+			auth := opts.SNMPAuth
+			if version, err := snmpVersionNumber(device.SNMPVersion); err == nil && version == 3 {
+				if auth = v3Names[device.ID]; auth == "" {
+					continue
+				}
+			} else if mapped, ok := opts.SNMPAuths[device.Community]; ok {
+				auth = mapped
+			}
+			byAuth[auth] = append(byAuth[auth], device)
+		}
+		auths := make([]string, 0, len(byAuth))
+		for auth := range byAuth {
+			auths = append(auths, auth)
+		}
+		sort.Strings(auths)
+		for _, auth := range auths {
+			job := &promScrapeConfig{
+				JobName:        "snmp",
+				ScrapeInterval: opts.SNMPInterval,
+				MetricsPath:    "/snmp",
+				Params:         map[string][]string{"module": opts.SNMPModules, "auth": {auth}},
+				StaticConfigs:  groupedStaticConfigs(byAuth[auth], snmpScrapeTarget),
+				RelabelConfigs: []*promRelabelConfig{
+					{SourceLabels: []string{"__address__"}, TargetLabel: "__param_target"},
+					{SourceLabels: []string{"__param_target"}, TargetLabel: "instance"},
+					{TargetLabel: "__address__", Replacement: exporter},
+				},
+			}
+			if len(auths) > 1 {
+				job.JobName = "snmp_" + metricName(auth)
+			}
+			out.ScrapeConfigs = append(out.ScrapeConfigs, job)
+		}
+	}
+
+	var nodeTargets []string
+	for _, host := range hosts {
+		if hostHasComponent(host, "node-exporter") {
+			nodeTargets = append(nodeTargets, fmt.Sprintf("%s:%d", host.IP, opts.NodeExporterPort))
+		}
+	}
+	if len(nodeTargets) > 0 {
+		out.ScrapeConfigs = append(out.ScrapeConfigs, &promScrapeConfig{
+			JobName:        "node",
+			ScrapeInterval: opts.NodeInterval,
+			StaticConfigs:  []*promStaticConfig{{Targets: nodeTargets}},
+		})
+	}
+	if len(out.ScrapeConfigs) == 0 {
+		return nil, fmt.Errorf("no devices or node_exporter hosts to scrape")
+	}
+
+	content, err := marshalConfigYAML(out)
+	if err != nil {
+		return nil, err
+	}
+	return &generatedConfig{
+		Content:     content,
+		Description: fmt.Sprintf("%s scrape config for %d devices and %d hosts", configType, len(devices), len(nodeTargets)),
+		Warnings:    warnings,
+	}, nil
+}
+
+// snmpScrapeTarget is the target parameter snmp_exporter expects, with the
+// port only when it is not 161
+func snmpScrapeTarget(device Device) string {
+	if device.SNMPPort == 0 || device.SNMPPort == 161 {
+		return device.IP
+	}
+	return fmt.Sprintf("%s:%d", device.IP, device.SNMPPort)
+}
+
+// groupedStaticConfigs puts devices into one static config per GroupName
+// and device Type, labelled with group and device_type
+func groupedStaticConfigs(devices []Device, target func(Device) string) []*promStaticConfig {
+	byGroup := make(map[string]*promStaticConfig)
+	var configs []*promStaticConfig
+	for _, device := range devices {
+		key := device.GroupName + "\x00" + device.Type
+		config := byGroup[key]
+		if config == nil {
+			config = &promStaticConfig{Labels: make(map[string]string)}
+			if device.GroupName != "" {
+				config.Labels["group"] = device.GroupName
+			}
+			if device.Type != "" {
+				config.Labels["device_type"] = device.Type
+			}
+			byGroup[key] = config
+			configs = append(configs, config)
+		}
+		config.Targets = append(config.Targets, target(device))
+	}
+	sort.SliceStable(configs, func(i, j int) bool {
+		if configs[i].Labels["group"] != configs[j].Labels["group"] {
+			return configs[i].Labels["group"] < configs[j].Labels["group"]
+		}
+		return configs[i].Labels["device_type"] < configs[j].Labels["device_type"]
+	})
+	return configs
+}
+
+// hostHasComponent reports whether a catalog component (node-exporter,
+// snmp-exporter, ...) is on host, either listed in InstalledComponents or
+// installed by a completed Installation
+func hostHasComponent(host Host, component string) bool {
+	var installed []string
+	if host.InstalledComponents != "" && json.Unmarshal([]byte(host.InstalledComponents), &installed) == nil {
+		for _, name := range installed {
+			if strings.ReplaceAll(strings.ToLower(name), "_", "-") == component {
+				return true
+			}
+		}
+	}
+	var count int64
+	db.Model(&Installation{}).
+		Where("host_id = ? AND component_id = ? AND status = ?", host.ID, component, "completed").
+		Count(&count)
+	return count > 0
+}
+
+// findComponentHost returns the first host with component installed
+func findComponentHost(hosts []Host, component string) *Host {
+	for i := range hosts {
+		if hostHasComponent(hosts[i], component) {
+			return &hosts[i]
+		}
+	}
+	return nil
+}
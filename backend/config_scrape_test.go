@@ -0,0 +1,169 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParsePromDuration(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"30s", 30 * time.Second, true},
+		{"500ms", 500 * time.Millisecond, true},
+		{"1m30s", 90 * time.Second, true},
+		{"1d", day, true},
+		{"1w", 7 * day, true},
+		{"1y", 365 * day, true},
+		{"2w3d12h", 17*day + 12*time.Hour, true},
+		{"1h0m", time.Hour, true},
+		{"", 0, false},
+		{"1.5h", 0, false},
+		{"30s1m", 0, false},
+		{"-5m", 0, false},
+		{"5", 0, false},
+		{"5 m", 0, false},
+		{"1us", 0, false},
+		{"300000y", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parsePromDuration(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parsePromDuration(%q) = %v, %v; want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+
+	options := scrapeConfigOptions{ScrapeInterval: "1d", SNMPInterval: "1w"}
+	if err := options.Validate(); err != nil {
+		t.Errorf("Validate() rejected day and week intervals: %v", err)
+	}
+	options.NodeInterval = "1.5h"
+	if err := options.Validate(); err == nil {
+		t.Error("Validate() accepted a fractional interval")
+	}
+}
+
+func TestScrapeConfigSNMPv3Auths(t *testing.T) {
+	openTestDB(t)
+	t.Setenv(secretKeyEnv, "test secret")
+	loadTestMIBTree(t)
+	devices := []Device{
+		{Name: "sw1", IP: "10.0.0.1", SNMPVersion: "v2c", Community: "public"},
+		{Name: "sw2", IP: "10.0.0.2", SNMPVersion: "v3", SecurityName: "monitor", SecurityLevel: "authPriv",
+			AuthProtocol: "SHA-256", AuthPassphrase: "authpass1", PrivProtocol: "AES", PrivPassphrase: "privpass1"},
+		{Name: "sw3", IP: "10.0.0.3", SNMPVersion: "v3", SecurityName: "monitor", SecurityLevel: "authPriv",
+			AuthProtocol: "SHA-256", AuthPassphrase: "authpass1", PrivProtocol: "AES", PrivPassphrase: "privpass1"},
+		{Name: "sw4", IP: "10.0.0.4", SNMPVersion: "v3", SecurityName: "readonly", SecurityLevel: "authNoPriv",
+			AuthProtocol: "MD5", AuthPassphrase: "authpass2"},
+	}
+	for i := range devices {
+		if err := devices[i].prepareSNMP(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&devices[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	generated, err := generateScrapeConfig("prometheus", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out promConfig
+	if err := yaml.Unmarshal([]byte(generated.Content), &out); err != nil {
+		t.Fatal(err)
+	}
+	jobs := map[string][]string{}
+	for _, job := range out.ScrapeConfigs {
+		for _, static := range job.StaticConfigs {
+			jobs[job.Params["auth"][0]] = append(jobs[job.Params["auth"][0]], static.Targets...)
+		}
+	}
+	want := map[string][]string{
+		"public_v2":                      {"10.0.0.1"},
+		"v3_monitor_authPriv_SHA256_AES": {"10.0.0.2", "10.0.0.3"},
+		"v3_readonly_authNoPriv_MD5":     {"10.0.0.4"},
+	}
+	if !reflect.DeepEqual(jobs, want) {
+		t.Fatalf("targets by auth = %v, want %v", jobs, want)
+	}
+
+	// snmp.yml defines every auth the scrape config uses
+	generated, err = generateSNMPExporterConfig("if_mib", []string{"ifTable"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exporter snmpExporterConfig
+	if err := yaml.Unmarshal([]byte(generated.Content), &exporter); err != nil {
+		t.Fatal(err)
+	}
+	wantAuths := map[string]*SNMPExporterAuth{
+		"public_v2": {Community: "public", Version: 2},
+		"v3_monitor_authPriv_SHA256_AES": {Version: 3, Username: "monitor", SecurityLevel: "authPriv",
+			AuthProtocol: "SHA256", Password: "${SNMP_V3_MONITOR_AUTHPRIV_SHA256_AES_PASSWORD}",
+			PrivProtocol: "AES", PrivPassword: "${SNMP_V3_MONITOR_AUTHPRIV_SHA256_AES_PRIV_PASSWORD}"},
+		"v3_readonly_authNoPriv_MD5": {Version: 3, Username: "readonly", SecurityLevel: "authNoPriv",
+			AuthProtocol: "MD5", Password: "${SNMP_V3_READONLY_AUTHNOPRIV_MD5_PASSWORD}"},
+	}
+	if !reflect.DeepEqual(exporter.Auths, wantAuths) {
+		t.Fatalf("auths = %+v, want %+v", exporter.Auths, wantAuths)
+	}
+	wantWarnings := []string{
+		"auth v3_monitor_authPriv_SHA256_AES reads the passphrases of SNMPv3 user monitor from SNMP_V3_MONITOR_AUTHPRIV_SHA256_AES_PASSWORD and SNMP_V3_MONITOR_AUTHPRIV_SHA256_AES_PRIV_PASSWORD: set them and start snmp_exporter with --config.expand-environment-variables",
+		"auth v3_readonly_authNoPriv_MD5 reads the passphrases of SNMPv3 user readonly from SNMP_V3_READONLY_AUTHNOPRIV_MD5_PASSWORD: set them and start snmp_exporter with --config.expand-environment-variables",
+	}
+	if !reflect.DeepEqual(generated.Warnings, wantWarnings) {
+		t.Fatalf("warnings = %q, want %q", generated.Warnings, wantWarnings)
+	}
+
+	// No generator writes a passphrase into a config
+	categraf, err := generateCategrafConfig("categraf", nil, map[string]interface{}{"objects": []interface{}{"sysUpTime"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{generated.Content, categraf.Content} {
+		for _, secret := range []string{"authpass", "privpass"} {
+			if strings.Contains(content, secret) {
+				t.Fatalf("generated config contains a passphrase:\n%s", content)
+			}
+		}
+	}
+	for _, want := range []string{
+		`auth_password = '${CATEGRAF_V3_MONITOR_AUTHPRIV_SHA256_AES_AUTH_PASSWORD}'`,
+		`priv_password = '${CATEGRAF_V3_MONITOR_AUTHPRIV_SHA256_AES_PRIV_PASSWORD}'`,
+		`auth_password = '${CATEGRAF_V3_READONLY_AUTHNOPRIV_MD5_AUTH_PASSWORD}'`,
+	} {
+		if !strings.Contains(categraf.Content, want) {
+			t.Errorf("categraf config lacks %s:\n%s", want, categraf.Content)
+		}
+	}
+
+	// One user name with two passphrases cannot share an auth
+	conflict := devices[2]
+	conflict.ID, conflict.Name, conflict.IP, conflict.PrivPassphrase = 0, "sw5", "10.0.0.5", "privpass2"
+	if err := conflict.prepareSNMP(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&conflict).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generateScrapeConfig("prometheus", nil, nil); err == nil || !strings.Contains(err.Error(), "different passphrases") {
+		t.Fatalf("generateScrapeConfig() error = %v, want different passphrases", err)
+	}
+	// categraf polls it from another instance with numbered variables
+	categraf, err = generateCategrafConfig("categraf", nil, map[string]interface{}{"objects": []interface{}{"sysUpTime"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `priv_password = '${CATEGRAF_V3_MONITOR_AUTHPRIV_SHA256_AES_2_PRIV_PASSWORD}'`; !strings.Contains(categraf.Content, want) {
+		t.Fatalf("categraf config lacks %s:\n%s", want, categraf.Content)
+	}
+}
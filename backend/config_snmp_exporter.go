@@ -0,0 +1,666 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"snmp-monitor-pro/snmp"
+)
+
+// SNMPExporterGenerator is the generator.yml input of the snmp_exporter
+// generator: named auths plus modules selecting what to walk
+type SNMPExporterGenerator struct {
+	Auths   map[string]*SNMPExporterAuth       `json:"auths,omitempty" yaml:"auths,omitempty"`
+	Modules map[string]*SNMPExporterModuleSpec `json:"modules" yaml:"modules"`
+}
+
+// SNMPExporterAuth is an snmp_exporter auth, identical in generator.yml and
+// snmp.yml
+type SNMPExporterAuth struct {
+	Community     string `json:"community,omitempty" yaml:"community,omitempty"`
+	SecurityLevel string `json:"security_level,omitempty" yaml:"security_level,omitempty"`
+	Username      string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password      string `json:"password,omitempty" yaml:"password,omitempty"`
+	AuthProtocol  string `json:"auth_protocol,omitempty" yaml:"auth_protocol,omitempty"`
+	PrivProtocol  string `json:"priv_protocol,omitempty" yaml:"priv_protocol,omitempty"`
+	PrivPassword  string `json:"priv_password,omitempty" yaml:"priv_password,omitempty"`
+	ContextName   string `json:"context_name,omitempty" yaml:"context_name,omitempty"`
+	Version       int    `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// SNMPExporterModuleSpec selects the objects of one snmp_exporter module.
+// Walk entries are MIB module names, object names (optionally qualified as
+// MODULE::name) or numeric OIDs.
+type SNMPExporterModuleSpec struct {
+	Walk           []string                         `json:"walk" yaml:"walk"`
+	Lookups        []*SNMPExporterLookupSpec        `json:"lookups,omitempty" yaml:"lookups,omitempty"`
+	Overrides      map[string]*SNMPExporterOverride `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+	MaxRepetitions uint32                           `json:"max_repetitions,omitempty" yaml:"max_repetitions,omitempty"`
+	Retries        *int                             `json:"retries,omitempty" yaml:"retries,omitempty"`
+	Timeout        string                           `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// SNMPExporterLookupSpec replaces index labels with the value of another
+// object in the same table, e.g. ifIndex with ifDescr
+type SNMPExporterLookupSpec struct {
+	SourceIndexes     []string `json:"source_indexes" yaml:"source_indexes"`
+	Lookup            string   `json:"lookup" yaml:"lookup"`
+	DropSourceIndexes bool     `json:"drop_source_indexes,omitempty" yaml:"drop_source_indexes,omitempty"`
+}
+
+// SNMPExporterOverride changes how a single object is exported
+type SNMPExporterOverride struct {
+	Ignore          bool                                   `json:"ignore,omitempty" yaml:"ignore,omitempty"`
+	Type            string                                 `json:"type,omitempty" yaml:"type,omitempty"`
+	Help            string                                 `json:"help,omitempty" yaml:"help,omitempty"`
+	RegexpExtracts  map[string][]SNMPExporterRegexpExtract `json:"regex_extracts,omitempty" yaml:"regex_extracts,omitempty"`
+	Offset          float64                                `json:"offset,omitempty" yaml:"offset,omitempty"`
+	Scale           float64                                `json:"scale,omitempty" yaml:"scale,omitempty"`
+	DateTimePattern string                                 `json:"datetime_pattern,omitempty" yaml:"datetime_pattern,omitempty"`
+}
+
+// SNMPExporterRegexpExtract derives a metric value from a string value
+type SNMPExporterRegexpExtract struct {
+	Regex string `json:"regex" yaml:"regex"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// snmpExporterConfig is the generated snmp.yml
+type snmpExporterConfig struct {
+	Auths   map[string]*SNMPExporterAuth   `yaml:"auths"`
+	Modules map[string]*snmpExporterModule `yaml:"modules"`
+}
+
+type snmpExporterModule struct {
+	Walk           []string              `yaml:"walk,omitempty"`
+	Get            []string              `yaml:"get,omitempty"`
+	Metrics        []*snmpExporterMetric `yaml:"metrics"`
+	MaxRepetitions uint32                `yaml:"max_repetitions,omitempty"`
+	Retries        *int                  `yaml:"retries,omitempty"`
+	Timeout        string                `yaml:"timeout,omitempty"`
+}
+
+type snmpExporterMetric struct {
+	Name            string                                 `yaml:"name"`
+	OID             string                                 `yaml:"oid"`
+	Type            string                                 `yaml:"type"`
+	Help            string                                 `yaml:"help"`
+	Indexes         []*snmpExporterIndex                   `yaml:"indexes,omitempty"`
+	Lookups         []*snmpExporterLookup                  `yaml:"lookups,omitempty"`
+	RegexpExtracts  map[string][]SNMPExporterRegexpExtract `yaml:"regex_extracts,omitempty"`
+	DateTimePattern string                                 `yaml:"datetime_pattern,omitempty"`
+	EnumValues      map[int64]string                       `yaml:"enum_values,omitempty"`
+	Offset          float64                                `yaml:"offset,omitempty"`
+	Scale           float64                                `yaml:"scale,omitempty"`
+}
+
+type snmpExporterIndex struct {
+	Labelname string `yaml:"labelname"`
+	Type      string `yaml:"type"`
+	FixedSize int    `yaml:"fixed_size,omitempty"`
+	Implied   bool   `yaml:"implied,omitempty"`
+}
+
+type snmpExporterLookup struct {
+	Labels    []string `yaml:"labels"`
+	Labelname string   `yaml:"labelname"`
+	OID       string   `yaml:"oid,omitempty"`
+	Type      string   `yaml:"type,omitempty"`
+}
+
+// snmpExporterTypes are the metric types snmp_exporter understands, for
+// overrides
+var snmpExporterTypes = map[string]bool{
+	"gauge": true, "counter": true, "OctetString": true, "DisplayString": true,
+	"PhysAddress48": true, "IpAddr": true, "DateAndTime": true, "ParseDateAndTime": true,
+	"NTPTimeStamp": true, "InetAddressIPv4": true, "InetAddressIPv6": true, "InetAddress": true,
+	"InetAddressMissingSize": true, "Bits": true, "EnumAsInfo": true, "EnumAsStateSet": true,
+	"Float": true, "Double": true, "uptime": true,
+}
+
+// snmpExporterHintTypes maps the DISPLAY-HINTs snmp_exporter decodes to
+// their metric types
+var snmpExporterHintTypes = map[string]string{
+	"255a":                         "DisplayString",
+	"255t":                         "DisplayString",
+	"1x:":                          "PhysAddress48",
+	"2d-1d-1d,1d:1d:1d.1d,1a1d:1d": "DateAndTime",
+	"1d.1d.1d.1d":                  "InetAddressIPv4",
+	"2x:2x:2x:2x:2x:2x:2x:2x":      "InetAddressIPv6",
+}
+
+// generateSNMPExporterConfig builds snmp.yml from the MIB store. The
+// generator input comes from options.generator (generator.yml text),
+// options.auths and options.modules, or a single module named after the
+// config that walks targets.
+func generateSNMPExporterConfig(name string, targets []string, options map[string]interface{}) (*generatedConfig, error) {
+	var opts struct {
+		Generator string `json:"generator"`
+		SNMPExporterGenerator
+	}
+	if err := decodeConfigOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	spec := opts.SNMPExporterGenerator
+	if opts.Generator != "" {
+		if err := yaml.Unmarshal([]byte(opts.Generator), &spec); err != nil {
+			return nil, fmt.Errorf("invalid generator.yml: %v", err)
+		}
+	}
+	if len(spec.Modules) == 0 && len(targets) > 0 {
+		spec.Modules = map[string]*SNMPExporterModuleSpec{name: {Walk: targets}}
+	}
+	if len(spec.Modules) == 0 {
+		return nil, fmt.Errorf("no modules to generate: set options.modules, options.generator or targets")
+	}
+	if len(spec.Auths) == 0 {
+		spec.Auths = map[string]*SNMPExporterAuth{"public_v2": {Community: "public", Version: 2}}
+	}
+	// The v3 devices are scraped with the auths of their credentials
+	devices, err := loadConfigDevices(nil)
+	if err != nil {
+		return nil, err
+	}
+	_, v3Auths, v3Warnings, err := snmpExporterV3Auths(devices)
+	if err != nil {
+		return nil, err
+	}
+	v3Names := make([]string, 0, len(v3Auths))
+	for authName := range v3Auths {
+		v3Names = append(v3Names, authName)
+	}
+	sort.Strings(v3Names)
+	for _, authName := range v3Names {
+		if _, ok := spec.Auths[authName]; ok {
+			continue
+		}
+		auth := v3Auths[authName]
+		spec.Auths[authName] = auth
+		if env := snmpExporterAuthEnv(authName, auth); len(env) > 0 {
+			v3Warnings = append(v3Warnings, fmt.Sprintf("auth %s reads the passphrases of SNMPv3 user %s from %s: set them and start snmp_exporter with --config.expand-environment-variables",
+				authName, auth.Username, strings.Join(env, " and ")))
+		}
+	}
+	for authName, auth := range spec.Auths {
+		if err := auth.Validate(); err != nil {
+			return nil, fmt.Errorf("auth %s: %v", authName, err)
+		}
+	}
+
+	tree, err := loadMIBTree()
+	if err != nil {
+		return nil, err
+	}
+	g := &snmpExporterGenerator{tree: tree}
+	out := snmpExporterConfig{Auths: spec.Auths, Modules: make(map[string]*snmpExporterModule)}
+	metrics := 0
+	for moduleName, moduleSpec := range spec.Modules {
+		if moduleSpec == nil {
+			return nil, fmt.Errorf("module %s is empty", moduleName)
+		}
+		module, err := g.module(moduleName, moduleSpec)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %v", moduleName, err)
+		}
+		out.Modules[moduleName] = module
+		metrics += len(module.Metrics)
+	}
+
+	generatorYAML, err := marshalConfigYAML(spec)
+	if err != nil {
+		return nil, err
+	}
+	content, err := marshalConfigYAML(out)
+	if err != nil {
+		return nil, err
+	}
+	return &generatedConfig{
+		Content:     content,
+		Description: fmt.Sprintf("snmp_exporter config with %d modules and %d metrics generated from the MIB store", len(out.Modules), metrics),
+		Extra:       map[string]interface{}{"generator": generatorYAML},
+		Warnings:    append(v3Warnings, g.warnings...),
+	}, nil
+}
+
+// snmpExporterV3Auths returns the snmp_exporter auths of the v3 devices,
+// one for each user, security level and protocols, and the auth name of
+// each device by ID. The scrape config generators use the same names.
+// Passphrases are ${ENV} references (see snmpExporterAuthEnv), never the
+// passphrases themselves. Devices whose credentials cannot be read are left
+// out with a warning.
+func snmpExporterV3Auths(devices []Device) (map[uint]string, map[string]*SNMPExporterAuth, []string, error) {
+	names := make(map[uint]string)
+	auths := make(map[string]*SNMPExporterAuth)
+	owners := make(map[string]string)
+	passphrases := make(map[string][2]string)
+	var warnings []string
+	for _, device := range devices {
+		if version, err := snmpVersionNumber(device.SNMPVersion); err != nil || version != 3 {
+			continue
+		}
+		security, err := deviceSecurity(device)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("skipped SNMPv3 device %s: %v", device.Name, err))
+			continue
+		}
+		name := snmpV3AuthName(security)
+		secrets := [2]string{security.AuthPassphrase, security.PrivPassphrase}
+		if existing, ok := passphrases[name]; ok {
+			if existing != secrets {
+				return nil, nil, nil, fmt.Errorf("SNMPv3 devices %s and %s use user %q with different passphrases", owners[name], device.Name, security.UserName)
+			}
+			names[device.ID] = name
+			continue
+		}
+		auth := &SNMPExporterAuth{Version: 3, Username: security.UserName, SecurityLevel: security.Level.String()}
+		if security.Level >= snmp.AuthNoPriv {
+			auth.AuthProtocol = strings.ReplaceAll(string(security.AuthProtocol), "-", "")
+			_, auth.Password = secretEnv("snmp", name, "password")
+		}
+		if security.Level == snmp.AuthPriv {
+			auth.PrivProtocol = strings.ReplaceAll(string(security.PrivProtocol), "-", "")
+			_, auth.PrivPassword = secretEnv("snmp", name, "priv_password")
+		}
+		auths[name], names[device.ID] = auth, name
+		owners[name], passphrases[name] = device.Name, secrets
+	}
+	return names, auths, warnings, nil
+}
+
+// snmpV3AuthName names the credentials of an SNMPv3 user after the user,
+// security level and protocols, e.g. v3_monitor_authPriv_SHA256_AES
+func snmpV3AuthName(security *snmp.Security) string {
+	parts := []string{"v3", security.UserName, security.Level.String()}
+	if security.Level >= snmp.AuthNoPriv {
+		parts = append(parts, strings.ReplaceAll(string(security.AuthProtocol), "-", ""))
+	}
+	if security.Level == snmp.AuthPriv {
+		parts = append(parts, strings.ReplaceAll(string(security.PrivProtocol), "-", ""))
+	}
+	return metricName(strings.Join(parts, "_"))
+}
+
+// snmpExporterAuthEnv returns the environment variables an auth reads its
+// passphrases from. snmp_exporter expands them when started with
+// --config.expand-environment-variables.
+func snmpExporterAuthEnv(name string, auth *SNMPExporterAuth) []string {
+	var env []string
+	if auth.Password != "" {
+		variable, _ := secretEnv("snmp", name, "password")
+		env = append(env, variable)
+	}
+	if auth.PrivPassword != "" {
+		variable, _ := secretEnv("snmp", name, "priv_password")
+		env = append(env, variable)
+	}
+	return env
+}
+
+// Validate checks the SNMP version and the fields it needs
+func (a *SNMPExporterAuth) Validate() error {
+	if a == nil {
+		return fmt.Errorf("auth is empty")
+	}
+	switch a.Version {
+	case 0:
+		a.Version = 2
+	case 1, 2, 3:
+	default:
+		return fmt.Errorf("unsupported SNMP version %d", a.Version)
+	}
+	if a.Version == 3 {
+		if a.Username == "" {
+			return fmt.Errorf("username is required for SNMPv3")
+		}
+		switch a.SecurityLevel {
+		case "", "noAuthNoPriv", "authNoPriv", "authPriv":
+		default:
+			return fmt.Errorf("invalid security_level %q", a.SecurityLevel)
+		}
+	}
+	return nil
+}
+
+// snmpExporterGenerator turns module specs into snmp.yml modules
+type snmpExporterGenerator struct {
+	tree     *mibTree
+	warnings []string
+}
+
+func (g *snmpExporterGenerator) warnf(format string, args ...interface{}) {
+	g.warnings = append(g.warnings, fmt.Sprintf(format, args...))
+}
+
+func (g *snmpExporterGenerator) module(name string, spec *SNMPExporterModuleSpec) (*snmpExporterModule, error) {
+	if len(spec.Walk) == 0 {
+		return nil, fmt.Errorf("walk is empty")
+	}
+	if spec.Timeout != "" {
+		if _, err := time.ParseDuration(spec.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout %q", spec.Timeout)
+		}
+	}
+
+	var walk, get []string
+	objects := make(map[string]*mibTreeNode)
+	addObject := func(n *mibTreeNode) {
+		if n.IsAccessible() {
+			objects[n.OID] = n
+		}
+	}
+	for _, ref := range spec.Walk {
+		if n := g.tree.Lookup(ref); n != nil {
+			if n.IsAccessible() && g.tree.Entry(n) == nil {
+				get = append(get, n.OID+".0")
+				addObject(n)
+				continue
+			}
+			walk = append(walk, n.OID)
+			for _, sub := range g.tree.Subtree(n.OID) {
+				addObject(sub)
+			}
+			continue
+		}
+		if oid := strings.TrimPrefix(strings.TrimSpace(ref), "."); isNumericOID(oid) {
+			subtree := g.tree.Subtree(oid)
+			if len(subtree) == 0 {
+				return nil, fmt.Errorf("no objects below %s", ref)
+			}
+			walk = append(walk, oid)
+			for _, sub := range subtree {
+				addObject(sub)
+			}
+			continue
+		}
+		// A MIB module walks the tables and reads the scalars it defines
+		module := g.tree.resolver.Module(ref)
+		if module == nil {
+			return nil, fmt.Errorf("unknown MIB object or module %q", ref)
+		}
+		found := false
+		for _, node := range module.Nodes {
+			n := g.tree.byName[module.Name+"::"+node.Name]
+			if n == nil || !n.IsAccessible() {
+				continue
+			}
+			found = true
+			addObject(n)
+			if entry := g.tree.Entry(n); entry != nil {
+				walk = append(walk, parentOID(entry.OID))
+			} else {
+				get = append(get, n.OID+".0")
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("module %s defines no readable objects", ref)
+		}
+	}
+
+	// Resolve lookups; their tables are walked too
+	type lookup struct {
+		spec *SNMPExporterLookupSpec
+		node *mibTreeNode
+		typ  string
+	}
+	var lookups []lookup
+	for _, l := range spec.Lookups {
+		if l == nil || len(l.SourceIndexes) == 0 {
+			return nil, fmt.Errorf("lookup needs source_indexes")
+		}
+		n := g.tree.Lookup(l.Lookup)
+		if n == nil || !n.IsAccessible() {
+			return nil, fmt.Errorf("unknown lookup object %q", l.Lookup)
+		}
+		entry := g.tree.Entry(n)
+		if entry == nil {
+			return nil, fmt.Errorf("lookup object %s is not a table column", l.Lookup)
+		}
+		indexes, _ := g.tree.Indexes(entry)
+		if len(indexes) != len(l.SourceIndexes) {
+			return nil, fmt.Errorf("lookup object %s is not indexed by %s", l.Lookup, strings.Join(l.SourceIndexes, ", "))
+		}
+		for i, index := range indexes {
+			if index.Name != l.SourceIndexes[i] {
+				return nil, fmt.Errorf("lookup object %s is not indexed by %s", l.Lookup, strings.Join(l.SourceIndexes, ", "))
+			}
+		}
+		typ, ok := g.metricType(n)
+		if !ok {
+			return nil, fmt.Errorf("lookup object %s has an unsupported syntax", l.Lookup)
+		}
+		lookups = append(lookups, lookup{spec: l, node: n, typ: typ})
+		walk = append(walk, n.OID)
+	}
+
+	nodes := make([]*mibTreeNode, 0, len(objects))
+	names := make(map[string]bool)
+	for _, n := range objects {
+		nodes = append(nodes, n)
+		names[n.Name] = true
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return oidSortKey(nodes[i].OID) < oidSortKey(nodes[j].OID)
+	})
+	for object, override := range spec.Overrides {
+		if !names[object] {
+			return nil, fmt.Errorf("override for %s, which is not walked", object)
+		}
+		if override != nil && override.Type != "" && !snmpExporterTypes[override.Type] {
+			return nil, fmt.Errorf("override for %s: unknown type %q", object, override.Type)
+		}
+	}
+
+	walk, get = reduceSNMPWalk(walk, get)
+	module := &snmpExporterModule{
+		Walk:           walk,
+		Get:            get,
+		Metrics:        []*snmpExporterMetric{},
+		MaxRepetitions: spec.MaxRepetitions,
+		Retries:        spec.Retries,
+		Timeout:        spec.Timeout,
+	}
+	for _, n := range nodes {
+		override := spec.Overrides[n.Name]
+		if override != nil && override.Ignore {
+			continue
+		}
+		typ, ok := g.metricType(n)
+		if !ok {
+			g.warnf("%s: skipped %s, unsupported syntax", name, n.Name)
+			continue
+		}
+		metric := &snmpExporterMetric{
+			Name: metricName(n.Name),
+			OID:  n.OID,
+			Type: typ,
+			Help: snmpExporterHelp(n),
+		}
+
+		if entry := g.tree.Entry(n); entry != nil {
+			indexes, implied := g.tree.Indexes(entry)
+			if len(indexes) == 0 {
+				g.warnf("%s: skipped %s, INDEX of %s cannot be resolved", name, n.Name, entry.Name)
+				continue
+			}
+			for i, index := range indexes {
+				indexType, fixedSize, ok := g.indexType(index)
+				// An InetAddress index is decoded by the InetAddressType before it
+				if ok && i > 0 && g.hasTC(index, "InetAddress") && g.hasTC(indexes[i-1], "InetAddressType") {
+					indexType, fixedSize = "InetAddress", 0
+				}
+				if !ok {
+					metric = nil
+					g.warnf("%s: skipped %s, index %s has an unsupported syntax", name, n.Name, index.Name)
+					break
+				}
+				metric.Indexes = append(metric.Indexes, &snmpExporterIndex{
+					Labelname: metricName(index.Name),
+					Type:      indexType,
+					FixedSize: fixedSize,
+					Implied:   implied && i == len(indexes)-1,
+				})
+			}
+			if metric == nil {
+				continue
+			}
+			for _, l := range lookups {
+				if !metric.hasIndexes(l.spec.SourceIndexes) {
+					continue
+				}
+				metric.Lookups = append(metric.Lookups, &snmpExporterLookup{
+					Labels:    l.spec.SourceIndexes,
+					Labelname: metricName(l.node.Name),
+					OID:       l.node.OID,
+					Type:      l.typ,
+				})
+				if l.spec.DropSourceIndexes {
+					for _, source := range l.spec.SourceIndexes {
+						metric.Lookups = append(metric.Lookups, &snmpExporterLookup{Labels: []string{}, Labelname: source})
+					}
+				}
+			}
+		}
+
+		if override != nil {
+			if override.Type != "" {
+				metric.Type = override.Type
+			}
+			if override.Help != "" {
+				metric.Help = override.Help
+			}
+			metric.RegexpExtracts = override.RegexpExtracts
+			metric.DateTimePattern = override.DateTimePattern
+			metric.Offset = override.Offset
+			metric.Scale = override.Scale
+		}
+		switch metric.Type {
+		case "gauge", "Bits", "EnumAsInfo", "EnumAsStateSet":
+			if enums := g.tree.EffectiveSyntax(n).Enums; len(enums) > 0 {
+				metric.EnumValues = make(map[int64]string, len(enums))
+				for _, enum := range enums {
+					metric.EnumValues[enum.Value] = enum.Label
+				}
+			}
+		}
+		if metric.Type == "Bits" && len(metric.EnumValues) == 0 {
+			g.warnf("%s: skipped %s, BITS without named bits", name, n.Name)
+			continue
+		}
+		module.Metrics = append(module.Metrics, metric)
+	}
+	return module, nil
+}
+
+// metricType maps the SYNTAX of an object to an snmp_exporter metric type
+func (g *snmpExporterGenerator) metricType(n *mibTreeNode) (string, bool) {
+	switch g.tree.BaseType(n) {
+	case "Counter", "Counter32", "Counter64":
+		return "counter", true
+	case "Gauge", "Gauge32", "Unsigned32", "TimeTicks", "Integer32", "INTEGER":
+		return "gauge", true
+	case "IpAddress", "NetworkAddress":
+		return "IpAddr", true
+	case "BITS":
+		return "Bits", true
+	case "OCTET STRING", "Opaque", "OBJECT IDENTIFIER":
+	default:
+		return "", false
+	}
+	// Strings are decoded by the first DISPLAY-HINT of their TC chain
+	for _, typ := range g.tree.TypeChain(n) {
+		if typ.DisplayHint != "" {
+			if hinted, ok := snmpExporterHintTypes[typ.DisplayHint]; ok {
+				return hinted, true
+			}
+			break
+		}
+	}
+	return "OctetString", true
+}
+
+// indexType returns the index type of an INDEX object and its fixed length
+// for fixed-size strings
+func (g *snmpExporterGenerator) indexType(n *mibTreeNode) (string, int, bool) {
+	typ, ok := g.metricType(n)
+	if !ok {
+		return "", 0, false
+	}
+	switch typ {
+	case "counter", "Bits":
+		return "", 0, false
+	case "OctetString", "DisplayString":
+		if sizes := g.tree.EffectiveSyntax(n).Sizes; len(sizes) == 1 && sizes[0].Min == sizes[0].Max {
+			if size, err := strconv.Atoi(sizes[0].Min); err == nil && size > 0 {
+				return typ, size, true
+			}
+		}
+	}
+	return typ, 0, true
+}
+
+// hasTC reports whether the SYNTAX of n refers to the named type
+func (g *snmpExporterGenerator) hasTC(n *mibTreeNode, name string) bool {
+	for _, typ := range g.tree.TypeChain(n) {
+		if typ.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *snmpExporterMetric) hasIndexes(names []string) bool {
+	for _, name := range names {
+		found := false
+		for _, index := range m.Indexes {
+			if index.Labelname == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// reduceSNMPWalk sorts and deduplicates the walked subtrees, dropping those
+// already covered by another walk, and gets that fall inside a walk
+func reduceSNMPWalk(walk, get []string) ([]string, []string) {
+	covered := func(oid string, by []string) bool {
+		for _, root := range by {
+			if oid == root || strings.HasPrefix(oid, root+".") {
+				return true
+			}
+		}
+		return false
+	}
+	sort.Slice(walk, func(i, j int) bool { return oidSortKey(walk[i]) < oidSortKey(walk[j]) })
+	var walks []string
+	for _, oid := range walk {
+		if !covered(oid, walks) {
+			walks = append(walks, oid)
+		}
+	}
+	sort.Slice(get, func(i, j int) bool { return oidSortKey(get[i]) < oidSortKey(get[j]) })
+	var gets []string
+	for _, oid := range get {
+		if !covered(oid, walks) && (len(gets) == 0 || gets[len(gets)-1] != oid) {
+			gets = append(gets, oid)
+		}
+	}
+	return walks, gets
+}
+
+// snmpExporterHelp is the first sentence of the DESCRIPTION followed by
+// the OID, as the upstream generator writes it
+func snmpExporterHelp(n *mibTreeNode) string {
+	help := strings.Join(strings.Fields(n.Description), " ")
+	help = strings.TrimSuffix(strings.SplitN(help, ". ", 2)[0], ".")
+	return help + " - " + n.OID
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestGenerateSNMPExporterConfig(t *testing.T) {
+	openTestDB(t)
+	loadTestMIBTree(t)
+
+	type wantMetric struct {
+		oid     string
+		typ     string
+		indexes string // labelname:type, comma separated
+		lookups string // labelnames, comma separated
+		enum    string // enum_values[1]
+	}
+	tests := []struct {
+		name    string
+		targets []string
+		options map[string]interface{}
+		walk    []string
+		get     []string
+		metrics map[string]wantMetric
+		err     string
+	}{
+		{
+			name:    "scalars are read as instance 0",
+			targets: []string{"sysUpTime", "sysDescr", "SNMPv2-MIB::sysName"},
+			get:     []string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.1.5.0"},
+			metrics: map[string]wantMetric{
+				"sysUpTime": {oid: "1.3.6.1.2.1.1.3", typ: "gauge"},
+				"sysDescr":  {oid: "1.3.6.1.2.1.1.1", typ: "DisplayString"},
+				"sysName":   {oid: "1.3.6.1.2.1.1.5", typ: "DisplayString"},
+			},
+		},
+		{
+			name:    "table columns with their index",
+			targets: []string{"ifTable"},
+			walk:    []string{"1.3.6.1.2.1.2.2"},
+			metrics: map[string]wantMetric{
+				"ifInOctets":    {oid: "1.3.6.1.2.1.2.2.1.10", typ: "counter", indexes: "ifIndex:gauge"},
+				"ifPhysAddress": {oid: "1.3.6.1.2.1.2.2.1.6", typ: "PhysAddress48", indexes: "ifIndex:gauge"},
+				"ifOperStatus":  {oid: "1.3.6.1.2.1.2.2.1.8", typ: "gauge", indexes: "ifIndex:gauge", enum: "up"},
+				"ifType":        {oid: "1.3.6.1.2.1.2.2.1.3", typ: "gauge", indexes: "ifIndex:gauge", enum: "other"},
+			},
+		},
+		{
+			name: "generator.yml with lookups and overrides",
+			options: map[string]interface{}{"generator": `
+modules:
+  test:
+    walk: [ifXTable, 1.3.6.1.2.1.2.2.1.2]
+    lookups:
+      - source_indexes: [ifIndex]
+        lookup: ifDescr
+        drop_source_indexes: true
+    overrides:
+      ifAlias: {ignore: true}
+      ifHCInOctets: {type: gauge}
+`},
+			walk: []string{"1.3.6.1.2.1.2.2.1.2", "1.3.6.1.2.1.31.1.1"},
+			metrics: map[string]wantMetric{
+				"ifDescr":      {oid: "1.3.6.1.2.1.2.2.1.2", typ: "DisplayString", indexes: "ifIndex:gauge", lookups: "ifDescr,ifIndex"},
+				"ifHCInOctets": {oid: "1.3.6.1.2.1.31.1.1.1.6", typ: "gauge", indexes: "ifIndex:gauge", lookups: "ifDescr,ifIndex"},
+				"ifName":       {oid: "1.3.6.1.2.1.31.1.1.1.1", typ: "DisplayString", indexes: "ifIndex:gauge", lookups: "ifDescr,ifIndex"},
+			},
+		},
+		{
+			name:    "InetAddress index decoded by its type",
+			targets: []string{"ipAddressIfIndex"},
+			walk:    []string{"1.3.6.1.2.1.4.34.1.3"},
+			metrics: map[string]wantMetric{
+				"ipAddressIfIndex": {oid: "1.3.6.1.2.1.4.34.1.3", typ: "gauge", indexes: "ipAddressAddrType:gauge,ipAddressAddr:InetAddress"},
+			},
+		},
+		{
+			name:    "module walks its tables and reads its scalars",
+			targets: []string{"HOST-RESOURCES-MIB"},
+			walk: []string{"1.3.6.1.2.1.25.2.3", "1.3.6.1.2.1.25.3.2", "1.3.6.1.2.1.25.3.3", "1.3.6.1.2.1.25.3.4",
+				"1.3.6.1.2.1.25.3.5", "1.3.6.1.2.1.25.3.6", "1.3.6.1.2.1.25.3.7", "1.3.6.1.2.1.25.3.8",
+				"1.3.6.1.2.1.25.4.2", "1.3.6.1.2.1.25.5.1", "1.3.6.1.2.1.25.6.3"},
+			get: []string{"1.3.6.1.2.1.25.1.1.0", "1.3.6.1.2.1.25.1.2.0", "1.3.6.1.2.1.25.1.3.0", "1.3.6.1.2.1.25.1.4.0",
+				"1.3.6.1.2.1.25.1.5.0", "1.3.6.1.2.1.25.1.6.0", "1.3.6.1.2.1.25.1.7.0", "1.3.6.1.2.1.25.2.2.0",
+				"1.3.6.1.2.1.25.4.1.0", "1.3.6.1.2.1.25.6.1.0", "1.3.6.1.2.1.25.6.2.0"},
+			metrics: map[string]wantMetric{
+				"hrSystemUptime":  {oid: "1.3.6.1.2.1.25.1.1", typ: "gauge"},
+				"hrMemorySize":    {oid: "1.3.6.1.2.1.25.2.2", typ: "gauge"},
+				"hrStorageUsed":   {oid: "1.3.6.1.2.1.25.2.3.1.6", typ: "gauge", indexes: "hrStorageIndex:gauge"},
+				"hrStorageDescr":  {oid: "1.3.6.1.2.1.25.2.3.1.3", typ: "DisplayString", indexes: "hrStorageIndex:gauge"},
+				"hrDeviceStatus":  {oid: "1.3.6.1.2.1.25.3.2.1.5", typ: "gauge", indexes: "hrDeviceIndex:gauge", enum: "unknown"},
+				"hrProcessorLoad": {oid: "1.3.6.1.2.1.25.3.3.1.2", typ: "gauge", indexes: "hrDeviceIndex:gauge"},
+			},
+		},
+		{name: "unknown object", targets: []string{"noSuchObject"}, err: `unknown MIB object or module "noSuchObject"`},
+		{name: "nothing to generate", err: "no modules to generate"},
+		{name: "invalid generator.yml", options: map[string]interface{}{"generator": "modules: ["}, err: "invalid generator.yml"},
+		{
+			name:    "override of an object that is not walked",
+			options: map[string]interface{}{"generator": "modules:\n  test:\n    walk: [ifTable]\n    overrides:\n      sysName: {type: DisplayString}\n"},
+			err:     "override for sysName, which is not walked",
+		},
+		{
+			name:    "override with an unknown type",
+			options: map[string]interface{}{"generator": "modules:\n  test:\n    walk: [ifTable]\n    overrides:\n      ifDescr: {type: String}\n"},
+			err:     `unknown type "String"`,
+		},
+		{
+			name:    "lookup of another table",
+			options: map[string]interface{}{"generator": "modules:\n  test:\n    walk: [ifTable]\n    lookups:\n      - source_indexes: [ifIndex]\n        lookup: hrStorageDescr\n"},
+			err:     "lookup object hrStorageDescr is not indexed by ifIndex",
+		},
+		{
+			name:    "invalid timeout",
+			options: map[string]interface{}{"generator": "modules:\n  test:\n    walk: [ifTable]\n    timeout: soon\n"},
+			err:     `invalid timeout "soon"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generated, err := generateSNMPExporterConfig("test", tt.targets, tt.options)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("generateSNMPExporterConfig() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out snmpExporterConfig
+			if err := yaml.Unmarshal([]byte(generated.Content), &out); err != nil {
+				t.Fatal(err)
+			}
+			module := out.Modules["test"]
+			if module == nil {
+				t.Fatalf("no module test in\n%s", generated.Content)
+			}
+			if !reflect.DeepEqual(module.Walk, tt.walk) || !reflect.DeepEqual(module.Get, tt.get) {
+				t.Errorf("walk %v, get %v; want %v, %v", module.Walk, module.Get, tt.walk, tt.get)
+			}
+			metrics := make(map[string]*snmpExporterMetric)
+			for _, m := range module.Metrics {
+				metrics[m.Name] = m
+			}
+			for name, want := range tt.metrics {
+				m := metrics[name]
+				if m == nil {
+					t.Errorf("no metric %s", name)
+					continue
+				}
+				var indexes, lookups []string
+				for _, index := range m.Indexes {
+					indexes = append(indexes, index.Labelname+":"+index.Type)
+				}
+				for _, lookup := range m.Lookups {
+					lookups = append(lookups, lookup.Labelname)
+				}
+				got := wantMetric{m.OID, m.Type, strings.Join(indexes, ","), strings.Join(lookups, ","), m.EnumValues[1]}
+				if got != want {
+					t.Errorf("metric %s = %+v, want %+v", name, got, want)
+				}
+				if !strings.HasSuffix(m.Help, " - "+m.OID) {
+					t.Errorf("metric %s help %q does not end with its OID", name, m.Help)
+				}
+			}
+			if _, ok := metrics["ifAlias"]; ok {
+				t.Error("ignored ifAlias was exported")
+			}
+		})
+	}
+}
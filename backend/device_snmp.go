@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"snmp-monitor-pro/snmp"
+)
+
+// prepareSNMP validates the device's SNMP settings before it is saved. For
+// v3 the level and protocols are normalized and passphrases given in the
+// request replace the encrypted ones; omitted passphrases are kept.
+func (d *Device) prepareSNMP() error {
+	version, err := snmp.ParseVersion(d.SNMPVersion)
+	if err != nil {
+		return err
+	}
+	if d.SNMPPort < 0 || d.SNMPPort > 65535 {
+		return fmt.Errorf("invalid SNMP port %d", d.SNMPPort)
+	}
+	if version != snmp.Version3 {
+		d.AuthPassphrase, d.PrivPassphrase = "", ""
+		return nil
+	}
+	d.SNMPVersion = "v3"
+
+	level, err := snmp.ParseSecurityLevel(d.SecurityLevel)
+	if err != nil {
+		return err
+	}
+	d.SecurityLevel = level.String()
+	if level >= snmp.AuthNoPriv {
+		protocol, err := snmp.ParseAuthProtocol(d.AuthProtocol)
+		if err != nil {
+			return err
+		}
+		d.AuthProtocol = string(protocol)
+	}
+	if level == snmp.AuthPriv {
+		protocol, err := snmp.ParsePrivProtocol(d.PrivProtocol)
+		if err != nil {
+			return err
+		}
+		d.PrivProtocol = string(protocol)
+	}
+
+	if d.AuthPassphrase != "" {
+		if d.EncAuthPassphrase, err = encryptSecret(d.AuthPassphrase); err != nil {
+			return err
+		}
+	}
+	if d.PrivPassphrase != "" {
+		if d.EncPrivPassphrase, err = encryptSecret(d.PrivPassphrase); err != nil {
+			return err
+		}
+	}
+	d.AuthPassphrase, d.PrivPassphrase = "", ""
+
+	_, err = deviceSecurity(*d)
+	return err
+}
+
+// deviceSecurity returns the device's USM user with decrypted passphrases
+func deviceSecurity(device Device) (*snmp.Security, error) {
+	level, err := snmp.ParseSecurityLevel(device.SecurityLevel)
+	if err != nil {
+		return nil, err
+	}
+	security := &snmp.Security{UserName: device.SecurityName, Level: level}
+	if level >= snmp.AuthNoPriv {
+		if security.AuthProtocol, err = snmp.ParseAuthProtocol(device.AuthProtocol); err != nil {
+			return nil, err
+		}
+		if security.AuthPassphrase, err = decryptSecret(device.EncAuthPassphrase); err != nil {
+			return nil, err
+		}
+	}
+	if level == snmp.AuthPriv {
+		if security.PrivProtocol, err = snmp.ParsePrivProtocol(device.PrivProtocol); err != nil {
+			return nil, err
+		}
+		if security.PrivPassphrase, err = decryptSecret(device.EncPrivPassphrase); err != nil {
+			return nil, err
+		}
+	}
+	if err := security.Validate(); err != nil {
+		return nil, err
+	}
+	return security, nil
+}
+
+// deviceSNMPClient returns an unconnected SNMP client with the device's
+// stored credentials
+func deviceSNMPClient(device Device) (*snmp.Client, error) {
+	version, err := snmp.ParseVersion(device.SNMPVersion)
+	if err != nil {
+		return nil, err
+	}
+	client := &snmp.Client{
+		Target:    device.IP,
+		Port:      device.SNMPPort,
+		Version:   version,
+		Community: device.Community,
+		Timeout:   2 * time.Second,
+		Retries:   1,
+	}
+	if version == snmp.Version3 {
+		if client.Security, err = deviceSecurity(device); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// Device query API handlers
+
+// Limits of a MIB browser query, so one request cannot hold a handler and
+// the device for long
+const (
+	maxQueryTimeout     = 10 * time.Second
+	maxQueryRetries     = 5
+	maxQueryResults     = 10000
+	defaultQueryResults = 1000
+)
+
+// queryDevice runs a GET, GETNEXT or WALK against a device for the MIB
+// browser. OIDs may be names, MODULE::name or numeric, with an optional
+// instance; a GET of a scalar without one reads instance 0.
+func queryDevice(c *gin.Context) {
+	var device Device
+	if err := db.First(&device, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	var req struct {
+		Operation  string   `json:"operation"` // get (default), getnext or walk
+		OIDs       []string `json:"oids" binding:"required"`
+		MaxResults int      `json:"max_results"` // walk limit, defaults to 1000, at most 10000
+		Timeout    int      `json:"timeout"`     // seconds per attempt, at most 10
+		Retries    *int     `json:"retries"`     // at most 5
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	operation := strings.ToLower(req.Operation)
+	if operation == "" {
+		operation = "get"
+	}
+	if operation != "get" && operation != "getnext" && operation != "walk" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Operation must be get, getnext or walk"})
+		return
+	}
+	if len(req.OIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one OID is required"})
+		return
+	}
+	if req.MaxResults <= 0 {
+		req.MaxResults = defaultQueryResults
+	}
+	if req.MaxResults > maxQueryResults {
+		req.MaxResults = maxQueryResults
+	}
+
+	tree, err := loadMIBTree()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	oids := make([]string, 0, len(req.OIDs))
+	for _, ref := range req.OIDs {
+		oid, err := tree.Translate(ref)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if node := tree.Lookup(oid); operation == "get" && node != nil && node.IsAccessible() && tree.Entry(node) == nil {
+			oid += ".0"
+		}
+		oids = append(oids, oid)
+	}
+
+	client, err := deviceSNMPClient(device)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Timeout > 0 {
+		client.Timeout = maxQueryTimeout
+		if req.Timeout < int(maxQueryTimeout/time.Second) {
+			client.Timeout = time.Duration(req.Timeout) * time.Second
+		}
+	}
+	if client.Timeout > maxQueryTimeout {
+		client.Timeout = maxQueryTimeout
+	}
+	if req.Retries != nil && *req.Retries >= 0 {
+		client.Retries = *req.Retries
+	}
+	if client.Retries > maxQueryRetries {
+		client.Retries = maxQueryRetries
+	}
+	if err := client.Connect(); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer client.Close()
+
+	var variables []snmp.Variable
+	truncated := false
+	switch operation {
+	case "get", "getnext":
+		var pdu *snmp.PDU
+		if operation == "get" {
+			pdu, err = client.Get(oids...)
+		} else {
+			pdu, err = client.GetNext(oids...)
+		}
+		if pdu != nil {
+			variables = pdu.Variables
+		}
+	case "walk":
+		errLimit := fmt.Errorf("limit reached")
+		for _, oid := range oids {
+			found := len(variables)
+			err = client.Walk(oid, func(v snmp.Variable) error {
+				if len(variables) >= req.MaxResults {
+					return errLimit
+				}
+				variables = append(variables, v)
+				return nil
+			})
+			if err == errLimit {
+				truncated, err = true, nil
+				break
+			}
+			if err != nil {
+				break
+			}
+			// Like snmpwalk, a walk of a single instance reads it instead
+			if len(variables) == found {
+				pdu, getErr := client.Get(oid)
+				if getErr == nil && len(pdu.Variables) == 1 && !pdu.Variables[0].Type.IsException() {
+					variables = append(variables, pdu.Variables[0])
+				}
+			}
+		}
+	}
+	if err != nil {
+		if _, ok := err.(*snmp.RequestError); !ok {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	results := make([]mibValue, 0, len(variables))
+	for _, v := range variables {
+		results = append(results, tree.FormatVariable(v))
+	}
+	response := gin.H{
+		"device":    device.Name,
+		"operation": operation,
+		"oids":      oids,
+		"results":   results,
+		"truncated": truncated,
+	}
+	if err != nil {
+		response["error"] = err.Error() // an SNMP error-status, such as noSuchName from a v1 agent
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // GitHub API structures for version checking
@@ -582,8 +584,6 @@ func installComponent(c *gin.Context) {
 	
 	// Start installation in background
 	go func() {
-		installer := NewComponentInstaller(host.IP, host.SSHPort, host.Username, host.Password)
-		
 		// This would be a real component installation
 		// For now, simulate the process
 		time.Sleep(2 * time.Second) // Simulate download
@@ -649,65 +649,182 @@ func getInstallationStatus(c *gin.Context) {
 }
 
 // MIB file handlers
+// getMIBFiles lists the current revision of each MIB file, optionally
+// filtered by validation status or by has_errors=true|false. Older revisions
+// are included with include_history=true.
 func getMIBFiles(c *gin.Context) {
+	query := db.Model(&MIBFile{})
+	if c.Query("include_history") != "true" {
+		query = query.Where("current_id IS NULL")
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	switch c.Query("has_errors") {
+	case "true", "1":
+		query = query.Where("error_count > 0")
+	case "false", "0":
+		query = query.Where("error_count = 0")
+	}
+
 	var mibFiles []MIBFile
-	db.Find(&mibFiles)
+	query.Find(&mibFiles)
 	c.JSON(http.StatusOK, mibFiles)
 }
 
+// getMIBOids browses the OID tree. It supports exact lookup by oid or name
+// (optionally MODULE::name), subtree and direct-children browsing, and paging.
+// The total match count is returned in the X-Total-Count header.
 func getMIBOids(c *gin.Context) {
-	// TODO: Implement actual MIB OID parsing and retrieval
-	// For now, return empty array to prevent frontend errors
-	c.JSON(http.StatusOK, []gin.H{})
+	filter := func(tx *gorm.DB) *gorm.DB {
+		if oid := strings.Trim(c.Query("oid"), "."); oid != "" {
+			tx = tx.Where("oid = ?", oid)
+		}
+		if name := c.Query("name"); name != "" {
+			if module, symbol, ok := strings.Cut(name, "::"); ok {
+				tx = tx.Where("module = ? AND name = ?", module, symbol)
+			} else {
+				tx = tx.Where("name = ?", name)
+			}
+		}
+		if subtree := strings.Trim(c.Query("subtree"), "."); subtree != "" {
+			tx = tx.Where("(oid = ? OR oid LIKE ?)", subtree, subtree+".%")
+		}
+		if parent, ok := c.GetQuery("parent"); ok {
+			tx = tx.Where("parent_oid = ?", strings.Trim(parent, "."))
+		}
+		if module := c.Query("module"); module != "" {
+			tx = tx.Where("module = ?", module)
+		}
+		if mibID := c.Query("mib_id"); mibID != "" {
+			tx = tx.Where("mib_file_id = ?", mibID)
+		}
+		if search := c.Query("search"); search != "" {
+			tx = tx.Where("(name LIKE ? OR description LIKE ?)", "%"+search+"%", "%"+search+"%")
+		}
+		return tx
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	var total int64
+	db.Model(&MIBObject{}).Scopes(filter).Count(&total)
+
+	var objects []MIBObject
+	db.Scopes(filter).Order("sort_key").Limit(limit).Offset((page - 1) * limit).Find(&objects)
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, objects)
 }
 
+// uploadMIBFile accepts one or more MIB files in the "file" or "files" form
+// fields. A single archive is handed over to uploadMIBArchive.
 func uploadMIBFile(c *gin.Context) {
-	// Handle both single files and archives
-	file, err := c.FormFile("file")
+	form, err := c.MultipartForm()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
 		return
 	}
+	files := append(form.File["file"], form.File["files"]...)
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
 
-	// Check if it's an archive
-	filename := file.Filename
-	isArchive := false
-	for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".tar", ".rar"} {
-		if strings.HasSuffix(strings.ToLower(filename), ext) {
-			isArchive = true
-			break
-		}
+	if len(files) == 1 && isMIBArchiveName(files[0].Filename) {
+		storeMIBArchive(c, files[0])
+		return
 	}
 
-	if isArchive {
-		// Handle as archive
-		uploadMIBArchive(c)
+	results, err := NewMIBManager().UploadMIBFiles(files)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "results": results})
 		return
 	}
 
-	// Handle as single MIB file
-	// TODO: Implement single file upload
-	c.JSON(http.StatusOK, gin.H{
-		"message": "MIB file uploaded successfully",
+	summary := map[string]int{"created": 0, "updated": 0, "history": 0, "duplicate": 0, "failed": 0}
+	for _, result := range results {
+		summary[result.Result]++
+	}
+	code := http.StatusOK
+	if summary["created"]+summary["updated"]+summary["history"] > 0 {
+		code = http.StatusCreated
+	}
+	c.JSON(code, gin.H{
+		"results": results,
+		"summary": summary,
 	})
 }
 
 func deleteMIBFile(c *gin.Context) {
 	id := c.Param("id")
-	if err := db.Delete(&MIBFile{}, id).Error; err != nil {
+	var mibFile MIBFile
+	if err := db.First(&mibFile, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MIB file not found"})
+		return
+	}
+	if mibFile.Source == "system" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Bundled base MIBs cannot be deleted"})
+		return
+	}
+	if err := removeMIBFile(mibFile); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	// Modules importing the deleted one may no longer resolve
+	go NewMIBManager().ResolveImports()
+
 	c.JSON(http.StatusOK, gin.H{"message": "MIB file deleted successfully"})
 }
 
+// validateMIBFile re-parses a MIB file, resolves it against the store and
+// returns the diagnostics with their source positions. The profile query
+// parameter previews another lint profile without saving the result.
 func validateMIBFile(c *gin.Context) {
 	id := c.Param("id")
-	// TODO: Implement MIB file validation
+	var mibFile MIBFile
+	if err := db.First(&mibFile, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MIB file not found"})
+		return
+	}
+
+	profile := c.Query("profile")
+	if profile != "" && !isMIBLintProfile(profile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown lint profile %q", profile)})
+		return
+	}
+
+	diags, err := NewMIBManager().ValidateMIBFile(&mibFile, profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if diags == nil {
+		diags = []MIBDiagnostic{}
+	}
+	applied := profile
+	if applied == "" {
+		applied = loadMIBLintSettings().ProfileFor(mibFile.ModuleName)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"id": id,
-		"status": "validated",
-		"oid_count": 1247,
+		"id":            mibFile.ID,
+		"module":        mibFile.ModuleName,
+		"profile":       applied,
+		"preview":       profile != "" || mibFile.CurrentID != nil,
+		"status":        mibFile.Status,
+		"oid_count":     mibFile.OIDCount,
+		"error_count":   mibFile.ErrorCount,
+		"warning_count": mibFile.WarningCount,
+		"diagnostics":   diags,
 	})
 }
 
@@ -724,6 +841,10 @@ func createDevice(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := device.prepareSNMP(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	
 	device.CreatedAt = time.Now()
 	device.UpdatedAt = time.Now()
@@ -749,6 +870,10 @@ func updateDevice(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := device.prepareSNMP(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	
 	device.UpdatedAt = time.Now()
 	db.Save(&device)
@@ -864,6 +989,7 @@ func createConfig(c *gin.Context) {
 func generateConfig(c *gin.Context) {
 	var req struct {
 		Type    string   `json:"type"`
+		Name    string   `json:"name"`
 		Targets []string `json:"targets"`
 		Options map[string]interface{} `json:"options"`
 	}
@@ -873,11 +999,57 @@ func generateConfig(c *gin.Context) {
 		return
 	}
 	
-	// TODO: Implement config generation logic
-	c.JSON(http.StatusOK, gin.H{
-		"config": "# Generated configuration\nglobal:\n  scrape_interval: 15s",
-		"type": req.Type,
-	})
+	generate, ok := configGenerators[req.Type]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown config type %q (%s)", req.Type, strings.Join(configTypes(), ", "))})
+		return
+	}
+	if req.Name == "" {
+		req.Name = req.Type
+	}
+	
+	generated, err := generate(req.Name, req.Targets, req.Options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	response := gin.H{
+		"type":     req.Type,
+		"warnings": generated.Warnings,
+	}
+	if len(generated.Files) > 0 {
+		keys := make([]string, 0, len(generated.Files))
+		for key := range generated.Files {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		files := make(map[string]string, len(keys))
+		saved := make([]*Config, 0, len(keys))
+		for _, key := range keys {
+			name := req.Name + "-" + key
+			config, err := saveGeneratedConfig(name, req.Type, generated.Files[key], generated.Description)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			files[name] = generated.Files[key]
+			saved = append(saved, config)
+		}
+		response["files"] = files
+		response["saved"] = saved
+	} else {
+		config, err := saveGeneratedConfig(req.Name, req.Type, generated.Content, generated.Description)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response["config"] = generated.Content
+		response["saved"] = config
+	}
+	for key, value := range generated.Extra {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func deployConfig(c *gin.Context) {
@@ -947,25 +1119,117 @@ func generateSSHKey(c *gin.Context) {
 }
 
 // Settings handlers
-func getSettings(c *gin.Context) {
-	// TODO: Implement settings retrieval
-	c.JSON(http.StatusOK, gin.H{
+// defaultSettings returns the settings used until others are saved
+func defaultSettings() map[string]interface{} {
+	return map[string]interface{}{
 		"theme": "dark",
 		"language": "en",
 		"notifications": true,
 		"autoRefresh": true,
 		"refreshInterval": 30,
-	})
+		mibLintSettingKey: defaultMIBLintSettings(),
+		mibArchiveLimitsSettingKey: defaultMIBArchiveLimits(),
+		mibSyncSettingKey: defaultMIBSyncSettings(),
+		trapReceiverSettingKey: defaultTrapReceiverSettings(),
+	}
+}
+
+// loadSetting decodes a stored setting into v and reports whether it exists
+func loadSetting(key string, v interface{}) bool {
+	var setting Setting
+	if err := db.Where("key = ?", key).First(&setting).Error; err != nil {
+		return false
+	}
+	return json.Unmarshal([]byte(setting.Value), v) == nil
+}
+
+// normalizeSetting validates the structured settings and fills in defaults
+// for the fields left out; other keys are stored as given
+func normalizeSetting(key string, raw json.RawMessage) (json.RawMessage, error) {
+	var value interface{ Validate() error }
+	switch key {
+	case mibLintSettingKey:
+		lint := defaultMIBLintSettings()
+		value = &lint
+	case mibArchiveLimitsSettingKey:
+		limits := defaultMIBArchiveLimits()
+		value = &limits
+	case mibSyncSettingKey:
+		sync := defaultMIBSyncSettings()
+		value = &sync
+	case trapReceiverSettingKey:
+		receiver := defaultTrapReceiverSettings()
+		value = &receiver
+	case snmpEngineSettingKey:
+		return nil, fmt.Errorf("%s is managed by the server", key)
+	default:
+		return raw, nil
+	}
+	if err := json.Unmarshal(raw, value); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	if err := value.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func getSettings(c *gin.Context) {
+	settings := defaultSettings()
+
+	var stored []Setting
+	db.Find(&stored)
+	for _, setting := range stored {
+		var value interface{}
+		if err := json.Unmarshal([]byte(setting.Value), &value); err == nil {
+			settings[setting.Key] = value
+		}
+	}
+	c.JSON(http.StatusOK, settings)
 }
 
+// updateSettings stores the given keys; keys that are left out keep their
+// current value
 func updateSettings(c *gin.Context) {
-	var settings map[string]interface{}
+	var settings map[string]json.RawMessage
 	if err := c.ShouldBindJSON(&settings); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	
-	// TODO: Implement settings update
+
+	for key, raw := range settings {
+		normalized, err := normalizeSetting(key, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		settings[key] = normalized
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for key, value := range settings {
+			setting := Setting{Key: key, Value: string(value), UpdatedAt: time.Now()}
+			if err := tx.Save(&setting).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Re-grade stored MIB files under the new lint settings
+	if _, ok := settings[mibLintSettingKey]; ok {
+		go NewMIBManager().ResolveImports()
+	}
+
+	// Rebind the trap listener to the new port and communities
+	if _, ok := settings[trapReceiverSettingKey]; ok {
+		StartTrapReceiver()
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Settings updated successfully",
 	})
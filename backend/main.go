@@ -3,7 +3,6 @@ package main
 import (
 	"log"
 	"net/http"
-	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -22,7 +21,18 @@ func main() {
 	}
 
 	// Auto migrate schemas
-	db.AutoMigrate(&Host{}, &Component{}, &MIBFile{}, &MIBServerPath{}, &MIBArchive{}, &Device{}, &Alert{}, &Config{}, &User{}, &AuditLog{}, &Installation{}, &SSHKey{})
+	db.AutoMigrate(&Host{}, &Component{}, &MIBFile{}, &MIBObject{}, &MIBServerPath{}, &MIBSyncRun{}, &MIBSyncDuplicate{}, &MIBArchive{}, &Device{}, &Alert{}, &Trap{}, &TrapAlertRule{}, &Config{}, &User{}, &AuditLog{}, &Installation{}, &SSHKey{}, &Setting{})
+
+	// Register the bundled IETF base MIBs
+	if err := NewMIBManager().LoadBaseMIBs(); err != nil {
+		log.Printf("Failed to load base MIBs: %v", err)
+	}
+
+	// Keep auto-sync server paths mirrored
+	StartMIBSyncScheduler()
+
+	// Receive SNMP traps and informs
+	StartTrapReceiver()
 
 	// Initialize Gin router
 	r := gin.Default()
@@ -68,11 +78,18 @@ func main() {
 		api.POST("/mibs/upload", uploadMIBFile)
 		api.DELETE("/mibs/:id", deleteMIBFile)
 		api.POST("/mibs/:id/validate", validateMIBFile)
+		api.GET("/mibs/dependencies", getMIBDependencyGraph)
+		api.GET("/mibs/:id/dependencies", getMIBFileDependencies)
+		api.GET("/mibs/lint-rules", getMIBLintRules)
+		api.GET("/mibs/:id/history", getMIBFileHistory)
+		api.GET("/mibs/diff", diffMIBFiles)
+		api.POST("/mibs/:id/diff", diffUploadedMIBFile)
 
 		// MIB server paths
 		api.GET("/mibs/server-paths", getMIBServerPaths)
 		api.POST("/mibs/server-paths", createMIBServerPath)
 		api.POST("/mibs/server-paths/:id/scan", scanMIBServerPath)
+		api.GET("/mibs/server-paths/:id/runs", getMIBSyncRuns)
 
 		// MIB archives
 		api.GET("/mibs/archives", getMIBArchives)
@@ -85,6 +102,7 @@ func main() {
 		api.PUT("/devices/:id", updateDevice)
 		api.DELETE("/devices/:id", deleteDevice)
 		api.POST("/devices/discover", discoverDevices)
+		api.POST("/devices/:id/query", queryDevice)
 
 		// Alert management
 		api.GET("/alerts", getAlerts)
@@ -92,6 +110,15 @@ func main() {
 		api.PUT("/alerts/:id", updateAlert)
 		api.DELETE("/alerts/:id", deleteAlert)
 
+		// SNMP traps
+		api.GET("/traps", getTraps)
+		api.GET("/traps/rules", getTrapAlertRules)
+		api.POST("/traps/rules", createTrapAlertRule)
+		api.PUT("/traps/rules/:id", updateTrapAlertRule)
+		api.DELETE("/traps/rules/:id", deleteTrapAlertRule)
+		api.GET("/traps/:id", getTrap)
+		api.DELETE("/traps/:id", deleteTrap)
+
 		// Configuration management
 		api.GET("/configs", getConfigs)
 		api.POST("/configs", createConfig)
@@ -121,6 +148,7 @@ func main() {
 	log.Println("  ✓ Configuration generation and deployment")
 	log.Println("  ✓ MIB file management and parsing")
 	log.Println("  ✓ Device monitoring and discovery")
+	log.Println("  ✓ SNMP trap and inform receiver")
 	log.Println("  ✓ Alert management and notifications")
 	log.Println("  ✓ System health monitoring")
 	
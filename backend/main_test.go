@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB points db at an empty database with the schema main migrates
+func openTestDB(t *testing.T) {
+	t.Helper()
+	var err error
+	db, err = gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&Host{}, &Component{}, &MIBFile{}, &MIBObject{}, &MIBServerPath{}, &MIBSyncRun{}, &MIBSyncDuplicate{}, &MIBArchive{}, &Device{}, &Alert{}, &Trap{}, &TrapAlertRule{}, &Config{}, &User{}, &AuditLog{}, &Installation{}, &SSHKey{}, &Setting{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadTestMIBTree registers the base MIBs in the test database and
+// resolves them
+func loadTestMIBTree(t *testing.T) *mibTree {
+	t.Helper()
+	if err := NewMIBManager().LoadBaseMIBs(); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := loadMIBTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// baseMIBResolver parses the bundled base MIBs into a resolved resolver
+func baseMIBResolver(t *testing.T) *MIBResolver {
+	t.Helper()
+	entries, err := fs.ReadDir(baseMIBs, baseMIBDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := NewMIBResolver()
+	for _, entry := range entries {
+		filePath := path.Join(baseMIBDir, entry.Name())
+		content, err := baseMIBs.ReadFile(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		module, err := ParseMIB(content)
+		if err != nil {
+			t.Fatalf("%s: %v", entry.Name(), err)
+		}
+		resolver.Add(MIBFile{Filename: entry.Name(), FilePath: filePath, Source: "system"}, module)
+	}
+	resolver.Resolve()
+	return resolver
+}
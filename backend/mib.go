@@ -3,57 +3,31 @@ package main
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
+	"compress/bzip2"
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/bodgit/sevenzip"
 	"github.com/gin-gonic/gin"
+	"github.com/nwaples/rardecode"
+	"github.com/ulikunitz/xz"
 )
 
-// MIBServerPath represents a server path configuration
-type MIBServerPath struct {
-	ID       uint   `json:"id" gorm:"primaryKey"`
-	Name     string `json:"name" gorm:"not null"`
-	Host     string `json:"host" gorm:"not null"`
-	Path     string `json:"path" gorm:"not null"`
-	SSHPort  int    `json:"ssh_port" gorm:"default:22"`
-	Username string `json:"username"`
-	Password string `json:"password,omitempty"`
-	SSHKey   string `json:"ssh_key,omitempty"`
-	AutoSync bool   `json:"auto_sync" gorm:"default:false"`
-	Status   string `json:"status" gorm:"default:disconnected"` // connected, disconnected, scanning
-	LastScan time.Time `json:"last_scan"`
-	FileCount int    `json:"file_count" gorm:"default:0"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
-
-// MIBArchive represents an uploaded archive
-type MIBArchive struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	Name          string    `json:"name" gorm:"not null"`
-	OriginalName  string    `json:"original_name"`
-	Size          int64     `json:"size"`
-	FilePath      string    `json:"file_path"`
-	Status        string    `json:"status" gorm:"default:uploaded"` // uploaded, extracting, extracted, error
-	ExtractedFiles int      `json:"extracted_files" gorm:"default:0"`
-	TotalFiles    int       `json:"total_files" gorm:"default:0"`
-	Progress      int       `json:"progress" gorm:"default:0"`
-	ErrorMessage  string    `json:"error_message,omitempty"`
-	UploadedAt    time.Time `json:"uploaded_at"`
-	ExtractedAt   *time.Time `json:"extracted_at"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
-}
-
 // MIBManager handles MIB file operations
 type MIBManager struct {
 	uploadDir   string
 	extractDir  string
+	syncDir     string
 	sshClients  map[string]*SSHClient
 }
 
@@ -62,62 +36,11 @@ func NewMIBManager() *MIBManager {
 	return &MIBManager{
 		uploadDir:  "./uploads/mibs",
 		extractDir: "./extracted/mibs",
+		syncDir:    "./synced/mibs",
 		sshClients: make(map[string]*SSHClient),
 	}
 }
 
-// ScanServerPath scans a server path for MIB files
-func (mm *MIBManager) ScanServerPath(pathConfig MIBServerPath) error {
-	// Create SSH client
-	sshClient := &SSHClient{
-		Host:     pathConfig.Host,
-		Port:     pathConfig.SSHPort,
-		Username: pathConfig.Username,
-		Password: pathConfig.Password,
-	}
-
-	// Connect to server
-	if err := sshClient.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to server: %v", err)
-	}
-	defer sshClient.Close()
-
-	// List MIB files in the directory
-	listCmd := fmt.Sprintf("find %s -name '*.mib' -o -name '*.txt' | head -1000", pathConfig.Path)
-	output, err := sshClient.Execute(listCmd)
-	if err != nil {
-		return fmt.Errorf("failed to list files: %v", err)
-	}
-
-	// Parse file list
-	files := strings.Split(strings.TrimSpace(output), "\n")
-	fileCount := 0
-
-	for _, file := range files {
-		if strings.TrimSpace(file) == "" {
-			continue
-		}
-
-		// Get file info
-		statCmd := fmt.Sprintf("stat -c '%%s %%Y' %s", file)
-		statOutput, err := sshClient.Execute(statCmd)
-		if err != nil {
-			continue
-		}
-
-		// Parse file info and create MIB record
-		// This would create MIBFile records with source='server'
-		fileCount++
-	}
-
-	// Update path configuration
-	pathConfig.FileCount = fileCount
-	pathConfig.LastScan = time.Now()
-	pathConfig.Status = "connected"
-
-	return nil
-}
-
 // ExtractArchive extracts a MIB archive
 func (mm *MIBManager) ExtractArchive(archiveID uint) error {
 	var archive MIBArchive
@@ -128,28 +51,23 @@ func (mm *MIBManager) ExtractArchive(archiveID uint) error {
 	// Update status to extracting
 	archive.Status = "extracting"
 	archive.Progress = 0
+	archive.ExtractedFiles = 0
+	archive.ErrorMessage = ""
 	db.Save(&archive)
 
 	// Create extraction directory
 	extractPath := filepath.Join(mm.extractDir, fmt.Sprintf("archive_%d", archive.ID))
+	os.RemoveAll(extractPath)
 	if err := os.MkdirAll(extractPath, 0755); err != nil {
 		return fmt.Errorf("failed to create extract directory: %v", err)
 	}
 
-	// Determine archive type and extract
-	var err error
-	switch {
-	case strings.HasSuffix(archive.Name, ".zip"):
-		err = mm.extractZip(archive.FilePath, extractPath, &archive)
-	case strings.HasSuffix(archive.Name, ".tar.gz") || strings.HasSuffix(archive.Name, ".tgz"):
-		err = mm.extractTarGz(archive.FilePath, extractPath, &archive)
-	case strings.HasSuffix(archive.Name, ".tar"):
-		err = mm.extractTar(archive.FilePath, extractPath, &archive)
-	default:
-		err = fmt.Errorf("unsupported archive format")
-	}
-
+	// The format is detected from the content, the name is only a fallback
+	budget := newMIBExtractBudget(loadMIBArchiveLimits())
+	err := mm.extractArchiveFile(archive.FilePath, archive.OriginalName, extractPath, &archive, budget, 0)
 	if err != nil {
+		// Leave nothing of a rejected archive behind
+		os.RemoveAll(extractPath)
 		archive.Status = "error"
 		archive.ErrorMessage = err.Error()
 		db.Save(&archive)
@@ -167,35 +85,78 @@ func (mm *MIBManager) ExtractArchive(archiveID uint) error {
 	return mm.scanExtractedFiles(extractPath, archive.ID)
 }
 
+// extractArchiveFile extracts the archive at archivePath into extractPath.
+// name is the archive's original name, used for single compressed files.
+// depth counts the archives it is nested in.
+func (mm *MIBManager) extractArchiveFile(archivePath, name, extractPath string, archive *MIBArchive, budget *mibExtractBudget, depth int) error {
+	format, err := detectMIBArchiveFile(archivePath)
+	if err != nil {
+		return err
+	}
+	if format == "" && strings.HasSuffix(strings.ToLower(name), ".tar") {
+		// Pre-POSIX tar files carry no magic
+		format = mibArchiveTar
+	}
+	if depth == 0 {
+		archive.Format = format
+	}
+
+	switch format {
+	case mibArchiveZip:
+		return mm.extractZip(archivePath, extractPath, archive, budget, depth)
+	case mibArchiveTar:
+		return mm.extractTar(archivePath, extractPath, archive, budget, depth)
+	case mibArchiveGzip, mibArchiveBzip2, mibArchiveXz:
+		return mm.extractCompressed(archivePath, name, format, extractPath, archive, budget, depth)
+	case mibArchiveRar:
+		return mm.extractRar(archivePath, extractPath, archive, budget, depth)
+	case mibArchive7z:
+		return mm.extract7z(archivePath, extractPath, archive, budget, depth)
+	}
+	return fmt.Errorf("unsupported archive format")
+}
+
 // extractZip extracts a ZIP archive
-func (mm *MIBManager) extractZip(archivePath, extractPath string, archive *MIBArchive) error {
+func (mm *MIBManager) extractZip(archivePath, extractPath string, archive *MIBArchive, budget *mibExtractBudget, depth int) error {
 	reader, err := zip.OpenReader(archivePath)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
-	archive.TotalFiles = len(reader.File)
-	db.Save(archive)
+	if depth == 0 {
+		archive.TotalFiles = len(reader.File)
+		db.Save(archive)
+	}
 
 	for i, file := range reader.File {
 		// Update progress
-		archive.Progress = (i * 100) / len(reader.File)
-		archive.ExtractedFiles = i
-		db.Save(archive)
+		if depth == 0 {
+			archive.Progress = (i * 100) / len(reader.File)
+			db.Save(archive)
+		}
+
+		if err := budget.addEntry(file.Name); err != nil {
+			return err
+		}
+		if file.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %s is a symbolic link", file.Name)
+		}
+		filePath, err := safeExtractPath(extractPath, file.Name)
+		if err != nil {
+			return err
+		}
 
 		// Skip directories
 		if file.FileInfo().IsDir() {
 			continue
 		}
-
-		// Only extract MIB files
-		if !mm.isMIBFile(file.Name) {
-			continue
+		if !file.Mode().IsRegular() {
+			return fmt.Errorf("archive entry %s is not a regular file", file.Name)
 		}
 
 		// Extract file
-		if err := mm.extractZipFile(file, extractPath); err != nil {
+		if err := mm.extractZipFile(file, filePath, archive, budget, depth); err != nil {
 			return err
 		}
 	}
@@ -203,38 +164,68 @@ func (mm *MIBManager) extractZip(archivePath, extractPath string, archive *MIBAr
 	return nil
 }
 
-// extractTarGz extracts a tar.gz archive
-func (mm *MIBManager) extractTarGz(archivePath, extractPath string, archive *MIBArchive) error {
+// extractTar extracts a tar archive
+func (mm *MIBManager) extractTar(archivePath, extractPath string, archive *MIBArchive, budget *mibExtractBudget, depth int) error {
 	file, err := os.Open(archivePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	gzReader, err := gzip.NewReader(file)
-	if err != nil {
-		return err
-	}
-	defer gzReader.Close()
-
-	return mm.extractTarReader(tar.NewReader(gzReader), extractPath, archive)
+	return mm.extractTarReader(tar.NewReader(file), extractPath, archive, budget, depth)
 }
 
-// extractTar extracts a tar archive
-func (mm *MIBManager) extractTar(archivePath, extractPath string, archive *MIBArchive) error {
+// extractCompressed extracts a gzip, bzip2 or xz file, which holds either a
+// tar archive or a single file
+func (mm *MIBManager) extractCompressed(archivePath, name, format, extractPath string, archive *MIBArchive, budget *mibExtractBudget, depth int) error {
 	file, err := os.Open(archivePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	return mm.extractTarReader(tar.NewReader(file), extractPath, archive)
+	var stream io.Reader
+	switch format {
+	case mibArchiveGzip:
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzReader.Close()
+		stream = gzReader
+	case mibArchiveBzip2:
+		stream = bzip2.NewReader(file)
+	case mibArchiveXz:
+		xzReader, err := xz.NewReader(file)
+		if err != nil {
+			return err
+		}
+		stream = xzReader
+	}
+
+	buffered := bufio.NewReaderSize(stream, mibArchiveMagicSize)
+	head, err := buffered.Peek(mibArchiveMagicSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	if detectMIBArchiveFormat(head) == mibArchiveTar {
+		return mm.extractTarReader(tar.NewReader(buffered), extractPath, archive, budget, depth)
+	}
+
+	// A single compressed file is named after the archive
+	inner := trimMIBCompressionExt(filepath.Base(filepath.FromSlash(name)))
+	if err := budget.addEntry(inner); err != nil {
+		return err
+	}
+	filePath, err := safeExtractPath(extractPath, inner)
+	if err != nil {
+		return err
+	}
+	return mm.extractEntry(filePath, inner, 0, buffered, archive, budget, depth)
 }
 
 // extractTarReader extracts files from a tar reader
-func (mm *MIBManager) extractTarReader(tarReader *tar.Reader, extractPath string, archive *MIBArchive) error {
-	extractedCount := 0
-
+func (mm *MIBManager) extractTarReader(tarReader *tar.Reader, extractPath string, archive *MIBArchive, budget *mibExtractBudget, depth int) error {
 	for {
 		header, err := tarReader.Next()
 		if err == io.EOF {
@@ -244,73 +235,186 @@ func (mm *MIBManager) extractTarReader(tarReader *tar.Reader, extractPath string
 			return err
 		}
 
-		// Skip directories
-		if header.Typeflag == tar.TypeDir {
+		if err := budget.addEntry(header.Name); err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			return fmt.Errorf("archive entry %s is a symbolic link", header.Name)
+		case tar.TypeLink:
+			return fmt.Errorf("archive entry %s is a hard link", header.Name)
+		case tar.TypeXGlobalHeader:
 			continue
 		}
+		filePath, err := safeExtractPath(extractPath, header.Name)
+		if err != nil {
+			return err
+		}
 
-		// Only extract MIB files
-		if !mm.isMIBFile(header.Name) {
+		// Skip directories
+		if header.Typeflag == tar.TypeDir {
 			continue
 		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			return fmt.Errorf("archive entry %s is not a regular file", header.Name)
+		}
 
 		// Extract file
-		if err := mm.extractTarFile(tarReader, header, extractPath); err != nil {
+		if err := mm.extractEntry(filePath, header.Name, header.Size, tarReader, archive, budget, depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractRar extracts a RAR archive
+func (mm *MIBManager) extractRar(archivePath, extractPath string, archive *MIBArchive, budget *mibExtractBudget, depth int) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rarReader, err := rardecode.NewReader(file, "")
+	if err != nil {
+		return err
+	}
+
+	for {
+		header, err := rarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
 			return err
 		}
 
-		extractedCount++
-		archive.ExtractedFiles = extractedCount
-		db.Save(archive)
+		if err := budget.addEntry(header.Name); err != nil {
+			return err
+		}
+		if header.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %s is a symbolic link", header.Name)
+		}
+		filePath, err := safeExtractPath(extractPath, header.Name)
+		if err != nil {
+			return err
+		}
+
+		// Skip directories
+		if header.IsDir {
+			continue
+		}
+		if !header.Mode().IsRegular() {
+			return fmt.Errorf("archive entry %s is not a regular file", header.Name)
+		}
+
+		size := header.UnPackedSize
+		if header.UnKnownSize {
+			size = 0
+		}
+		if err := mm.extractEntry(filePath, header.Name, size, rarReader, archive, budget, depth); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// extractZipFile extracts a single file from ZIP
-func (mm *MIBManager) extractZipFile(file *zip.File, extractPath string) error {
-	reader, err := file.Open()
+// extract7z extracts a 7-Zip archive
+func (mm *MIBManager) extract7z(archivePath, extractPath string, archive *MIBArchive, budget *mibExtractBudget, depth int) error {
+	reader, err := sevenzip.OpenReader(archivePath)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
-	// Create file path
-	filePath := filepath.Join(extractPath, file.Name)
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return err
+	if depth == 0 {
+		archive.TotalFiles = len(reader.File)
+		db.Save(archive)
 	}
 
-	// Create file
-	outFile, err := os.Create(filePath)
+	for i, file := range reader.File {
+		// Update progress
+		if depth == 0 {
+			archive.Progress = (i * 100) / len(reader.File)
+			db.Save(archive)
+		}
+
+		if err := budget.addEntry(file.Name); err != nil {
+			return err
+		}
+		if file.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %s is a symbolic link", file.Name)
+		}
+		filePath, err := safeExtractPath(extractPath, file.Name)
+		if err != nil {
+			return err
+		}
+
+		// Skip directories
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			return fmt.Errorf("archive entry %s is not a regular file", file.Name)
+		}
+
+		entry, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = mm.extractEntry(filePath, file.Name, int64(file.UncompressedSize), entry, archive, budget, depth)
+		entry.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractZipFile extracts a single file from ZIP
+func (mm *MIBManager) extractZipFile(file *zip.File, filePath string, archive *MIBArchive, budget *mibExtractBudget, depth int) error {
+	reader, err := file.Open()
 	if err != nil {
 		return err
 	}
-	defer outFile.Close()
+	defer reader.Close()
 
-	// Copy content
-	_, err = io.Copy(outFile, reader)
-	return err
+	return mm.extractEntry(filePath, file.Name, int64(file.UncompressedSize64), reader, archive, budget, depth)
 }
 
-// extractTarFile extracts a single file from tar
-func (mm *MIBManager) extractTarFile(tarReader *tar.Reader, header *tar.Header, extractPath string) error {
-	// Create file path
-	filePath := filepath.Join(extractPath, header.Name)
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+// extractEntry writes one archive entry to filePath if it is a MIB file or
+// may be a nested archive. Nested archives, recognised by their content, are
+// expanded next to it within the same budget.
+func (mm *MIBManager) extractEntry(filePath, name string, size int64, r io.Reader, archive *MIBArchive, budget *mibExtractBudget, depth int) error {
+	isMIB := mm.isMIBFile(name)
+	if !isMIB && !isMIBArchiveName(name) {
+		return nil
+	}
+	if err := budget.extract(filePath, name, size, r); err != nil {
 		return err
 	}
 
-	// Create file
-	outFile, err := os.Create(filePath)
+	format, err := detectMIBArchiveFile(filePath)
 	if err != nil {
 		return err
 	}
-	defer outFile.Close()
+	if format != "" {
+		defer os.Remove(filePath)
+		if depth+1 > maxMIBArchiveDepth {
+			return fmt.Errorf("archive entry %s nests archives more than %d levels deep", name, maxMIBArchiveDepth)
+		}
+		return mm.extractArchiveFile(filePath, name, filePath+".d", archive, budget, depth+1)
+	}
+	if !isMIB {
+		return os.Remove(filePath)
+	}
 
-	// Copy content
-	_, err = io.Copy(outFile, tarReader)
-	return err
+	archive.ExtractedFiles++
+	db.Save(archive)
+	return nil
 }
 
 // isMIBFile checks if a file is a MIB file
@@ -322,7 +426,7 @@ func (mm *MIBManager) isMIBFile(filename string) bool {
 
 // scanExtractedFiles scans extracted files and creates MIB records
 func (mm *MIBManager) scanExtractedFiles(extractPath string, archiveID uint) error {
-	return filepath.Walk(extractPath, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(extractPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -338,68 +442,244 @@ func (mm *MIBManager) scanExtractedFiles(extractPath string, archiveID uint) err
 		}
 
 		// Create MIB file record
+		sourcePath, _ := filepath.Rel(extractPath, path)
 		mibFile := MIBFile{
 			Name:        strings.TrimSuffix(info.Name(), filepath.Ext(info.Name())),
 			Filename:    info.Name(),
 			Size:        info.Size(),
 			FilePath:    path,
 			Status:      "pending",
+			Source:      "archive",
+			SourcePath:  filepath.ToSlash(sourcePath),
+			ArchiveID:   &archiveID,
 			UploadedAt:  time.Now(),
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
 		}
 
-		// Parse MIB file to extract metadata
-		if err := mm.parseMIBFile(&mibFile); err != nil {
+		// Parse MIB file to extract metadata; imports are resolved once all
+		// files of the archive are known
+		if _, err := mm.parseMIBFile(&mibFile); err != nil {
 			mibFile.Status = "error"
-		} else {
-			mibFile.Status = "validated"
 		}
 
-		// Save to database
-		return db.Create(&mibFile).Error
+		// Save to database unless the same file was extracted before
+		result, _, err := mm.registerMIBFile(&mibFile)
+		if err != nil {
+			return err
+		}
+		if result == "duplicate" {
+			return os.Remove(path)
+		}
+		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	return mm.ResolveImports()
 }
 
-// parseMIBFile parses a MIB file to extract metadata
-func (mm *MIBManager) parseMIBFile(mibFile *MIBFile) error {
-	// Read file content
-	content, err := os.ReadFile(mibFile.FilePath)
-	if err != nil {
+// storeMIBObjects replaces the OID tree rows recorded for a MIB file
+func (mm *MIBManager) storeMIBObjects(mibFile *MIBFile, module *MIBModule) error {
+	if err := db.Where("mib_file_id = ?", mibFile.ID).Delete(&MIBObject{}).Error; err != nil {
 		return err
 	}
 
-	// Basic MIB parsing (simplified)
-	contentStr := string(content)
-	
-	// Extract vendor from file content
-	if strings.Contains(strings.ToUpper(contentStr), "CISCO") {
-		mibFile.Vendor = "Cisco"
-		mibFile.Category = "Network Equipment"
-	} else if strings.Contains(strings.ToUpper(contentStr), "HUAWEI") {
-		mibFile.Vendor = "Huawei"
-		mibFile.Category = "Network Equipment"
-	} else if strings.Contains(strings.ToUpper(contentStr), "HP") {
-		mibFile.Vendor = "HP"
-		mibFile.Category = "Printers"
-	}
-
-	// Count OIDs (simplified)
-	mibFile.OIDCount = strings.Count(contentStr, "OBJECT-TYPE")
-
-	// Extract description (first comment block)
-	lines := strings.Split(contentStr, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(strings.TrimSpace(line), "--") {
-			desc := strings.TrimPrefix(strings.TrimSpace(line), "--")
-			if len(desc) > 10 && mibFile.Description == "" {
-				mibFile.Description = strings.TrimSpace(desc)
-				break
+	var objects []MIBObject
+	for _, node := range module.Nodes {
+		// Nodes hanging off unknown imports have no place in the tree yet
+		if node.OID == "" {
+			continue
+		}
+		objects = append(objects, newMIBObject(mibFile.ID, module.Name, node))
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+	return db.CreateInBatches(objects, 500).Error
+}
+
+// newMIBObject converts a parsed node into its database row
+func newMIBObject(mibFileID uint, moduleName string, node *MIBNode) MIBObject {
+	object := MIBObject{
+		MIBFileID:   mibFileID,
+		Module:      moduleName,
+		Name:        node.Name,
+		OID:         node.OID,
+		ParentOID:   parentOID(node.OID),
+		SortKey:     oidSortKey(node.OID),
+		Kind:        node.Kind,
+		Syntax:      node.Syntax.String(),
+		Access:      node.Access,
+		Status:      node.Status,
+		Units:       node.Units,
+		Description: node.Description,
+		Augments:    node.Augments,
+		CreatedAt:   time.Now(),
+	}
+	if len(node.Index) > 0 {
+		index, _ := json.Marshal(node.Index)
+		object.Index = string(index)
+	}
+	if node.Syntax != nil && len(node.Syntax.Enums) > 0 {
+		enums, _ := json.Marshal(node.Syntax.Enums)
+		object.Enums = string(enums)
+	}
+	if len(node.Objects) > 0 {
+		objects, _ := json.Marshal(node.Objects)
+		object.Objects = string(objects)
+	}
+	return object
+}
+
+// parentOID strips the last arc of a numeric OID
+func parentOID(oid string) string {
+	if i := strings.LastIndexByte(oid, '.'); i >= 0 {
+		return oid[:i]
+	}
+	return ""
+}
+
+// oidSortKey zero-pads every arc so that string order matches OID order
+func oidSortKey(oid string) string {
+	arcs := strings.Split(oid, ".")
+	for i, arc := range arcs {
+		arcs[i] = fmt.Sprintf("%010s", arc)
+	}
+	return strings.Join(arcs, ".")
+}
+
+// mibVendor describes a private enterprise number registered with IANA
+type mibVendor struct {
+	Name     string
+	Category string
+}
+
+// mibVendors maps enterprise numbers under 1.3.6.1.4.1 to vendors
+var mibVendors = map[string]mibVendor{
+	"9":     {"Cisco", "Network Equipment"},
+	"11":    {"HP", "Servers"},
+	"43":    {"3Com", "Network Equipment"},
+	"311":   {"Microsoft", "Servers"},
+	"318":   {"APC", "Power"},
+	"534":   {"Eaton", "Power"},
+	"674":   {"Dell", "Servers"},
+	"1916":  {"Extreme Networks", "Network Equipment"},
+	"1991":  {"Brocade", "Network Equipment"},
+	"2011":  {"Huawei", "Network Equipment"},
+	"2021":  {"Net-SNMP", "Servers"},
+	"2636":  {"Juniper", "Network Equipment"},
+	"3375":  {"F5", "Network Equipment"},
+	"4526":  {"Netgear", "Network Equipment"},
+	"6027":  {"Dell Force10", "Network Equipment"},
+	"6527":  {"Nokia", "Network Equipment"},
+	"6876":  {"VMware", "Servers"},
+	"8072":  {"Net-SNMP", "Servers"},
+	"12356": {"Fortinet", "Security"},
+	"14179": {"Cisco Airespace", "Wireless"},
+	"14823": {"Aruba", "Wireless"},
+	"14988": {"MikroTik", "Network Equipment"},
+	"25461": {"Palo Alto Networks", "Security"},
+	"25506": {"H3C", "Network Equipment"},
+	"30065": {"Arista", "Network Equipment"},
+	"41112": {"Ubiquiti", "Wireless"},
+}
+
+// parseMIBFile parses a MIB file to extract metadata and resolve its OIDs
+func (mm *MIBManager) parseMIBFile(mibFile *MIBFile) (*MIBModule, error) {
+	content, err := readMIBFile(mibFile)
+	if err != nil {
+		return nil, err
+	}
+	mibFile.ContentHash = mibContentHash(content)
+
+	module, err := ParseMIB(content)
+	if err != nil {
+		mibFile.Description = err.Error()
+		applyMIBDiagnostics(mibFile, mibSyntaxDiagnostics(err))
+		return nil, err
+	}
+	module.ResolveOIDs(nil)
+
+	mibFile.ModuleName = module.Name
+	mibFile.SMIVersion = module.SMIVersion
+	mibFile.LastUpdated = module.LastUpdated
+	mibFile.Organization = module.Organization
+	mibFile.ContactInfo = module.ContactInfo
+	mibFile.OIDCount = len(module.Nodes)
+
+	revisions, _ := json.Marshal(module.Revisions)
+	mibFile.Revisions = string(revisions)
+	imports, _ := json.Marshal(module.Imports)
+	mibFile.Imports = string(imports)
+	mibFile.Version = module.LastUpdated
+	if len(module.Revisions) > 0 {
+		mibFile.Version = module.Revisions[0].Date
+	}
+
+	if vendor, ok := detectMIBVendor(module); ok {
+		mibFile.Vendor = vendor.Name
+		mibFile.Category = vendor.Category
+	}
+
+	mibFile.Description = strings.TrimSpace(module.Description)
+	if mibFile.Description == "" {
+		// SMIv1 modules have no MODULE-IDENTITY; fall back to the first comment
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "--") {
+				desc := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-"))
+				if len(desc) > 10 {
+					mibFile.Description = desc
+					break
+				}
 			}
 		}
 	}
 
-	return nil
+	return module, nil
+}
+
+// detectMIBVendor derives the vendor from the enterprise subtree the module
+// defines its objects under, falling back to the ORGANIZATION clause.
+func detectMIBVendor(module *MIBModule) (mibVendor, bool) {
+	enterprisePrefix := smiRootOIDs["enterprises"] + "."
+	for _, node := range module.Nodes {
+		if !strings.HasPrefix(node.OID, enterprisePrefix) {
+			continue
+		}
+		number := strings.SplitN(strings.TrimPrefix(node.OID, enterprisePrefix), ".", 2)[0]
+		if vendor, ok := mibVendors[number]; ok {
+			return vendor, true
+		}
+	}
+
+	for _, node := range module.Nodes {
+		if strings.HasPrefix(node.OID, smiRootOIDs["mib-2"]+".") || strings.HasPrefix(node.OID, smiRootOIDs["snmpModules"]+".") {
+			return mibVendor{Name: "IETF", Category: "Standard"}, true
+		}
+	}
+
+	org := strings.ToLower(module.Organization)
+	if org == "" {
+		return mibVendor{}, false
+	}
+	numbers := make([]int, 0, len(mibVendors))
+	for number := range mibVendors {
+		n, _ := strconv.Atoi(number)
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	for _, n := range numbers {
+		vendor := mibVendors[strconv.Itoa(n)]
+		if strings.Contains(org, strings.ToLower(vendor.Name)) {
+			return vendor, true
+		}
+	}
+	if strings.Contains(org, "ietf") {
+		return mibVendor{Name: "IETF", Category: "Standard"}, true
+	}
+	return mibVendor{}, false
 }
 
 // API Handlers for MIB management
@@ -407,6 +687,9 @@ func (mm *MIBManager) parseMIBFile(mibFile *MIBFile) error {
 func getMIBServerPaths(c *gin.Context) {
 	var paths []MIBServerPath
 	db.Find(&paths)
+	for i := range paths {
+		paths[i].redact()
+	}
 	c.JSON(200, paths)
 }
 
@@ -417,6 +700,14 @@ func createMIBServerPath(c *gin.Context) {
 		return
 	}
 
+	if path.Type == "" {
+		path.Type = "ssh"
+	}
+	if err := path.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
 	path.CreatedAt = time.Now()
 	path.UpdatedAt = time.Now()
 
@@ -425,6 +716,7 @@ func createMIBServerPath(c *gin.Context) {
 		return
 	}
 
+	path.redact()
 	c.JSON(201, path)
 }
 
@@ -437,15 +729,14 @@ func scanMIBServerPath(c *gin.Context) {
 		return
 	}
 
-	// Start scanning in background
+	// Start scanning in background; the outcome is recorded as a sync run
+	if !beginMIBSync(path.ID) {
+		c.JSON(409, gin.H{"error": errMIBSyncRunning.Error()})
+		return
+	}
 	go func() {
-		mibManager := NewMIBManager()
-		if err := mibManager.ScanServerPath(path); err != nil {
-			path.Status = "error"
-		} else {
-			path.Status = "connected"
-		}
-		db.Save(&path)
+		defer endMIBSync(path.ID)
+		NewMIBManager().scanServerPath(&path, "manual")
 	}()
 
 	c.JSON(200, gin.H{
@@ -467,7 +758,13 @@ func uploadMIBArchive(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "No file uploaded"})
 		return
 	}
+	storeMIBArchive(c, file)
+}
 
+// storeMIBArchive saves an uploaded archive and records it for extraction.
+// uploadMIBFile passes single archives here whichever form field they were
+// sent in.
+func storeMIBArchive(c *gin.Context, file *multipart.FileHeader) {
 	// Create upload directory
 	uploadDir := "./uploads/archives"
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
@@ -476,7 +773,7 @@ func uploadMIBArchive(c *gin.Context) {
 	}
 
 	// Save uploaded file
-	filename := fmt.Sprintf("%d_%s", time.Now().Unix(), file.Filename)
+	filename := fmt.Sprintf("%d_%s", time.Now().Unix(), filepath.Base(file.Filename))
 	filepath := filepath.Join(uploadDir, filename)
 	
 	if err := c.SaveUploadedFile(file, filepath); err != nil {
@@ -484,10 +781,22 @@ func uploadMIBArchive(c *gin.Context) {
 		return
 	}
 
+	// Trust the content rather than the suffix
+	format, err := detectMIBArchiveFile(filepath)
+	if err == nil && format == "" && strings.HasSuffix(strings.ToLower(file.Filename), ".tar") {
+		format = mibArchiveTar
+	}
+	if err != nil || format == "" {
+		os.Remove(filepath)
+		c.JSON(400, gin.H{"error": "Unsupported archive format"})
+		return
+	}
+
 	// Create archive record
 	archive := MIBArchive{
 		Name:         filename,
 		OriginalName: file.Filename,
+		Format:       format,
 		Size:         file.Size,
 		FilePath:     filepath,
 		Status:       "uploaded",
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Archive formats recognised by their magic bytes
+const (
+	mibArchiveZip   = "zip"
+	mibArchiveTar   = "tar"
+	mibArchiveGzip  = "gzip"
+	mibArchiveBzip2 = "bzip2"
+	mibArchiveXz    = "xz"
+	mibArchiveRar   = "rar"
+	mibArchive7z    = "7z"
+)
+
+// mibArchiveMagicSize is how much of a file format detection looks at; the
+// tar magic sits at offset 257
+const mibArchiveMagicSize = 512
+
+// maxMIBArchiveDepth limits how deeply archives may be nested in each other
+const maxMIBArchiveDepth = 3
+
+// mibArchiveMagics maps leading bytes to the archive format they introduce
+var mibArchiveMagics = []struct {
+	magic  []byte
+	format string
+}{
+	{[]byte("PK\x03\x04"), mibArchiveZip},
+	{[]byte("PK\x05\x06"), mibArchiveZip}, // empty archive
+	{[]byte("\x1f\x8b"), mibArchiveGzip},
+	{[]byte("BZh"), mibArchiveBzip2},
+	{[]byte("\xfd7zXZ\x00"), mibArchiveXz},
+	{[]byte("Rar!\x1a\x07"), mibArchiveRar}, // RAR 4 and 5
+	{[]byte("7z\xbc\xaf\x27\x1c"), mibArchive7z},
+}
+
+// mibArchiveExts are the file name suffixes of supported archives
+var mibArchiveExts = []string{
+	".zip", ".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tbz", ".tar.xz", ".txz",
+	".gz", ".bz2", ".xz", ".rar", ".7z",
+}
+
+// isMIBArchiveName reports whether a file name has an archive extension
+func isMIBArchiveName(filename string) bool {
+	lower := strings.ToLower(filename)
+	for _, ext := range mibArchiveExts {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectMIBArchiveFormat returns the archive format the leading bytes of a
+// file belong to, or "" when they are not an archive
+func detectMIBArchiveFormat(head []byte) string {
+	for _, m := range mibArchiveMagics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.format
+		}
+	}
+	if len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")) {
+		return mibArchiveTar
+	}
+	return ""
+}
+
+// detectMIBArchiveFile detects the archive format of a file on disk
+func detectMIBArchiveFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, mibArchiveMagicSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return detectMIBArchiveFormat(head[:n]), nil
+}
+
+// trimMIBCompressionExt returns the name of the file a compressed file
+// expands to, e.g. IF-MIB.my for IF-MIB.my.gz
+func trimMIBCompressionExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".gz", ".bz2", ".xz"} {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// mibArchiveLimitsSettingKey is the Setting holding MIBArchiveLimits
+const mibArchiveLimitsSettingKey = "mib_archive_limits"
+
+// MIBArchiveLimits bounds what an archive may expand to, guarding against
+// decompression bombs
+type MIBArchiveLimits struct {
+	MaxEntries   int   `json:"max_entries"`    // entries of any kind, directories included
+	MaxEntrySize int64 `json:"max_entry_size"` // uncompressed bytes of one extracted file
+	MaxTotalSize int64 `json:"max_total_size"` // uncompressed bytes of all extracted files
+}
+
+// defaultMIBArchiveLimits returns the limits used until others are saved
+func defaultMIBArchiveLimits() MIBArchiveLimits {
+	return MIBArchiveLimits{
+		MaxEntries:   10000,
+		MaxEntrySize: maxMIBFileSize,
+		MaxTotalSize: 512 << 20,
+	}
+}
+
+// Validate checks that all limits are positive
+func (l MIBArchiveLimits) Validate() error {
+	if l.MaxEntries <= 0 || l.MaxEntrySize <= 0 || l.MaxTotalSize <= 0 {
+		return fmt.Errorf("archive limits must be positive")
+	}
+	return nil
+}
+
+// loadMIBArchiveLimits reads the archive limits, falling back to the defaults
+func loadMIBArchiveLimits() MIBArchiveLimits {
+	limits := defaultMIBArchiveLimits()
+	if !loadSetting(mibArchiveLimitsSettingKey, &limits) || limits.Validate() != nil {
+		return defaultMIBArchiveLimits()
+	}
+	return limits
+}
+
+// mibExtractBudget tracks how much of the limits an extraction has used
+type mibExtractBudget struct {
+	limits  MIBArchiveLimits
+	entries int
+	total   int64
+}
+
+func newMIBExtractBudget(limits MIBArchiveLimits) *mibExtractBudget {
+	return &mibExtractBudget{limits: limits}
+}
+
+// addEntry counts one archive entry against the entry limit
+func (b *mibExtractBudget) addEntry(name string) error {
+	b.entries++
+	if b.entries > b.limits.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries", b.limits.MaxEntries)
+	}
+	return nil
+}
+
+// extract writes an entry to filePath, enforcing the size limits on the
+// bytes actually read since declared sizes cannot be trusted
+func (b *mibExtractBudget) extract(filePath, name string, declared int64, r io.Reader) error {
+	if declared > b.limits.MaxEntrySize {
+		return fmt.Errorf("archive entry %s is larger than %d bytes", name, b.limits.MaxEntrySize)
+	}
+	if b.total+declared > b.limits.MaxTotalSize {
+		return fmt.Errorf("archive expands to more than %d bytes", b.limits.MaxTotalSize)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	outFile, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	allowed := b.limits.MaxEntrySize
+	if remaining := b.limits.MaxTotalSize - b.total; remaining < allowed {
+		allowed = remaining
+	}
+	written, err := io.Copy(outFile, io.LimitReader(r, allowed+1))
+	b.total += written
+	if err != nil {
+		return err
+	}
+	if written > allowed {
+		if written > b.limits.MaxEntrySize {
+			return fmt.Errorf("archive entry %s is larger than %d bytes", name, b.limits.MaxEntrySize)
+		}
+		return fmt.Errorf("archive expands to more than %d bytes", b.limits.MaxTotalSize)
+	}
+	return nil
+}
+
+// safeExtractPath returns where an archive entry is extracted to, rejecting
+// absolute names and names that climb out of extractPath (zip-slip)
+func safeExtractPath(extractPath, name string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+	if strings.ContainsRune(name, 0) || filepath.IsAbs(cleaned) || filepath.VolumeName(cleaned) != "" ||
+		cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %s escapes the extract directory", name)
+	}
+	return filepath.Join(extractPath, cleaned), nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSafeExtractPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // relative to the extract directory, "" when rejected
+	}{
+		{"IF-MIB.txt", "IF-MIB.txt"},
+		{"vendor/mibs/FOO-MIB.mib", "vendor/mibs/FOO-MIB.mib"},
+		{"./vendor/FOO-MIB", "vendor/FOO-MIB"},
+		{"vendor/../FOO-MIB", "FOO-MIB"},
+		{"../FOO-MIB", ""},
+		{"vendor/../../FOO-MIB", ""},
+		{"..", ""},
+		{`..\..\FOO-MIB`, ""},
+		{"/etc/passwd", ""},
+		{"FOO\x00-MIB", ""},
+	}
+	for _, tt := range tests {
+		got, err := safeExtractPath("/extract", tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%q: got %s, want it rejected", tt.name, got)
+			}
+			continue
+		}
+		if want := filepath.Join("/extract", filepath.FromSlash(tt.want)); err != nil || got != want {
+			t.Errorf("%q: got %s, %v; want %s", tt.name, got, err, want)
+		}
+	}
+}
+
+func TestDetectMIBArchiveFormat(t *testing.T) {
+	var tarHead bytes.Buffer
+	tw := tar.NewWriter(&tarHead)
+	tw.WriteHeader(&tar.Header{Name: "IF-MIB.txt", Mode: 0644, Size: 0, Typeflag: tar.TypeReg, Format: tar.FormatUSTAR})
+	tw.Close()
+
+	tests := []struct {
+		head []byte
+		want string
+	}{
+		{[]byte("PK\x03\x04rest"), mibArchiveZip},
+		{[]byte("PK\x05\x06"), mibArchiveZip},
+		{[]byte("\x1f\x8b\x08"), mibArchiveGzip},
+		{[]byte("BZh91AY"), mibArchiveBzip2},
+		{[]byte("\xfd7zXZ\x00\x00"), mibArchiveXz},
+		{[]byte("Rar!\x1a\x07\x01\x00"), mibArchiveRar},
+		{[]byte("7z\xbc\xaf\x27\x1c\x00"), mibArchive7z},
+		{tarHead.Bytes(), mibArchiveTar},
+		{[]byte("IF-MIB DEFINITIONS ::= BEGIN"), ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := detectMIBArchiveFormat(tt.head); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.head[:min(len(tt.head), 8)], got, tt.want)
+		}
+	}
+}
+
+// testArchiveEntry is a file, directory or link to put in a test archive
+type testArchiveEntry struct {
+	name     string
+	body     string
+	typeflag byte // tar type, TypeReg when zero
+	linkname string
+}
+
+func buildTestZip(t *testing.T, entries []testArchiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		switch e.typeflag {
+		case tar.TypeSymlink:
+			header.SetMode(os.ModeSymlink | 0777)
+		case tar.TypeDir:
+			header.SetMode(os.ModeDir | 0755)
+		default:
+			header.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.body + e.linkname))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTestTarGz(t *testing.T, entries []testArchiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		typeflag := e.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		header := &tar.Header{Name: e.name, Mode: 0644, Typeflag: typeflag, Linkname: e.linkname}
+		if typeflag == tar.TypeReg {
+			header.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestExtractArchiveGuards(t *testing.T) {
+	mib := "TEST-MIB DEFINITIONS ::= BEGIN END\n"
+	big := strings.Repeat("-- padding\n", 1000)
+	limits := MIBArchiveLimits{MaxEntries: 5, MaxEntrySize: 4096, MaxTotalSize: 6000}
+
+	nested := buildTestZip(t, []testArchiveEntry{{name: "IF-MIB.txt", body: mib}})
+	for i := 0; i <= maxMIBArchiveDepth; i++ {
+		nested = buildTestZip(t, []testArchiveEntry{{name: "inner.zip", body: string(nested)}})
+	}
+
+	tests := []struct {
+		name     string
+		archive  []byte
+		filename string
+		err      string // "" when extraction succeeds
+		files    []string
+	}{
+		{"zip", buildTestZip(t, []testArchiveEntry{{name: "mibs/", typeflag: tar.TypeDir}, {name: "mibs/IF-MIB.txt", body: mib}, {name: "README.md", body: "skipped"}}),
+			"mibs.zip", "", []string{"mibs/IF-MIB.txt"}},
+		{"tar.gz", buildTestTarGz(t, []testArchiveEntry{{name: "mibs/IF-MIB.txt", body: mib}}),
+			"mibs.tgz", "", []string{"mibs/IF-MIB.txt"}},
+		{"single gzip file", gzipBytes(t, mib), "IF-MIB.txt.gz", "", []string{"IF-MIB.txt"}},
+		{"zip-slip zip", buildTestZip(t, []testArchiveEntry{{name: "../../evil-MIB.txt", body: mib}}),
+			"evil.zip", "escapes the extract directory", nil},
+		{"zip-slip tar", buildTestTarGz(t, []testArchiveEntry{{name: "/tmp/evil-MIB.txt", body: mib}}),
+			"evil.tgz", "escapes the extract directory", nil},
+		{"zip symlink", buildTestZip(t, []testArchiveEntry{{name: "link-MIB.txt", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}}),
+			"link.zip", "symbolic link", nil},
+		{"tar symlink", buildTestTarGz(t, []testArchiveEntry{{name: "link-MIB.txt", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}}),
+			"link.tgz", "symbolic link", nil},
+		{"tar hard link", buildTestTarGz(t, []testArchiveEntry{{name: "link-MIB.txt", typeflag: tar.TypeLink, linkname: "/etc/passwd"}}),
+			"link.tgz", "hard link", nil},
+		{"tar device", buildTestTarGz(t, []testArchiveEntry{{name: "dev-MIB.txt", typeflag: tar.TypeChar}}),
+			"dev.tgz", "not a regular file", nil},
+		{"too many entries", buildTestZip(t, []testArchiveEntry{{name: "a/", typeflag: tar.TypeDir}, {name: "b/", typeflag: tar.TypeDir},
+			{name: "c/", typeflag: tar.TypeDir}, {name: "d/", typeflag: tar.TypeDir}, {name: "e/", typeflag: tar.TypeDir}, {name: "f/", typeflag: tar.TypeDir}}),
+			"many.zip", "more than 5 entries", nil},
+		{"entry bomb", buildTestZip(t, []testArchiveEntry{{name: "BIG-MIB.txt", body: big}}),
+			"bomb.zip", "larger than 4096 bytes", nil},
+		{"single file bomb", gzipBytes(t, big), "BIG-MIB.txt.gz", "larger than 4096 bytes", nil},
+		{"total bomb", buildTestTarGz(t, []testArchiveEntry{{name: "A-MIB.txt", body: big[:4000]}, {name: "B-MIB.txt", body: big[:4000]}}),
+			"total.tgz", "expands to more than 6000 bytes", nil},
+		{"nested too deep", nested, "nested.zip", "nests archives more than", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, tt.filename)
+			if err := os.WriteFile(archivePath, tt.archive, 0644); err != nil {
+				t.Fatal(err)
+			}
+			extractPath := filepath.Join(dir, "extract")
+			archive := MIBArchive{OriginalName: tt.filename}
+			err := NewMIBManager().extractArchiveFile(archivePath, tt.filename, extractPath, &archive, newMIBExtractBudget(limits), 0)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil-MIB.txt")); err == nil {
+					t.Errorf("entry was written outside the extract directory")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			filepath.Walk(extractPath, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					rel, _ := filepath.Rel(extractPath, path)
+					files = append(files, filepath.ToSlash(rel))
+				}
+				return nil
+			})
+			if strings.Join(files, ",") != strings.Join(tt.files, ",") {
+				t.Errorf("extracted %v, want %v", files, tt.files)
+			}
+		})
+	}
+
+}
+
+func gzipBytes(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(content))
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
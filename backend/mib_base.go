@@ -0,0 +1,86 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// baseMIBs holds the IETF modules every vendor MIB builds upon. They are
+// registered with Source "system" and cannot be deleted through the API.
+//
+//go:embed mibs/base/*.txt
+var baseMIBs embed.FS
+
+// baseMIBDir is the directory of baseMIBs holding the module files
+const baseMIBDir = "mibs/base"
+
+// readMIBFile returns the content of a stored MIB file. Files of the
+// "system" source are read from the embedded base set.
+func readMIBFile(mibFile *MIBFile) ([]byte, error) {
+	if mibFile.Source == "system" {
+		return baseMIBs.ReadFile(mibFile.FilePath)
+	}
+	return os.ReadFile(mibFile.FilePath)
+}
+
+// LoadBaseMIBs registers the embedded base MIBs in the MIB store, refreshing
+// rows left by an older binary, and re-resolves imports across all files.
+func (mm *MIBManager) LoadBaseMIBs() error {
+	entries, err := fs.ReadDir(baseMIBs, baseMIBDir)
+	if err != nil {
+		return err
+	}
+
+	var existing []MIBFile
+	if err := db.Where("source = ?", "system").Find(&existing).Error; err != nil {
+		return err
+	}
+	stored := make(map[string]MIBFile, len(existing))
+	for _, file := range existing {
+		stored[file.FilePath] = file
+	}
+
+	for _, entry := range entries {
+		filePath := path.Join(baseMIBDir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		mibFile, ok := stored[filePath]
+		delete(stored, filePath)
+		if !ok {
+			mibFile = MIBFile{
+				Name:       strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())),
+				Filename:   entry.Name(),
+				FilePath:   filePath,
+				Source:     "system",
+				Status:     "pending",
+				UploadedAt: time.Now(),
+				CreatedAt:  time.Now(),
+			}
+		}
+		mibFile.Size = info.Size()
+		mibFile.UpdatedAt = time.Now()
+
+		if _, err := mm.parseMIBFile(&mibFile); err != nil {
+			return fmt.Errorf("failed to parse base MIB %s: %v", entry.Name(), err)
+		}
+		if err := db.Save(&mibFile).Error; err != nil {
+			return err
+		}
+	}
+
+	// Base modules dropped from this build
+	for _, file := range stored {
+		db.Where("mib_file_id = ?", file.ID).Delete(&MIBObject{})
+		db.Delete(&file)
+	}
+
+	return mm.ResolveImports()
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rules of RFC 2578 section 10 (and RFC 2579 section 5 for textual
+// conventions) cited by diff changes
+const (
+	mibRuleRevisedDefinition   = "RFC 2578 10: a changed definition requires a new OBJECT IDENTIFIER"
+	mibRuleRevisedNotification = "RFC 2578 10.3: notifications may only revise STATUS, REFERENCE and DESCRIPTION"
+	mibRuleRemovedDefinition   = "RFC 2578 10: definitions must not be removed, only made obsolete"
+	mibRuleRenamed             = "RFC 2578 10.2: changing the descriptor of an object is a semantic change"
+	mibRuleRenumbered          = "RFC 2578 10.2: an object keeps its OBJECT IDENTIFIER"
+	mibRuleEnumsAdded          = "RFC 2578 10.2(1): enumerations and named bits may be added or relabelled"
+	mibRuleEquivalentTC        = "RFC 2578 10.2(2): SYNTAX may be replaced by an equivalent textual convention"
+	mibRuleStatusRevised       = "RFC 2578 10.2(3): STATUS may move from current to deprecated to obsolete"
+	mibRuleDefValUpdated       = "RFC 2578 10.2(4): DEFVAL may be added or updated"
+	mibRuleReferenceUpdated    = "RFC 2578 10.2(5): REFERENCE may be added or updated"
+	mibRuleUnitsAdded          = "RFC 2578 10.2(6): UNITS may be added"
+	mibRuleColumnsAppended     = "RFC 2578 10.2(7): columns may be added at the end of a row"
+	mibRuleDescription         = "RFC 2578 10.2(8): DESCRIPTION may be clarified"
+	mibRuleNewDefinition       = "RFC 2578 10.2(9): new objects may be defined under unassigned OIDs"
+	mibRuleDisplayHintAdded    = "RFC 2579 5: DISPLAY-HINT may be added"
+)
+
+// MIBRevisionRef identifies one side of a MIB diff
+type MIBRevisionRef struct {
+	ID       uint   `json:"id,omitempty"` // 0 for an uploaded file that is not stored
+	Module   string `json:"module"`
+	Version  string `json:"version"`
+	Filename string `json:"filename"`
+}
+
+// MIBObjectRef names a definition that exists on one side of a diff only
+type MIBObjectRef struct {
+	Name       string `json:"name"`
+	OID        string `json:"oid,omitempty"`
+	Kind       string `json:"kind"` // node kind, textual-convention or type
+	Status     string `json:"status,omitempty"`
+	Compatible bool   `json:"compatible"`
+	Rule       string `json:"rule"`
+}
+
+// MIBRenaming is a definition whose descriptor changed while its OID stayed
+type MIBRenaming struct {
+	OID  string `json:"oid"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	Rule string `json:"rule"`
+}
+
+// MIBRenumbering is a definition whose OID changed while its name stayed
+type MIBRenumbering struct {
+	Name    string `json:"name"`
+	FromOID string `json:"from_oid"`
+	ToOID   string `json:"to_oid"`
+	Rule    string `json:"rule"`
+}
+
+// MIBFieldChange is one clause of a definition that differs between revisions
+type MIBFieldChange struct {
+	Field      string `json:"field"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Compatible bool   `json:"compatible"`
+	Rule       string `json:"rule"`
+}
+
+// MIBObjectChange lists the changed clauses of a definition. It is
+// compatible when every change is.
+type MIBObjectChange struct {
+	Name       string           `json:"name"`
+	OID        string           `json:"oid,omitempty"`
+	Kind       string           `json:"kind"`
+	Compatible bool             `json:"compatible"`
+	Changes    []MIBFieldChange `json:"changes"`
+}
+
+// MIBDiffSummary counts the entries of a MIBDiff
+type MIBDiffSummary struct {
+	Added      int `json:"added"`
+	Removed    int `json:"removed"`
+	Renamed    int `json:"renamed"`
+	Renumbered int `json:"renumbered"`
+	Deprecated int `json:"deprecated"`
+	Changed    int `json:"changed"`
+	Breaking   int `json:"breaking"`
+}
+
+// MIBDiff is the definition-level difference between two revisions of a
+// module. Compatible reports whether the newer revision only makes the
+// changes RFC 2578 section 10 allows without assigning new OIDs.
+type MIBDiff struct {
+	From       MIBRevisionRef    `json:"from"`
+	To         MIBRevisionRef    `json:"to"`
+	Compatible bool              `json:"compatible"`
+	Summary    MIBDiffSummary    `json:"summary"`
+	Added      []MIBObjectRef    `json:"added"`
+	Removed    []MIBObjectRef    `json:"removed"`
+	Renamed    []MIBRenaming     `json:"renamed"`
+	Renumbered []MIBRenumbering  `json:"renumbered"`
+	Deprecated []MIBObjectRef    `json:"deprecated"` // status moved to deprecated or obsolete
+	Changed    []MIBObjectChange `json:"changed"`
+}
+
+// mibStatusRank orders STATUS values; SMIv1 mandatory and optional count as current
+var mibStatusRank = map[string]int{
+	"":           0,
+	"current":    0,
+	"mandatory":  0,
+	"optional":   0,
+	"deprecated": 1,
+	"obsolete":   2,
+}
+
+// mibDiffer compares two revisions of a module, each resolved by resolver
+type mibDiffer struct {
+	from, to *MIBModule
+	resolver *MIBResolver
+	diff     MIBDiff
+}
+
+// DiffMIBModules compares two revisions of a module definition by
+// definition and grades each change by the rules of RFC 2578 section 10.
+// Both modules must have been resolved by resolver.
+func DiffMIBModules(from, to *MIBModule, resolver *MIBResolver) MIBDiff {
+	d := &mibDiffer{from: from, to: to, resolver: resolver}
+	d.diff = MIBDiff{
+		Added:      []MIBObjectRef{},
+		Removed:    []MIBObjectRef{},
+		Renamed:    []MIBRenaming{},
+		Renumbered: []MIBRenumbering{},
+		Deprecated: []MIBObjectRef{},
+		Changed:    []MIBObjectChange{},
+	}
+	d.diffNodes()
+	d.diffTypes()
+
+	diff := &d.diff
+	diff.Summary = MIBDiffSummary{
+		Added:      len(diff.Added),
+		Removed:    len(diff.Removed),
+		Renamed:    len(diff.Renamed),
+		Renumbered: len(diff.Renumbered),
+		Deprecated: len(diff.Deprecated),
+		Changed:    len(diff.Changed),
+	}
+	diff.Summary.Breaking = len(diff.Removed) + len(diff.Renamed) + len(diff.Renumbered)
+	for _, change := range diff.Changed {
+		if !change.Compatible {
+			diff.Summary.Breaking++
+		}
+	}
+	diff.Compatible = diff.Summary.Breaking == 0
+	return *diff
+}
+
+// diffNodes compares the OID-bearing definitions of both revisions
+func (d *mibDiffer) diffNodes() {
+	// Definitions that vanished under one name but kept their OID were renamed
+	renamedTo := make(map[string]string)
+	addedByOID := make(map[string]*MIBNode)
+	for _, node := range d.to.Nodes {
+		if node.OID != "" && d.from.Node(node.Name) == nil {
+			addedByOID[node.OID] = node
+		}
+	}
+
+	for _, node := range d.from.Nodes {
+		newer := d.to.Node(node.Name)
+		if newer == nil {
+			if renamed := addedByOID[node.OID]; node.OID != "" && renamed != nil {
+				renamedTo[renamed.Name] = node.Name
+				d.diff.Renamed = append(d.diff.Renamed, MIBRenaming{node.OID, node.Name, renamed.Name, mibRuleRenamed})
+				continue
+			}
+			d.diff.Removed = append(d.diff.Removed, MIBObjectRef{
+				Name: node.Name, OID: node.OID, Kind: node.Kind, Status: node.Status, Rule: mibRuleRemovedDefinition,
+			})
+			continue
+		}
+		if node.OID != "" && newer.OID != "" && node.OID != newer.OID {
+			d.diff.Renumbered = append(d.diff.Renumbered, MIBRenumbering{node.Name, node.OID, newer.OID, mibRuleRenumbered})
+		}
+		d.diffNode(node, newer)
+	}
+
+	for _, node := range d.to.Nodes {
+		if d.from.Node(node.Name) != nil || renamedTo[node.Name] != "" {
+			continue
+		}
+		d.diff.Added = append(d.diff.Added, MIBObjectRef{
+			Name: node.Name, OID: node.OID, Kind: node.Kind, Status: node.Status, Compatible: true, Rule: mibRuleNewDefinition,
+		})
+	}
+}
+
+// diffNode records the clause changes between two revisions of a node
+func (d *mibDiffer) diffNode(older, newer *MIBNode) {
+	revised := mibRuleRevisedDefinition
+	if older.Kind == "notification-type" || older.Kind == "trap-type" {
+		revised = mibRuleRevisedNotification
+	}
+	change := MIBObjectChange{Name: newer.Name, OID: newer.OID, Kind: newer.Kind, Compatible: true}
+	add := func(field, from, to string, compatible bool, rule string) {
+		if from == to {
+			return
+		}
+		if !compatible {
+			change.Compatible = false
+		}
+		change.Changes = append(change.Changes, MIBFieldChange{field, from, to, compatible, rule})
+	}
+
+	add("kind", older.Kind, newer.Kind, false, revised)
+	if older.Syntax.String() != newer.Syntax.String() {
+		compatible, rule := d.compareSyntax(older.Syntax, newer.Syntax)
+		if !compatible {
+			rule = revised
+		}
+		add("syntax", older.Syntax.String(), newer.Syntax.String(), compatible, rule)
+	}
+	add("access", older.Access, newer.Access, false, revised)
+	add("status", older.Status, newer.Status, mibStatusRank[newer.Status] >= mibStatusRank[older.Status], mibRuleStatusRevised)
+	add("units", older.Units, newer.Units, older.Units == "", mibRuleUnitsAdded)
+	add("index", formatMIBIndex(older), formatMIBIndex(newer), false, revised)
+	add("augments", older.Augments, newer.Augments, false, revised)
+	add("defval", older.DefVal, newer.DefVal, newer.DefVal != "", mibRuleDefValUpdated)
+	add("objects", strings.Join(older.Objects, ", "), strings.Join(newer.Objects, ", "), false, revised)
+	add("enterprise", older.Enterprise, newer.Enterprise, false, revised)
+	add("reference", normalizeMIBText(older.Reference), normalizeMIBText(newer.Reference), newer.Reference != "", mibRuleReferenceUpdated)
+	add("description", normalizeMIBText(older.Description), normalizeMIBText(newer.Description), true, mibRuleDescription)
+	if len(change.Changes) == 0 {
+		return
+	}
+
+	d.diff.Changed = append(d.diff.Changed, change)
+	if mibStatusRank[newer.Status] > mibStatusRank[older.Status] {
+		d.diff.Deprecated = append(d.diff.Deprecated, MIBObjectRef{
+			Name: newer.Name, OID: newer.OID, Kind: newer.Kind, Status: newer.Status, Compatible: true, Rule: mibRuleStatusRevised,
+		})
+	}
+}
+
+// diffTypes compares the textual conventions and other type assignments
+func (d *mibDiffer) diffTypes() {
+	for _, t := range d.from.Types {
+		newer := d.to.Type(t.Name)
+		if newer == nil {
+			d.diff.Removed = append(d.diff.Removed, MIBObjectRef{
+				Name: t.Name, Kind: mibTypeKind(t), Status: t.Status, Rule: mibRuleRemovedDefinition,
+			})
+			continue
+		}
+
+		change := MIBObjectChange{Name: t.Name, Kind: mibTypeKind(newer), Compatible: true}
+		add := func(field, from, to string, compatible bool, rule string) {
+			if from == to {
+				return
+			}
+			if !compatible {
+				change.Compatible = false
+			}
+			change.Changes = append(change.Changes, MIBFieldChange{field, from, to, compatible, rule})
+		}
+		if t.Syntax.String() != newer.Syntax.String() {
+			compatible, rule := d.compareSyntax(t.Syntax, newer.Syntax)
+			add("syntax", t.Syntax.String(), newer.Syntax.String(), compatible, rule)
+		}
+		add("display-hint", t.DisplayHint, newer.DisplayHint, t.DisplayHint == "", mibRuleDisplayHintAdded)
+		add("status", t.Status, newer.Status, mibStatusRank[newer.Status] >= mibStatusRank[t.Status], mibRuleStatusRevised)
+		add("description", normalizeMIBText(t.Description), normalizeMIBText(newer.Description), true, mibRuleDescription)
+		if len(change.Changes) > 0 {
+			d.diff.Changed = append(d.diff.Changed, change)
+		}
+	}
+
+	for _, t := range d.to.Types {
+		if d.from.Type(t.Name) == nil {
+			d.diff.Added = append(d.diff.Added, MIBObjectRef{
+				Name: t.Name, Kind: mibTypeKind(t), Status: t.Status, Compatible: true, Rule: mibRuleNewDefinition,
+			})
+		}
+	}
+}
+
+// compareSyntax reports whether replacing older by newer is an allowed
+// revision and which rule applies
+func (d *mibDiffer) compareSyntax(older, newer *MIBSyntax) (bool, string) {
+	if older == nil || newer == nil {
+		return false, mibRuleRevisedDefinition
+	}
+
+	if older.Base == newer.Base && older.SequenceOf == newer.SequenceOf &&
+		formatMIBRanges(older.Ranges) == formatMIBRanges(newer.Ranges) &&
+		formatMIBRanges(older.Sizes) == formatMIBRanges(newer.Sizes) {
+		// Conceptual rows may grow at the end
+		if older.Base == "SEQUENCE" && len(older.Enums) == 0 && len(newer.Enums) == 0 {
+			if mibFieldsPrefix(older.Fields, newer.Fields) {
+				return true, mibRuleColumnsAppended
+			}
+			return false, mibRuleRevisedDefinition
+		}
+		if len(older.Fields) == 0 && len(newer.Fields) == 0 && mibEnumsKept(older.Enums, newer.Enums) {
+			return true, mibRuleEnumsAdded
+		}
+		return false, mibRuleRevisedDefinition
+	}
+
+	// A type reference may replace an equivalent one
+	olderEff := (&mibValidator{module: d.from, resolver: d.resolver}).effectiveSyntax(older)
+	newerEff := (&mibValidator{module: d.to, resolver: d.resolver}).effectiveSyntax(newer)
+	if olderEff.Base != "" && olderEff.Base == newerEff.Base &&
+		formatMIBEnums(olderEff.Enums) == formatMIBEnums(newerEff.Enums) &&
+		formatMIBRanges(olderEff.Ranges) == formatMIBRanges(newerEff.Ranges) &&
+		formatMIBRanges(olderEff.Sizes) == formatMIBRanges(newerEff.Sizes) {
+		return true, mibRuleEquivalentTC
+	}
+	return false, mibRuleRevisedDefinition
+}
+
+// mibEnumsKept reports whether every value of older is still present in
+// newer, whatever its label
+func mibEnumsKept(older, newer []MIBEnum) bool {
+	values := make(map[int64]bool, len(newer))
+	for _, enum := range newer {
+		values[enum.Value] = true
+	}
+	for _, enum := range older {
+		if !values[enum.Value] {
+			return false
+		}
+	}
+	return true
+}
+
+// mibFieldsPrefix reports whether the SEQUENCE members of older start newer
+func mibFieldsPrefix(older, newer []MIBField) bool {
+	if len(older) > len(newer) {
+		return false
+	}
+	for i, field := range older {
+		if field.Name != newer[i].Name || field.Syntax.String() != newer[i].Syntax.String() {
+			return false
+		}
+	}
+	return true
+}
+
+func formatMIBEnums(enums []MIBEnum) string {
+	items := make([]string, len(enums))
+	for i, e := range enums {
+		items[i] = fmt.Sprintf("%s(%d)", e.Label, e.Value)
+	}
+	return strings.Join(items, ", ")
+}
+
+// formatMIBIndex renders the INDEX clause of a node
+func formatMIBIndex(node *MIBNode) string {
+	index := append([]string(nil), node.Index...)
+	if node.Implied && len(index) > 0 {
+		index[len(index)-1] = "IMPLIED " + index[len(index)-1]
+	}
+	return strings.Join(index, ", ")
+}
+
+// normalizeMIBText collapses whitespace so that reflowed text compares equal
+func normalizeMIBText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func mibTypeKind(t *MIBType) string {
+	if t.IsTC {
+		return "textual-convention"
+	}
+	return "type"
+}
+
+// errMIBModuleMismatch is returned when two revisions are of different
+// modules
+var errMIBModuleMismatch = errors.New("revisions of different modules cannot be compared")
+
+// loadMIBRevision parses a revision of a module and resolves its OIDs in
+// place of the stored module of the same name, so older revisions get the
+// OIDs they had
+func loadMIBRevision(resolver *MIBResolver, file MIBFile, content []byte) (*MIBModule, error) {
+	module, err := ParseMIB(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file.Filename, err)
+	}
+	resolver.Add(file, module)
+	resolver.Resolve()
+	return module, nil
+}
+
+// diffMIBRevisions parses and compares a stored MIB file against another
+// stored or uploaded revision of the same module. It fails with
+// errMIBModuleMismatch when the module names differ, as loading the newer
+// revision would otherwise replace another stored module.
+func diffMIBRevisions(from MIBFile, to MIBFile, toContent []byte) (MIBDiff, error) {
+	resolver, _, err := LoadMIBResolver()
+	if err != nil {
+		return MIBDiff{}, err
+	}
+	fromContent, err := readMIBFile(&from)
+	if err != nil {
+		return MIBDiff{}, err
+	}
+	older, err := loadMIBRevision(resolver, from, fromContent)
+	if err != nil {
+		return MIBDiff{}, err
+	}
+	newer, err := ParseMIB(toContent)
+	if err != nil {
+		return MIBDiff{}, fmt.Errorf("%s: %v", to.Filename, err)
+	}
+	if newer.Name != older.Name {
+		return MIBDiff{}, fmt.Errorf("%w: %s is %s, %s is %s", errMIBModuleMismatch, from.Filename, older.Name, to.Filename, newer.Name)
+	}
+	resolver.Add(to, newer)
+	resolver.Resolve()
+
+	version := newer.LastUpdated
+	if len(newer.Revisions) > 0 {
+		version = newer.Revisions[0].Date
+	}
+	diff := DiffMIBModules(older, newer, resolver)
+	diff.From = MIBRevisionRef{from.ID, older.Name, from.Version, from.Filename}
+	diff.To = MIBRevisionRef{to.ID, newer.Name, version, to.Filename}
+	return diff, nil
+}
+
+// MIB diff API handlers
+
+// diffMIBFiles compares two stored MIB files, from and to, definition by
+// definition
+func diffMIBFiles(c *gin.Context) {
+	fromID, toID := c.Query("from"), c.Query("to")
+	if fromID == "" || toID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parameters 'from' and 'to' are required"})
+		return
+	}
+
+	var from, to MIBFile
+	if err := db.First(&from, fromID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MIB file 'from' not found"})
+		return
+	}
+	if err := db.First(&to, toID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MIB file 'to' not found"})
+		return
+	}
+	toContent, err := readMIBFile(&to)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	diff, err := diffMIBRevisions(from, to, toContent)
+	if errors.Is(err, errMIBModuleMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// diffUploadedMIBFile compares a stored MIB file against an uploaded
+// revision without storing the upload
+func diffUploadedMIBFile(c *gin.Context) {
+	var from MIBFile
+	if err := db.First(&from, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MIB file not found"})
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	content, err := readMIBUpload(header)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	diff, err := diffMIBRevisions(from, MIBFile{Filename: header.Filename}, content)
+	if errors.Is(err, errMIBModuleMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
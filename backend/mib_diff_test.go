@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testDiffMIB wraps definitions into a module revision
+func testDiffMIB(definitions string) string {
+	return `TEST-DIFF-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, NOTIFICATION-TYPE,
+    Integer32, enterprises             FROM SNMPv2-SMI
+    TEXTUAL-CONVENTION                 FROM SNMPv2-TC;
+
+testDiffMIB MODULE-IDENTITY
+    LAST-UPDATED "202401010000Z"
+    ORGANIZATION "Test"
+    CONTACT-INFO "Test"
+    DESCRIPTION  "Test module"
+    REVISION     "202401010000Z"
+    DESCRIPTION  "Initial revision"
+    ::= { enterprises 99995 }
+
+testObjects OBJECT IDENTIFIER ::= { testDiffMIB 1 }
+` + definitions + `
+END
+`
+}
+
+// testDiffObject renders the testValue object with the given clauses
+func testDiffObject(name, syntax, extra string, subID string) string {
+	return name + ` OBJECT-TYPE
+    SYNTAX      ` + syntax + `
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The value of the test"
+` + extra + `    ::= { testObjects ` + subID + ` }
+`
+}
+
+func TestDiffMIBModulesGrading(t *testing.T) {
+	const enum = "INTEGER { up(1), down(2) }"
+	base := testDiffObject("testValue", enum, "", "1")
+	other := testDiffObject("testOther", "Integer32", "", "3")
+	replace := func(old, new string) string {
+		return strings.Replace(base, old, new, 1)
+	}
+	table := func(columns string) string {
+		return `
+testTable OBJECT-TYPE
+    SYNTAX      SEQUENCE OF TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A table"
+    ::= { testObjects 2 }
+
+testEntry OBJECT-TYPE
+    SYNTAX      TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A row"
+    INDEX       { testIndex }
+    ::= { testTable 1 }
+
+TestEntry ::= SEQUENCE { ` + columns + ` }
+`
+	}
+	notification := func(objects string) string {
+		return `
+testEvent NOTIFICATION-TYPE
+    OBJECTS     { ` + objects + ` }
+    STATUS      current
+    DESCRIPTION "An event"
+    ::= { testDiffMIB 0 1 }
+`
+	}
+	tc := `
+TestState ::= TEXTUAL-CONVENTION
+    STATUS      current
+    DESCRIPTION "A state"
+    SYNTAX      INTEGER { up(1), down(2) }
+`
+
+	tests := []struct {
+		name       string
+		from, to   string
+		compatible bool
+		summary    MIBDiffSummary
+		rule       string // rule cited by the change, when one is expected
+	}{
+		{"unchanged", base, base, true, MIBDiffSummary{}, ""},
+		{"description reflowed", base, replace(`"The value of the test"`, "\"The value\n        of the test\""), true, MIBDiffSummary{}, ""},
+		{"description clarified", base, replace(`"The value of the test"`, `"The current value of the test"`), true,
+			MIBDiffSummary{Changed: 1}, mibRuleDescription},
+		{"enumeration added", base, replace(enum, "INTEGER { up(1), down(2), testing(3) }"), true,
+			MIBDiffSummary{Changed: 1}, mibRuleEnumsAdded},
+		{"enumeration relabelled", base, replace(enum, "INTEGER { up(1), dormant(2) }"), true,
+			MIBDiffSummary{Changed: 1}, mibRuleEnumsAdded},
+		{"enumeration removed", base, replace(enum, "INTEGER { up(1) }"), false,
+			MIBDiffSummary{Changed: 1, Breaking: 1}, mibRuleRevisedDefinition},
+		{"range narrowed", testDiffObject("testValue", "Integer32 (0..100)", "", "1"), testDiffObject("testValue", "Integer32 (0..10)", "", "1"), false,
+			MIBDiffSummary{Changed: 1, Breaking: 1}, mibRuleRevisedDefinition},
+		{"equivalent textual convention", tc + base, tc + replace(enum, "TestState"), true,
+			MIBDiffSummary{Changed: 1}, mibRuleEquivalentTC},
+		{"deprecated", base, replace("STATUS      current", "STATUS      deprecated"), true,
+			MIBDiffSummary{Changed: 1, Deprecated: 1}, mibRuleStatusRevised},
+		{"undeprecated", replace("STATUS      current", "STATUS      deprecated"), base, false,
+			MIBDiffSummary{Changed: 1, Breaking: 1}, mibRuleStatusRevised},
+		{"access changed", base, replace("read-only", "read-write"), false,
+			MIBDiffSummary{Changed: 1, Breaking: 1}, mibRuleRevisedDefinition},
+		{"units added", base, testDiffObject("testValue", enum, "    UNITS       \"state\"\n", "1"), true,
+			MIBDiffSummary{Changed: 1}, mibRuleUnitsAdded},
+		{"units changed", testDiffObject("testValue", enum, "    UNITS       \"state\"\n", "1"), testDiffObject("testValue", enum, "    UNITS       \"mode\"\n", "1"), false,
+			MIBDiffSummary{Changed: 1, Breaking: 1}, mibRuleUnitsAdded},
+		{"defval added", base, testDiffObject("testValue", enum, "    DEFVAL      { up }\n", "1"), true,
+			MIBDiffSummary{Changed: 1}, mibRuleDefValUpdated},
+		{"defval removed", testDiffObject("testValue", enum, "    DEFVAL      { up }\n", "1"), base, false,
+			MIBDiffSummary{Changed: 1, Breaking: 1}, mibRuleDefValUpdated},
+		{"object added", base, base + other, true,
+			MIBDiffSummary{Added: 1}, mibRuleNewDefinition},
+		{"object removed", base + other, base, false,
+			MIBDiffSummary{Removed: 1, Breaking: 1}, mibRuleRemovedDefinition},
+		{"object renamed", base, strings.Replace(base, "testValue", "testState", 1), false,
+			MIBDiffSummary{Renamed: 1, Breaking: 1}, mibRuleRenamed},
+		{"object renumbered", base, testDiffObject("testValue", enum, "", "5"), false,
+			MIBDiffSummary{Renumbered: 1, Breaking: 1}, mibRuleRenumbered},
+		{"column appended", base + table("testIndex Integer32"), base + table("testIndex Integer32, testValue2 Integer32"), true,
+			MIBDiffSummary{Changed: 1}, mibRuleColumnsAppended},
+		{"column inserted", base + table("testIndex Integer32, testValue2 Integer32"), base + table("testValue2 Integer32, testIndex Integer32"), false,
+			MIBDiffSummary{Changed: 1, Breaking: 1}, mibRuleRevisedDefinition},
+		{"notification objects changed", base + other + notification("testValue"), base + other + notification("testValue, testOther"), false,
+			MIBDiffSummary{Changed: 1, Breaking: 1}, mibRuleRevisedNotification},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := baseMIBResolver(t)
+			from, err := loadMIBRevision(resolver, MIBFile{Filename: "from"}, []byte(testDiffMIB(tt.from)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			to, err := loadMIBRevision(resolver, MIBFile{Filename: "to"}, []byte(testDiffMIB(tt.to)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			diff := DiffMIBModules(from, to, resolver)
+			if diff.Compatible != tt.compatible || diff.Summary != tt.summary {
+				t.Fatalf("compatible %v, summary %+v; want %v, %+v\n%+v", diff.Compatible, diff.Summary, tt.compatible, tt.summary, diff)
+			}
+			if tt.rule != "" && !diffCites(diff, tt.rule) {
+				t.Errorf("no change cites %q: %+v", tt.rule, diff)
+			}
+		})
+	}
+}
+
+// diffCites reports whether any entry of diff cites rule
+func diffCites(diff MIBDiff, rule string) bool {
+	for _, ref := range append(append(diff.Added, diff.Removed...), diff.Deprecated...) {
+		if ref.Rule == rule {
+			return true
+		}
+	}
+	for _, r := range diff.Renamed {
+		if r.Rule == rule {
+			return true
+		}
+	}
+	for _, r := range diff.Renumbered {
+		if r.Rule == rule {
+			return true
+		}
+	}
+	for _, change := range diff.Changed {
+		for _, c := range change.Changes {
+			if c.Rule == rule {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestDiffMIBRevisionsSameModule(t *testing.T) {
+	openTestDB(t)
+	loadTestMIBTree(t)
+	var ifMIB MIBFile
+	if err := db.Where("module_name = ?", "IF-MIB").First(&ifMIB).Error; err != nil {
+		t.Fatal(err)
+	}
+	content, err := readMIBFile(&ifMIB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := diffMIBRevisions(ifMIB, MIBFile{Filename: "IF-MIB.my"}, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Compatible || diff.Summary != (MIBDiffSummary{}) || diff.To.Module != "IF-MIB" {
+		t.Fatalf("IF-MIB against itself: %+v", diff)
+	}
+
+	// Another module is refused before it replaces its stored namesake
+	_, err = diffMIBRevisions(ifMIB, MIBFile{Filename: "TEST-DIFF-MIB.my"}, []byte(testDiffMIB("")))
+	if !errors.Is(err, errMIBModuleMismatch) || !strings.Contains(err.Error(), "TEST-DIFF-MIB.my is TEST-DIFF-MIB") {
+		t.Fatalf("diffMIBRevisions() = %v, want %v", err, errMIBModuleMismatch)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"snmp-monitor-pro/snmp"
+)
+
+// mibValue is a varbind decoded with the MIB definition of its object
+type mibValue struct {
+	OID     string      `json:"oid"`
+	Name    string      `json:"name"`             // MODULE::object.instance, or the OID when unknown
+	Type    string      `json:"type"`             // type on the wire
+	Syntax  string      `json:"syntax,omitempty"` // textual convention or base type in the MIB
+	Value   interface{} `json:"value"`
+	Display string      `json:"display"`
+	Units   string      `json:"units,omitempty"`
+}
+
+// FormatVariable decodes a varbind the way snmpget prints it: enum labels,
+// named bits, DISPLAY-HINT formatting and the units of its object
+func (t *mibTree) FormatVariable(v snmp.Variable) mibValue {
+	value := mibValue{OID: v.OID, Name: t.Name(v.OID), Type: v.Type.String()}
+	switch raw := v.Value.(type) {
+	case nil:
+		value.Display = v.Type.String()
+		return value
+	case []byte:
+		if isPrintableOctets(raw) {
+			value.Value, value.Display = string(raw), string(raw)
+		} else {
+			value.Value, value.Display = hex.EncodeToString(raw), formatHexOctets(raw)
+		}
+	case string: // OBJECT IDENTIFIER
+		value.Value, value.Display = raw, t.Name(raw)
+	case uint32:
+		value.Value, value.Display = raw, strconv.FormatUint(uint64(raw), 10)
+		if v.Type == snmp.TimeTicks {
+			value.Display = fmt.Sprintf("(%d) %s", raw, formatTimeTicks(raw))
+		}
+	default:
+		value.Value, value.Display = raw, v.String()
+	}
+
+	node, _ := t.Describe(v.OID)
+	if node == nil || !node.IsAccessible() {
+		return value
+	}
+	chain := t.TypeChain(node)
+	value.Syntax = t.BaseType(node)
+	if len(chain) > 0 {
+		value.Syntax = chain[0].Name
+	}
+	value.Units = node.Units
+
+	syntax := t.EffectiveSyntax(node)
+	hint := ""
+	for _, typ := range chain {
+		if typ.DisplayHint != "" {
+			hint = typ.DisplayHint
+			break
+		}
+	}
+	switch raw := v.Value.(type) {
+	case int64:
+		if label := mibEnumLabel(syntax.Enums, raw); label != "" {
+			value.Display = fmt.Sprintf("%s(%d)", label, raw)
+			return value
+		}
+		if hint != "" {
+			value.Display = formatIntegerHint(hint, big.NewInt(raw))
+		}
+	case uint32:
+		if hint != "" && v.Type != snmp.TimeTicks {
+			value.Display = formatIntegerHint(hint, new(big.Int).SetUint64(uint64(raw)))
+		}
+	case uint64:
+		if hint != "" {
+			value.Display = formatIntegerHint(hint, new(big.Int).SetUint64(raw))
+		}
+	case []byte:
+		if syntax.Base == "BITS" {
+			value.Display = formatBits(syntax.Enums, raw)
+			return value
+		}
+		if hint != "" {
+			value.Display = formatOctetHint(hint, raw)
+		}
+		return value
+	}
+	if value.Units != "" {
+		value.Display += " " + value.Units
+	}
+	return value
+}
+
+// mibEnumLabel returns the label of an enumeration value
+func mibEnumLabel(enums []MIBEnum, value int64) string {
+	for _, enum := range enums {
+		if enum.Value == value {
+			return enum.Label
+		}
+	}
+	return ""
+}
+
+// formatBits lists the named bits set in a BITS value, bit 0 being the
+// most significant bit of the first octet
+func formatBits(enums []MIBEnum, raw []byte) string {
+	var set []string
+	for i, b := range raw {
+		for bit := 0; bit < 8; bit++ {
+			if b&(0x80>>bit) == 0 {
+				continue
+			}
+			position := int64(i*8 + bit)
+			label := mibEnumLabel(enums, position)
+			if label == "" {
+				label = "bit"
+			}
+			set = append(set, fmt.Sprintf("%s(%d)", label, position))
+		}
+	}
+	return strings.Join(set, " ")
+}
+
+// formatTimeTicks renders hundredths of a second as days and h:mm:ss.cc
+func formatTimeTicks(ticks uint32) string {
+	seconds := ticks / 100
+	days := seconds / 86400
+	clock := fmt.Sprintf("%d:%02d:%02d.%02d", seconds/3600%24, seconds/60%60, seconds%60, ticks%100)
+	switch days {
+	case 0:
+		return clock
+	case 1:
+		return "1 day, " + clock
+	}
+	return fmt.Sprintf("%d days, %s", days, clock)
+}
+
+// isPrintableOctets reports whether an OCTET STRING reads as text
+func isPrintableOctets(raw []byte) bool {
+	if !utf8.Valid(raw) {
+		return false
+	}
+	for _, c := range raw {
+		if (c < 0x20 && c != '\t' && c != '\n' && c != '\r') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// formatHexOctets renders binary octets as space separated hex
+func formatHexOctets(raw []byte) string {
+	parts := make([]string, len(raw))
+	for i, b := range raw {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatIntegerHint applies an INTEGER DISPLAY-HINT (RFC 2579 3.1): d with
+// an optional implied decimal point (d-2), x, o or b
+func formatIntegerHint(hint string, value *big.Int) string {
+	switch {
+	case hint == "x":
+		return value.Text(16)
+	case hint == "o":
+		return value.Text(8)
+	case hint == "b":
+		return value.Text(2)
+	case hint == "d":
+		return value.String()
+	case strings.HasPrefix(hint, "d-"):
+		places, err := strconv.Atoi(hint[2:])
+		if err != nil || places <= 0 {
+			return value.String()
+		}
+		digits := new(big.Int).Abs(value).String()
+		if len(digits) <= places {
+			digits = strings.Repeat("0", places-len(digits)+1) + digits
+		}
+		sign := ""
+		if value.Sign() < 0 {
+			sign = "-"
+		}
+		return sign + digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+	}
+	return value.String()
+}
+
+// octetHintSpec is one octet-format specification of a DISPLAY-HINT
+type octetHintSpec struct {
+	repeat     bool
+	length     int
+	format     byte
+	separator  byte
+	terminator byte
+}
+
+// parseOctetHint splits an OCTET STRING DISPLAY-HINT such as "1d.1d.1d.1d",
+// "255a" or "*1x:" into its specifications
+func parseOctetHint(hint string) ([]octetHintSpec, bool) {
+	var specs []octetHintSpec
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	for i := 0; i < len(hint); {
+		var spec octetHintSpec
+		if hint[i] == '*' {
+			spec.repeat = true
+			i++
+		}
+		start := i
+		for i < len(hint) && isDigit(hint[i]) {
+			i++
+		}
+		if start == i || i == len(hint) {
+			return nil, false
+		}
+		if spec.length, _ = strconv.Atoi(hint[start:i]); spec.length == 0 {
+			return nil, false
+		}
+		spec.format = hint[i]
+		if !strings.ContainsRune("xdoat", rune(spec.format)) {
+			return nil, false
+		}
+		i++
+		if i < len(hint) && !isDigit(hint[i]) && hint[i] != '*' {
+			spec.separator = hint[i]
+			i++
+		}
+		if spec.repeat && i < len(hint) && !isDigit(hint[i]) && hint[i] != '*' {
+			spec.terminator = hint[i]
+			i++
+		}
+		specs = append(specs, spec)
+	}
+	return specs, len(specs) > 0
+}
+
+// formatOctetHint applies an OCTET STRING DISPLAY-HINT (RFC 2579 3.1). The
+// last specification repeats until the value is used up.
+func formatOctetHint(hint string, raw []byte) string {
+	specs, ok := parseOctetHint(hint)
+	if !ok {
+		return formatHexOctets(raw)
+	}
+	var out strings.Builder
+	for i := 0; len(raw) > 0; i++ {
+		spec := specs[len(specs)-1]
+		if i < len(specs) {
+			spec = specs[i]
+		}
+		count := 1
+		if spec.repeat {
+			count = int(raw[0])
+			raw = raw[1:]
+		}
+		for r := 0; r < count && len(raw) > 0; r++ {
+			n := min(spec.length, len(raw))
+			if n == 0 {
+				break
+			}
+			chunk := raw[:n]
+			raw = raw[n:]
+			switch spec.format {
+			case 'a', 't':
+				out.Write(chunk)
+			case 'x':
+				out.WriteString(fmt.Sprintf("%0*x", 2*len(chunk), new(big.Int).SetBytes(chunk)))
+			case 'd':
+				out.WriteString(new(big.Int).SetBytes(chunk).String())
+			case 'o':
+				out.WriteString(new(big.Int).SetBytes(chunk).Text(8))
+			}
+			last := r == count-1 || len(raw) == 0
+			if spec.separator != 0 && len(raw) > 0 && !(last && spec.terminator != 0) {
+				out.WriteByte(spec.separator)
+			}
+		}
+		if spec.terminator != 0 && len(raw) > 0 {
+			out.WriteByte(spec.terminator)
+		}
+	}
+	return out.String()
+}
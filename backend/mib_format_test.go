@@ -0,0 +1,191 @@
+package main
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"snmp-monitor-pro/snmp"
+)
+
+const testFormatMIB = `TEST-FORMAT-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, Integer32, Unsigned32,
+    enterprises                        FROM SNMPv2-SMI
+    TEXTUAL-CONVENTION                 FROM SNMPv2-TC;
+
+testFormatMIB MODULE-IDENTITY
+    LAST-UPDATED "202401010000Z"
+    ORGANIZATION "Test"
+    CONTACT-INFO "Test"
+    DESCRIPTION  "Objects with display hints, named bits and units"
+    ::= { enterprises 99994 }
+
+Temperature ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "d-1"
+    STATUS       current
+    DESCRIPTION  "Tenths of a degree"
+    SYNTAX       Integer32
+
+HexCode ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "x"
+    STATUS       current
+    DESCRIPTION  "A code shown in hex"
+    SYNTAX       Unsigned32
+
+Version ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "1d.1d.1d"
+    STATUS       current
+    DESCRIPTION  "Major, minor and patch"
+    SYNTAX       OCTET STRING (SIZE (3))
+
+testTemperature OBJECT-TYPE
+    SYNTAX      Temperature
+    UNITS       "degrees Celsius"
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The temperature"
+    ::= { testFormatMIB 1 }
+
+testFlags OBJECT-TYPE
+    SYNTAX      BITS { overheat(0), fanFailure(1), powerLoss(9) }
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "Alarm flags"
+    ::= { testFormatMIB 2 }
+
+testMode OBJECT-TYPE
+    SYNTAX      INTEGER { auto(1), manual(2) }
+    UNITS       "mode"
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The mode"
+    ::= { testFormatMIB 3 }
+
+testCode OBJECT-TYPE
+    SYNTAX      HexCode
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The code"
+    ::= { testFormatMIB 4 }
+
+testVersion OBJECT-TYPE
+    SYNTAX      Version
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The version"
+    ::= { testFormatMIB 5 }
+
+END
+`
+
+func TestFormatVariable(t *testing.T) {
+	openTestDB(t)
+	filePath := filepath.Join(t.TempDir(), "TEST-FORMAT-MIB.txt")
+	if err := os.WriteFile(filePath, []byte(testFormatMIB), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&MIBFile{Name: "TEST-FORMAT-MIB", Filename: "TEST-FORMAT-MIB.txt", FilePath: filePath,
+		ModuleName: "TEST-FORMAT-MIB", Source: "upload"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	tree := loadTestMIBTree(t)
+
+	tests := []struct {
+		name    string
+		v       snmp.Variable
+		display string
+		syntax  string
+		units   string
+	}{
+		{"enumeration", snmp.Variable{OID: "1.3.6.1.2.1.2.2.1.8.3", Type: snmp.Integer, Value: int64(1)}, "up(1)", "INTEGER", ""},
+		{"enumeration of a textual convention", snmp.Variable{OID: "1.3.6.1.2.1.2.2.1.3.1", Type: snmp.Integer, Value: int64(6)}, "ethernetCsmacd(6)", "IANAifType", ""},
+		{"enumeration label replaces units", snmp.Variable{OID: "1.3.6.1.4.1.99994.3.0", Type: snmp.Integer, Value: int64(2)}, "manual(2)", "INTEGER", "mode"},
+		{"undefined enumeration value", snmp.Variable{OID: "1.3.6.1.4.1.99994.3.0", Type: snmp.Integer, Value: int64(7)}, "7 mode", "INTEGER", "mode"},
+		{"implied decimal point", snmp.Variable{OID: "1.3.6.1.4.1.99994.1.0", Type: snmp.Integer, Value: int64(235)}, "23.5 degrees Celsius", "Temperature", "degrees Celsius"},
+		{"negative implied decimal point", snmp.Variable{OID: "1.3.6.1.4.1.99994.1.0", Type: snmp.Integer, Value: int64(-5)}, "-0.5 degrees Celsius", "Temperature", "degrees Celsius"},
+		{"hex integer", snmp.Variable{OID: "1.3.6.1.4.1.99994.4.0", Type: snmp.Gauge32, Value: uint32(48879)}, "beef", "HexCode", ""},
+		{"named bits", snmp.Variable{OID: "1.3.6.1.4.1.99994.2.0", Type: snmp.OctetString, Value: []byte{0xc0, 0x40}}, "overheat(0) fanFailure(1) powerLoss(9)", "BITS", ""},
+		{"unnamed bit", snmp.Variable{OID: "1.3.6.1.4.1.99994.2.0", Type: snmp.OctetString, Value: []byte{0x10}}, "bit(3)", "BITS", ""},
+		{"no bits set", snmp.Variable{OID: "1.3.6.1.4.1.99994.2.0", Type: snmp.OctetString, Value: []byte{0x00, 0x00}}, "", "BITS", ""},
+		{"octet hint", snmp.Variable{OID: "1.3.6.1.4.1.99994.5.0", Type: snmp.OctetString, Value: []byte{2, 10, 1}}, "2.10.1", "Version", ""},
+		{"MAC address", snmp.Variable{OID: "1.3.6.1.2.1.2.2.1.6.1", Type: snmp.OctetString, Value: []byte{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}}, "00:1a:2b:3c:4d:5e", "PhysAddress", ""},
+		{"text", snmp.Variable{OID: "1.3.6.1.2.1.1.1.0", Type: snmp.OctetString, Value: []byte("Linux sw1")}, "Linux sw1", "DisplayString", ""},
+		{"time ticks", snmp.Variable{OID: "1.3.6.1.2.1.1.3.0", Type: snmp.TimeTicks, Value: uint32(8640123)}, "(8640123) 1 day, 0:00:01.23", "TimeTicks", ""},
+		{"gauge with units", snmp.Variable{OID: "1.3.6.1.2.1.31.1.1.1.15.1", Type: snmp.Gauge32, Value: uint32(1000)}, "1000 Mbps", "Gauge32", "Mbps"},
+		{"integer with units", snmp.Variable{OID: "1.3.6.1.2.1.25.2.3.1.4.1", Type: snmp.Integer, Value: int64(4096)}, "4096 Bytes", "Integer32", "Bytes"},
+		{"unknown object", snmp.Variable{OID: "1.3.6.1.4.1.99999.1.0", Type: snmp.OctetString, Value: []byte{0x00, 0x01, 0xff}}, "00 01 FF", "", ""},
+		{"exception", snmp.Variable{OID: "1.3.6.1.2.1.1.1.0", Type: snmp.NoSuchInstance}, "noSuchInstance", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tree.FormatVariable(tt.v)
+			if got.Display != tt.display || got.Syntax != tt.syntax || got.Units != tt.units {
+				t.Errorf("FormatVariable() display %q, syntax %q, units %q; want %q, %q, %q",
+					got.Display, got.Syntax, got.Units, tt.display, tt.syntax, tt.units)
+			}
+			if got.OID != tt.v.OID || got.Type != tt.v.Type.String() {
+				t.Errorf("FormatVariable() oid %s, type %s", got.OID, got.Type)
+			}
+		})
+	}
+
+	if got := tree.FormatVariable(snmp.Variable{OID: "1.3.6.1.2.1.2.2.1.8.3", Type: snmp.Integer, Value: int64(1)}); got.Name != "IF-MIB::ifOperStatus.3" {
+		t.Errorf("name %q, want IF-MIB::ifOperStatus.3", got.Name)
+	}
+}
+
+func TestFormatIntegerHint(t *testing.T) {
+	tests := []struct {
+		hint  string
+		value int64
+		want  string
+	}{
+		{"d", 42, "42"},
+		{"d-2", 1234, "12.34"},
+		{"d-2", 5, "0.05"},
+		{"d-2", -5, "-0.05"},
+		{"d-3", -12345, "-12.345"},
+		{"d-2", 0, "0.00"},
+		{"x", 255, "ff"},
+		{"o", 8, "10"},
+		{"b", 5, "101"},
+		{"d-x", 7, "7"},
+		{"d-0", 7, "7"},
+		{"", 7, "7"},
+	}
+	for _, tt := range tests {
+		if got := formatIntegerHint(tt.hint, big.NewInt(tt.value)); got != tt.want {
+			t.Errorf("formatIntegerHint(%q, %d) = %q, want %q", tt.hint, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFormatOctetHint(t *testing.T) {
+	tests := []struct {
+		hint string
+		raw  []byte
+		want string
+	}{
+		{"1d.1d.1d.1d", []byte{192, 168, 0, 1}, "192.168.0.1"},
+		{"1x:", []byte{0x00, 0x1a, 0x2b}, "00:1a:2b"},
+		{"255a", []byte("eth0"), "eth0"},
+		{"255t", []byte("résumé"), "résumé"},
+		{"2d-1d-1d,1d:1d:1d.1d,1a1d:1d", []byte{0x07, 0xe8, 1, 15, 13, 30, 15, 0, '+', 1, 0}, "2024-1-15,13:30:15.0,+1:0"},
+		{"2x:2x:2x:2x:2x:2x:2x:2x", []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, "2001:0db8:0000:0000:0000:0000:0000:0001"},
+		{"4d", []byte{0, 0, 1, 0}, "256"},
+		{"1o", []byte{8, 9}, "1011"},
+		{"*1d./", []byte{2, 10, 20, 1, 30}, "10.20/30"},
+		{"1d.", []byte{1, 2}, "1.2"},
+		{"1d.", []byte{}, ""},
+		{"zz", []byte{0x0a, 0x0b}, "0A 0B"},
+		{"0d", []byte{1}, "01"},
+	}
+	for _, tt := range tests {
+		if got := formatOctetHint(tt.hint, tt.raw); got != tt.want {
+			t.Errorf("formatOctetHint(%q, % x) = %q, want %q", tt.hint, tt.raw, got, tt.want)
+		}
+	}
+}
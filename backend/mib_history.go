@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// normalizeMIBRevision turns an SMI ExtUTCTime into a comparable string.
+// Two-digit years denote 19xx (RFC 2578 section 2).
+func normalizeMIBRevision(date string) string {
+	date = strings.ToUpper(strings.TrimSpace(date))
+	if len(date) == 11 {
+		return "19" + date
+	}
+	return date
+}
+
+// compareMIBRevisions compares two LAST-UPDATED or REVISION dates
+func compareMIBRevisions(a, b string) int {
+	return strings.Compare(normalizeMIBRevision(a), normalizeMIBRevision(b))
+}
+
+// registerMIBFile stores a parsed MIB file, keeping a single current row per
+// module. It returns:
+//   - "duplicate" when a file with the same content is stored already; the
+//     stored file is returned and mibFile is not saved
+//   - "updated" when mibFile is a newer revision (or a changed copy of the
+//     same revision) of a stored module; the previous current row, returned,
+//     becomes history of mibFile
+//   - "history" when mibFile is an older revision; it is stored as history
+//     of the returned current row
+//   - "created" otherwise
+//
+// Bundled base MIBs never take part: uploads shadow them in the resolver.
+func (mm *MIBManager) registerMIBFile(mibFile *MIBFile) (string, *MIBFile, error) {
+	if mibFile.ContentHash != "" {
+		var existing MIBFile
+		if err := db.Where("content_hash = ?", mibFile.ContentHash).First(&existing).Error; err == nil {
+			return "duplicate", &existing, nil
+		}
+	}
+
+	var current MIBFile
+	err := db.Where("module_name = ? AND current_id IS NULL AND source <> ?", mibFile.ModuleName, "system").
+		Order("id desc").First(&current).Error
+	if mibFile.ModuleName == "" || err != nil {
+		return "created", nil, db.Create(mibFile).Error
+	}
+
+	if compareMIBRevisions(mibFile.Version, current.Version) < 0 {
+		mibFile.CurrentID = &current.ID
+		mibFile.Status = "superseded"
+		return "history", &current, db.Create(mibFile).Error
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(mibFile).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&MIBFile{}).Where("id = ? OR current_id = ?", current.ID, current.ID).
+			Updates(map[string]interface{}{"current_id": mibFile.ID, "status": "superseded"}).Error; err != nil {
+			return err
+		}
+		// Only the current revision is part of the OID tree
+		return tx.Where("mib_file_id = ?", current.ID).Delete(&MIBObject{}).Error
+	})
+	return "updated", &current, err
+}
+
+// removeMIBFile deletes a MIB file row and its OID tree rows. When it was
+// the current revision, the newest older revision takes over.
+func removeMIBFile(mibFile MIBFile) error {
+	if err := db.Delete(&mibFile).Error; err != nil {
+		return err
+	}
+	db.Where("mib_file_id = ?", mibFile.ID).Delete(&MIBObject{})
+	if mibFile.CurrentID == nil {
+		return promoteMIBHistory(mibFile)
+	}
+	return nil
+}
+
+// promoteMIBHistory makes the newest history row of a deleted current MIB
+// file the current revision of its module
+func promoteMIBHistory(deleted MIBFile) error {
+	var history []MIBFile
+	if err := db.Where("current_id = ?", deleted.ID).Find(&history).Error; err != nil || len(history) == 0 {
+		return err
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		if c := compareMIBRevisions(history[i].Version, history[j].Version); c != 0 {
+			return c > 0
+		}
+		return history[i].ID > history[j].ID
+	})
+
+	promoted := history[0]
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&MIBFile{}).Where("id = ?", promoted.ID).
+			Updates(map[string]interface{}{"current_id": nil, "status": "pending"}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&MIBFile{}).Where("current_id = ?", deleted.ID).
+			Update("current_id", promoted.ID).Error
+	})
+}
+
+// MIB history API handlers
+
+// getMIBFileHistory lists all stored revisions of a MIB file's module,
+// newest first
+func getMIBFileHistory(c *gin.Context) {
+	id := c.Param("id")
+	var file MIBFile
+	if err := db.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MIB file not found"})
+		return
+	}
+
+	currentID := file.ID
+	if file.CurrentID != nil {
+		currentID = *file.CurrentID
+	}
+	var revisions []MIBFile
+	db.Select("id, name, filename, module_name, version, last_updated, revisions, source, source_path, status, content_hash, current_id, uploaded_at, created_at").
+		Where("id = ? OR current_id = ?", currentID, currentID).Find(&revisions)
+	sort.SliceStable(revisions, func(i, j int) bool {
+		if revisions[i].CurrentID == nil || revisions[j].CurrentID == nil {
+			return revisions[i].CurrentID == nil && revisions[j].CurrentID != nil
+		}
+		if c := compareMIBRevisions(revisions[i].Version, revisions[j].Version); c != 0 {
+			return c > 0
+		}
+		return revisions[i].ID > revisions[j].ID
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"module":     file.ModuleName,
+		"current_id": currentID,
+		"revisions":  revisions,
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MIB lint profiles, from most to least demanding
+const (
+	mibLintStrict  = "strict"  // every RFC 2578 violation is an error
+	mibLintDefault = "default" // style problems are warnings
+	mibLintLenient = "lenient" // only problems that break loading; for vendor MIBs
+)
+
+// mibLintProfiles lists the profiles in the order they are presented
+var mibLintProfiles = []string{mibLintStrict, mibLintDefault, mibLintLenient}
+
+// MIB validation rules
+const (
+	mibRuleSyntaxError          = "syntax-error"
+	mibRuleMissingImport        = "missing-import"
+	mibRuleUndefinedSymbol      = "undefined-symbol"
+	mibRuleUnresolvedOID        = "unresolved-oid"
+	mibRuleDuplicateOID         = "duplicate-oid"
+	mibRuleDuplicateDefinition  = "duplicate-definition"
+	mibRuleBadDefVal            = "bad-defval"
+	mibRuleMissingRevision      = "missing-revision"
+	mibRuleBadRange             = "bad-range"
+	mibRuleIdentifierUnderscore = "identifier-underscore"
+	mibRuleIdentifierLength     = "identifier-length"
+	mibRuleMissingIndex         = "missing-index"
+	mibRuleMissingUnits         = "missing-units"
+)
+
+// MIBLintRule is a validation rule with its severity in each profile
+type MIBLintRule struct {
+	ID          string            `json:"id"`
+	Description string            `json:"description"`
+	Severity    map[string]string `json:"severity"` // profile -> error, warning, info, off
+	Fixed       bool              `json:"fixed"`    // cannot be disabled
+}
+
+// mibLintRules lists every rule ValidateMIBModule can report
+var mibLintRules = []MIBLintRule{
+	{mibRuleSyntaxError, "The file cannot be parsed", mibLintSeverities("error", "error", "error"), true},
+	{mibRuleMissingImport, "An imported module or symbol is not in the MIB store", mibLintSeverities("error", "error", "error"), true},
+	{mibRuleUndefinedSymbol, "A symbol is used without being defined or imported", mibLintSeverities("error", "error", "error"), true},
+	{mibRuleUnresolvedOID, "The numeric OID of a node cannot be computed", mibLintSeverities("error", "error", "error"), true},
+	{mibRuleDuplicateDefinition, "A descriptor is defined twice in the module", mibLintSeverities("error", "error", "error"), false},
+	{mibRuleDuplicateOID, "Two nodes of the module share an OID", mibLintSeverities("error", "error", "warning"), false},
+	{mibRuleBadDefVal, "A DEFVAL does not fit the object's SYNTAX", mibLintSeverities("error", "error", "warning"), false},
+	{mibRuleMissingIndex, "A conceptual row has neither INDEX nor AUGMENTS", mibLintSeverities("error", "error", "warning"), false},
+	{mibRuleBadRange, "A range or SIZE constraint is empty, negative or overlapping", mibLintSeverities("error", "warning", "off"), false},
+	{mibRuleIdentifierUnderscore, "An identifier contains an underscore", mibLintSeverities("error", "warning", "off"), false},
+	{mibRuleIdentifierLength, "An identifier is longer than 64 characters", mibLintSeverities("error", "warning", "off"), false},
+	{mibRuleMissingRevision, "MODULE-IDENTITY has no REVISION for LAST-UPDATED", mibLintSeverities("warning", "warning", "off"), false},
+	{mibRuleMissingUnits, "A counter or gauge has no UNITS clause", mibLintSeverities("warning", "off", "off"), false},
+}
+
+func mibLintSeverities(strict, def, lenient string) map[string]string {
+	return map[string]string{mibLintStrict: strict, mibLintDefault: def, mibLintLenient: lenient}
+}
+
+// mibLintRuleByID returns the rule with the given ID, or nil
+func mibLintRuleByID(id string) *MIBLintRule {
+	for i := range mibLintRules {
+		if mibLintRules[i].ID == id {
+			return &mibLintRules[i]
+		}
+	}
+	return nil
+}
+
+func isMIBLintProfile(profile string) bool {
+	for _, p := range mibLintProfiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// mibLintSettingKey is the Setting holding MIBLintSettings
+const mibLintSettingKey = "mib_lint"
+
+// MIBLintSettings selects how strictly MIB files are validated
+type MIBLintSettings struct {
+	Profile string            `json:"profile"`           // strict, default, lenient
+	Rules   map[string]bool   `json:"rules,omitempty"`   // rule ID -> enabled, overrides the profile
+	Modules map[string]string `json:"modules,omitempty"` // module name -> profile, e.g. strict for our own MIB
+}
+
+// defaultMIBLintSettings returns the settings used until others are saved
+func defaultMIBLintSettings() MIBLintSettings {
+	return MIBLintSettings{Profile: mibLintDefault}
+}
+
+// Validate checks that all profiles and rule IDs are known
+func (s MIBLintSettings) Validate() error {
+	if !isMIBLintProfile(s.Profile) {
+		return fmt.Errorf("unknown lint profile %q", s.Profile)
+	}
+	for id := range s.Rules {
+		rule := mibLintRuleByID(id)
+		if rule == nil {
+			return fmt.Errorf("unknown lint rule %q", id)
+		}
+		if rule.Fixed && !s.Rules[id] {
+			return fmt.Errorf("lint rule %q cannot be disabled", id)
+		}
+	}
+	for module, profile := range s.Modules {
+		if !isMIBLintProfile(profile) {
+			return fmt.Errorf("unknown lint profile %q for module %s", profile, module)
+		}
+	}
+	return nil
+}
+
+// ProfileFor returns the profile applied to a module
+func (s MIBLintSettings) ProfileFor(module string) string {
+	if profile, ok := s.Modules[module]; ok {
+		return profile
+	}
+	if s.Profile == "" {
+		return mibLintDefault
+	}
+	return s.Profile
+}
+
+// severity returns the severity of a rule for a module, "off" when disabled
+func (s MIBLintSettings) severity(rule *MIBLintRule, module string) string {
+	severity := rule.Severity[s.ProfileFor(module)]
+	if enabled, ok := s.Rules[rule.ID]; ok {
+		switch {
+		case !enabled && !rule.Fixed:
+			return "off"
+		case enabled && severity == "off":
+			// Enabled explicitly although the profile skips it
+			return rule.Severity[mibLintStrict]
+		}
+	}
+	return severity
+}
+
+// Apply re-grades diagnostics of a module and drops those of disabled rules
+func (s MIBLintSettings) Apply(module string, diags []MIBDiagnostic) []MIBDiagnostic {
+	result := make([]MIBDiagnostic, 0, len(diags))
+	for _, diag := range diags {
+		if rule := mibLintRuleByID(diag.Rule); rule != nil {
+			diag.Severity = s.severity(rule, module)
+		}
+		if diag.Severity != "off" {
+			result = append(result, diag)
+		}
+	}
+	return result
+}
+
+// loadMIBLintSettings reads the lint settings, falling back to the defaults
+func loadMIBLintSettings() MIBLintSettings {
+	settings := defaultMIBLintSettings()
+	if !loadSetting(mibLintSettingKey, &settings) || settings.Validate() != nil {
+		return defaultMIBLintSettings()
+	}
+	return settings
+}
+
+// MIB lint API handlers
+
+// getMIBLintRules lists the validation rules with their severity in each
+// profile, together with the current lint settings
+func getMIBLintRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"profiles": mibLintProfiles,
+		"rules":    mibLintRules,
+		"settings": loadMIBLintSettings(),
+	})
+}
@@ -0,0 +1,1195 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MIBModule is the parsed form of a single SMIv1/SMIv2 module
+type MIBModule struct {
+	Name         string
+	SMIVersion   int // 1 or 2
+	Imports      []MIBImport
+	Identity     string // name of the MODULE-IDENTITY node, if any
+	LastUpdated  string
+	Organization string
+	ContactInfo  string
+	Description  string
+	Revisions    []MIBRevision
+	Nodes        []*MIBNode
+	Types        []*MIBType
+	Macros       []string // MACRO definitions, only found in the SMI modules
+	Line         int
+}
+
+// MIBImport is one "symbols FROM module" clause of IMPORTS. Line and Column
+// locate the module reference and SymbolPositions each symbol, for
+// diagnostics; they are not stored.
+type MIBImport struct {
+	Module          string        `json:"module"`
+	Symbols         []string      `json:"symbols"`
+	Line            int           `json:"-"`
+	Column          int           `json:"-"`
+	SymbolPositions []MIBPosition `json:"-"`
+}
+
+// MIBPosition is a line and column of a MIB file, both counted from 1
+type MIBPosition struct {
+	Line   int
+	Column int
+}
+
+// MIBRevision is a REVISION clause of MODULE-IDENTITY
+type MIBRevision struct {
+	Date        string `json:"date"`
+	Description string `json:"description"`
+}
+
+// MIBNode is any definition that is assigned an OBJECT IDENTIFIER value
+type MIBNode struct {
+	Name        string
+	Kind        string // oid, module-identity, object-identity, object-type, notification-type, trap-type, object-group, notification-group, module-compliance, agent-capabilities
+	Parent      string // first symbolic component of the OID value
+	SubIDs      []uint32
+	OID         string // numeric OID, filled in by ResolveOIDs
+	Syntax      *MIBSyntax
+	Access      string
+	Status      string
+	Units       string
+	Description string
+	Reference   string
+	Index       []string
+	Implied     bool // last INDEX object is IMPLIED
+	Augments    string
+	DefVal      string
+	Objects     []string // OBJECTS, VARIABLES or NOTIFICATIONS
+	Enterprise  string   // TRAP-TYPE only
+	Line        int
+	Column      int
+}
+
+// MIBType is a type assignment or TEXTUAL-CONVENTION
+type MIBType struct {
+	Name        string
+	IsTC        bool
+	DisplayHint string
+	Status      string
+	Description string
+	Syntax      *MIBSyntax
+	Line        int
+	Column      int
+}
+
+// MIBSyntax describes the SYNTAX of an object or type
+type MIBSyntax struct {
+	Base       string // INTEGER, OCTET STRING, OBJECT IDENTIFIER, BITS, SEQUENCE, SEQUENCE OF, or a type name
+	SequenceOf string
+	Enums      []MIBEnum
+	Ranges     []MIBRange
+	Sizes      []MIBRange
+	Fields     []MIBField // SEQUENCE members
+}
+
+// MIBEnum is a named number of an INTEGER enumeration or BITS
+type MIBEnum struct {
+	Label string `json:"label"`
+	Value int64  `json:"value"`
+}
+
+// MIBRange is one element of a value or SIZE constraint
+type MIBRange struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+// MIBField is a member of a SEQUENCE type
+type MIBField struct {
+	Name   string
+	Syntax *MIBSyntax
+}
+
+// MIBSyntaxError reports a parse failure with its position in the source
+type MIBSyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *MIBSyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// smiRootOIDs holds the ASN.1 roots and the SMI skeleton every module hangs off
+var smiRootOIDs = map[string]string{
+	"ccitt":           "0",
+	"zeroDotZero":     "0.0",
+	"iso":             "1",
+	"joint-iso-ccitt": "2",
+	"org":             "1.3",
+	"dod":             "1.3.6",
+	"internet":        "1.3.6.1",
+	"directory":       "1.3.6.1.1",
+	"mgmt":            "1.3.6.1.2",
+	"mib-2":           "1.3.6.1.2.1",
+	"transmission":    "1.3.6.1.2.1.10",
+	"experimental":    "1.3.6.1.3",
+	"private":         "1.3.6.1.4",
+	"enterprises":     "1.3.6.1.4.1",
+	"security":        "1.3.6.1.5",
+	"snmpV2":          "1.3.6.1.6",
+	"snmpDomains":     "1.3.6.1.6.1",
+	"snmpProxys":      "1.3.6.1.6.2",
+	"snmpModules":     "1.3.6.1.6.3",
+}
+
+// ParseMIB parses SMI source text. Files carrying more than one module are
+// rare; only the first module is returned.
+func ParseMIB(src []byte) (*MIBModule, error) {
+	tokens, err := tokenizeMIB(string(src))
+	if err != nil {
+		return nil, err
+	}
+	p := &mibParser{tokens: tokens}
+	return p.parseModule()
+}
+
+// Node returns the node with the given name, or nil
+func (m *MIBModule) Node(name string) *MIBNode {
+	for _, n := range m.Nodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// Type returns the type or textual convention with the given name, or nil
+func (m *MIBModule) Type(name string) *MIBType {
+	for _, t := range m.Types {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Defines reports whether the module defines a node, type or macro with the given name
+func (m *MIBModule) Defines(symbol string) bool {
+	if m.Node(symbol) != nil || m.Type(symbol) != nil {
+		return true
+	}
+	for _, macro := range m.Macros {
+		if macro == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportedFrom returns the module a symbol is imported from, or ""
+func (m *MIBModule) ImportedFrom(symbol string) string {
+	for _, imp := range m.Imports {
+		for _, s := range imp.Symbols {
+			if s == symbol {
+				return imp.Module
+			}
+		}
+	}
+	return ""
+}
+
+// ResolveOIDs computes numeric OIDs for every node. Parents defined outside
+// the module are looked up through lookup and then smiRootOIDs. It returns
+// the names of nodes that could not be resolved.
+func (m *MIBModule) ResolveOIDs(lookup func(symbol string) (string, bool)) []string {
+	local := make(map[string]*MIBNode, len(m.Nodes))
+	for _, n := range m.Nodes {
+		local[n.Name] = n
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, n := range m.Nodes {
+			if n.OID != "" {
+				continue
+			}
+			var base string
+			switch {
+			case n.Parent == "":
+				base = ""
+			case local[n.Parent] != nil:
+				base = local[n.Parent].OID
+				if base == "" {
+					continue
+				}
+			default:
+				oid, ok := "", false
+				if lookup != nil {
+					oid, ok = lookup(n.Parent)
+				}
+				if !ok {
+					oid, ok = smiRootOIDs[n.Parent]
+				}
+				if !ok {
+					continue
+				}
+				base = oid
+			}
+			n.OID = joinOID(base, n.SubIDs)
+			changed = true
+		}
+	}
+
+	var unresolved []string
+	for _, n := range m.Nodes {
+		if n.OID == "" {
+			unresolved = append(unresolved, n.Name)
+		}
+	}
+	return unresolved
+}
+
+func joinOID(base string, subIDs []uint32) string {
+	parts := make([]string, 0, len(subIDs)+1)
+	if base != "" {
+		parts = append(parts, base)
+	}
+	for _, id := range subIDs {
+		parts = append(parts, strconv.FormatUint(uint64(id), 10))
+	}
+	return strings.Join(parts, ".")
+}
+
+// String renders the syntax back in SMI notation
+func (s *MIBSyntax) String() string {
+	if s == nil {
+		return ""
+	}
+	var b strings.Builder
+	if s.Base == "SEQUENCE OF" {
+		b.WriteString("SEQUENCE OF " + s.SequenceOf)
+		return b.String()
+	}
+	b.WriteString(s.Base)
+	if len(s.Fields) > 0 {
+		names := make([]string, len(s.Fields))
+		for i, f := range s.Fields {
+			names[i] = f.Name + " " + f.Syntax.String()
+		}
+		b.WriteString(" { " + strings.Join(names, ", ") + " }")
+	}
+	if len(s.Enums) > 0 {
+		items := make([]string, len(s.Enums))
+		for i, e := range s.Enums {
+			items[i] = fmt.Sprintf("%s(%d)", e.Label, e.Value)
+		}
+		b.WriteString(" { " + strings.Join(items, ", ") + " }")
+	}
+	if len(s.Ranges) > 0 {
+		b.WriteString(" (" + formatMIBRanges(s.Ranges) + ")")
+	}
+	if len(s.Sizes) > 0 {
+		b.WriteString(" (SIZE (" + formatMIBRanges(s.Sizes) + "))")
+	}
+	return b.String()
+}
+
+func formatMIBRanges(ranges []MIBRange) string {
+	items := make([]string, len(ranges))
+	for i, r := range ranges {
+		if r.Min == r.Max {
+			items[i] = r.Min
+		} else {
+			items[i] = r.Min + ".." + r.Max
+		}
+	}
+	return strings.Join(items, " | ")
+}
+
+// Lexer
+
+type mibTokenKind int
+
+const (
+	mibTokIdent mibTokenKind = iota
+	mibTokNumber
+	mibTokString
+	mibTokBinString // 'xx'H or 'xx'B
+	mibTokPunct
+	mibTokEOF
+)
+
+type mibToken struct {
+	kind   mibTokenKind
+	text   string
+	line   int
+	column int
+}
+
+func tokenizeMIB(src string) ([]mibToken, error) {
+	var tokens []mibToken
+	line, col := 1, 1
+	i := 0
+
+	advance := func(n int) {
+		for k := 0; k < n && i < len(src); k++ {
+			if src[i] == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+			i++
+		}
+	}
+
+	for i < len(src) {
+		ch := src[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' || ch == '\f':
+			advance(1)
+
+		case ch == '-' && i+1 < len(src) && src[i+1] == '-':
+			// Comment runs to the end of the line or the next "--"
+			advance(2)
+			for i < len(src) && src[i] != '\n' {
+				if src[i] == '-' && i+1 < len(src) && src[i+1] == '-' {
+					advance(2)
+					break
+				}
+				advance(1)
+			}
+
+		case ch == '"':
+			startLine, startCol := line, col
+			advance(1)
+			var b strings.Builder
+			closed := false
+			for i < len(src) {
+				if src[i] == '"' {
+					if i+1 < len(src) && src[i+1] == '"' {
+						b.WriteByte('"')
+						advance(2)
+						continue
+					}
+					advance(1)
+					closed = true
+					break
+				}
+				b.WriteByte(src[i])
+				advance(1)
+			}
+			if !closed {
+				return nil, &MIBSyntaxError{Line: startLine, Column: startCol, Message: "unterminated string"}
+			}
+			tokens = append(tokens, mibToken{mibTokString, b.String(), startLine, startCol})
+
+		case ch == '\'':
+			startLine, startCol := line, col
+			end := strings.IndexByte(src[i+1:], '\'')
+			if end < 0 || i+end+2 >= len(src) {
+				return nil, &MIBSyntaxError{Line: startLine, Column: startCol, Message: "unterminated binary or hex string"}
+			}
+			text := src[i : i+end+3]
+			advance(len(text))
+			tokens = append(tokens, mibToken{mibTokBinString, text, startLine, startCol})
+
+		case isMIBDigit(ch) || (ch == '-' && i+1 < len(src) && isMIBDigit(src[i+1])):
+			startLine, startCol := line, col
+			j := i + 1
+			for j < len(src) && isMIBDigit(src[j]) {
+				j++
+			}
+			text := src[i:j]
+			advance(j - i)
+			tokens = append(tokens, mibToken{mibTokNumber, text, startLine, startCol})
+
+		case isMIBIdentStart(ch):
+			startLine, startCol := line, col
+			j := i + 1
+			for j < len(src) && isMIBIdentChar(src[j]) {
+				// A "--" inside a word starts a comment
+				if src[j] == '-' && j+1 < len(src) && src[j+1] == '-' {
+					break
+				}
+				j++
+			}
+			text := strings.TrimRight(src[i:j], "-")
+			advance(len(text))
+			tokens = append(tokens, mibToken{mibTokIdent, text, startLine, startCol})
+
+		default:
+			startLine, startCol := line, col
+			text := string(ch)
+			switch {
+			case strings.HasPrefix(src[i:], "::="):
+				text = "::="
+			case strings.HasPrefix(src[i:], ".."):
+				text = ".."
+			}
+			advance(len(text))
+			tokens = append(tokens, mibToken{mibTokPunct, text, startLine, startCol})
+		}
+	}
+
+	tokens = append(tokens, mibToken{mibTokEOF, "", line, col})
+	return tokens, nil
+}
+
+func isMIBDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isMIBIdentStart(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_'
+}
+
+func isMIBIdentChar(ch byte) bool {
+	return isMIBIdentStart(ch) || isMIBDigit(ch) || ch == '-'
+}
+
+// Parser
+
+type mibParser struct {
+	tokens []mibToken
+	pos    int
+	module *MIBModule
+}
+
+func (p *mibParser) peek() mibToken {
+	return p.tokens[p.pos]
+}
+
+func (p *mibParser) peekAt(offset int) mibToken {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *mibParser) next() mibToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != mibTokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *mibParser) is(text string) bool {
+	tok := p.peek()
+	return tok.kind != mibTokString && tok.text == text
+}
+
+func (p *mibParser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *mibParser) errorf(tok mibToken, format string, args ...interface{}) error {
+	return &MIBSyntaxError{Line: tok.line, Column: tok.column, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *mibParser) expect(text string) error {
+	tok := p.next()
+	if tok.kind == mibTokString || tok.text != text {
+		return p.errorf(tok, "expected %q, found %s", text, describeMIBToken(tok))
+	}
+	return nil
+}
+
+func (p *mibParser) expectIdent() (mibToken, error) {
+	tok := p.next()
+	if tok.kind != mibTokIdent {
+		return tok, p.errorf(tok, "expected identifier, found %s", describeMIBToken(tok))
+	}
+	return tok, nil
+}
+
+func (p *mibParser) expectString() (string, error) {
+	tok := p.next()
+	if tok.kind != mibTokString {
+		return "", p.errorf(tok, "expected quoted string, found %s", describeMIBToken(tok))
+	}
+	return tok.text, nil
+}
+
+func describeMIBToken(tok mibToken) string {
+	switch tok.kind {
+	case mibTokEOF:
+		return "end of file"
+	case mibTokString:
+		return "quoted string"
+	}
+	return fmt.Sprintf("%q", tok.text)
+}
+
+// skipBalanced skips a {...} or (...) group starting at the current token
+func (p *mibParser) skipBalanced() error {
+	open := p.next()
+	closeText := map[string]string{"{": "}", "(": ")", "[": "]"}[open.text]
+	if closeText == "" {
+		return p.errorf(open, "expected '{' or '(', found %s", describeMIBToken(open))
+	}
+	depth := 1
+	for depth > 0 {
+		tok := p.next()
+		switch {
+		case tok.kind == mibTokEOF:
+			return p.errorf(open, "unbalanced %q", open.text)
+		case tok.kind == mibTokString:
+		case tok.text == open.text:
+			depth++
+		case tok.text == closeText:
+			depth--
+		}
+	}
+	return nil
+}
+
+// rawBalanced returns the source text of a balanced group without the outer delimiters
+func (p *mibParser) rawBalanced() (string, error) {
+	start := p.pos
+	if err := p.skipBalanced(); err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, tok := range p.tokens[start+1 : p.pos-1] {
+		if tok.kind == mibTokString {
+			parts = append(parts, strconv.Quote(tok.text))
+		} else {
+			parts = append(parts, tok.text)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func (p *mibParser) parseModule() (*MIBModule, error) {
+	nameTok, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	p.module = &MIBModule{Name: nameTok.text, SMIVersion: 1, Line: nameTok.line}
+
+	// Optional module OID, e.g. "FOO-MIB { iso ... } DEFINITIONS"
+	if p.is("{") {
+		if err := p.skipBalanced(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("DEFINITIONS"); err != nil {
+		return nil, err
+	}
+	// Tag defaults such as "IMPLICIT TAGS"
+	for !p.is("::=") && p.peek().kind != mibTokEOF {
+		p.next()
+	}
+	if err := p.expect("::="); err != nil {
+		return nil, err
+	}
+	if err := p.expect("BEGIN"); err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == mibTokEOF:
+			return nil, p.errorf(tok, "missing END of module %s", p.module.Name)
+		case tok.text == "END" && tok.kind == mibTokIdent:
+			p.next()
+			return p.module, nil
+		case tok.text == "IMPORTS":
+			if err := p.parseImports(); err != nil {
+				return nil, err
+			}
+		case tok.text == "EXPORTS":
+			for !p.accept(";") {
+				if p.next().kind == mibTokEOF {
+					return nil, p.errorf(tok, "unterminated EXPORTS")
+				}
+			}
+		default:
+			if err := p.parseAssignment(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (p *mibParser) parseImports() error {
+	start := p.next()
+	var pending []string
+	var positions []MIBPosition
+	for !p.accept(";") {
+		tok := p.next()
+		switch {
+		case tok.kind == mibTokEOF:
+			return p.errorf(start, "unterminated IMPORTS")
+		case tok.text == ",":
+		case tok.text == "FROM":
+			modTok, err := p.expectIdent()
+			if err != nil {
+				return err
+			}
+			// Module references may carry an OID value
+			if p.is("{") {
+				if err := p.skipBalanced(); err != nil {
+					return err
+				}
+			}
+			p.module.Imports = append(p.module.Imports, MIBImport{
+				Module:          modTok.text,
+				Symbols:         pending,
+				Line:            modTok.line,
+				Column:          modTok.column,
+				SymbolPositions: positions,
+			})
+			pending, positions = nil, nil
+			if modTok.text == "SNMPv2-SMI" || modTok.text == "SNMPv2-TC" || modTok.text == "SNMPv2-CONF" {
+				p.module.SMIVersion = 2
+			}
+		case tok.kind == mibTokIdent:
+			pending = append(pending, tok.text)
+			positions = append(positions, MIBPosition{Line: tok.line, Column: tok.column})
+		default:
+			return p.errorf(tok, "unexpected %s in IMPORTS", describeMIBToken(tok))
+		}
+	}
+	if len(pending) > 0 {
+		return &MIBSyntaxError{
+			Line:    positions[0].Line,
+			Column:  positions[0].Column,
+			Message: fmt.Sprintf("IMPORTS symbols without FROM clause: %s", strings.Join(pending, ", ")),
+		}
+	}
+	return nil
+}
+
+// mibMacroKinds maps SMI macro invocations to MIBNode kinds
+var mibMacroKinds = map[string]string{
+	"MODULE-IDENTITY":    "module-identity",
+	"OBJECT-IDENTITY":    "object-identity",
+	"OBJECT-TYPE":        "object-type",
+	"NOTIFICATION-TYPE":  "notification-type",
+	"TRAP-TYPE":          "trap-type",
+	"OBJECT-GROUP":       "object-group",
+	"NOTIFICATION-GROUP": "notification-group",
+	"MODULE-COMPLIANCE":  "module-compliance",
+	"AGENT-CAPABILITIES": "agent-capabilities",
+}
+
+func (p *mibParser) parseAssignment() error {
+	nameTok, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	tok := p.peek()
+
+	switch {
+	case tok.text == "MACRO":
+		// Macro definitions only appear in the SMI modules themselves
+		p.module.Macros = append(p.module.Macros, nameTok.text)
+		for {
+			t := p.next()
+			if t.kind == mibTokEOF {
+				return p.errorf(nameTok, "unterminated MACRO %s", nameTok.text)
+			}
+			if t.kind == mibTokIdent && t.text == "END" {
+				return nil
+			}
+		}
+
+	case tok.text == "OBJECT" && p.peekAt(1).text == "IDENTIFIER":
+		p.next()
+		p.next()
+		if err := p.expect("::="); err != nil {
+			return err
+		}
+		node := &MIBNode{Name: nameTok.text, Kind: "oid", Line: nameTok.line, Column: nameTok.column}
+		if err := p.parseOIDValue(node); err != nil {
+			return err
+		}
+		p.module.Nodes = append(p.module.Nodes, node)
+		return nil
+
+	case mibMacroKinds[tok.text] != "":
+		p.next()
+		return p.parseMacroValue(nameTok, mibMacroKinds[tok.text])
+
+	case tok.text == "::=":
+		p.next()
+		return p.parseTypeAssignment(nameTok)
+	}
+
+	return p.errorf(tok, "unexpected %s after %s", describeMIBToken(tok), nameTok.text)
+}
+
+func (p *mibParser) parseTypeAssignment(nameTok mibToken) error {
+	t := &MIBType{Name: nameTok.text, Line: nameTok.line, Column: nameTok.column}
+
+	if p.accept("TEXTUAL-CONVENTION") {
+		t.IsTC = true
+		for !p.is("SYNTAX") {
+			tok := p.next()
+			switch tok.text {
+			case "DISPLAY-HINT":
+				s, err := p.expectString()
+				if err != nil {
+					return err
+				}
+				t.DisplayHint = s
+			case "STATUS":
+				st, err := p.expectIdent()
+				if err != nil {
+					return err
+				}
+				t.Status = st.text
+			case "DESCRIPTION":
+				s, err := p.expectString()
+				if err != nil {
+					return err
+				}
+				t.Description = s
+			case "REFERENCE":
+				if _, err := p.expectString(); err != nil {
+					return err
+				}
+			default:
+				return p.errorf(tok, "unexpected %s in TEXTUAL-CONVENTION %s", describeMIBToken(tok), t.Name)
+			}
+		}
+		p.next()
+	}
+
+	if p.is("CHOICE") {
+		p.next()
+		if err := p.skipBalanced(); err != nil {
+			return err
+		}
+		t.Syntax = &MIBSyntax{Base: "CHOICE"}
+	} else {
+		syntax, err := p.parseSyntax()
+		if err != nil {
+			return err
+		}
+		t.Syntax = syntax
+	}
+
+	p.module.Types = append(p.module.Types, t)
+	return nil
+}
+
+func (p *mibParser) parseMacroValue(nameTok mibToken, kind string) error {
+	node := &MIBNode{Name: nameTok.text, Kind: kind, Line: nameTok.line, Column: nameTok.column}
+	if kind == "module-identity" {
+		p.module.Identity = node.Name
+		p.module.SMIVersion = 2
+	}
+
+	for !p.is("::=") {
+		tok := p.next()
+		if tok.kind == mibTokEOF {
+			return p.errorf(nameTok, "missing ::= for %s", node.Name)
+		}
+
+		switch tok.text {
+		case "SYNTAX":
+			syntax, err := p.parseSyntax()
+			if err != nil {
+				return err
+			}
+			node.Syntax = syntax
+		case "UNITS":
+			s, err := p.expectString()
+			if err != nil {
+				return err
+			}
+			node.Units = s
+		case "MAX-ACCESS", "ACCESS":
+			access, err := p.expectIdent()
+			if err != nil {
+				return err
+			}
+			node.Access = access.text
+		case "STATUS":
+			status, err := p.expectIdent()
+			if err != nil {
+				return err
+			}
+			node.Status = status.text
+		case "DESCRIPTION":
+			s, err := p.expectString()
+			if err != nil {
+				return err
+			}
+			node.Description = s
+			if kind == "module-identity" {
+				p.module.Description = s
+			}
+		case "REFERENCE":
+			s, err := p.expectString()
+			if err != nil {
+				return err
+			}
+			node.Reference = s
+		case "INDEX":
+			if err := p.parseIndex(node); err != nil {
+				return err
+			}
+		case "AUGMENTS":
+			names, err := p.parseNameList()
+			if err != nil {
+				return err
+			}
+			if len(names) > 0 {
+				node.Augments = names[0]
+			}
+		case "DEFVAL":
+			raw, err := p.rawBalanced()
+			if err != nil {
+				return err
+			}
+			node.DefVal = raw
+		case "OBJECTS", "VARIABLES", "NOTIFICATIONS":
+			names, err := p.parseNameList()
+			if err != nil {
+				return err
+			}
+			node.Objects = names
+		case "ENTERPRISE":
+			ent, err := p.expectIdent()
+			if err != nil {
+				return err
+			}
+			node.Enterprise = ent.text
+		case "LAST-UPDATED":
+			s, err := p.expectString()
+			if err != nil {
+				return err
+			}
+			p.module.LastUpdated = s
+		case "ORGANIZATION":
+			s, err := p.expectString()
+			if err != nil {
+				return err
+			}
+			p.module.Organization = s
+		case "CONTACT-INFO":
+			s, err := p.expectString()
+			if err != nil {
+				return err
+			}
+			p.module.ContactInfo = s
+		case "REVISION":
+			date, err := p.expectString()
+			if err != nil {
+				return err
+			}
+			rev := MIBRevision{Date: date}
+			if p.accept("DESCRIPTION") {
+				if rev.Description, err = p.expectString(); err != nil {
+					return err
+				}
+			}
+			p.module.Revisions = append(p.module.Revisions, rev)
+		case "PRODUCT-RELEASE":
+			if _, err := p.expectString(); err != nil {
+				return err
+			}
+		case "MODULE", "SUPPORTS":
+			// Compliance and capability bodies repeat DESCRIPTION and SYNTAX
+			// clauses for the objects they refine; none of it belongs to the node.
+			for !p.is("::=") && p.peek().kind != mibTokEOF {
+				p.next()
+			}
+		default:
+			return p.errorf(tok, "unexpected %s in %s", describeMIBToken(tok), node.Name)
+		}
+	}
+	p.next()
+
+	if kind == "trap-type" {
+		numTok := p.next()
+		n, err := strconv.ParseUint(numTok.text, 10, 32)
+		if numTok.kind != mibTokNumber || err != nil {
+			return p.errorf(numTok, "expected trap number for %s", node.Name)
+		}
+		node.Parent = node.Enterprise
+		node.SubIDs = []uint32{0, uint32(n)}
+	} else if err := p.parseOIDValue(node); err != nil {
+		return err
+	}
+
+	p.module.Nodes = append(p.module.Nodes, node)
+	return nil
+}
+
+// parseOIDValue parses "{ parent 1 2 }" or "{ iso org(3) dod(6) }"
+func (p *mibParser) parseOIDValue(node *MIBNode) error {
+	open := p.peek()
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	first := true
+	for !p.accept("}") {
+		tok := p.next()
+		switch tok.kind {
+		case mibTokIdent:
+			if p.accept("(") {
+				numTok := p.next()
+				n, err := strconv.ParseUint(numTok.text, 10, 32)
+				if err != nil {
+					return p.errorf(numTok, "invalid sub-identifier %s", describeMIBToken(numTok))
+				}
+				if err := p.expect(")"); err != nil {
+					return err
+				}
+				if first {
+					// "iso(1)" style roots are fully numeric
+					node.Parent = ""
+				}
+				node.SubIDs = append(node.SubIDs, uint32(n))
+			} else if first {
+				node.Parent = tok.text
+			} else {
+				return p.errorf(tok, "symbolic sub-identifier %s must carry a number", tok.text)
+			}
+		case mibTokNumber:
+			n, err := strconv.ParseUint(tok.text, 10, 32)
+			if err != nil {
+				return p.errorf(tok, "invalid sub-identifier %s", tok.text)
+			}
+			node.SubIDs = append(node.SubIDs, uint32(n))
+		default:
+			if tok.kind == mibTokEOF {
+				return p.errorf(open, "unterminated OID value for %s", node.Name)
+			}
+			return p.errorf(tok, "unexpected %s in OID value of %s", describeMIBToken(tok), node.Name)
+		}
+		first = false
+	}
+	if node.Parent == "" && len(node.SubIDs) == 0 {
+		return p.errorf(open, "empty OID value for %s", node.Name)
+	}
+	return nil
+}
+
+func (p *mibParser) parseIndex(node *MIBNode) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.accept("}") {
+		tok := p.next()
+		switch {
+		case tok.text == ",":
+		case tok.text == "IMPLIED":
+			node.Implied = true
+		case tok.kind == mibTokIdent:
+			// SMIv1 allows base types such as "INTEGER" or "OCTET STRING" as index
+			if tok.text == "OCTET" || tok.text == "OBJECT" {
+				p.next()
+				node.Index = append(node.Index, tok.text+" "+p.tokens[p.pos-1].text)
+				continue
+			}
+			node.Index = append(node.Index, tok.text)
+		default:
+			return p.errorf(tok, "unexpected %s in INDEX of %s", describeMIBToken(tok), node.Name)
+		}
+	}
+	return nil
+}
+
+func (p *mibParser) parseNameList() ([]string, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var names []string
+	for !p.accept("}") {
+		tok := p.next()
+		switch {
+		case tok.text == ",":
+		case tok.kind == mibTokIdent:
+			names = append(names, tok.text)
+		default:
+			return nil, p.errorf(tok, "unexpected %s in object list", describeMIBToken(tok))
+		}
+	}
+	return names, nil
+}
+
+func (p *mibParser) parseSyntax() (*MIBSyntax, error) {
+	s := &MIBSyntax{}
+
+	// [APPLICATION n] IMPLICIT tags in the SMI modules
+	if p.is("[") {
+		if err := p.skipBalanced(); err != nil {
+			return nil, err
+		}
+		p.accept("IMPLICIT")
+	}
+
+	tok, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok.text {
+	case "OCTET":
+		if err := p.expect("STRING"); err != nil {
+			return nil, err
+		}
+		s.Base = "OCTET STRING"
+	case "OBJECT":
+		if err := p.expect("IDENTIFIER"); err != nil {
+			return nil, err
+		}
+		s.Base = "OBJECT IDENTIFIER"
+	case "SEQUENCE":
+		if p.accept("OF") {
+			entry, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			s.Base = "SEQUENCE OF"
+			s.SequenceOf = entry.text
+			return s, nil
+		}
+		s.Base = "SEQUENCE"
+		fields, err := p.parseSequenceFields()
+		if err != nil {
+			return nil, err
+		}
+		s.Fields = fields
+		return s, nil
+	default:
+		s.Base = tok.text
+	}
+
+	if p.is("{") {
+		enums, err := p.parseNamedNumbers()
+		if err != nil {
+			return nil, err
+		}
+		s.Enums = enums
+	}
+	if p.is("(") {
+		if err := p.parseConstraint(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *mibParser) parseSequenceFields() ([]MIBField, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []MIBField
+	for !p.accept("}") {
+		nameTok, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		syntax, err := p.parseSyntax()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, MIBField{Name: nameTok.text, Syntax: syntax})
+		if !p.accept(",") && !p.is("}") {
+			return nil, p.errorf(p.peek(), "expected ',' or '}' in SEQUENCE, found %s", describeMIBToken(p.peek()))
+		}
+	}
+	return fields, nil
+}
+
+func (p *mibParser) parseNamedNumbers() ([]MIBEnum, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var enums []MIBEnum
+	for !p.accept("}") {
+		label, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		numTok := p.next()
+		value, err := strconv.ParseInt(numTok.text, 10, 64)
+		if numTok.kind != mibTokNumber || err != nil {
+			return nil, p.errorf(numTok, "invalid value for %s", label.text)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		enums = append(enums, MIBEnum{Label: label.text, Value: value})
+		if !p.accept(",") && !p.is("}") {
+			return nil, p.errorf(p.peek(), "expected ',' or '}' in enumeration, found %s", describeMIBToken(p.peek()))
+		}
+	}
+	return enums, nil
+}
+
+// parseConstraint parses "(0..255 | 300)" or "(SIZE (0..64))"
+func (p *mibParser) parseConstraint(s *MIBSyntax) error {
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	if p.accept("SIZE") {
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		ranges, err := p.parseRanges()
+		if err != nil {
+			return err
+		}
+		s.Sizes = ranges
+		return p.expect(")")
+	}
+	ranges, err := p.parseRanges()
+	if err != nil {
+		return err
+	}
+	s.Ranges = ranges
+	return nil
+}
+
+// parseRanges consumes range items up to and including the closing ")"
+func (p *mibParser) parseRanges() ([]MIBRange, error) {
+	var ranges []MIBRange
+	for {
+		min, err := p.parseRangeValue()
+		if err != nil {
+			return nil, err
+		}
+		r := MIBRange{Min: min, Max: min}
+		if p.accept("..") {
+			if r.Max, err = p.parseRangeValue(); err != nil {
+				return nil, err
+			}
+		}
+		ranges = append(ranges, r)
+		if p.accept(")") {
+			return ranges, nil
+		}
+		if err := p.expect("|"); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *mibParser) parseRangeValue() (string, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == mibTokNumber, tok.kind == mibTokBinString:
+		return tok.text, nil
+	case tok.text == "MIN" || tok.text == "MAX":
+		return tok.text, nil
+	}
+	return "", p.errorf(tok, "invalid range value %s", describeMIBToken(tok))
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBaseMIBs(t *testing.T) {
+	resolver := baseMIBResolver(t)
+	for _, entry := range resolver.entries {
+		module := entry.module
+		if missing := resolver.MissingImports(module); len(missing) > 0 {
+			t.Errorf("%s: missing imports %+v", module.Name, missing)
+		}
+		for _, node := range module.Nodes {
+			if node.OID == "" {
+				t.Errorf("%s::%s has no OID", module.Name, node.Name)
+			}
+		}
+	}
+
+	tests := []struct {
+		module, name, oid string
+	}{
+		{"SNMPv2-SMI", "enterprises", "1.3.6.1.4.1"},
+		{"SNMPv2-MIB", "sysDescr", "1.3.6.1.2.1.1.1"},
+		{"SNMPv2-MIB", "coldStart", "1.3.6.1.6.3.1.1.5.1"},
+		{"SNMPv2-MIB", "snmpTrapOID", "1.3.6.1.6.3.1.1.4.1"},
+		{"RFC1213-MIB", "ifDescr", "1.3.6.1.2.1.2.2.1.2"},
+		{"IF-MIB", "ifOperStatus", "1.3.6.1.2.1.2.2.1.8"},
+		{"IF-MIB", "ifHCInOctets", "1.3.6.1.2.1.31.1.1.1.6"},
+		{"IF-MIB", "linkDown", "1.3.6.1.6.3.1.1.5.3"},
+		{"IF-MIB", "ifTestResult", "1.3.6.1.2.1.31.1.3.1.4"},
+		{"IANAifType-MIB", "ianaifType", "1.3.6.1.2.1.30"},
+		{"IP-MIB", "ipAddressIfIndex", "1.3.6.1.2.1.4.34.1.3"},
+		{"HOST-RESOURCES-MIB", "hrStorageUsed", "1.3.6.1.2.1.25.2.3.1.6"},
+		{"HOST-RESOURCES-MIB", "hrProcessorLoad", "1.3.6.1.2.1.25.3.3.1.2"},
+		{"HOST-RESOURCES-MIB", "hrFSMountPoint", "1.3.6.1.2.1.25.3.8.1.2"},
+		{"HOST-RESOURCES-TYPES", "hrStorageFixedDisk", "1.3.6.1.2.1.25.2.1.4"},
+		{"HOST-RESOURCES-TYPES", "hrFSLinuxExt2", "1.3.6.1.2.1.25.3.9.23"},
+		{"ENTITY-MIB", "entPhysicalDescr", "1.3.6.1.2.1.47.1.1.1.1.2"},
+		{"SNMP-FRAMEWORK-MIB", "snmpEngineID", "1.3.6.1.6.3.10.2.1.1"},
+	}
+	for _, tt := range tests {
+		module := resolver.Module(tt.module)
+		if module == nil {
+			t.Errorf("module %s not found", tt.module)
+			continue
+		}
+		node := module.Node(tt.name)
+		if node == nil {
+			t.Errorf("%s::%s not found", tt.module, tt.name)
+			continue
+		}
+		if node.OID != tt.oid {
+			t.Errorf("%s::%s = %s, want %s", tt.module, tt.name, node.OID, tt.oid)
+		}
+	}
+
+	for name, version := range map[string]int{"RFC1213-MIB": 1, "RFC1155-SMI": 1, "IF-MIB": 2, "SNMPv2-MIB": 2} {
+		if got := resolver.Module(name).SMIVersion; got != version {
+			t.Errorf("%s: SMI version %d, want %d", name, got, version)
+		}
+	}
+}
+
+const testParserMIB = `TEST-PARSER-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, NOTIFICATION-TYPE,
+    Integer32, enterprises             FROM SNMPv2-SMI
+    TEXTUAL-CONVENTION, DisplayString  FROM SNMPv2-TC;
+
+testParserMIB MODULE-IDENTITY
+    LAST-UPDATED "202402010000Z"
+    ORGANIZATION "Test"
+    CONTACT-INFO "Test"
+    DESCRIPTION  "Parser test module"
+    REVISION     "202402010000Z"
+    DESCRIPTION  "Second revision"
+    REVISION     "202401010000Z"
+    DESCRIPTION  "Initial revision"
+    ::= { enterprises 99999 }
+
+TestLabel ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "32a"
+    STATUS       current
+    DESCRIPTION  "A short label"
+    SYNTAX       OCTET STRING (SIZE (0..32))
+
+testObjects OBJECT IDENTIFIER ::= { testParserMIB 1 }
+
+testTable OBJECT-TYPE
+    SYNTAX      SEQUENCE OF TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A table"
+    ::= { testObjects 1 }
+
+testEntry OBJECT-TYPE
+    SYNTAX      TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A row"
+    INDEX       { testIndex, IMPLIED testName }
+    ::= { testTable 1 }
+
+TestEntry ::= SEQUENCE {
+    testIndex   Integer32,
+    testName    TestLabel,
+    testState   INTEGER
+}
+
+testIndex OBJECT-TYPE
+    SYNTAX      Integer32 (1..100 | 200)
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "The index"
+    ::= { testEntry 1 }
+
+testName OBJECT-TYPE
+    SYNTAX      TestLabel
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "The name"
+    ::= { testEntry 2 }
+
+testState OBJECT-TYPE
+    SYNTAX      INTEGER { up(1), down(2), testing(3) }
+    UNITS       "state"
+    MAX-ACCESS  read-write
+    STATUS      current
+    DESCRIPTION "The state, with a ""quoted"" word"
+    DEFVAL      { down }
+    ::= { testEntry 3 }
+
+testNotifications OBJECT IDENTIFIER ::= { testParserMIB 0 }
+
+testStateChange NOTIFICATION-TYPE
+    OBJECTS     { testState }
+    STATUS      current
+    DESCRIPTION "The state changed"
+    ::= { testNotifications 1 }
+
+END
+`
+
+func TestParseMIBDefinitions(t *testing.T) {
+	module, err := ParseMIB([]byte(testParserMIB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if module.Name != "TEST-PARSER-MIB" || module.SMIVersion != 2 || module.Identity != "testParserMIB" {
+		t.Fatalf("module %s, SMI version %d, identity %s", module.Name, module.SMIVersion, module.Identity)
+	}
+	if module.LastUpdated != "202402010000Z" || len(module.Revisions) != 2 || module.Revisions[1].Date != "202401010000Z" {
+		t.Errorf("last updated %s, revisions %+v", module.LastUpdated, module.Revisions)
+	}
+	if len(module.Imports) != 2 || module.ImportedFrom("DisplayString") != "SNMPv2-TC" || module.ImportedFrom("enterprises") != "SNMPv2-SMI" {
+		t.Errorf("imports %+v", module.Imports)
+	}
+	if imp := module.Imports[1]; imp.Line != 6 || imp.Column != 45 || imp.SymbolPositions[1] != (MIBPosition{Line: 6, Column: 25}) {
+		t.Errorf("import positions %+v", imp)
+	}
+
+	module.ResolveOIDs(nil)
+	tests := []struct {
+		name, kind, oid string
+		line, column    int
+	}{
+		{"testParserMIB", "module-identity", "1.3.6.1.4.1.99999", 8, 1},
+		{"testObjects", "oid", "1.3.6.1.4.1.99999.1", 25, 1},
+		{"testEntry", "object-type", "1.3.6.1.4.1.99999.1.1.1", 34, 1},
+		{"testState", "object-type", "1.3.6.1.4.1.99999.1.1.1.3", 62, 1},
+		{"testStateChange", "notification-type", "1.3.6.1.4.1.99999.0.1", 73, 1},
+	}
+	for _, tt := range tests {
+		node := module.Node(tt.name)
+		if node == nil {
+			t.Errorf("%s not found", tt.name)
+			continue
+		}
+		if node.Kind != tt.kind || node.OID != tt.oid || node.Line != tt.line || node.Column != tt.column {
+			t.Errorf("%s: kind %s, OID %s at %d:%d; want %s, %s at %d:%d",
+				tt.name, node.Kind, node.OID, node.Line, node.Column, tt.kind, tt.oid, tt.line, tt.column)
+		}
+	}
+
+	entry := module.Node("testEntry")
+	if strings.Join(entry.Index, ",") != "testIndex,testName" || !entry.Implied {
+		t.Errorf("testEntry INDEX %v, implied %v", entry.Index, entry.Implied)
+	}
+	index := module.Node("testIndex").Syntax
+	if index.Base != "Integer32" || len(index.Ranges) != 2 || index.Ranges[0] != (MIBRange{"1", "100"}) || index.Ranges[1] != (MIBRange{"200", "200"}) {
+		t.Errorf("testIndex syntax %+v", index)
+	}
+	state := module.Node("testState")
+	if len(state.Syntax.Enums) != 3 || state.Syntax.Enums[1] != (MIBEnum{"down", 2}) {
+		t.Errorf("testState enums %+v", state.Syntax.Enums)
+	}
+	if state.Access != "read-write" || state.Units != "state" || state.DefVal != "down" || state.Description != `The state, with a "quoted" word` {
+		t.Errorf("testState access %q, units %q, defval %q, description %q", state.Access, state.Units, state.DefVal, state.Description)
+	}
+	if objects := module.Node("testStateChange").Objects; len(objects) != 1 || objects[0] != "testState" {
+		t.Errorf("testStateChange objects %v", objects)
+	}
+	label := module.Type("TestLabel")
+	if label == nil || !label.IsTC || label.DisplayHint != "32a" || label.Syntax.Base != "OCTET STRING" || label.Syntax.Sizes[0] != (MIBRange{"0", "32"}) {
+		t.Errorf("TestLabel %+v", label)
+	}
+	if seq := module.Type("TestEntry"); seq == nil || seq.Syntax.Base != "SEQUENCE" || len(seq.Syntax.Fields) != 3 {
+		t.Errorf("TestEntry %+v", seq)
+	}
+}
+
+func TestParseMIBSMIv1(t *testing.T) {
+	src := `TEST-V1-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    enterprises FROM RFC1155-SMI
+    OBJECT-TYPE FROM RFC-1212
+    TRAP-TYPE   FROM RFC-1215;
+
+test        OBJECT IDENTIFIER ::= { enterprises 99998 }
+
+testCount OBJECT-TYPE
+    SYNTAX  Counter
+    ACCESS  read-only
+    STATUS  mandatory
+    DESCRIPTION "A counter"
+    ::= { test 1 }
+
+testTrap TRAP-TYPE
+    ENTERPRISE  test
+    VARIABLES   { testCount }
+    DESCRIPTION "A trap"
+    ::= 7
+
+END
+`
+	module, err := ParseMIB([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	module.ResolveOIDs(nil)
+	if module.SMIVersion != 1 {
+		t.Errorf("SMI version %d", module.SMIVersion)
+	}
+	count := module.Node("testCount")
+	if count.OID != "1.3.6.1.4.1.99998.1" || count.Access != "read-only" || count.Status != "mandatory" {
+		t.Errorf("testCount %+v", count)
+	}
+	trap := module.Node("testTrap")
+	if trap == nil || trap.Kind != "trap-type" || trap.Enterprise != "test" || len(trap.Objects) != 1 {
+		t.Fatalf("testTrap %+v", trap)
+	}
+	// RFC 3584 3.1: enterprise.0.specific
+	if trap.OID != "1.3.6.1.4.1.99998.0.7" {
+		t.Errorf("testTrap OID %s", trap.OID)
+	}
+}
+
+func TestParseMIBMultipleModules(t *testing.T) {
+	src := `FIRST-MIB DEFINITIONS ::= BEGIN
+first OBJECT IDENTIFIER ::= { enterprises 1 }
+END
+
+SECOND-MIB DEFINITIONS ::= BEGIN
+second OBJECT IDENTIFIER ::= { enterprises 2 }
+END
+`
+	module, err := ParseMIB([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if module.Name != "FIRST-MIB" || module.Node("first") == nil || module.Node("second") != nil {
+		t.Errorf("got module %s with nodes %v", module.Name, module.Nodes)
+	}
+}
+
+func TestParseMIBErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		src          string
+		line, column int
+		message      string
+	}{
+		{"empty", "", 1, 1, "expected"},
+		{"no DEFINITIONS", "TEST-MIB BEGIN END", 1, 10, "DEFINITIONS"},
+		{"missing END", "TEST-MIB DEFINITIONS ::= BEGIN\ntest OBJECT IDENTIFIER ::= { enterprises 1 }\n", 3, 1, "missing END"},
+		{"unterminated string", "TEST-MIB DEFINITIONS ::= BEGIN\n\ntest OBJECT-TYPE\n    DESCRIPTION \"open\nEND\n", 4, 17, "unterminated string"},
+		{"unterminated hex string", "TEST-MIB DEFINITIONS ::= BEGIN\nx INTEGER ::= 'ff\n", 2, 15, "unterminated binary or hex string"},
+		{"unterminated IMPORTS", "TEST-MIB DEFINITIONS ::= BEGIN\nIMPORTS enterprises FROM SNMPv2-SMI\n", 2, 1, "unterminated IMPORTS"},
+		{"IMPORTS without FROM", "TEST-MIB DEFINITIONS ::= BEGIN\nIMPORTS enterprises;\nEND\n", 2, 9, "without FROM"},
+		{"bad IMPORTS token", "TEST-MIB DEFINITIONS ::= BEGIN\nIMPORTS 42 FROM SNMPv2-SMI;\nEND\n", 2, 9, "unexpected"},
+		{"unterminated OID value", "TEST-MIB DEFINITIONS ::= BEGIN\ntest OBJECT IDENTIFIER ::= { enterprises 1\nEND\n", 3, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMIB([]byte(tt.src))
+			syntaxErr, ok := err.(*MIBSyntaxError)
+			if !ok {
+				t.Fatalf("got %v, want a syntax error", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column || !strings.Contains(syntaxErr.Message, tt.message) {
+				t.Errorf("got %v, want line %d, column %d: ...%s...", err, tt.line, tt.column, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mibResolveMu serialises store-wide import resolution runs
+var mibResolveMu sync.Mutex
+
+// MIBMissingImport lists symbols a module imports that cannot be found.
+// An empty Module means the symbols are used as OID parents without being
+// defined or imported at all.
+type MIBMissingImport struct {
+	Module        string   `json:"module"`
+	Symbols       []string `json:"symbols"`
+	ModuleMissing bool     `json:"module_missing"`
+}
+
+// mibResolverEntry pairs a stored MIB file with its parsed module
+type mibResolverEntry struct {
+	file   MIBFile
+	module *MIBModule
+}
+
+// MIBResolver resolves IMPORTS and numeric OIDs across a set of MIB modules
+type MIBResolver struct {
+	entries []*mibResolverEntry
+	modules map[string]*mibResolverEntry // module name -> entry
+}
+
+// NewMIBResolver creates an empty resolver
+func NewMIBResolver() *MIBResolver {
+	return &MIBResolver{modules: make(map[string]*mibResolverEntry)}
+}
+
+// LoadMIBResolver parses every current MIB file into a new resolver. Bundled
+// base modules are added first so that uploaded copies take precedence.
+// Files that can no longer be read or parsed are returned separately.
+func LoadMIBResolver() (*MIBResolver, []MIBFile, error) {
+	var files []MIBFile
+	if err := db.Where("module_name <> '' AND current_id IS NULL").Order("source <> 'system', id").Find(&files).Error; err != nil {
+		return nil, nil, err
+	}
+
+	resolver := NewMIBResolver()
+	var failed []MIBFile
+	for _, file := range files {
+		content, err := readMIBFile(&file)
+		if err != nil {
+			failed = append(failed, file)
+			continue
+		}
+		module, err := ParseMIB(content)
+		if err != nil {
+			failed = append(failed, file)
+			continue
+		}
+		resolver.Add(file, module)
+	}
+	return resolver, failed, nil
+}
+
+// Add registers a parsed module. When two files define the same module the
+// one added last wins.
+func (r *MIBResolver) Add(file MIBFile, module *MIBModule) {
+	entry := &mibResolverEntry{file: file, module: module}
+	r.entries = append(r.entries, entry)
+	r.modules[module.Name] = entry
+}
+
+// Module returns the parsed module registered under name, or nil
+func (r *MIBResolver) Module(name string) *MIBModule {
+	if entry := r.modules[name]; entry != nil {
+		return entry.module
+	}
+	return nil
+}
+
+// Resolve computes numeric OIDs for all modules, following imports until no
+// further node can be resolved.
+func (r *MIBResolver) Resolve() {
+	for progress := true; progress; {
+		progress = false
+		for _, entry := range r.entries {
+			before := countResolvedNodes(entry.module)
+			entry.module.ResolveOIDs(r.lookupFor(entry.module))
+			if countResolvedNodes(entry.module) != before {
+				progress = true
+			}
+		}
+	}
+}
+
+func countResolvedNodes(module *MIBModule) int {
+	count := 0
+	for _, node := range module.Nodes {
+		if node.OID != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// lookupFor returns the symbol lookup used when resolving module
+func (r *MIBResolver) lookupFor(module *MIBModule) func(string) (string, bool) {
+	return func(symbol string) (string, bool) {
+		from := r.Module(module.ImportedFrom(symbol))
+		if from == nil {
+			return "", false
+		}
+		node := from.Node(symbol)
+		if node == nil || node.OID == "" {
+			return "", false
+		}
+		return node.OID, true
+	}
+}
+
+// MissingImports reports imported modules and symbols that cannot be found,
+// plus OID parents that are neither defined nor imported.
+func (r *MIBResolver) MissingImports(module *MIBModule) []MIBMissingImport {
+	var missing []MIBMissingImport
+	for _, imp := range module.Imports {
+		from := r.Module(imp.Module)
+		if from == nil {
+			missing = append(missing, MIBMissingImport{Module: imp.Module, Symbols: imp.Symbols, ModuleMissing: true})
+			continue
+		}
+		var symbols []string
+		for _, symbol := range imp.Symbols {
+			if !from.Defines(symbol) {
+				symbols = append(symbols, symbol)
+			}
+		}
+		if len(symbols) > 0 {
+			missing = append(missing, MIBMissingImport{Module: imp.Module, Symbols: symbols})
+		}
+	}
+
+	var undefined []string
+	seen := make(map[string]bool)
+	for _, node := range module.Nodes {
+		if node.Parent == "" || seen[node.Parent] {
+			continue
+		}
+		if module.Node(node.Parent) == nil && module.ImportedFrom(node.Parent) == "" {
+			if _, root := smiRootOIDs[node.Parent]; !root {
+				undefined = append(undefined, node.Parent)
+			}
+		}
+		seen[node.Parent] = true
+	}
+	if len(undefined) > 0 {
+		missing = append(missing, MIBMissingImport{Symbols: undefined})
+	}
+	return missing
+}
+
+// ResolveImports re-resolves IMPORTS and OIDs across all stored MIB files,
+// refreshes their OID tree rows and marks files whose dependencies cannot be
+// found as "unresolved".
+func (mm *MIBManager) ResolveImports() error {
+	mibResolveMu.Lock()
+	defer mibResolveMu.Unlock()
+
+	resolver, failed, err := LoadMIBResolver()
+	if err != nil {
+		return err
+	}
+	for _, file := range failed {
+		content, err := readMIBFile(&file)
+		if err == nil {
+			_, err = ParseMIB(content)
+		}
+		applyMIBDiagnostics(&file, mibSyntaxDiagnostics(err))
+		file.UpdatedAt = time.Now()
+		db.Save(&file)
+	}
+
+	resolver.Resolve()
+
+	lint := loadMIBLintSettings()
+	for _, entry := range resolver.entries {
+		file := entry.file
+		applyMIBValidation(&file, entry.module, resolver, lint)
+		file.UpdatedAt = time.Now()
+		if err := db.Save(&file).Error; err != nil {
+			return err
+		}
+		if err := mm.storeMIBObjects(&file, entry.module); err != nil {
+			return fmt.Errorf("failed to store objects of %s: %v", file.ModuleName, err)
+		}
+	}
+	return nil
+}
+
+// MIB dependency API handlers
+
+// getMIBDependencyGraph returns every stored module as a node and every
+// IMPORTS clause as an edge. Imported modules that are not stored appear as
+// nodes with status "missing".
+func getMIBDependencyGraph(c *gin.Context) {
+	var files []MIBFile
+	db.Where("module_name <> '' AND current_id IS NULL").Order("module_name").Find(&files)
+
+	known := make(map[string]bool, len(files))
+	for _, file := range files {
+		known[file.ModuleName] = true
+	}
+
+	nodes := make([]gin.H, 0, len(files))
+	edges := []gin.H{}
+	missingModules := make(map[string]bool)
+	for _, file := range files {
+		nodes = append(nodes, gin.H{
+			"id":          file.ID,
+			"module":      file.ModuleName,
+			"filename":    file.Filename,
+			"status":      file.Status,
+			"source":      file.Source,
+			"has_missing": file.MissingImports != "",
+		})
+
+		var imports []MIBImport
+		json.Unmarshal([]byte(file.Imports), &imports)
+		for _, imp := range imports {
+			edges = append(edges, gin.H{
+				"from":     file.ModuleName,
+				"to":       imp.Module,
+				"symbols":  imp.Symbols,
+				"resolved": known[imp.Module],
+			})
+			if !known[imp.Module] {
+				missingModules[imp.Module] = true
+			}
+		}
+	}
+
+	missing := make([]string, 0, len(missingModules))
+	for module := range missingModules {
+		missing = append(missing, module)
+	}
+	sort.Strings(missing)
+	for _, module := range missing {
+		nodes = append(nodes, gin.H{"id": 0, "module": module, "status": "missing"})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"nodes":           nodes,
+		"edges":           edges,
+		"missing_modules": missing,
+	})
+}
+
+// getMIBFileDependencies returns the imports of one MIB file, what is missing
+// from them, and which stored modules depend on it.
+func getMIBFileDependencies(c *gin.Context) {
+	id := c.Param("id")
+	var file MIBFile
+	if err := db.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MIB file not found"})
+		return
+	}
+
+	var imports []MIBImport
+	json.Unmarshal([]byte(file.Imports), &imports)
+	var missing []MIBMissingImport
+	json.Unmarshal([]byte(file.MissingImports), &missing)
+
+	dependencies := make([]gin.H, 0, len(imports))
+	for _, imp := range imports {
+		var provider MIBFile
+		dependency := gin.H{"module": imp.Module, "symbols": imp.Symbols, "mib_file_id": nil}
+		if err := db.Where("module_name = ? AND current_id IS NULL", imp.Module).Order("source = 'system', id desc").First(&provider).Error; err == nil {
+			dependency["mib_file_id"] = provider.ID
+		}
+		dependencies = append(dependencies, dependency)
+	}
+
+	dependents := []gin.H{}
+	if file.ModuleName != "" {
+		var candidates []MIBFile
+		db.Where("imports LIKE ? AND current_id IS NULL", "%\""+file.ModuleName+"\"%").Find(&candidates)
+		for _, candidate := range candidates {
+			var candidateImports []MIBImport
+			json.Unmarshal([]byte(candidate.Imports), &candidateImports)
+			for _, imp := range candidateImports {
+				if imp.Module == file.ModuleName {
+					dependents = append(dependents, gin.H{"id": candidate.ID, "module": candidate.ModuleName})
+					break
+				}
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           file.ID,
+		"module":       file.ModuleName,
+		"status":       file.Status,
+		"dependencies": dependencies,
+		"missing":      missing,
+		"dependents":   dependents,
+	})
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// mibSource lists and reads the MIB files of a MIBServerPath
+type mibSource interface {
+	// Walk visits every file below the configured path. The paths passed to
+	// fn are the ones recorded as MIBFile.SourcePath.
+	Walk(fn func(path string, info os.FileInfo, err error))
+	Open(path string) (io.ReadCloser, error)
+	Close() error
+}
+
+// mibSourceNames maps MIBServerPath types to the MIBFile Source of the
+// files they provide
+var mibSourceNames = map[string]string{
+	"ssh":   "server",
+	"local": "local",
+	"git":   "git",
+}
+
+// Validate checks that a server path is complete for its type
+func (p *MIBServerPath) Validate() error {
+	if p.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	switch p.Type {
+	case "ssh":
+		if p.Host == "" {
+			return fmt.Errorf("host is required for ssh sources")
+		}
+	case "local":
+		if !filepath.IsAbs(p.Path) {
+			return fmt.Errorf("local sources need an absolute path")
+		}
+		if err := checkLocalRoots(p.Type, p.Path); err != nil {
+			return err
+		}
+	case "git":
+		repo := p.Path
+		if strings.HasPrefix(repo, "file://") {
+			u, err := url.Parse(repo)
+			if err != nil || (u.Host != "" && u.Host != "localhost") {
+				return fmt.Errorf("invalid file:// URL %q", p.Path)
+			}
+			repo = u.Path
+		}
+		if !filepath.IsAbs(repo) {
+			return fmt.Errorf("git sources need an absolute path or a file:// URL")
+		}
+		if err := checkLocalRoots(p.Type, repo); err != nil {
+			return err
+		}
+		if strings.HasPrefix(p.Ref, "-") {
+			return fmt.Errorf("invalid git ref %q", p.Ref)
+		}
+		if subdir := path.Clean(p.Subdir); path.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, "../") {
+			return fmt.Errorf("subdirectory %q is outside the repository", p.Subdir)
+		}
+	default:
+		return fmt.Errorf("unknown source type %q (ssh, local, git)", p.Type)
+	}
+	return nil
+}
+
+// mibLocalRootsEnv lists the directories local and git sources may read,
+// separated like PATH. It is set by the administrator running the server
+// rather than through the API, and both are refused while it is empty.
+const mibLocalRootsEnv = "SNMP_MONITOR_MIB_LOCAL_ROOTS"
+
+// checkLocalRoots checks that the absolute path dir, with its symlinks
+// resolved, is within the allowed directories of local and git sources
+func checkLocalRoots(sourceType, dir string) error {
+	roots := mibLocalRoots()
+	if len(roots) == 0 {
+		return fmt.Errorf("%s sources are disabled; the administrator allows directories with %s", sourceType, mibLocalRootsEnv)
+	}
+	clean := filepath.Clean(dir)
+	if resolved, err := filepath.EvalSymlinks(clean); err == nil {
+		clean = resolved
+	}
+	if !pathWithin(clean, roots) {
+		return fmt.Errorf("%s is outside the directories allowed for %s sources", dir, sourceType)
+	}
+	return nil
+}
+
+// mibLocalRoots returns the allowed directories of local sources with their
+// symlinks resolved
+func mibLocalRoots() []string {
+	var roots []string
+	for _, root := range filepath.SplitList(os.Getenv(mibLocalRootsEnv)) {
+		if !filepath.IsAbs(root) {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+		roots = append(roots, filepath.Clean(root))
+	}
+	return roots
+}
+
+// pathWithin reports whether the clean absolute path p is one of dirs or
+// below one of them
+func pathWithin(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact clears the SSH credentials of a server path before it is returned
+// by the API; they are write-only
+func (p *MIBServerPath) redact() {
+	p.Password, p.SSHKey = "", ""
+}
+
+// openMIBSource connects to the source behind a server path. Git sources
+// are cloned or pulled and checked out first.
+func (mm *MIBManager) openMIBSource(pathConfig *MIBServerPath) (mibSource, error) {
+	if err := pathConfig.Validate(); err != nil {
+		return nil, err
+	}
+	switch pathConfig.Type {
+	case "local":
+		return newLocalMIBSource(pathConfig.Path, "", mibLocalRoots())
+	case "git":
+		repoDir := filepath.Join(mm.syncDir, "git", strconv.FormatUint(uint64(pathConfig.ID), 10))
+		if err := checkoutGitMIBSource(repoDir, pathConfig.Path, pathConfig.Ref); err != nil {
+			return nil, err
+		}
+		resolved, err := filepath.EvalSymlinks(repoDir)
+		if err != nil {
+			return nil, err
+		}
+		// A missing subdirectory lost its last file and is walked as empty
+		return &localMIBSource{
+			root:   filepath.Join(repoDir, filepath.FromSlash(pathConfig.Subdir)),
+			base:   repoDir,
+			within: []string{resolved},
+		}, nil
+	default:
+		return newSFTPMIBSource(pathConfig)
+	}
+}
+
+// sftpMIBSource reads a directory on an SSH server over SFTP
+type sftpMIBSource struct {
+	ssh    *SSHClient
+	client *sftp.Client
+	root   string
+}
+
+func newSFTPMIBSource(pathConfig *MIBServerPath) (*sftpMIBSource, error) {
+	sshClient := &SSHClient{
+		Host:       pathConfig.Host,
+		Port:       pathConfig.SSHPort,
+		Username:   pathConfig.Username,
+		Password:   pathConfig.Password,
+		PrivateKey: pathConfig.SSHKey,
+	}
+	if err := sshClient.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to server: %v", err)
+	}
+	client, err := sshClient.SFTP()
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+
+	source := &sftpMIBSource{ssh: sshClient, client: client, root: pathConfig.Path}
+	if info, err := client.Stat(source.root); err != nil {
+		source.Close()
+		return nil, fmt.Errorf("failed to read %s: %v", source.root, err)
+	} else if !info.IsDir() {
+		source.Close()
+		return nil, fmt.Errorf("%s is not a directory", source.root)
+	}
+	return source, nil
+}
+
+func (s *sftpMIBSource) Walk(fn func(path string, info os.FileInfo, err error)) {
+	walker := s.client.Walk(s.root)
+	for walker.Step() {
+		fn(walker.Path(), walker.Stat(), walker.Err())
+	}
+}
+
+func (s *sftpMIBSource) Open(path string) (io.ReadCloser, error) {
+	return s.client.Open(path)
+}
+
+func (s *sftpMIBSource) Close() error {
+	s.client.Close()
+	return s.ssh.Close()
+}
+
+// localMIBSource reads a local directory such as an NFS mount. When base is
+// set, paths are reported relative to it in slash form. Symlinks are only
+// followed while they resolve within the within directories.
+type localMIBSource struct {
+	root   string
+	base   string
+	within []string
+}
+
+func newLocalMIBSource(root, base string, within []string) (*localMIBSource, error) {
+	if info, err := os.Stat(root); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", root, err)
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	} else if !pathWithin(resolved, within) {
+		return nil, fmt.Errorf("%s resolves outside the allowed directories", root)
+	}
+	return &localMIBSource{root: root, base: base, within: within}, nil
+}
+
+func (s *localMIBSource) Walk(fn func(path string, info os.FileInfo, err error)) {
+	filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if info != nil && info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if err != nil && path == s.root && s.base != "" && os.IsNotExist(err) {
+			return nil
+		}
+		if s.base != "" {
+			if rel, relErr := filepath.Rel(s.base, path); relErr == nil {
+				path = filepath.ToSlash(rel)
+			}
+		}
+		fn(path, info, err)
+		return nil
+	})
+}
+
+func (s *localMIBSource) Open(path string) (io.ReadCloser, error) {
+	if s.base != "" {
+		path = filepath.Join(s.base, filepath.FromSlash(path))
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if !pathWithin(resolved, s.within) {
+		return nil, fmt.Errorf("%s resolves outside the allowed directories", path)
+	}
+	return os.Open(resolved)
+}
+
+func (s *localMIBSource) Close() error {
+	return nil
+}
+
+// checkoutGitMIBSource clones repo into repoDir, or fetches it when already
+// cloned, and checks out ref (a branch, tag or commit; the remote HEAD when
+// empty). Only local repositories may be used.
+func checkoutGitMIBSource(repoDir, repo, ref string) error {
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); err != nil {
+		os.RemoveAll(repoDir)
+		if err := os.MkdirAll(filepath.Dir(repoDir), 0755); err != nil {
+			return fmt.Errorf("failed to create sync directory: %v", err)
+		}
+		if _, err := runGit("", "clone", "--quiet", "--no-checkout", "--", repo, repoDir); err != nil {
+			return err
+		}
+	} else {
+		if _, err := runGit(repoDir, "remote", "set-url", "origin", repo); err != nil {
+			return err
+		}
+		if _, err := runGit(repoDir, "fetch", "--quiet", "--prune", "--tags", "origin"); err != nil {
+			return err
+		}
+	}
+
+	candidates := []string{"origin/HEAD"}
+	if ref != "" {
+		candidates = []string{"origin/" + ref, ref}
+	}
+	for _, candidate := range candidates {
+		commit, err := runGit(repoDir, "rev-parse", "--verify", "--quiet", candidate+"^{commit}")
+		if err != nil {
+			continue
+		}
+		_, err = runGit(repoDir, "checkout", "--quiet", "--force", "--detach", commit)
+		return err
+	}
+	return fmt.Errorf("git ref %q not found in %s", ref, repo)
+}
+
+// runGit runs a git command restricted to the local file transport and
+// returns its trimmed output
+func runGit(dir string, args ...string) (string, error) {
+	args = append([]string{"-c", "protocol.allow=never", "-c", "protocol.file.allow=always"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[4], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
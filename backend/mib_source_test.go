@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalMIBSourceRoots(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(allowed, "mibs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(allowed, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		roots string
+		path  string
+		err   string
+	}{
+		{"disabled without roots", "", filepath.Join(allowed, "mibs"), "local sources are disabled"},
+		{"relative path", allowed, "mibs", "absolute path"},
+		{"allowed root", allowed, allowed, ""},
+		{"below allowed root", allowed, filepath.Join(allowed, "mibs"), ""},
+		{"one of several roots", outside + string(os.PathListSeparator) + allowed, filepath.Join(allowed, "mibs"), ""},
+		{"outside the roots", allowed, outside, "outside the directories"},
+		{"prefix of a root name", allowed, allowed + "-other", "outside the directories"},
+		{"dot-dot out of the root", allowed, filepath.Join(allowed, "mibs") + "/../..", "outside the directories"},
+		{"relative roots are ignored", "mibs", filepath.Join(allowed, "mibs"), "local sources are disabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(mibLocalRootsEnv, tt.roots)
+			err := (&MIBServerPath{Type: "local", Path: tt.path}).Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+
+	// The root itself may not be a symlink out of the allowed directories
+	t.Setenv(mibLocalRootsEnv, allowed)
+	if _, err := NewMIBManager().openMIBSource(&MIBServerPath{Type: "local", Path: filepath.Join(allowed, "escape")}); err == nil {
+		t.Fatal("openMIBSource followed a root symlink out of the allowed directories")
+	}
+}
+
+func TestGitMIBSourceRoots(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(allowed, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		roots string
+		path  string
+		err   string
+	}{
+		{"disabled without roots", "", filepath.Join(allowed, "repo"), "git sources are disabled"},
+		{"file URL disabled without roots", "", "file://" + filepath.Join(allowed, "repo"), "git sources are disabled"},
+		{"relative path", allowed, "repo", "absolute path or a file:// URL"},
+		{"remote URL", allowed, "https://example.com/mibs.git", "absolute path or a file:// URL"},
+		{"path below a root", allowed, filepath.Join(allowed, "repo"), ""},
+		{"file URL below a root", allowed, "file://" + filepath.Join(allowed, "repo"), ""},
+		{"file URL naming localhost", allowed, "file://localhost" + filepath.Join(allowed, "repo"), ""},
+		{"file URL naming another host", allowed, "file://mirror" + filepath.Join(allowed, "repo"), "invalid file:// URL"},
+		{"path outside the roots", allowed, outside, "outside the directories"},
+		{"file URL outside the roots", allowed, "file://" + outside, "outside the directories"},
+		{"file URL escaping with dot-dot", allowed, "file://" + allowed + "/repo/../..", "outside the directories"},
+		{"symlink out of a root", allowed, "file://" + filepath.Join(allowed, "escape"), "outside the directories"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(mibLocalRootsEnv, tt.roots)
+			err := (&MIBServerPath{Type: "git", Path: tt.path}).Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLocalMIBSourceSymlinks(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlink := func(target, link string) {
+		t.Helper()
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(root, "A-MIB.txt"), "inside")
+	write(filepath.Join(outside, "SECRET.txt"), "outside")
+	symlink(filepath.Join(root, "A-MIB.txt"), filepath.Join(root, "LINK-MIB.txt"))
+	symlink(filepath.Join(outside, "SECRET.txt"), filepath.Join(root, "SECRET-MIB.txt"))
+	symlink(outside, filepath.Join(root, "dir"))
+
+	resolved, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := newLocalMIBSource(root, "", []string{resolved})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		content string
+	}{
+		{"regular file", filepath.Join(root, "A-MIB.txt"), "inside"},
+		{"link within the root", filepath.Join(root, "LINK-MIB.txt"), "inside"},
+		{"link out of the root", filepath.Join(root, "SECRET-MIB.txt"), ""},
+		{"through a directory link", filepath.Join(root, "dir", "SECRET.txt"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := source.Open(tt.path)
+			if tt.content == "" {
+				if err == nil {
+					file.Close()
+					t.Fatalf("Open(%s) followed a symlink out of the root", tt.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open(%s) = %v", tt.path, err)
+			}
+			defer file.Close()
+			data, err := io.ReadAll(file)
+			if err != nil || string(data) != tt.content {
+				t.Fatalf("Open(%s) read %q, %v; want %q", tt.path, data, err, tt.content)
+			}
+		})
+	}
+
+	// The walk reports the escaping link but never descends into it
+	var walked []string
+	source.Walk(func(path string, info os.FileInfo, err error) {
+		if err == nil && info.Mode().IsRegular() {
+			walked = append(walked, filepath.Base(path))
+		}
+	})
+	if strings.Join(walked, ",") != "A-MIB.txt" {
+		t.Fatalf("Walk visited %v, want only A-MIB.txt", walked)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MIBSyncResult counts what a server path scan changed
+type MIBSyncResult struct {
+	Files     int      `json:"files"` // MIB files found on the server
+	Added     int      `json:"added"`
+	Updated   int      `json:"updated"`
+	Unchanged int      `json:"unchanged"`
+	Removed   int      `json:"removed"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// fail records a file that could not be synced
+func (r *MIBSyncResult) fail(remotePath string, err error) {
+	r.Failed++
+	r.Errors = append(r.Errors, fmt.Sprintf("%s: %v", remotePath, err))
+}
+
+// mibSyncSettingKey is the Setting holding MIBSyncSettings
+const mibSyncSettingKey = "mib_sync"
+
+// mibSyncTick is how often the scheduler looks for auto-sync paths that are due
+const mibSyncTick = time.Minute
+
+// MIBSyncSettings configures the auto-sync of MIB server paths
+type MIBSyncSettings struct {
+	Interval int `json:"interval"` // minutes between scans of an auto-sync path
+}
+
+// defaultMIBSyncSettings returns the settings used until others are saved
+func defaultMIBSyncSettings() MIBSyncSettings {
+	return MIBSyncSettings{Interval: 60}
+}
+
+// Validate checks that the interval is positive
+func (s MIBSyncSettings) Validate() error {
+	if s.Interval <= 0 {
+		return fmt.Errorf("sync interval must be positive")
+	}
+	return nil
+}
+
+// loadMIBSyncSettings reads the sync settings, falling back to the defaults
+func loadMIBSyncSettings() MIBSyncSettings {
+	settings := defaultMIBSyncSettings()
+	if !loadSetting(mibSyncSettingKey, &settings) || settings.Validate() != nil {
+		return defaultMIBSyncSettings()
+	}
+	return settings
+}
+
+// errMIBSyncRunning is returned when a server path is already being scanned
+var errMIBSyncRunning = errors.New("a scan of this server path is already running")
+
+// mibSyncRunning holds the IDs of the server paths being scanned
+var (
+	mibSyncMu      sync.Mutex
+	mibSyncRunning = make(map[uint]bool)
+)
+
+// beginMIBSync claims a server path for a scan and reports whether it was free
+func beginMIBSync(pathID uint) bool {
+	mibSyncMu.Lock()
+	defer mibSyncMu.Unlock()
+	if mibSyncRunning[pathID] {
+		return false
+	}
+	mibSyncRunning[pathID] = true
+	return true
+}
+
+// endMIBSync releases a server path claimed by beginMIBSync
+func endMIBSync(pathID uint) {
+	mibSyncMu.Lock()
+	defer mibSyncMu.Unlock()
+	delete(mibSyncRunning, pathID)
+}
+
+// StartMIBSyncScheduler periodically scans the server paths with AutoSync
+// enabled whose last scan is older than the configured interval
+func StartMIBSyncScheduler() {
+	go func() {
+		ticker := time.NewTicker(mibSyncTick)
+		defer ticker.Stop()
+		for range ticker.C {
+			runDueMIBSyncs()
+		}
+	}()
+}
+
+// runDueMIBSyncs starts a scan of every auto-sync path that is due
+func runDueMIBSyncs() {
+	interval := time.Duration(loadMIBSyncSettings().Interval) * time.Minute
+	var paths []MIBServerPath
+	if err := db.Where("auto_sync = ?", true).Find(&paths).Error; err != nil {
+		log.Printf("Failed to load MIB server paths: %v", err)
+		return
+	}
+	for i := range paths {
+		pathConfig := &paths[i]
+		if time.Since(pathConfig.LastScan) < interval || !beginMIBSync(pathConfig.ID) {
+			continue
+		}
+		go func() {
+			defer endMIBSync(pathConfig.ID)
+			if _, err := NewMIBManager().scanServerPath(pathConfig, "auto"); err != nil {
+				log.Printf("Auto-sync of MIB server path %s failed: %v", pathConfig.Name, err)
+			}
+		}()
+	}
+}
+
+// ScanServerPath mirrors the MIB files below a server path into local
+// storage. It fails with errMIBSyncRunning while another scan of
+// the path is in progress.
+func (mm *MIBManager) ScanServerPath(pathConfig *MIBServerPath, trigger string) (*MIBSyncRun, error) {
+	if !beginMIBSync(pathConfig.ID) {
+		return nil, errMIBSyncRunning
+	}
+	defer endMIBSync(pathConfig.ID)
+	return mm.scanServerPath(pathConfig, trigger)
+}
+
+// scanServerPath runs a scan of a path claimed by beginMIBSync and records
+// the outcome as a MIBSyncRun and on pathConfig
+func (mm *MIBManager) scanServerPath(pathConfig *MIBServerPath, trigger string) (*MIBSyncRun, error) {
+	run := MIBSyncRun{ServerPathID: pathConfig.ID, Trigger: trigger, Status: "running", StartedAt: time.Now()}
+	if err := db.Create(&run).Error; err != nil {
+		return nil, err
+	}
+	db.Model(pathConfig).Update("status", "scanning")
+
+	result, err := mm.syncServerPath(pathConfig)
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Status = "success"
+	if result != nil {
+		run.Files = result.Files
+		run.Added = result.Added
+		run.Updated = result.Updated
+		run.Unchanged = result.Unchanged
+		run.Removed = result.Removed
+		run.Failed = result.Failed
+		if len(result.Errors) > 0 {
+			errs, _ := json.Marshal(result.Errors)
+			run.FileErrors = string(errs)
+		}
+	}
+
+	pathConfig.LastScan = finished
+	pathConfig.LastError = ""
+	if err != nil {
+		run.Status = "error"
+		run.Error = err.Error()
+		pathConfig.Status = "error"
+		pathConfig.LastError = err.Error()
+	} else {
+		pathConfig.Status = "connected"
+		pathConfig.FileCount = result.Files
+		pathConfig.LastAdded = result.Added
+		pathConfig.LastUpdated = result.Updated
+		pathConfig.LastRemoved = result.Removed
+		pathConfig.LastFailed = result.Failed
+		if len(result.Errors) > 0 {
+			pathConfig.LastError = result.Errors[0]
+		}
+	}
+	pathConfig.UpdatedAt = finished
+	if saveErr := db.Save(&run).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if saveErr := db.Save(pathConfig).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return &run, err
+}
+
+// syncServerPath copies new and changed MIB files, detected by size and
+// mtime, into local storage and removes the records of files deleted at the
+// source
+func (mm *MIBManager) syncServerPath(pathConfig *MIBServerPath) (*MIBSyncResult, error) {
+	source, err := mm.openMIBSource(pathConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	// Rows synced earlier, by source path in creation order
+	var rows []MIBFile
+	if err := db.Where("server_path_id = ?", pathConfig.ID).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	synced := make(map[string][]MIBFile)
+	for _, row := range rows {
+		synced[row.SourcePath] = append(synced[row.SourcePath], row)
+	}
+	var duplicateRows []MIBSyncDuplicate
+	if err := db.Where("server_path_id = ?", pathConfig.ID).Find(&duplicateRows).Error; err != nil {
+		return nil, err
+	}
+	duplicates := make(map[string]MIBSyncDuplicate)
+	for _, duplicate := range duplicateRows {
+		duplicates[duplicate.SourcePath] = duplicate
+	}
+
+	localDir := filepath.Join(mm.syncDir, strconv.FormatUint(uint64(pathConfig.ID), 10))
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sync directory: %v", err)
+	}
+
+	result := &MIBSyncResult{}
+	seen := make(map[string]bool)
+	source.Walk(func(sourcePath string, info os.FileInfo, err error) {
+		if err != nil {
+			result.fail(sourcePath, err)
+			return
+		}
+		if !info.Mode().IsRegular() || !mm.isMIBFile(info.Name()) {
+			return
+		}
+		seen[sourcePath] = true
+		result.Files++
+
+		var previous *MIBFile
+		if history := synced[sourcePath]; len(history) > 0 {
+			previous = &history[len(history)-1]
+		}
+		if previous != nil && previous.SourceModTime != nil &&
+			previous.Size == info.Size() && previous.SourceModTime.Equal(info.ModTime()) {
+			result.Unchanged++
+			return
+		}
+		// A copy of a stored file is skipped while that file is kept
+		if duplicate, ok := duplicates[sourcePath]; ok && duplicate.Size == info.Size() &&
+			duplicate.SourceModTime.Equal(info.ModTime()) && db.First(&MIBFile{}, duplicate.MIBFileID).Error == nil {
+			result.Unchanged++
+			return
+		}
+
+		outcome, err := mm.syncServerFile(source, pathConfig, sourcePath, info, localDir, previous)
+		if err != nil {
+			result.fail(sourcePath, err)
+			return
+		}
+		switch outcome {
+		case "created":
+			result.Added++
+		case "updated", "history":
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	})
+
+	for sourcePath, duplicate := range duplicates {
+		if !seen[sourcePath] {
+			db.Delete(&duplicate)
+		}
+	}
+
+	// Files gone from the source take their revisions with them
+	for sourcePath := range synced {
+		if seen[sourcePath] {
+			continue
+		}
+		// Older revisions go first so that none of them is promoted
+		var stale []MIBFile
+		db.Where("server_path_id = ? AND source_path = ?", pathConfig.ID, sourcePath).
+			Order("current_id IS NULL, id").Find(&stale)
+		for _, row := range stale {
+			if err := removeMIBFile(row); err != nil {
+				result.fail(sourcePath, err)
+				continue
+			}
+			os.Remove(row.FilePath)
+		}
+		result.Removed++
+	}
+
+	if result.Added+result.Updated+result.Removed > 0 {
+		if err := mm.ResolveImports(); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// syncServerFile copies one MIB file from source and registers it. previous
+// is the last row synced from the same source path, if any.
+func (mm *MIBManager) syncServerFile(source mibSource, pathConfig *MIBServerPath, sourcePath string, info os.FileInfo, localDir string, previous *MIBFile) (string, error) {
+	if info.Size() > maxMIBFileSize {
+		return "", fmt.Errorf("file exceeds %d bytes", maxMIBFileSize)
+	}
+
+	name := info.Name()
+	localPath := filepath.Join(localDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), name))
+	if err := copyMIBSourceFile(source, sourcePath, localPath); err != nil {
+		return "", err
+	}
+
+	modTime := info.ModTime()
+	mibFile := MIBFile{
+		Name:          strings.TrimSuffix(name, filepath.Ext(name)),
+		Filename:      name,
+		Size:          info.Size(),
+		FilePath:      localPath,
+		Status:        "pending",
+		Source:        mibSourceNames[pathConfig.Type],
+		SourcePath:    sourcePath,
+		ServerPathID:  &pathConfig.ID,
+		SourceModTime: &modTime,
+		UploadedAt:    time.Now(),
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if _, err := mm.parseMIBFile(&mibFile); err != nil {
+		mibFile.Status = "error"
+	}
+
+	outcome, stored, err := mm.registerMIBFile(&mibFile)
+	if err != nil {
+		os.Remove(localPath)
+		return "", err
+	}
+
+	db.Where("server_path_id = ? AND source_path = ?", pathConfig.ID, sourcePath).Delete(&MIBSyncDuplicate{})
+	switch {
+	case outcome == "duplicate":
+		os.Remove(localPath)
+		// Remember the size and mtime so the file is skipped next time
+		if stored.ServerPathID != nil && *stored.ServerPathID == pathConfig.ID && stored.SourcePath == sourcePath {
+			db.Model(stored).Updates(map[string]interface{}{"size": mibFile.Size, "source_mod_time": modTime})
+			break
+		}
+		duplicate := MIBSyncDuplicate{
+			ServerPathID:  pathConfig.ID,
+			SourcePath:    sourcePath,
+			Size:          info.Size(),
+			SourceModTime: modTime,
+			MIBFileID:     stored.ID,
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
+		}
+		if err := db.Create(&duplicate).Error; err != nil {
+			return outcome, err
+		}
+	case outcome == "created" && previous != nil && previous.CurrentID == nil:
+		// The file now holds another module; its former module is gone
+		if err := removeMIBFile(*previous); err != nil {
+			return outcome, err
+		}
+		os.Remove(previous.FilePath)
+	}
+	return outcome, nil
+}
+
+// copyMIBSourceFile copies a file from source to localPath, enforcing
+// maxMIBFileSize
+func copyMIBSourceFile(source mibSource, sourcePath, localPath string) error {
+	src, err := source.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(dst, io.LimitReader(src, maxMIBFileSize+1))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > maxMIBFileSize {
+		err = fmt.Errorf("file exceeds %d bytes", maxMIBFileSize)
+	}
+	if err != nil {
+		os.Remove(localPath)
+		return fmt.Errorf("failed to copy: %v", err)
+	}
+	return nil
+}
+
+// MIB sync API handlers
+
+// getMIBSyncRuns lists the recent scans of a server path, newest first
+func getMIBSyncRuns(c *gin.Context) {
+	var path MIBServerPath
+	if err := db.First(&path, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Server path not found"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	var runs []MIBSyncRun
+	db.Where("server_path_id = ?", path.ID).Order("id desc").Limit(limit).Find(&runs)
+	c.JSON(http.StatusOK, runs)
+}
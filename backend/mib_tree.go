@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// mibTreeNode is a resolved node together with the module defining it
+type mibTreeNode struct {
+	module *MIBModule
+	*MIBNode
+}
+
+// mibTree indexes the resolved nodes of all current MIB files by name and
+// numeric OID. It backs the configuration generators.
+type mibTree struct {
+	resolver *MIBResolver
+	nodes    []*mibTreeNode // ordered by OID
+	byName   map[string]*mibTreeNode
+	byOID    map[string]*mibTreeNode
+}
+
+// loadMIBTree parses and resolves every current MIB file. A name defined
+// by several modules refers to the module loaded last, as in the resolver,
+// unless that would replace an SMIv2 definition of the OID by an SMIv1 one.
+func loadMIBTree() (*mibTree, error) {
+	resolver, _, err := LoadMIBResolver()
+	if err != nil {
+		return nil, err
+	}
+	resolver.Resolve()
+
+	tree := &mibTree{
+		resolver: resolver,
+		byName:   make(map[string]*mibTreeNode),
+		byOID:    make(map[string]*mibTreeNode),
+	}
+	for _, entry := range resolver.entries {
+		// Only the copy of a module that won in the resolver counts
+		if resolver.Module(entry.module.Name) != entry.module {
+			continue
+		}
+		for _, node := range entry.module.Nodes {
+			if node.OID == "" {
+				continue
+			}
+			n := &mibTreeNode{module: entry.module, MIBNode: node}
+			tree.byName[entry.module.Name+"::"+node.Name] = n
+			// An OID defined by an SMIv1 and an SMIv2 module, such as the
+			// RFC1213-MIB and IF-MIB interfaces table, uses the SMIv2 one
+			if existing := tree.byOID[node.OID]; existing != nil && existing.module.SMIVersion > n.module.SMIVersion {
+				continue
+			}
+			tree.byName[node.Name] = n
+			tree.byOID[node.OID] = n
+		}
+	}
+	for _, n := range tree.byOID {
+		tree.nodes = append(tree.nodes, n)
+	}
+	sort.Slice(tree.nodes, func(i, j int) bool {
+		return oidSortKey(tree.nodes[i].OID) < oidSortKey(tree.nodes[j].OID)
+	})
+	return tree, nil
+}
+
+// isNumericOID reports whether s is a dotted numeric OID
+func isNumericOID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, part := range strings.Split(s, ".") {
+		if part == "" || strings.Trim(part, "0123456789") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup finds a node by name, MODULE::name or numeric OID
+func (t *mibTree) Lookup(ref string) *mibTreeNode {
+	ref = strings.TrimSpace(ref)
+	if oid := strings.TrimPrefix(ref, "."); isNumericOID(oid) {
+		return t.byOID[oid]
+	}
+	return t.byName[ref]
+}
+
+// Subtree returns the node at oid and all nodes below it, in OID order
+func (t *mibTree) Subtree(oid string) []*mibTreeNode {
+	var nodes []*mibTreeNode
+	for _, n := range t.nodes {
+		if n.OID == oid || strings.HasPrefix(n.OID, oid+".") {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// resolveIn finds a symbol as seen from module: defined locally, imported,
+// or anywhere in the tree
+func (t *mibTree) resolveIn(module *MIBModule, name string) *mibTreeNode {
+	if node := module.Node(name); node != nil && node.OID != "" {
+		return &mibTreeNode{module: module, MIBNode: node}
+	}
+	if from := t.resolver.Module(module.ImportedFrom(name)); from != nil {
+		if node := from.Node(name); node != nil && node.OID != "" {
+			return &mibTreeNode{module: from, MIBNode: node}
+		}
+	}
+	return t.byName[name]
+}
+
+// IsAccessible reports whether a node is an object with a value to read
+func (n *mibTreeNode) IsAccessible() bool {
+	if n.Kind != "object-type" || n.Syntax == nil || n.Syntax.Base == "SEQUENCE OF" {
+		return false
+	}
+	switch n.Access {
+	case "", "not-accessible", "accessible-for-notify", "write-only":
+		return false
+	}
+	return true
+}
+
+// Entry returns the conceptual row a columnar object belongs to, or nil for
+// scalars
+func (t *mibTree) Entry(n *mibTreeNode) *mibTreeNode {
+	parent := t.byOID[parentOID(n.OID)]
+	if parent == nil || (len(parent.Index) == 0 && parent.Augments == "") {
+		return nil
+	}
+	return parent
+}
+
+// Indexes returns the INDEX objects of a row, following AUGMENTS, and
+// whether the last one is IMPLIED
+func (t *mibTree) Indexes(entry *mibTreeNode) ([]*mibTreeNode, bool) {
+	for depth := 0; entry != nil && entry.Augments != "" && depth < 8; depth++ {
+		entry = t.resolveIn(entry.module, entry.Augments)
+	}
+	if entry == nil {
+		return nil, false
+	}
+	indexes := make([]*mibTreeNode, 0, len(entry.Index))
+	for _, name := range entry.Index {
+		index := t.resolveIn(entry.module, name)
+		if index == nil {
+			return nil, false
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, entry.Implied
+}
+
+// EffectiveSyntax follows the SYNTAX of a node down to its ASN.1 base
+func (t *mibTree) EffectiveSyntax(n *mibTreeNode) mibEffectiveSyntax {
+	return (&mibValidator{module: n.module, resolver: t.resolver}).effectiveSyntax(n.Syntax)
+}
+
+// TypeChain returns the named types the SYNTAX of a node refers to,
+// outermost first, ending before the SMI application or ASN.1 base type
+func (t *mibTree) TypeChain(n *mibTreeNode) []*MIBType {
+	var chain []*MIBType
+	module, syntax := n.module, n.Syntax
+	for depth := 0; syntax != nil && depth < 16; depth++ {
+		if _, app := mibApplicationBases[syntax.Base]; app || mibBuiltinTypes[syntax.Base] {
+			break
+		}
+		typ := module.Type(syntax.Base)
+		if typ == nil {
+			from := t.resolver.Module(module.ImportedFrom(syntax.Base))
+			if from == nil {
+				break
+			}
+			if typ = from.Type(syntax.Base); typ == nil {
+				break
+			}
+			module = from
+		}
+		chain = append(chain, typ)
+		syntax = typ.Syntax
+	}
+	return chain
+}
+
+// BaseType returns the SMI application type (Counter32, Gauge32, ...) or
+// ASN.1 type a node's SYNTAX ends in
+func (t *mibTree) BaseType(n *mibTreeNode) string {
+	base := ""
+	if n.Syntax != nil {
+		base = n.Syntax.Base
+	}
+	if chain := t.TypeChain(n); len(chain) > 0 && chain[len(chain)-1].Syntax != nil {
+		base = chain[len(chain)-1].Syntax.Base
+	}
+	return base
+}
+
+// Translate turns a name, MODULE::name or numeric OID, each optionally
+// followed by a numeric instance such as ifOperStatus.3, into a numeric OID
+func (t *mibTree) Translate(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if oid := strings.TrimPrefix(ref, "."); isNumericOID(oid) {
+		return oid, nil
+	}
+	name, instance := ref, ""
+	offset := strings.LastIndex(ref, "::") + 1 // names never contain dots
+	if i := strings.IndexByte(ref[offset:], '.'); i >= 0 {
+		name, instance = ref[:offset+i], ref[offset+i+1:]
+		if !isNumericOID(instance) {
+			return "", fmt.Errorf("invalid instance %q in %s", instance, ref)
+		}
+	}
+	node := t.Lookup(name)
+	if node == nil {
+		return "", fmt.Errorf("unknown MIB object %s", name)
+	}
+	if instance != "" {
+		return node.OID + "." + instance, nil
+	}
+	return node.OID, nil
+}
+
+// Describe finds the closest node at or above oid and the instance arcs
+// below it
+func (t *mibTree) Describe(oid string) (*mibTreeNode, string) {
+	oid = strings.TrimPrefix(oid, ".")
+	for prefix := oid; prefix != ""; prefix = parentOID(prefix) {
+		if n := t.byOID[prefix]; n != nil {
+			return n, strings.TrimPrefix(strings.TrimPrefix(oid, prefix), ".")
+		}
+	}
+	return nil, ""
+}
+
+// Name renders oid as MODULE::name.instance, or returns it unchanged when
+// no node covers it
+func (t *mibTree) Name(oid string) string {
+	n, instance := t.Describe(oid)
+	if n == nil {
+		return oid
+	}
+	name := n.module.Name + "::" + n.Name
+	if instance != "" {
+		name += "." + instance
+	}
+	return name
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxMIBFileSize caps a single uploaded MIB file
+const maxMIBFileSize = 16 << 20
+
+// MIBUploadResult reports what happened to one uploaded file
+type MIBUploadResult struct {
+	Filename  string `json:"filename"`
+	Result    string `json:"result"` // created, updated, history, duplicate, failed
+	ID        uint   `json:"id,omitempty"`
+	Module    string `json:"module,omitempty"`
+	Status    string `json:"status,omitempty"` // MIBFile status after import resolution
+	Errors    int    `json:"error_count"`
+	Warnings  int    `json:"warning_count"`
+	Message   string `json:"message,omitempty"`
+	Duplicate uint   `json:"duplicate_of,omitempty"`
+}
+
+// mibContentHash returns the hex SHA-256 of a MIB file's content
+func mibContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// UploadMIBFiles stores uploaded MIB files under uploadDir and records them
+// with Source "upload", deduplicated and versioned by registerMIBFile.
+// Imports are resolved once all files are stored.
+func (mm *MIBManager) UploadMIBFiles(files []*multipart.FileHeader) ([]MIBUploadResult, error) {
+	if err := os.MkdirAll(mm.uploadDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %v", err)
+	}
+
+	results := make([]MIBUploadResult, 0, len(files))
+	for _, header := range files {
+		result := MIBUploadResult{Filename: header.Filename}
+		if err := mm.uploadMIBFile(header, &result); err != nil {
+			result.Result = "failed"
+			result.Message = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	if err := mm.ResolveImports(); err != nil {
+		return results, err
+	}
+
+	// Report the status each file ended up with after resolution
+	for i := range results {
+		if results[i].ID == 0 {
+			continue
+		}
+		var mibFile MIBFile
+		if err := db.First(&mibFile, results[i].ID).Error; err != nil {
+			continue
+		}
+		results[i].Status = mibFile.Status
+		results[i].Errors = mibFile.ErrorCount
+		results[i].Warnings = mibFile.WarningCount
+	}
+	return results, nil
+}
+
+// readMIBUpload reads an uploaded MIB file, enforcing maxMIBFileSize
+func readMIBUpload(header *multipart.FileHeader) ([]byte, error) {
+	if header.Size > maxMIBFileSize {
+		return nil, fmt.Errorf("file exceeds %d bytes", maxMIBFileSize)
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	content, err := io.ReadAll(io.LimitReader(src, maxMIBFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxMIBFileSize {
+		return nil, fmt.Errorf("file exceeds %d bytes", maxMIBFileSize)
+	}
+	return content, nil
+}
+
+// uploadMIBFile stores a single uploaded MIB file and fills in its result
+func (mm *MIBManager) uploadMIBFile(header *multipart.FileHeader, result *MIBUploadResult) error {
+	name := filepath.Base(header.Filename)
+	if isMIBArchiveName(name) {
+		return fmt.Errorf("archives are uploaded through /api/v1/mibs/archives/upload")
+	}
+	content, err := readMIBUpload(header)
+	if err != nil {
+		return err
+	}
+
+	hash := mibContentHash(content)
+	var existing MIBFile
+	if err := db.Where("content_hash = ?", hash).First(&existing).Error; err == nil {
+		result.Result = "duplicate"
+		result.ID = existing.ID
+		result.Module = existing.ModuleName
+		result.Duplicate = existing.ID
+		result.Message = fmt.Sprintf("identical to %s", existing.Filename)
+		return nil
+	}
+
+	filePath := filepath.Join(mm.uploadDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), name))
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("failed to save file: %v", err)
+	}
+
+	mibFile := MIBFile{
+		Name:       strings.TrimSuffix(name, filepath.Ext(name)),
+		Filename:   name,
+		Size:       int64(len(content)),
+		FilePath:   filePath,
+		Source:     "upload",
+		Status:     "pending",
+		UploadedAt: time.Now(),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if _, err := mm.parseMIBFile(&mibFile); err != nil {
+		result.Message = err.Error()
+	}
+
+	outcome, stored, err := mm.registerMIBFile(&mibFile)
+	if err != nil {
+		os.Remove(filePath)
+		return err
+	}
+	result.Result = outcome
+	switch outcome {
+	case "duplicate":
+		os.Remove(filePath)
+		result.Duplicate = stored.ID
+		result.Message = fmt.Sprintf("identical to %s", stored.Filename)
+		mibFile = *stored
+	case "updated":
+		result.Message = fmt.Sprintf("supersedes revision %s", stored.Version)
+	case "history":
+		result.Message = fmt.Sprintf("older than current revision %s, kept as history", stored.Version)
+	}
+	result.ID = mibFile.ID
+	result.Module = mibFile.ModuleName
+	return nil
+}
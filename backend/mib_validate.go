@@ -0,0 +1,646 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MIBDiagnostic is a single finding of MIB validation
+type MIBDiagnostic struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"` // error, warning, info
+	Rule     string `json:"rule"`
+	Symbol   string `json:"symbol,omitempty"`
+	Message  string `json:"message"`
+}
+
+// mibBuiltinTypes are the ASN.1 types every module may use without IMPORTS
+var mibBuiltinTypes = map[string]bool{
+	"INTEGER":           true,
+	"OCTET STRING":      true,
+	"OBJECT IDENTIFIER": true,
+	"BITS":              true,
+	"SEQUENCE":          true,
+	"SEQUENCE OF":       true,
+	"CHOICE":            true,
+}
+
+// mibApplicationBases maps the SMI application types to their ASN.1 base,
+// used when the defining SMI module is not in the store
+var mibApplicationBases = map[string]string{
+	"Integer32":      "INTEGER",
+	"Unsigned32":     "INTEGER",
+	"Counter":        "INTEGER",
+	"Counter32":      "INTEGER",
+	"Counter64":      "INTEGER",
+	"Gauge":          "INTEGER",
+	"Gauge32":        "INTEGER",
+	"TimeTicks":      "INTEGER",
+	"IpAddress":      "OCTET STRING",
+	"Opaque":         "OCTET STRING",
+	"NetworkAddress": "OCTET STRING",
+}
+
+// mibSyntaxDiagnostics converts a read or parse failure into diagnostics
+func mibSyntaxDiagnostics(err error) []MIBDiagnostic {
+	diag := MIBDiagnostic{Severity: "error", Rule: mibRuleSyntaxError, Message: err.Error()}
+	if syntaxErr, ok := err.(*MIBSyntaxError); ok {
+		diag.Line = syntaxErr.Line
+		diag.Column = syntaxErr.Column
+		diag.Message = syntaxErr.Message
+	}
+	return []MIBDiagnostic{diag}
+}
+
+// mibValidator checks one parsed module against the rest of the store
+type mibValidator struct {
+	module   *MIBModule
+	resolver *MIBResolver
+	diags    []MIBDiagnostic
+}
+
+// ValidateMIBModule returns the diagnostics for a module whose OIDs have
+// been resolved by resolver
+func ValidateMIBModule(module *MIBModule, resolver *MIBResolver) []MIBDiagnostic {
+	v := &mibValidator{module: module, resolver: resolver}
+	reported := v.checkImports()
+	v.checkDefinitions(reported)
+	v.checkOIDs(reported)
+	v.checkDefVals()
+	v.checkRevisions()
+	v.checkIdentifiers()
+	v.checkRanges()
+	v.checkObjectTypes()
+
+	sort.SliceStable(v.diags, func(i, j int) bool {
+		if v.diags[i].Line != v.diags[j].Line {
+			return v.diags[i].Line < v.diags[j].Line
+		}
+		return v.diags[i].Column < v.diags[j].Column
+	})
+	return v.diags
+}
+
+// add records a finding with the severity its rule has in the strict
+// profile; lint settings relax it afterwards
+func (v *mibValidator) add(line, column int, rule, symbol, format string, args ...interface{}) {
+	v.diags = append(v.diags, MIBDiagnostic{
+		Line:     line,
+		Column:   column,
+		Severity: mibLintRuleByID(rule).Severity[mibLintStrict],
+		Rule:     rule,
+		Symbol:   symbol,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// known reports whether symbol is defined locally, imported or an SMI root
+func (v *mibValidator) known(symbol string) bool {
+	if v.module.Defines(symbol) || v.module.ImportedFrom(symbol) != "" {
+		return true
+	}
+	_, root := smiRootOIDs[symbol]
+	return root
+}
+
+// checkImports reports imported modules and symbols missing from the store.
+// It returns the symbols already reported so later checks do not repeat them.
+func (v *mibValidator) checkImports() map[string]bool {
+	reported := make(map[string]bool)
+	for _, missing := range v.resolver.MissingImports(v.module) {
+		if missing.Module == "" {
+			continue // undefined parents are reported per node
+		}
+		for _, symbol := range missing.Symbols {
+			reported[symbol] = true
+		}
+		line, column := v.importPosition(missing)
+		if missing.ModuleMissing {
+			v.add(line, column, mibRuleMissingImport, missing.Module,
+				"imported module %s is not in the MIB store", missing.Module)
+			continue
+		}
+		v.add(line, column, mibRuleMissingImport, strings.Join(missing.Symbols, ", "),
+			"%s not defined in module %s", strings.Join(missing.Symbols, ", "), missing.Module)
+	}
+	return reported
+}
+
+// importPosition locates a missing import in IMPORTS: at the module
+// reference when the module is missing, otherwise at the first missing
+// symbol. It falls back to the module header.
+func (v *mibValidator) importPosition(missing MIBMissingImport) (int, int) {
+	for _, imp := range v.module.Imports {
+		if imp.Module != missing.Module || imp.Line == 0 {
+			continue
+		}
+		if missing.ModuleMissing {
+			return imp.Line, imp.Column
+		}
+		for i, symbol := range imp.Symbols {
+			if symbol == missing.Symbols[0] && i < len(imp.SymbolPositions) {
+				return imp.SymbolPositions[i].Line, imp.SymbolPositions[i].Column
+			}
+		}
+	}
+	return v.module.Line, 1
+}
+
+// checkDefinitions reports duplicate definitions and references to symbols
+// that are neither defined nor imported
+func (v *mibValidator) checkDefinitions(reported map[string]bool) {
+	firstLine := make(map[string]int)
+	define := func(name string, line, column int) {
+		if first, ok := firstLine[name]; ok {
+			v.add(line, column, mibRuleDuplicateDefinition, name,
+				"%s is already defined at line %d", name, first)
+			return
+		}
+		firstLine[name] = line
+	}
+	for _, t := range v.module.Types {
+		define(t.Name, t.Line, t.Column)
+	}
+	for _, node := range v.module.Nodes {
+		define(node.Name, node.Line, node.Column)
+	}
+
+	reference := func(symbol string, line, column int, what string) {
+		if symbol == "" || reported[symbol] || v.known(symbol) {
+			return
+		}
+		v.add(line, column, mibRuleUndefinedSymbol, symbol,
+			"%s %s is neither defined nor imported", what, symbol)
+		reported[symbol] = true
+	}
+	var referenceSyntax func(s *MIBSyntax, line, column int)
+	referenceSyntax = func(s *MIBSyntax, line, column int) {
+		if s == nil {
+			return
+		}
+		if !mibBuiltinTypes[s.Base] {
+			reference(s.Base, line, column, "type")
+		}
+		if s.SequenceOf != "" {
+			reference(s.SequenceOf, line, column, "type")
+		}
+		for _, field := range s.Fields {
+			referenceSyntax(field.Syntax, line, column)
+		}
+	}
+
+	for _, t := range v.module.Types {
+		referenceSyntax(t.Syntax, t.Line, t.Column)
+	}
+	for _, node := range v.module.Nodes {
+		reference(node.Parent, node.Line, node.Column, "OID parent")
+		referenceSyntax(node.Syntax, node.Line, node.Column)
+		for _, index := range node.Index {
+			reference(index, node.Line, node.Column, "INDEX object")
+		}
+		reference(node.Augments, node.Line, node.Column, "AUGMENTS entry")
+		for _, object := range node.Objects {
+			reference(object, node.Line, node.Column, "object")
+		}
+	}
+}
+
+// checkOIDs reports nodes whose OID cannot be computed and OIDs assigned twice
+func (v *mibValidator) checkOIDs(reported map[string]bool) {
+	owners := make(map[string]*MIBNode)
+	for _, node := range v.module.Nodes {
+		if node.OID == "" {
+			// Only report where the chain breaks; nodes below a local
+			// unresolved parent follow from it.
+			if node.Parent != "" && v.module.Node(node.Parent) == nil && !reported[node.Parent] {
+				v.add(node.Line, node.Column, mibRuleUnresolvedOID, node.Name,
+					"cannot resolve OID of %s: parent %s has no known OID", node.Name, node.Parent)
+			}
+			continue
+		}
+		if owner, ok := owners[node.OID]; ok {
+			v.add(node.Line, node.Column, mibRuleDuplicateOID, node.Name,
+				"OID %s of %s is already assigned to %s at line %d", node.OID, node.Name, owner.Name, owner.Line)
+			continue
+		}
+		owners[node.OID] = node
+	}
+}
+
+// checkRevisions reports SMIv2 modules without a REVISION for LAST-UPDATED
+func (v *mibValidator) checkRevisions() {
+	identity := v.module.Node(v.module.Identity)
+	if identity == nil {
+		return
+	}
+	if len(v.module.Revisions) == 0 {
+		v.add(identity.Line, identity.Column, mibRuleMissingRevision, identity.Name,
+			"MODULE-IDENTITY %s has no REVISION clause", identity.Name)
+		return
+	}
+	if v.module.LastUpdated == "" {
+		return
+	}
+	for _, rev := range v.module.Revisions {
+		if rev.Date == v.module.LastUpdated {
+			return
+		}
+	}
+	v.add(identity.Line, identity.Column, mibRuleMissingRevision, identity.Name,
+		"no REVISION clause matches LAST-UPDATED %s", v.module.LastUpdated)
+}
+
+// checkIdentifiers reports descriptors that break the RFC 2578 naming rules
+func (v *mibValidator) checkIdentifiers() {
+	check := func(name string, line, column int) {
+		if strings.Contains(name, "_") {
+			v.add(line, column, mibRuleIdentifierUnderscore, name,
+				"identifier %s contains an underscore", name)
+		}
+		if len(name) > 64 {
+			v.add(line, column, mibRuleIdentifierLength, name,
+				"identifier %s is longer than 64 characters", name)
+		}
+	}
+	checkEnums := func(s *MIBSyntax, line, column int) {
+		if s == nil {
+			return
+		}
+		for _, enum := range s.Enums {
+			check(enum.Label, line, column)
+		}
+	}
+	for _, t := range v.module.Types {
+		check(t.Name, t.Line, t.Column)
+		checkEnums(t.Syntax, t.Line, t.Column)
+	}
+	for _, node := range v.module.Nodes {
+		check(node.Name, node.Line, node.Column)
+		checkEnums(node.Syntax, node.Line, node.Column)
+	}
+}
+
+// checkRanges reports value and SIZE constraints that are empty or overlap
+func (v *mibValidator) checkRanges() {
+	check := func(name string, ranges []MIBRange, what string, line, column int) {
+		var prevMax *big.Int
+		for _, r := range ranges {
+			min, minOK := parseMIBNumber(r.Min)
+			max, maxOK := parseMIBNumber(r.Max)
+			if what == "SIZE" && minOK && min.Sign() < 0 {
+				v.add(line, column, mibRuleBadRange, name,
+					"%s of %s has a negative bound %s", what, name, r.Min)
+			}
+			if minOK && maxOK && min.Cmp(max) > 0 {
+				v.add(line, column, mibRuleBadRange, name,
+					"%s (%s) of %s has its lower bound above the upper bound", what, formatMIBRanges([]MIBRange{r}), name)
+			}
+			if minOK && prevMax != nil && min.Cmp(prevMax) <= 0 {
+				v.add(line, column, mibRuleBadRange, name,
+					"%s (%s) of %s overlaps or is not in ascending order", what, formatMIBRanges(ranges), name)
+				return
+			}
+			if maxOK {
+				prevMax = max
+			}
+		}
+	}
+	checkSyntax := func(name string, s *MIBSyntax, line, column int) {
+		if s == nil {
+			return
+		}
+		check(name, s.Ranges, "range", line, column)
+		check(name, s.Sizes, "SIZE", line, column)
+	}
+	for _, t := range v.module.Types {
+		checkSyntax(t.Name, t.Syntax, t.Line, t.Column)
+	}
+	for _, node := range v.module.Nodes {
+		checkSyntax(node.Name, node.Syntax, node.Line, node.Column)
+	}
+}
+
+// mibUnitsTypes are the SMIv2 types whose objects should declare UNITS
+var mibUnitsTypes = map[string]bool{
+	"Counter32": true,
+	"Counter64": true,
+	"Gauge32":   true,
+}
+
+// checkObjectTypes reports conceptual rows without INDEX or AUGMENTS and
+// SMIv2 counters and gauges without UNITS
+func (v *mibValidator) checkObjectTypes() {
+	for _, node := range v.module.Nodes {
+		if node.Kind != "object-type" || node.Syntax == nil {
+			continue
+		}
+		if t := v.module.Type(node.Syntax.Base); t != nil && t.Syntax != nil && t.Syntax.Base == "SEQUENCE" {
+			if len(node.Index) == 0 && node.Augments == "" {
+				v.add(node.Line, node.Column, mibRuleMissingIndex, node.Name,
+					"row %s has neither INDEX nor AUGMENTS", node.Name)
+			}
+			continue
+		}
+		if v.module.SMIVersion == 2 && mibUnitsTypes[node.Syntax.Base] && node.Units == "" {
+			v.add(node.Line, node.Column, mibRuleMissingUnits, node.Name,
+				"%s of type %s has no UNITS clause", node.Name, node.Syntax.Base)
+		}
+	}
+}
+
+// mibEffectiveSyntax is a syntax with its type references followed down to
+// the ASN.1 base, keeping the innermost-declared constraints
+type mibEffectiveSyntax struct {
+	Base   string
+	Enums  []MIBEnum
+	Ranges []MIBRange
+	Sizes  []MIBRange
+}
+
+// effectiveSyntax follows type references through local and imported types.
+// Base is empty when a referenced type cannot be found.
+func (v *mibValidator) effectiveSyntax(syntax *MIBSyntax) mibEffectiveSyntax {
+	var eff mibEffectiveSyntax
+	module := v.module
+	for depth := 0; syntax != nil && depth < 16; depth++ {
+		if eff.Enums == nil {
+			eff.Enums = syntax.Enums
+		}
+		if eff.Ranges == nil {
+			eff.Ranges = syntax.Ranges
+		}
+		if eff.Sizes == nil {
+			eff.Sizes = syntax.Sizes
+		}
+		if mibBuiltinTypes[syntax.Base] {
+			eff.Base = syntax.Base
+			return eff
+		}
+
+		t := module.Type(syntax.Base)
+		if t == nil {
+			if from := v.resolver.Module(module.ImportedFrom(syntax.Base)); from != nil {
+				t = from.Type(syntax.Base)
+				module = from
+			}
+		}
+		if t == nil {
+			eff.Base = mibApplicationBases[syntax.Base]
+			return eff
+		}
+		syntax = t.Syntax
+	}
+	return eff
+}
+
+// checkDefVals reports DEFVAL clauses that do not fit the object's SYNTAX
+func (v *mibValidator) checkDefVals() {
+	for _, node := range v.module.Nodes {
+		if node.DefVal == "" || node.Syntax == nil {
+			continue
+		}
+		eff := v.effectiveSyntax(node.Syntax)
+		if problem := v.defValProblem(node.DefVal, eff); problem != "" {
+			v.add(node.Line, node.Column, mibRuleBadDefVal, node.Name,
+				"DEFVAL { %s } of %s: %s", node.DefVal, node.Name, problem)
+		}
+	}
+}
+
+// defValProblem describes why value does not fit eff, or returns ""
+func (v *mibValidator) defValProblem(value string, eff mibEffectiveSyntax) string {
+	switch eff.Base {
+	case "INTEGER":
+		if len(eff.Enums) > 0 {
+			for _, enum := range eff.Enums {
+				if value == enum.Label || value == strconv.FormatInt(enum.Value, 10) {
+					return ""
+				}
+			}
+			return "not one of the enumerated values"
+		}
+		n, ok := parseMIBNumber(value)
+		if !ok {
+			return "not an integer"
+		}
+		if !mibRangesContain(eff.Ranges, n) {
+			return fmt.Sprintf("outside range (%s)", formatMIBRanges(eff.Ranges))
+		}
+	case "OCTET STRING":
+		var length int64
+		switch {
+		case strings.HasPrefix(value, `"`):
+			s, err := strconv.Unquote(value)
+			if err != nil {
+				return "malformed string"
+			}
+			length = int64(len(s))
+		case isMIBBinString(value):
+			digits := value[1 : len(value)-2]
+			if strings.HasSuffix(value, "'H") || strings.HasSuffix(value, "'h") {
+				if _, ok := new(big.Int).SetString("0"+digits, 16); !ok || len(digits)%2 != 0 {
+					return "malformed hex string"
+				}
+				length = int64(len(digits) / 2)
+			} else {
+				if _, ok := new(big.Int).SetString("0"+digits, 2); !ok || len(digits)%8 != 0 {
+					return "malformed binary string"
+				}
+				length = int64(len(digits) / 8)
+			}
+		default:
+			return "not a string"
+		}
+		if !mibRangesContain(eff.Sizes, big.NewInt(length)) {
+			return fmt.Sprintf("length %d outside SIZE (%s)", length, formatMIBRanges(eff.Sizes))
+		}
+	case "OBJECT IDENTIFIER":
+		if strings.HasPrefix(value, "{") {
+			return ""
+		}
+		if !v.known(value) {
+			return value + " is neither defined nor imported"
+		}
+	case "BITS":
+		if !strings.HasPrefix(value, "{") || !strings.HasSuffix(value, "}") {
+			return "BITS value must be a list of bit names"
+		}
+		for _, label := range strings.Split(strings.Trim(value, "{}"), ",") {
+			label = strings.TrimSpace(label)
+			if label == "" {
+				continue
+			}
+			found := false
+			for _, enum := range eff.Enums {
+				if enum.Label == label {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return label + " is not a named bit"
+			}
+		}
+	}
+	return ""
+}
+
+// isMIBBinString reports whether s is an ASN.1 'xx'H or 'xx'B literal
+func isMIBBinString(s string) bool {
+	if len(s) < 3 || s[0] != '\'' {
+		return false
+	}
+	suffix := strings.ToUpper(s[len(s)-2:])
+	return suffix == "'H" || suffix == "'B"
+}
+
+// parseMIBNumber parses a decimal, 'xx'H or 'xx'B value
+func parseMIBNumber(s string) (*big.Int, bool) {
+	if isMIBBinString(s) {
+		base := 16
+		if strings.ToUpper(s[len(s)-1:]) == "B" {
+			base = 2
+		}
+		return new(big.Int).SetString("0"+s[1:len(s)-2], base)
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+// mibRangesContain reports whether n lies in one of ranges. An empty range
+// list admits every value.
+func mibRangesContain(ranges []MIBRange, n *big.Int) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if r.Min != "MIN" {
+			min, ok := parseMIBNumber(r.Min)
+			if !ok || n.Cmp(min) < 0 {
+				continue
+			}
+		}
+		if r.Max != "MAX" {
+			max, ok := parseMIBNumber(r.Max)
+			if !ok || n.Cmp(max) > 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// mibUnresolvedRules are the rules caused by dependencies missing from the
+// store rather than by the file itself
+var mibUnresolvedRules = map[string]bool{
+	mibRuleMissingImport:   true,
+	mibRuleUndefinedSymbol: true,
+	mibRuleUnresolvedOID:   true,
+}
+
+// applyMIBDiagnostics records diagnostics on a MIB file and derives its
+// status: "error" for problems in the file itself, "unresolved" when only
+// dependencies are missing, "validated" otherwise.
+func applyMIBDiagnostics(mibFile *MIBFile, diags []MIBDiagnostic) {
+	if diags == nil {
+		diags = []MIBDiagnostic{}
+	}
+	data, _ := json.Marshal(diags)
+	mibFile.Diagnostics = string(data)
+	mibFile.ErrorCount = 0
+	mibFile.WarningCount = 0
+
+	unresolved, broken := false, false
+	for _, diag := range diags {
+		switch diag.Severity {
+		case "error":
+			mibFile.ErrorCount++
+			if mibUnresolvedRules[diag.Rule] {
+				unresolved = true
+			} else {
+				broken = true
+			}
+		case "warning":
+			mibFile.WarningCount++
+		}
+	}
+
+	switch {
+	case broken:
+		mibFile.Status = "error"
+	case unresolved:
+		mibFile.Status = "unresolved"
+	default:
+		mibFile.Status = "validated"
+	}
+	now := time.Now()
+	mibFile.ValidatedAt = &now
+}
+
+// applyMIBValidation records the missing imports and the diagnostics of a
+// module resolved by resolver on its MIB file, graded by the lint settings
+func applyMIBValidation(mibFile *MIBFile, module *MIBModule, resolver *MIBResolver, lint MIBLintSettings) []MIBDiagnostic {
+	mibFile.MissingImports = ""
+	if missing := resolver.MissingImports(module); len(missing) > 0 {
+		data, _ := json.Marshal(missing)
+		mibFile.MissingImports = string(data)
+	}
+	diags := lint.Apply(module.Name, ValidateMIBModule(module, resolver))
+	applyMIBDiagnostics(mibFile, diags)
+	return diags
+}
+
+// ValidateMIBFile re-parses a stored MIB file, resolves it against the rest
+// of the store and saves the resulting diagnostics and status. A non-empty
+// profile overrides the configured lint profile; such a preview, like the
+// validation of an older revision, is returned without being saved.
+func (mm *MIBManager) ValidateMIBFile(mibFile *MIBFile, profile string) ([]MIBDiagnostic, error) {
+	mibResolveMu.Lock()
+	defer mibResolveMu.Unlock()
+
+	lint := loadMIBLintSettings()
+	// Older revisions are not part of the OID tree; their results are not kept
+	preview := profile != "" || mibFile.CurrentID != nil
+	if profile != "" {
+		lint.Profile = profile
+		lint.Modules = nil
+	}
+
+	var diags []MIBDiagnostic
+	module, err := mm.parseMIBFile(mibFile)
+	if err != nil {
+		diags = mibSyntaxDiagnostics(err)
+		applyMIBDiagnostics(mibFile, diags)
+	} else {
+		resolver, _, err := LoadMIBResolver()
+		if err != nil {
+			return nil, err
+		}
+		// Validate the freshly parsed copy even if another file provides
+		// the same module name
+		resolver.Add(*mibFile, module)
+		resolver.Resolve()
+		diags = applyMIBValidation(mibFile, module, resolver, lint)
+		if preview {
+			return diags, nil
+		}
+		if err := mm.storeMIBObjects(mibFile, module); err != nil {
+			return nil, fmt.Errorf("failed to store objects of %s: %v", mibFile.ModuleName, err)
+		}
+	}
+	if preview {
+		return diags, nil
+	}
+
+	mibFile.UpdatedAt = time.Now()
+	if err := db.Save(mibFile).Error; err != nil {
+		return nil, err
+	}
+	return diags, nil
+}
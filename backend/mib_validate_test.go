@@ -0,0 +1,252 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testLintMIB has an identifier with an underscore, an error in the strict
+// profile, a warning by default and ignored in the lenient one
+const testLintMIB = `TEST-LINT-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, Integer32, enterprises FROM SNMPv2-SMI;
+
+testLintMIB MODULE-IDENTITY
+    LAST-UPDATED "202401010000Z"
+    ORGANIZATION "Test"
+    CONTACT-INFO "Test"
+    DESCRIPTION  "Test module"
+    REVISION     "202401010000Z"
+    DESCRIPTION  "Initial revision"
+    ::= { enterprises 99999 }
+
+bad_name OBJECT-TYPE
+    SYNTAX      Integer32
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "An object"
+    ::= { testLintMIB 1 }
+
+END
+`
+
+func TestValidateMIBFileHistoryKeepsLintSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		profile  string
+		want     string // severity of the identifier-underscore diagnostic, "" for none
+	}{
+		{"configured profile", `{"profile":"lenient"}`, "", ""},
+		{"module override", `{"profile":"strict","modules":{"TEST-LINT-MIB":"lenient"}}`, "", ""},
+		{"strict profile", `{"profile":"strict"}`, "", "error"},
+		{"requested profile", `{"profile":"lenient"}`, "strict", "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			loadTestMIBTree(t)
+			db.Save(&Setting{Key: mibLintSettingKey, Value: tt.settings})
+
+			path := filepath.Join(t.TempDir(), "TEST-LINT-MIB.txt")
+			if err := os.WriteFile(path, []byte(testLintMIB), 0644); err != nil {
+				t.Fatal(err)
+			}
+			current := MIBFile{Name: "TEST-LINT-MIB", Filename: "TEST-LINT-MIB.txt", FilePath: path}
+			db.Create(&current)
+			old := MIBFile{Name: "TEST-LINT-MIB", Filename: "TEST-LINT-MIB.txt", FilePath: path, CurrentID: &current.ID, Status: "superseded"}
+			db.Create(&old)
+
+			diags, err := NewMIBManager().ValidateMIBFile(&old, tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			for _, diag := range diags {
+				if diag.Rule == mibRuleIdentifierUnderscore {
+					got = diag.Severity
+				}
+			}
+			if got != tt.want {
+				t.Errorf("identifier-underscore severity %q, want %q (diagnostics %+v)", got, tt.want, diags)
+			}
+		})
+	}
+}
+
+func TestValidateMIBModuleReportsImportPositions(t *testing.T) {
+	src := `TEST-IMPORTS-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, enterprises       FROM SNMPv2-SMI
+    DisplayString, NoSuchType          FROM SNMPv2-TC
+    vendorThing                        FROM VENDOR-MISSING-MIB;
+
+testImportsMIB MODULE-IDENTITY
+    LAST-UPDATED "202401010000Z"
+    ORGANIZATION "Test"
+    CONTACT-INFO "Test"
+    DESCRIPTION  "Test module"
+    REVISION     "202401010000Z"
+    DESCRIPTION  "Initial revision"
+    ::= { enterprises 99997 }
+
+END
+`
+	module, err := ParseMIB([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := baseMIBResolver(t)
+	resolver.Add(MIBFile{}, module)
+	resolver.Resolve()
+
+	var got []MIBDiagnostic
+	for _, diag := range ValidateMIBModule(module, resolver) {
+		if diag.Rule == mibRuleMissingImport {
+			got = append(got, diag)
+		}
+	}
+	want := []struct {
+		line, column int
+		symbol       string
+	}{
+		{5, 20, "NoSuchType"},
+		{6, 45, "VENDOR-MISSING-MIB"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i, w := range want {
+		if got[i].Line != w.line || got[i].Column != w.column || got[i].Symbol != w.symbol {
+			t.Errorf("diagnostic %d: %s at %d:%d, want %s at %d:%d", i, got[i].Symbol, got[i].Line, got[i].Column, w.symbol, w.line, w.column)
+		}
+	}
+}
+
+// testDiagnosticsMIB breaks one validation rule per definition
+const testDiagnosticsMIB = `TEST-DIAG-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, Integer32, Counter32,
+    enterprises                        FROM SNMPv2-SMI;
+
+testDiagMIB MODULE-IDENTITY
+    LAST-UPDATED "202401010000Z"
+    ORGANIZATION "Test"
+    CONTACT-INFO "Test"
+    DESCRIPTION  "Test module"
+    ::= { enterprises 99996 }
+
+testCount OBJECT-TYPE
+    SYNTAX      Counter32
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "A counter without UNITS"
+    ::= { testDiagMIB 1 }
+
+testLevel OBJECT-TYPE
+    SYNTAX      Integer32 (10..1)
+    MAX-ACCESS  read-write
+    STATUS      current
+    DESCRIPTION "An empty range"
+    DEFVAL      { 20 }
+    ::= { testDiagMIB 2 }
+
+  testAgain OBJECT-TYPE
+    SYNTAX      Integer32
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "Same OID as testLevel"
+    ::= { testDiagMIB 2 }
+
+testTable OBJECT-TYPE
+    SYNTAX      SEQUENCE OF TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A table"
+    ::= { testDiagMIB 3 }
+
+testEntry OBJECT-TYPE
+    SYNTAX      TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A row without INDEX"
+    ::= { testTable 1 }
+
+TestEntry ::= SEQUENCE { test_value Integer32 }
+
+test_value OBJECT-TYPE
+    SYNTAX      NoSuchType
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "An underscore and an undefined type"
+    ::= { testEntry 1 }
+
+testOrphan OBJECT IDENTIFIER ::= { noSuchParent 1 }
+
+testCount OBJECT IDENTIFIER ::= { testDiagMIB 9 }
+
+testAVeryLongIdentifierThatGoesOnAndOnWellBeyondTheSixtyFourCharLimit OBJECT IDENTIFIER ::= { testDiagMIB 10 }
+
+END
+`
+
+func TestValidateMIBModuleDiagnostics(t *testing.T) {
+	module, err := ParseMIB([]byte(testDiagnosticsMIB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := baseMIBResolver(t)
+	resolver.Add(MIBFile{}, module)
+	resolver.Resolve()
+
+	want := []struct {
+		line, column int
+		rule, symbol string
+	}{
+		{7, 1, mibRuleMissingRevision, "testDiagMIB"},
+		{14, 1, mibRuleMissingUnits, "testCount"},
+		{21, 1, mibRuleBadDefVal, "testLevel"},
+		{21, 1, mibRuleBadRange, "testLevel"},
+		{29, 3, mibRuleDuplicateOID, "testAgain"},
+		{43, 1, mibRuleMissingIndex, "testEntry"},
+		{52, 1, mibRuleUndefinedSymbol, "NoSuchType"},
+		{52, 1, mibRuleIdentifierUnderscore, "test_value"},
+		{59, 1, mibRuleUndefinedSymbol, "noSuchParent"},
+		{61, 1, mibRuleDuplicateDefinition, "testCount"},
+		{63, 1, mibRuleIdentifierLength, "testAVeryLongIdentifierThatGoesOnAndOnWellBeyondTheSixtyFourCharLimit"},
+	}
+	got := ValidateMIBModule(module, resolver)
+	if len(got) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %+v", len(got), len(want), got)
+	}
+	for _, w := range want {
+		found := false
+		for _, diag := range got {
+			if diag.Line == w.line && diag.Column == w.column && diag.Rule == w.rule && diag.Symbol == w.symbol {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("no %s diagnostic for %s at %d:%d in %+v", w.rule, w.symbol, w.line, w.column, got)
+		}
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Line < got[i-1].Line {
+			t.Errorf("diagnostics not ordered by line: %+v", got)
+			break
+		}
+	}
+}
+
+func TestMIBSyntaxDiagnostics(t *testing.T) {
+	_, err := ParseMIB([]byte("TEST-MIB DEFINITIONS ::= BEGIN\n\ntest OBJECT-TYPE\n    SYNTAX Integer32 (1..\n"))
+	diags := mibSyntaxDiagnostics(err)
+	if len(diags) != 1 || diags[0].Rule != mibRuleSyntaxError || diags[0].Severity != "error" || diags[0].Line != 5 {
+		t.Errorf("got %+v", diags)
+	}
+}
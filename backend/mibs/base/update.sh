@@ -0,0 +1,38 @@
+#!/bin/sh
+# Replaces the bundled base MIBs with verbatim copies of their sources, as
+# listed in README.md. Review the diff and run go test ./... afterwards.
+set -eu
+
+cd "$(dirname "$0")"
+
+NETSNMP=https://raw.githubusercontent.com/net-snmp/net-snmp/v5.9.4/mibs
+
+fetch() {
+	curl -fsSL -o "$1.tmp" "$2"
+	mv "$1.tmp" "$1"
+}
+
+for mib in RFC1155-SMI RFC-1212 RFC-1215 RFC1213-MIB \
+	SNMPv2-SMI SNMPv2-TC SNMPv2-CONF SNMPv2-MIB SNMP-FRAMEWORK-MIB \
+	INET-ADDRESS-MIB IF-MIB IP-MIB HOST-RESOURCES-MIB HOST-RESOURCES-TYPES; do
+	fetch "$mib.txt" "$NETSNMP/$mib.txt"
+done
+
+fetch IANAifType-MIB.txt https://www.iana.org/assignments/ianaiftype-mib/ianaiftype-mib
+
+# Extract ENTITY-MIB from RFC 4133 the way smistrip does: from the module
+# header to END, without page footers, headers and form feeds. The blank
+# lines around a page break collapse into one when the page ended on one.
+curl -fsSL https://www.rfc-editor.org/rfc/rfc4133.txt | awk '
+	/^ *ENTITY-MIB DEFINITIONS ::= BEGIN/ { on = 1 }
+	!on { next }
+	/\[Page [0-9]+\]$/ || /^\f/ || /^RFC 4133 / { blanks = blanks > 0; pagebreak = 1; next }
+	/^[[:space:]]*$/ { if (!pagebreak) blanks++; next }
+	{
+		while (blanks > 0) { print ""; blanks-- }
+		pagebreak = 0
+		print
+	}
+	/^ *END[[:space:]]*$/ { exit }
+' >ENTITY-MIB.txt.tmp
+mv ENTITY-MIB.txt.tmp ENTITY-MIB.txt
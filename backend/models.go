@@ -2,8 +2,6 @@ package main
 
 import (
 	"time"
-
-	"gorm.io/gorm"
 )
 
 // Host represents a remote host for component deployment
@@ -102,41 +100,132 @@ type MIBFile struct {
 	Version     string    `json:"version"`
 	Size        int64     `json:"size"`
 	FilePath    string    `json:"file_path"`
-	Status      string    `json:"status" gorm:"default:pending"` // pending, validated, error
+	ContentHash string    `json:"content_hash" gorm:"index"` // SHA-256 of the file content
+	Status      string    `json:"status" gorm:"default:pending"` // pending, validated, unresolved, error, superseded
 	OIDCount    int       `json:"oid_count"`
 	Description string    `json:"description"`
+
+	// Parsed module metadata
+	ModuleName   string `json:"module_name" gorm:"index"`
+	SMIVersion   int    `json:"smi_version"`
+	LastUpdated  string `json:"last_updated"`
+	Organization string `json:"organization"`
+	ContactInfo  string `json:"contact_info" gorm:"type:text"`
+	Revisions    string `json:"revisions" gorm:"type:text"` // JSON array
+
+	// Dependencies
+	Imports        string `json:"imports" gorm:"type:text"`         // JSON array
+	MissingImports string `json:"missing_imports" gorm:"type:text"` // JSON array, empty when all imports resolve
+
+	// Version history
+	CurrentID *uint `json:"current_id" gorm:"index"` // on older revisions: the current revision of the module
+
+	// Validation results
+	Diagnostics  string     `json:"diagnostics,omitempty" gorm:"type:text"` // JSON array
+	ErrorCount   int        `json:"error_count"`
+	WarningCount int        `json:"warning_count"`
+	ValidatedAt  *time.Time `json:"validated_at"`
+
 	Category    string    `json:"category"`
-	Source      string    `json:"source" gorm:"default:upload"` // upload, server, archive
+	Source      string    `json:"source" gorm:"default:upload"` // upload, server, local, git, archive, system
 	SourcePath  string    `json:"source_path"`
 	ArchiveID   *uint     `json:"archive_id"`
+	ServerPathID  *uint      `json:"server_path_id" gorm:"index"`
+	SourceModTime *time.Time `json:"source_mod_time"` // mtime of the remote file when last synced
 	UploadedAt  time.Time `json:"uploaded_at"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// MIBObject represents a node of the OID tree parsed from a MIB file
+type MIBObject struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	MIBFileID   uint      `json:"mib_file_id" gorm:"index"`
+	Module      string    `json:"module" gorm:"index"`
+	Name        string    `json:"name" gorm:"index"`
+	OID         string    `json:"oid" gorm:"index"`
+	ParentOID   string    `json:"parent_oid" gorm:"index"`
+	SortKey     string    `json:"-" gorm:"index"` // zero-padded arcs for numeric ordering
+	Kind        string    `json:"kind"`           // oid, object-type, notification-type, trap-type, object-group, ...
+	Syntax      string    `json:"syntax"`
+	Access      string    `json:"access"`
+	Status      string    `json:"status"`
+	Units       string    `json:"units"`
+	Description string    `json:"description" gorm:"type:text"`
+	Index       string    `json:"index" gorm:"type:text"`   // JSON array
+	Augments    string    `json:"augments"`
+	Enums       string    `json:"enums" gorm:"type:text"`   // JSON array
+	Objects     string    `json:"objects" gorm:"type:text"` // JSON array
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 // MIBServerPath represents a server path configuration
 type MIBServerPath struct {
 	ID       uint   `json:"id" gorm:"primaryKey"`
 	Name     string `json:"name" gorm:"not null"`
-	Host     string `json:"host" gorm:"not null"`
-	Path     string `json:"path" gorm:"not null"`
+	Type     string `json:"type" gorm:"default:ssh"` // ssh, local, git
+	Host     string `json:"host" gorm:"not null"`    // ssh only
+	Path     string `json:"path" gorm:"not null"`    // remote or local directory, or git repository path or file:// URL
+	Ref      string `json:"ref"`                     // git only: branch, tag or commit, remote HEAD when empty
+	Subdir   string `json:"subdir"`                  // git only: directory within the repository
 	SSHPort  int    `json:"ssh_port" gorm:"default:22"`
 	Username string `json:"username"`
 	Password string `json:"password,omitempty"`
 	SSHKey   string `json:"ssh_key,omitempty"`
 	AutoSync bool   `json:"auto_sync" gorm:"default:false"`
-	Status   string `json:"status" gorm:"default:disconnected"` // connected, disconnected, scanning
+	Status   string `json:"status" gorm:"default:disconnected"` // connected, disconnected, scanning, error
 	LastScan time.Time `json:"last_scan"`
 	FileCount int    `json:"file_count" gorm:"default:0"`
+	LastError string `json:"last_error"`
+
+	// Changes made by the last scan
+	LastAdded   int `json:"last_added"`
+	LastUpdated int `json:"last_updated"`
+	LastRemoved int `json:"last_removed"`
+	LastFailed  int `json:"last_failed"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+
+// MIBSyncRun records one scan of a MIB server path
+type MIBSyncRun struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	ServerPathID uint       `json:"server_path_id" gorm:"index"`
+	Trigger      string     `json:"trigger"` // manual, auto
+	Status       string     `json:"status"`  // running, success, error
+	Files        int        `json:"files"`
+	Added        int        `json:"added"`
+	Updated      int        `json:"updated"`
+	Unchanged    int        `json:"unchanged"`
+	Removed      int        `json:"removed"`
+	Failed       int        `json:"failed"`
+	Error        string     `json:"error"`                        // why the scan as a whole failed
+	FileErrors   string     `json:"file_errors" gorm:"type:text"` // JSON array, one entry per failed file
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+}
+
+// MIBSyncDuplicate records a server path file whose content is already
+// stored as another MIB file, so that scans skip it while it is unchanged
+type MIBSyncDuplicate struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ServerPathID  uint      `json:"server_path_id" gorm:"index"`
+	SourcePath    string    `json:"source_path"`
+	Size          int64     `json:"size"`
+	SourceModTime time.Time `json:"source_mod_time"`
+	MIBFileID     uint      `json:"mib_file_id"` // the stored file with the same content
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
 // MIBArchive represents an uploaded archive
 type MIBArchive struct {
 	ID            uint      `json:"id" gorm:"primaryKey"`
 	Name          string    `json:"name" gorm:"not null"`
 	OriginalName  string    `json:"original_name"`
+	Format        string    `json:"format"` // zip, tar, gzip, bzip2, xz, rar, 7z; detected from the content
 	Size          int64     `json:"size"`
 	FilePath      string    `json:"file_path"`
 	Status        string    `json:"status" gorm:"default:uploaded"` // uploaded, extracting, extracted, error
@@ -166,6 +255,17 @@ type Device struct {
 	LastPolled   time.Time `json:"last_polled"`
 	GroupName    string    `json:"group_name"`
 	
+	// SNMPv3 USM credentials, used when SNMPVersion is v3. Passphrases are
+	// write-only and stored encrypted.
+	SecurityName      string `json:"security_name"`
+	SecurityLevel     string `json:"security_level"` // noAuthNoPriv, authNoPriv, authPriv
+	AuthProtocol      string `json:"auth_protocol"`  // MD5, SHA, SHA-224, SHA-256, SHA-384, SHA-512
+	AuthPassphrase    string `json:"auth_passphrase,omitempty" gorm:"-"`
+	PrivProtocol      string `json:"priv_protocol"`  // DES, AES, AES-192, AES-256
+	PrivPassphrase    string `json:"priv_passphrase,omitempty" gorm:"-"`
+	EncAuthPassphrase string `json:"-"`
+	EncPrivPassphrase string `json:"-"`
+	
 	// Performance metrics
 	CPUUsage     float64 `json:"cpu_usage"`
 	MemoryUsage  float64 `json:"memory_usage"`
@@ -200,6 +300,42 @@ type Alert struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// Trap is an SNMP trap or inform received from a device
+type Trap struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	DeviceID     *uint     `json:"device_id" gorm:"index"`
+	Device       Device    `json:"device,omitempty" gorm:"foreignKey:DeviceID"`
+	Source       string    `json:"source" gorm:"index"` // sender IP address
+	Version      string    `json:"version"`             // v1, v2c, v3
+	PDUType      string    `json:"pdu_type"`            // trap, inform
+	SecurityName string    `json:"security_name"`       // v3 user
+	TrapOID      string    `json:"trap_oid" gorm:"column:trap_oid;index"`
+	Name         string    `json:"name"` // MODULE::notification, or the OID when no MIB defines it
+	Description  string    `json:"description" gorm:"type:text"`
+	Enterprise   string    `json:"enterprise"`                 // v1 only
+	AgentAddress string    `json:"agent_address"`              // v1 only
+	Uptime       uint32    `json:"uptime"`                     // sysUpTime.0 of the sender, in hundredths of a second
+	Variables    string    `json:"variables" gorm:"type:text"` // JSON array of decoded varbinds
+	ReceivedAt   time.Time `json:"received_at" gorm:"index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TrapAlertRule raises an Alert for matching traps and resolves it when
+// the paired clear trap arrives, such as linkUp for linkDown
+type TrapAlertRule struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Name         string    `json:"name" gorm:"not null"`
+	TrapOID      string    `json:"trap_oid" gorm:"column:trap_oid;not null;index"`    // numeric; names are translated when saved
+	Match        string    `json:"match" gorm:"type:text"`                            // JSON object, varbind object -> required value
+	Severity     string    `json:"severity" gorm:"not null"`                          // critical, warning, info
+	AlertName    string    `json:"alert_name"`                                        // template, e.g. "Link down on {{device}} port {{ifIndex}}"
+	Description  string    `json:"description"`                                       // template
+	ClearTrapOID string    `json:"clear_trap_oid" gorm:"column:clear_trap_oid;index"` // trap resolving the alert, none when empty
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
 // Config represents a configuration template
 type Config struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
@@ -253,4 +389,11 @@ type SSHKey struct {
 	UsedByHosts string    `json:"used_by_hosts" gorm:"type:text"` // JSON array
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
-}
\ No newline at end of file
+}
+
+// Setting is one persisted application setting
+type Setting struct {
+	Key       string    `json:"key" gorm:"primaryKey"`
+	Value     string    `json:"value" gorm:"type:text"` // JSON
+	UpdatedAt time.Time `json:"updated_at"`
+}
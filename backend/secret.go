@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	secretKeyEnv  = "SNMP_MONITOR_SECRET_KEY"
+	secretKeyFile = "snmp_monitor.key"
+	secretPrefix  = "enc:"
+)
+
+var (
+	secretKeyOnce sync.Once
+	secretAEAD    cipher.AEAD
+	secretKeyErr  error
+)
+
+// secretCipher returns the AES-256-GCM cipher for stored secrets. The key
+// is derived from SNMP_MONITOR_SECRET_KEY, or read from snmp_monitor.key
+// next to the database, which is created on first use.
+func secretCipher() (cipher.AEAD, error) {
+	secretKeyOnce.Do(func() {
+		var key []byte
+		if passphrase := os.Getenv(secretKeyEnv); passphrase != "" {
+			sum := sha256.Sum256([]byte(passphrase))
+			key = sum[:]
+		} else {
+			data, err := os.ReadFile(secretKeyFile)
+			if os.IsNotExist(err) {
+				data = make([]byte, 32)
+				if _, err = rand.Read(data); err == nil {
+					err = os.WriteFile(secretKeyFile, data, 0600)
+				}
+			}
+			if err != nil {
+				secretKeyErr = fmt.Errorf("failed to load secret key: %v", err)
+				return
+			}
+			if len(data) != 32 {
+				secretKeyErr = fmt.Errorf("secret key %s must be 32 bytes", secretKeyFile)
+				return
+			}
+			key = data
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			secretKeyErr = err
+			return
+		}
+		secretAEAD, secretKeyErr = cipher.NewGCM(block)
+	})
+	return secretAEAD, secretKeyErr
+}
+
+// encryptSecret seals a secret for storage
+func encryptSecret(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret opens a secret sealed by encryptSecret
+func decryptSecret(stored string) (string, error) {
+	if stored == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(stored, secretPrefix) {
+		return "", fmt.Errorf("secret is not encrypted")
+	}
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, secretPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted secret")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret, was the secret key changed?")
+	}
+	return string(plaintext), nil
+}
+
+// secretEnv returns the environment variable reference, ${NAME}, that a
+// generated config holds instead of a passphrase, so passphrases are never
+// written into stored configs. NAME is built from parts in upper case.
+func secretEnv(parts ...string) (name, reference string) {
+	name = strings.ToUpper(strings.Join(parts, "_"))
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	return name, "${" + name + "}"
+}
@@ -0,0 +1,275 @@
+package snmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags used by SNMP
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagOID         = 0x06
+	tagSequence    = 0x30
+)
+
+// berElement is a decoded tag-length-value triple
+type berElement struct {
+	Tag   byte
+	Value []byte
+}
+
+// appendLength appends a BER definite length
+func appendLength(buf []byte, n int) []byte {
+	if n < 0x80 {
+		return append(buf, byte(n))
+	}
+	var octets []byte
+	for v := n; v > 0; v >>= 8 {
+		octets = append([]byte{byte(v)}, octets...)
+	}
+	buf = append(buf, 0x80|byte(len(octets)))
+	return append(buf, octets...)
+}
+
+// encodeTLV wraps value in a tag and length
+func encodeTLV(tag byte, value []byte) []byte {
+	buf := make([]byte, 0, len(value)+6)
+	buf = append(buf, tag)
+	buf = appendLength(buf, len(value))
+	return append(buf, value...)
+}
+
+// encodeSequence concatenates encoded elements under a constructed tag
+func encodeSequence(tag byte, elements ...[]byte) []byte {
+	var value []byte
+	for _, element := range elements {
+		value = append(value, element...)
+	}
+	return encodeTLV(tag, value)
+}
+
+// encodeInteger encodes a signed integer in the fewest two's complement
+// octets
+func encodeInteger(tag byte, v int64) []byte {
+	var octets []byte
+	for {
+		octets = append([]byte{byte(v)}, octets...)
+		if (v >= -128 && v < 128) || len(octets) == 8 {
+			break
+		}
+		v >>= 8
+	}
+	return encodeTLV(tag, octets)
+}
+
+// encodeUnsigned encodes an unsigned application integer, adding a leading
+// zero when the high bit is set so it is not read as negative
+func encodeUnsigned(tag byte, v uint64) []byte {
+	var octets []byte
+	for {
+		octets = append([]byte{byte(v)}, octets...)
+		v >>= 8
+		if v == 0 {
+			break
+		}
+	}
+	if octets[0]&0x80 != 0 {
+		octets = append([]byte{0}, octets...)
+	}
+	return encodeTLV(tag, octets)
+}
+
+// encodeOID encodes a dotted OID
+func encodeOID(oid string) ([]byte, error) {
+	arcs, err := parseOID(oid)
+	if err != nil {
+		return nil, err
+	}
+	if len(arcs) < 2 {
+		return nil, fmt.Errorf("OID %q needs at least two arcs", oid)
+	}
+	if arcs[0] > 2 || (arcs[0] < 2 && arcs[1] >= 40) {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	value := appendBase128(nil, arcs[0]*40+arcs[1])
+	for _, arc := range arcs[2:] {
+		value = appendBase128(value, arc)
+	}
+	return encodeTLV(tagOID, value), nil
+}
+
+func appendBase128(buf []byte, v uint64) []byte {
+	var octets []byte
+	octets = append(octets, byte(v&0x7f))
+	for v >>= 7; v > 0; v >>= 7 {
+		octets = append([]byte{byte(v&0x7f) | 0x80}, octets...)
+	}
+	return append(buf, octets...)
+}
+
+// parseOID splits a dotted OID, with or without a leading dot
+func parseOID(oid string) ([]uint64, error) {
+	oid = strings.TrimPrefix(strings.TrimSpace(oid), ".")
+	if oid == "" {
+		return nil, fmt.Errorf("empty OID")
+	}
+	parts := strings.Split(oid, ".")
+	arcs := make([]uint64, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		arcs[i] = arc
+	}
+	return arcs, nil
+}
+
+// decodeElement reads one TLV from data and returns it with the rest
+func decodeElement(data []byte) (berElement, []byte, error) {
+	if len(data) < 2 {
+		return berElement{}, nil, fmt.Errorf("truncated BER element")
+	}
+	tag := data[0]
+	length := int(data[1])
+	offset := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(data) < 2+n {
+			return berElement{}, nil, fmt.Errorf("invalid BER length")
+		}
+		length = 0
+		for _, b := range data[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+	if length < 0 || len(data)-offset < length {
+		return berElement{}, nil, fmt.Errorf("BER element of %d bytes exceeds the packet", length)
+	}
+	return berElement{Tag: tag, Value: data[offset : offset+length]}, data[offset+length:], nil
+}
+
+// decodeElements splits the contents of a constructed element
+func decodeElements(data []byte) ([]berElement, error) {
+	var elements []berElement
+	for len(data) > 0 {
+		element, rest, err := decodeElement(data)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		data = rest
+	}
+	return elements, nil
+}
+
+// expect reads one element with the given tag
+func expect(data []byte, tag byte, what string) (berElement, []byte, error) {
+	element, rest, err := decodeElement(data)
+	if err != nil {
+		return element, nil, fmt.Errorf("%s: %v", what, err)
+	}
+	if element.Tag != tag {
+		return element, nil, fmt.Errorf("%s: unexpected tag 0x%02x", what, element.Tag)
+	}
+	return element, rest, nil
+}
+
+// decodeInteger reads a two's complement integer
+func decodeInteger(value []byte) (int64, error) {
+	if len(value) == 0 || len(value) > 8 {
+		return 0, fmt.Errorf("invalid integer length %d", len(value))
+	}
+	v := int64(int8(value[0]))
+	for _, b := range value[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+// decodeUnsigned reads an unsigned application integer of up to 64 bits
+func decodeUnsigned(value []byte) (uint64, error) {
+	if len(value) > 0 && value[0] == 0 {
+		value = value[1:]
+	}
+	if len(value) == 0 {
+		return 0, nil
+	}
+	if len(value) > 8 {
+		return 0, fmt.Errorf("invalid unsigned length %d", len(value))
+	}
+	var v uint64
+	for _, b := range value {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// decodeOID returns the dotted form of an encoded OID
+func decodeOID(value []byte) (string, error) {
+	if len(value) == 0 {
+		return "", fmt.Errorf("empty OID")
+	}
+	var arcs []string
+	var arc uint64
+	first := true
+	for i, b := range value {
+		if arc > 1<<56 {
+			return "", fmt.Errorf("OID arc overflows")
+		}
+		arc = arc<<7 | uint64(b&0x7f)
+		if b&0x80 != 0 {
+			if i == len(value)-1 {
+				return "", fmt.Errorf("truncated OID")
+			}
+			continue
+		}
+		if first {
+			switch {
+			case arc < 40:
+				arcs = append(arcs, "0", strconv.FormatUint(arc, 10))
+			case arc < 80:
+				arcs = append(arcs, "1", strconv.FormatUint(arc-40, 10))
+			default:
+				arcs = append(arcs, "2", strconv.FormatUint(arc-80, 10))
+			}
+			first = false
+		} else {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+		}
+		arc = 0
+	}
+	return strings.Join(arcs, "."), nil
+}
+
+// CompareOIDs orders two dotted OIDs arc by arc, returning -1, 0 or 1
+func CompareOIDs(a, b string) int {
+	aArcs, _ := parseOID(a)
+	bArcs, _ := parseOID(b)
+	for i := 0; i < len(aArcs) && i < len(bArcs); i++ {
+		if aArcs[i] != bArcs[i] {
+			if aArcs[i] < bArcs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(aArcs) < len(bArcs):
+		return -1
+	case len(aArcs) > len(bArcs):
+		return 1
+	}
+	return 0
+}
+
+// HasPrefix reports whether oid is root or below it
+func HasPrefix(oid, root string) bool {
+	oid = strings.TrimPrefix(oid, ".")
+	root = strings.TrimPrefix(root, ".")
+	return oid == root || strings.HasPrefix(oid, root+".")
+}
@@ -0,0 +1,186 @@
+package snmp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEncodeInteger(t *testing.T) {
+	tests := []struct {
+		v    int64
+		want string
+	}{
+		{0, "020100"},
+		{1, "020101"},
+		{127, "02017f"},
+		{128, "02020080"},
+		{255, "020200ff"},
+		{256, "02020100"},
+		{-1, "0201ff"},
+		{-128, "020180"},
+		{-129, "0202ff7f"},
+		{-256, "0202ff00"},
+		{math.MaxInt32, "02047fffffff"},
+		{math.MinInt32, "020480000000"},
+		{math.MaxInt64, "02087fffffffffffffff"},
+		{math.MinInt64, "02088000000000000000"},
+	}
+	for _, tt := range tests {
+		encoded := encodeInteger(tagInteger, tt.v)
+		if got := hex.EncodeToString(encoded); got != tt.want {
+			t.Errorf("encodeInteger(%d) = %s, want %s", tt.v, got, tt.want)
+			continue
+		}
+		element, rest, err := decodeElement(encoded)
+		if err != nil || len(rest) != 0 {
+			t.Errorf("decodeElement(%s) = %v, rest %x", tt.want, err, rest)
+			continue
+		}
+		if v, err := decodeInteger(element.Value); err != nil || v != tt.v {
+			t.Errorf("decodeInteger(%s) = %d, %v; want %d", tt.want, v, err, tt.v)
+		}
+	}
+}
+
+func TestEncodeUnsigned(t *testing.T) {
+	tests := []struct {
+		tag  byte
+		v    uint64
+		want string
+	}{
+		{byte(Counter32), 0, "410100"},
+		{byte(Counter32), 127, "41017f"},
+		{byte(Counter32), 128, "41020080"},
+		{byte(Gauge32), 0x80000000, "42050080000000"},
+		{byte(TimeTicks), math.MaxUint32, "430500ffffffff"},
+		{byte(Counter64), math.MaxUint32 + 1, "46050100000000"},
+		{byte(Counter64), 1 << 63, "4609008000000000000000"},
+		{byte(Counter64), math.MaxUint64, "460900ffffffffffffffff"},
+	}
+	for _, tt := range tests {
+		encoded := encodeUnsigned(tt.tag, tt.v)
+		if got := hex.EncodeToString(encoded); got != tt.want {
+			t.Errorf("encodeUnsigned(%d) = %s, want %s", tt.v, got, tt.want)
+			continue
+		}
+		element, _, err := decodeElement(encoded)
+		if err != nil {
+			t.Errorf("decodeElement(%s) = %v", tt.want, err)
+			continue
+		}
+		if v, err := decodeUnsigned(element.Value); err != nil || v != tt.v {
+			t.Errorf("decodeUnsigned(%s) = %d, %v; want %d", tt.want, v, err, tt.v)
+		}
+	}
+
+	for _, value := range []string{"010000000000000000", "00010000000000000000"} {
+		raw, _ := hex.DecodeString(value)
+		if _, err := decodeUnsigned(raw); err == nil {
+			t.Errorf("decodeUnsigned(%s) accepted more than 64 bits", value)
+		}
+	}
+}
+
+func TestEncodeOID(t *testing.T) {
+	tests := []struct {
+		oid  string
+		want string
+	}{
+		{"1.3.6.1.2.1.1.1.0", "06082b06010201010100"},
+		{".1.3.6.1.2.1.1.3.0", "06082b06010201010300"},
+		{"0.0", "060100"},
+		{"2.999.3", "0603883703"},
+		{"1.3.6.1.4.1.9.9.13.1.3.1.3", "060c2b0601040109090d01030103"},
+		{"1.3.6.1.4.1.4294967295", "060a2b060104018fffffff7f"},
+	}
+	for _, tt := range tests {
+		encoded, err := encodeOID(tt.oid)
+		if err != nil {
+			t.Errorf("encodeOID(%s) = %v", tt.oid, err)
+			continue
+		}
+		if got := hex.EncodeToString(encoded); got != tt.want {
+			t.Errorf("encodeOID(%s) = %s, want %s", tt.oid, got, tt.want)
+			continue
+		}
+		element, _, _ := decodeElement(encoded)
+		decoded, err := decodeOID(element.Value)
+		if err != nil || decoded != strings.TrimPrefix(tt.oid, ".") {
+			t.Errorf("decodeOID(%s) = %s, %v", tt.want, decoded, err)
+		}
+	}
+
+	for _, oid := range []string{"", "1", "3.1", "1.40", "1.3.x", "1.3.6.1.4294967296", "1..3"} {
+		if _, err := encodeOID(oid); err == nil {
+			t.Errorf("encodeOID(%q) accepted an invalid OID", oid)
+		}
+	}
+	for _, value := range []string{"", "2b0681", "2bffffffffffffffffff7f"} {
+		raw, _ := hex.DecodeString(value)
+		if _, err := decodeOID(raw); err == nil {
+			t.Errorf("decodeOID(%s) accepted a malformed OID", value)
+		}
+	}
+}
+
+func TestDecodeElementLengths(t *testing.T) {
+	for _, n := range []int{0, 1, 127, 128, 255, 256, 300, 65535, 70000} {
+		value := bytes.Repeat([]byte{0xab}, n)
+		encoded := encodeTLV(tagOctetString, value)
+		element, rest, err := decodeElement(append(encoded, 0x05, 0x00))
+		if err != nil {
+			t.Errorf("length %d: %v", n, err)
+			continue
+		}
+		if !bytes.Equal(element.Value, value) || !bytes.Equal(rest, []byte{0x05, 0x00}) {
+			t.Errorf("length %d: decoded %d bytes with rest %x", n, len(element.Value), rest)
+		}
+	}
+	if got := hex.EncodeToString(encodeTLV(tagOctetString, make([]byte, 200))[:3]); got != "0481c8" {
+		t.Errorf("200 byte header = %s, want 0481c8", got)
+	}
+	if got := hex.EncodeToString(encodeTLV(tagOctetString, make([]byte, 300))[:4]); got != "0482012c" {
+		t.Errorf("300 byte header = %s, want 0482012c", got)
+	}
+
+	malformed := []string{
+		"",                   // empty
+		"04",                 // no length
+		"0405616263",         // shorter than its length
+		"0480",               // indefinite length
+		"0481",               // missing length octet
+		"048500000000010000", // length of five octets
+		"0484ffffffff00",     // length beyond the packet
+	}
+	for _, value := range malformed {
+		raw, _ := hex.DecodeString(value)
+		if _, _, err := decodeElement(raw); err == nil {
+			t.Errorf("decodeElement(%s) accepted a malformed element", value)
+		}
+	}
+}
+
+func TestCompareOIDs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.3.6.1", "1.3.6.1", 0},
+		{".1.3.6.1", "1.3.6.1", 0},
+		{"1.3.6.1.2", "1.3.6.1.10", -1},
+		{"1.3.6.1.10", "1.3.6.1.2", 1},
+		{"1.3.6.1", "1.3.6.1.0", -1},
+		{"1.3.6.2", "1.3.6.1.99", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareOIDs(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareOIDs(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if !HasPrefix("1.3.6.1.2.1", "1.3.6.1") || HasPrefix("1.3.6.10", "1.3.6.1") || !HasPrefix(".1.3", "1.3") {
+		t.Error("HasPrefix does not match whole arcs")
+	}
+}
@@ -0,0 +1,434 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout        = 2 * time.Second
+	defaultMaxRepetitions = 25
+	maxPacketSize         = 65535
+)
+
+// ErrTimeout is returned when no matching response arrives after all retries
+var ErrTimeout = errors.New("SNMP request timed out")
+
+// RequestError is a response carrying a non-zero error-status
+type RequestError struct {
+	Status ErrorStatus
+	Index  int
+	OID    string
+}
+
+func (e *RequestError) Error() string {
+	if e.OID != "" {
+		return fmt.Sprintf("SNMP error %s at %s", e.Status, e.OID)
+	}
+	return fmt.Sprintf("SNMP error %s (index %d)", e.Status, e.Index)
+}
+
+// Client talks to one SNMP agent over UDP
+type Client struct {
+	Target         string
+	Port           int // defaults to 161
+	Version        Version
+	Community      string
+	Security       *Security     // SNMPv3 USM user, required for Version3
+	ContextName    string        // SNMPv3 context, usually empty
+	Timeout        time.Duration // per attempt, defaults to 2s
+	Retries        int
+	MaxRepetitions int // GETBULK max-repetitions for walks, defaults to 25
+
+	mu        sync.Mutex
+	conn      net.Conn
+	requestID int32
+	user      *User
+	engine    engineState
+}
+
+// Connect opens the UDP socket to the agent
+func (c *Client) Connect() error {
+	port := c.Port
+	if port == 0 {
+		port = 161
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(c.Target, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("failed to open SNMP socket: %v", err)
+	}
+	c.conn = conn
+	c.requestID = rand.Int31()
+	if c.Version == Version3 {
+		if c.Security == nil {
+			conn.Close()
+			c.conn = nil
+			return fmt.Errorf("SNMPv3 needs security parameters")
+		}
+		if c.user, err = NewUser(*c.Security); err != nil {
+			conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the socket
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Get fetches the given instances
+func (c *Client) Get(oids ...string) (*PDU, error) {
+	return c.request(GetRequest, oids, 0, 0)
+}
+
+// GetNext fetches the lexicographic successor of each OID
+func (c *Client) GetNext(oids ...string) (*PDU, error) {
+	return c.request(GetNextRequest, oids, 0, 0)
+}
+
+// GetBulk fetches the successors of the first nonRepeaters OIDs once and up
+// to maxRepetitions successors of the rest. It needs v2c or later.
+func (c *Client) GetBulk(nonRepeaters, maxRepetitions int, oids ...string) (*PDU, error) {
+	if c.Version == Version1 {
+		return nil, fmt.Errorf("GETBULK is not available in SNMPv1")
+	}
+	return c.request(GetBulkRequest, oids, nonRepeaters, maxRepetitions)
+}
+
+// Walk calls fn for every instance below root in order. It uses GETBULK
+// except on v1, and stops at the end of the subtree, at endOfMibView or when
+// the agent returns OIDs out of order.
+func (c *Client) Walk(root string, fn func(Variable) error) error {
+	if _, err := parseOID(root); err != nil {
+		return err
+	}
+	maxRepetitions := c.MaxRepetitions
+	if maxRepetitions <= 0 {
+		maxRepetitions = defaultMaxRepetitions
+	}
+
+	current := root
+	for {
+		var pdu *PDU
+		var err error
+		if c.Version == Version1 {
+			pdu, err = c.GetNext(current)
+			if reqErr, ok := err.(*RequestError); ok && reqErr.Status == NoSuchName {
+				return nil // noSuchName marks the end of the MIB view in v1
+			}
+		} else {
+			pdu, err = c.GetBulk(0, maxRepetitions, current)
+		}
+		if err != nil {
+			return err
+		}
+		if len(pdu.Variables) == 0 {
+			return nil
+		}
+		for _, variable := range pdu.Variables {
+			if variable.Type == EndOfMibView || !HasPrefix(variable.OID, root) || variable.OID == root {
+				return nil
+			}
+			if CompareOIDs(variable.OID, current) <= 0 {
+				return fmt.Errorf("agent returned %s after %s, OIDs are not increasing", variable.OID, current)
+			}
+			if err := fn(variable); err != nil {
+				return err
+			}
+			current = variable.OID
+		}
+	}
+}
+
+// WalkAll collects a walk of root
+func (c *Client) WalkAll(root string) ([]Variable, error) {
+	var variables []Variable
+	err := c.Walk(root, func(v Variable) error {
+		variables = append(variables, v)
+		return nil
+	})
+	return variables, err
+}
+
+// request sends one PDU and waits for the response with its request ID,
+// resending on timeout
+func (c *Client) request(pduType PDUType, oids []string, nonRepeaters, maxRepetitions int) (*PDU, error) {
+	if len(oids) == 0 {
+		return nil, fmt.Errorf("no OIDs requested")
+	}
+	pdu := &PDU{Type: pduType, ErrorStatus: ErrorStatus(nonRepeaters), ErrorIndex: maxRepetitions}
+	for _, oid := range oids {
+		pdu.Variables = append(pdu.Variables, Variable{OID: oid, Type: Null})
+	}
+
+	response, err := c.exchange(pdu)
+	if err != nil {
+		return nil, err
+	}
+	if response.ErrorStatus != NoError {
+		reqErr := &RequestError{Status: response.ErrorStatus, Index: response.ErrorIndex}
+		if response.ErrorIndex > 0 && response.ErrorIndex <= len(oids) {
+			reqErr.OID = oids[response.ErrorIndex-1]
+		}
+		return response, reqErr
+	}
+	return response, nil
+}
+
+func (c *Client) exchange(pdu *PDU) (*PDU, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil, fmt.Errorf("SNMP client not connected")
+	}
+	switch c.Version {
+	case Version1, Version2c:
+		return c.roundTrip(func(requestID int32) ([]byte, error) {
+			pdu.RequestID = requestID
+			return (&Message{Version: c.Version, Community: c.Community, PDU: pdu}).Marshal()
+		}, func(data []byte, requestID int32) *PDU {
+			message, err := Unmarshal(data)
+			if err != nil || message.PDU.Type != GetResponse || message.PDU.RequestID != requestID {
+				return nil
+			}
+			return message.PDU
+		})
+	case Version3:
+		return c.exchangeV3(pdu)
+	}
+	return nil, fmt.Errorf("SNMP %s is not supported", c.Version)
+}
+
+// roundTrip sends the packet build returns and waits for a datagram accept
+// takes, resending on timeout. Every attempt gets a fresh request ID so a
+// late answer to an earlier attempt cannot be mistaken for this one.
+func (c *Client) roundTrip(build func(requestID int32) ([]byte, error), accept func(data []byte, requestID int32) *PDU) (*PDU, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	buf := make([]byte, maxPacketSize)
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		c.requestID = (c.requestID + 1) & 0x7fffffff
+		requestID := c.requestID
+		packet, err := build(requestID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.conn.Write(packet); err != nil {
+			return nil, fmt.Errorf("failed to send SNMP request: %v", err)
+		}
+
+		deadline := time.Now().Add(timeout)
+		for {
+			c.conn.SetReadDeadline(deadline)
+			n, err := c.conn.Read(buf)
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					break
+				}
+				return nil, fmt.Errorf("failed to read SNMP response: %v", err)
+			}
+			if response := accept(buf[:n], requestID); response != nil {
+				return response, nil
+			}
+			// stray, malformed or unauthenticated datagram
+		}
+	}
+	return nil, ErrTimeout
+}
+
+// USM statistics an agent reports instead of answering a v3 request
+const (
+	usmStatsNotInTimeWindows = "1.3.6.1.6.3.15.1.1.2.0"
+	usmStatsUnknownEngineIDs = "1.3.6.1.6.3.15.1.1.4.0"
+)
+
+var reportNames = map[string]string{
+	"1.3.6.1.6.3.15.1.1.1.0": "usmStatsUnsupportedSecLevels",
+	usmStatsNotInTimeWindows: "usmStatsNotInTimeWindows",
+	"1.3.6.1.6.3.15.1.1.3.0": "usmStatsUnknownUserNames",
+	usmStatsUnknownEngineIDs: "usmStatsUnknownEngineIDs",
+	"1.3.6.1.6.3.15.1.1.5.0": "usmStatsWrongDigests",
+	"1.3.6.1.6.3.15.1.1.6.0": "usmStatsDecryptionErrors",
+	"1.3.6.1.6.3.11.2.1.1.0": "snmpUnknownSecurityModels",
+	"1.3.6.1.6.3.11.2.1.2.0": "snmpInvalidMsgs",
+	"1.3.6.1.6.3.11.2.1.3.0": "snmpUnknownPDUHandlers",
+	"1.3.6.1.6.3.12.1.4.0":   "snmpUnavailableContexts",
+	"1.3.6.1.6.3.12.1.5.0":   "snmpUnknownContexts",
+}
+
+// ReportError is an SNMPv3 Report the agent sent instead of a response
+type ReportError struct {
+	OID  string
+	Name string
+}
+
+func (e *ReportError) Error() string {
+	return "SNMPv3 agent reported " + e.Name
+}
+
+func newReportError(pdu *PDU) *ReportError {
+	if len(pdu.Variables) == 0 {
+		return &ReportError{Name: "an empty report"}
+	}
+	oid := pdu.Variables[0].OID
+	if name, ok := reportNames[oid]; ok {
+		return &ReportError{OID: oid, Name: name}
+	}
+	return &ReportError{OID: oid, Name: oid}
+}
+
+// engineState is the client's notion of the agent's authoritative engine
+type engineState struct {
+	id         []byte
+	boots      int32
+	time       int32
+	syncedAt   time.Time
+	latestTime int32 // latest engine time received, for the time window
+}
+
+// now estimates the agent's engine time from the last synchronisation
+func (e *engineState) now() int32 {
+	return e.time + int32(time.Since(e.syncedAt)/time.Second)
+}
+
+// update takes boots and time from an authenticated message when they are
+// newer and reports whether the message falls within the 150 second time
+// window (RFC 3414 3.2.7)
+func (e *engineState) update(boots, engineTime int32) bool {
+	if boots > e.boots || (boots == e.boots && engineTime > e.latestTime) {
+		e.boots, e.time, e.latestTime, e.syncedAt = boots, engineTime, engineTime, time.Now()
+	}
+	if e.boots == math.MaxInt32 || boots < e.boots {
+		return false
+	}
+	return boots > e.boots || engineTime >= e.latestTime-150
+}
+
+// exchangeV3 sends pdu as the USM user. The agent's engine ID and clock are
+// discovered first; an unknown engine ID or a request outside the time
+// window is retried once after resynchronising.
+func (c *Client) exchangeV3(pdu *PDU) (*PDU, error) {
+	for retry := true; ; retry = false {
+		if c.engine.id == nil {
+			if err := c.discover(); err != nil {
+				return nil, err
+			}
+		}
+		response, err := c.sendV3(pdu)
+		if err == ErrTimeout {
+			c.engine = engineState{} // the agent may have a new engine ID
+		}
+		if err != nil {
+			return nil, err
+		}
+		if response.Type != Report {
+			return response, nil
+		}
+		reportErr := newReportError(response)
+		switch {
+		case retry && reportErr.OID == usmStatsNotInTimeWindows:
+			continue // the authenticated report carried the agent's clock
+		case retry && reportErr.OID == usmStatsUnknownEngineIDs:
+			c.engine = engineState{}
+			continue
+		}
+		return nil, reportErr
+	}
+}
+
+// discover learns the agent's engine ID, boots and time from the Report it
+// sends for an empty unauthenticated request (RFC 3414 4)
+func (c *Client) discover() error {
+	var discovered *MessageV3
+	_, err := c.roundTrip(func(msgID int32) ([]byte, error) {
+		return MarshalV3(&MessageV3{
+			MsgID: msgID,
+			Flags: flagReportable,
+			PDU:   &PDU{Type: GetRequest, RequestID: msgID},
+		}, nil)
+	}, func(data []byte, msgID int32) *PDU {
+		m, err := UnmarshalV3(data, nil)
+		if err != nil || m.MsgID != msgID || m.PDU.Type != Report || len(m.EngineID) == 0 {
+			return nil
+		}
+		discovered = m
+		return m.PDU
+	})
+	if err != nil {
+		return fmt.Errorf("SNMPv3 engine discovery failed: %v", err)
+	}
+	c.engine = engineState{
+		id:         discovered.EngineID,
+		boots:      discovered.EngineBoots,
+		time:       discovered.EngineTime,
+		latestTime: discovered.EngineTime,
+		syncedAt:   time.Now(),
+	}
+	return nil
+}
+
+// sendV3 sends pdu at the user's security level and returns the matching
+// response or report
+func (c *Client) sendV3(pdu *PDU) (*PDU, error) {
+	level := c.user.Level
+	lookup := func(name string) *User {
+		if name == c.user.UserName {
+			return c.user
+		}
+		return nil
+	}
+	return c.roundTrip(func(msgID int32) ([]byte, error) {
+		pdu.RequestID = msgID
+		return MarshalV3(&MessageV3{
+			MsgID:           msgID,
+			Flags:           levelFlags(level) | flagReportable,
+			EngineID:        c.engine.id,
+			EngineBoots:     c.engine.boots,
+			EngineTime:      c.engine.now(),
+			UserName:        c.user.UserName,
+			ContextEngineID: c.engine.id,
+			ContextName:     c.ContextName,
+			PDU:             pdu,
+		}, c.user)
+	}, func(data []byte, msgID int32) *PDU {
+		m, err := UnmarshalV3(data, lookup)
+		if err != nil || m.MsgID != msgID {
+			return nil
+		}
+		switch m.PDU.Type {
+		case GetResponse:
+			if m.PDU.RequestID != msgID || m.Level() != level || string(m.EngineID) != string(c.engine.id) {
+				return nil
+			}
+			if level > NoAuthNoPriv && !c.engine.update(m.EngineBoots, m.EngineTime) {
+				return nil
+			}
+		case Report:
+			// Reports on failed authentication cannot be authenticated
+			// themselves; only authenticated ones move the clock
+			if m.Level() > NoAuthNoPriv && string(m.EngineID) == string(c.engine.id) {
+				c.engine.update(m.EngineBoots, m.EngineTime)
+			}
+		default:
+			return nil
+		}
+		return m.PDU
+	})
+}
@@ -0,0 +1,508 @@
+package snmp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Version is the SNMP message version as carried on the wire
+type Version int
+
+const (
+	Version1  Version = 0
+	Version2c Version = 1
+	Version3  Version = 3
+)
+
+func (v Version) String() string {
+	switch v {
+	case Version1:
+		return "v1"
+	case Version2c:
+		return "v2c"
+	case Version3:
+		return "v3"
+	}
+	return "v?" + strconv.Itoa(int(v))
+}
+
+// ParseVersion accepts the spellings stored on Device.SNMPVersion
+func ParseVersion(s string) (Version, error) {
+	switch strings.ToLower(s) {
+	case "1", "v1":
+		return Version1, nil
+	case "", "2", "2c", "v2", "v2c":
+		return Version2c, nil
+	case "3", "v3":
+		return Version3, nil
+	}
+	return 0, fmt.Errorf("unsupported SNMP version %q", s)
+}
+
+// PDUType is the context-specific tag of a PDU
+type PDUType byte
+
+const (
+	GetRequest     PDUType = 0xa0
+	GetNextRequest PDUType = 0xa1
+	GetResponse    PDUType = 0xa2
+	SetRequest     PDUType = 0xa3
+	TrapV1         PDUType = 0xa4
+	GetBulkRequest PDUType = 0xa5
+	InformRequest  PDUType = 0xa6
+	TrapV2         PDUType = 0xa7
+	Report         PDUType = 0xa8
+)
+
+var pduTypeNames = map[PDUType]string{
+	GetRequest:     "GetRequest",
+	GetNextRequest: "GetNextRequest",
+	GetResponse:    "GetResponse",
+	SetRequest:     "SetRequest",
+	TrapV1:         "Trap",
+	GetBulkRequest: "GetBulkRequest",
+	InformRequest:  "InformRequest",
+	TrapV2:         "SNMPv2-Trap",
+	Report:         "Report",
+}
+
+func (t PDUType) String() string {
+	if name, ok := pduTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("PDU(0x%02x)", byte(t))
+}
+
+// Type is the BER tag of a varbind value
+type Type byte
+
+const (
+	Integer        Type = 0x02
+	OctetString    Type = 0x04
+	Null           Type = 0x05
+	ObjectID       Type = 0x06
+	IPAddress      Type = 0x40
+	Counter32      Type = 0x41
+	Gauge32        Type = 0x42
+	TimeTicks      Type = 0x43
+	Opaque         Type = 0x44
+	Counter64      Type = 0x46
+	NoSuchObject   Type = 0x80
+	NoSuchInstance Type = 0x81
+	EndOfMibView   Type = 0x82
+)
+
+var typeNames = map[Type]string{
+	Integer:        "INTEGER",
+	OctetString:    "OCTET STRING",
+	Null:           "NULL",
+	ObjectID:       "OBJECT IDENTIFIER",
+	IPAddress:      "IpAddress",
+	Counter32:      "Counter32",
+	Gauge32:        "Gauge32",
+	TimeTicks:      "TimeTicks",
+	Opaque:         "Opaque",
+	Counter64:      "Counter64",
+	NoSuchObject:   "noSuchObject",
+	NoSuchInstance: "noSuchInstance",
+	EndOfMibView:   "endOfMibView",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Type(0x%02x)", byte(t))
+}
+
+// IsException reports whether t is one of the v2 varbind exceptions
+func (t Type) IsException() bool {
+	return t == NoSuchObject || t == NoSuchInstance || t == EndOfMibView
+}
+
+// Variable is a varbind. Value holds int64 for Integer, uint32 for
+// Counter32, Gauge32 and TimeTicks, uint64 for Counter64, []byte for
+// OctetString and Opaque, a dotted string for ObjectID, net.IP for
+// IPAddress and nil for Null and the exceptions.
+type Variable struct {
+	OID   string      `json:"oid"`
+	Type  Type        `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// String renders the value the way net-snmp does for its type
+func (v Variable) String() string {
+	switch value := v.Value.(type) {
+	case nil:
+		return v.Type.String()
+	case []byte:
+		if utf8.Valid(value) && isPrintable(value) {
+			return string(value)
+		}
+		return hex.EncodeToString(value)
+	case net.IP:
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func isPrintable(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			return false
+		}
+		if c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// Uint64 returns numeric values widened to uint64
+func (v Variable) Uint64() (uint64, bool) {
+	switch value := v.Value.(type) {
+	case int64:
+		if value < 0 {
+			return 0, false
+		}
+		return uint64(value), true
+	case uint32:
+		return uint64(value), true
+	case uint64:
+		return value, true
+	}
+	return 0, false
+}
+
+// ErrorStatus is the error-status field of a response PDU
+type ErrorStatus int
+
+const (
+	NoError ErrorStatus = iota
+	TooBig
+	NoSuchName
+	BadValue
+	ReadOnly
+	GenErr
+)
+
+var errorStatusNames = []string{
+	"noError", "tooBig", "noSuchName", "badValue", "readOnly", "genErr",
+	"noAccess", "wrongType", "wrongLength", "wrongEncoding", "wrongValue",
+	"noCreation", "inconsistentValue", "resourceUnavailable", "commitFailed",
+	"undoFailed", "authorizationError", "notWritable", "inconsistentName",
+}
+
+func (s ErrorStatus) String() string {
+	if s >= 0 && int(s) < len(errorStatusNames) {
+		return errorStatusNames[s]
+	}
+	return "error(" + strconv.Itoa(int(s)) + ")"
+}
+
+// PDU is a request, response or notification. For GetBulkRequest
+// ErrorStatus and ErrorIndex carry non-repeaters and max-repetitions. A v1
+// Trap PDU has no request ID or error fields but the trap fields instead.
+type PDU struct {
+	Type        PDUType     `json:"type"`
+	RequestID   int32       `json:"request_id"`
+	ErrorStatus ErrorStatus `json:"error_status"`
+	ErrorIndex  int         `json:"error_index"`
+	Variables   []Variable  `json:"variables"`
+
+	// v1 Trap PDU fields (RFC 1157)
+	Enterprise   string `json:"enterprise,omitempty"`
+	AgentAddress net.IP `json:"agent_address,omitempty"`
+	GenericTrap  int    `json:"generic_trap,omitempty"`
+	SpecificTrap int    `json:"specific_trap,omitempty"`
+	Timestamp    uint32 `json:"timestamp,omitempty"`
+}
+
+// Message is a community-based (v1 or v2c) SNMP message
+type Message struct {
+	Version   Version
+	Community string
+	PDU       *PDU
+}
+
+// Marshal encodes the message
+func (m *Message) Marshal() ([]byte, error) {
+	pdu, err := m.PDU.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return encodeSequence(tagSequence,
+		encodeInteger(tagInteger, int64(m.Version)),
+		encodeTLV(tagOctetString, []byte(m.Community)),
+		pdu,
+	), nil
+}
+
+// Unmarshal decodes a v1 or v2c message
+func Unmarshal(data []byte) (*Message, error) {
+	message, _, err := expect(data, tagSequence, "message")
+	if err != nil {
+		return nil, err
+	}
+	elements, err := decodeElements(message.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) != 3 || elements[0].Tag != tagInteger || elements[1].Tag != tagOctetString {
+		return nil, fmt.Errorf("malformed SNMP message")
+	}
+	version, err := decodeInteger(elements[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	if Version(version) != Version1 && Version(version) != Version2c {
+		return nil, fmt.Errorf("unsupported SNMP message version %d", version)
+	}
+	pdu, err := unmarshalPDU(elements[2])
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Version: Version(version), Community: string(elements[1].Value), PDU: pdu}, nil
+}
+
+func (p *PDU) marshal() ([]byte, error) {
+	var varbinds []byte
+	for _, variable := range p.Variables {
+		encoded, err := variable.marshal()
+		if err != nil {
+			return nil, err
+		}
+		varbinds = append(varbinds, encoded...)
+	}
+	if p.Type == TrapV1 {
+		enterprise, err := encodeOID(p.Enterprise)
+		if err != nil {
+			return nil, err
+		}
+		agent := p.AgentAddress.To4()
+		if agent == nil {
+			agent = net.IPv4zero.To4()
+		}
+		return encodeSequence(byte(p.Type),
+			enterprise,
+			encodeTLV(byte(IPAddress), agent),
+			encodeInteger(tagInteger, int64(p.GenericTrap)),
+			encodeInteger(tagInteger, int64(p.SpecificTrap)),
+			encodeUnsigned(byte(TimeTicks), uint64(p.Timestamp)),
+			encodeTLV(tagSequence, varbinds),
+		), nil
+	}
+	return encodeSequence(byte(p.Type),
+		encodeInteger(tagInteger, int64(p.RequestID)),
+		encodeInteger(tagInteger, int64(p.ErrorStatus)),
+		encodeInteger(tagInteger, int64(p.ErrorIndex)),
+		encodeTLV(tagSequence, varbinds),
+	), nil
+}
+
+func unmarshalPDU(element berElement) (*PDU, error) {
+	pduType := PDUType(element.Tag)
+	if _, ok := pduTypeNames[pduType]; !ok {
+		return nil, fmt.Errorf("unknown PDU type 0x%02x", element.Tag)
+	}
+	elements, err := decodeElements(element.Value)
+	if err != nil {
+		return nil, err
+	}
+	if pduType == TrapV1 {
+		return unmarshalTrapV1(elements)
+	}
+	if len(elements) != 4 {
+		return nil, fmt.Errorf("malformed %s PDU", pduType)
+	}
+	var fields [3]int64
+	for i := range fields {
+		if elements[i].Tag != tagInteger {
+			return nil, fmt.Errorf("malformed %s PDU", pduType)
+		}
+		if fields[i], err = decodeInteger(elements[i].Value); err != nil {
+			return nil, err
+		}
+	}
+	if elements[3].Tag != tagSequence {
+		return nil, fmt.Errorf("malformed %s varbind list", pduType)
+	}
+	variables, err := unmarshalVariables(elements[3].Value)
+	if err != nil {
+		return nil, err
+	}
+	return &PDU{
+		Type:        pduType,
+		RequestID:   int32(fields[0]),
+		ErrorStatus: ErrorStatus(fields[1]),
+		ErrorIndex:  int(fields[2]),
+		Variables:   variables,
+	}, nil
+}
+
+// unmarshalTrapV1 decodes the fields of a v1 Trap PDU: enterprise,
+// agent-addr, generic-trap, specific-trap, time-stamp and the varbinds
+func unmarshalTrapV1(elements []berElement) (*PDU, error) {
+	if len(elements) != 6 || elements[0].Tag != tagOID || elements[1].Tag != byte(IPAddress) ||
+		elements[2].Tag != tagInteger || elements[3].Tag != tagInteger ||
+		elements[4].Tag != byte(TimeTicks) || elements[5].Tag != tagSequence {
+		return nil, fmt.Errorf("malformed %s PDU", TrapV1)
+	}
+	enterprise, err := decodeOID(elements[0].Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements[1].Value) != 4 {
+		return nil, fmt.Errorf("malformed %s agent-addr", TrapV1)
+	}
+	generic, err := decodeInteger(elements[2].Value)
+	if err != nil {
+		return nil, err
+	}
+	specific, err := decodeInteger(elements[3].Value)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := decodeUnsigned(elements[4].Value)
+	if err != nil || timestamp > 0xffffffff {
+		return nil, fmt.Errorf("malformed %s time-stamp", TrapV1)
+	}
+	variables, err := unmarshalVariables(elements[5].Value)
+	if err != nil {
+		return nil, err
+	}
+	return &PDU{
+		Type:         TrapV1,
+		Variables:    variables,
+		Enterprise:   enterprise,
+		AgentAddress: net.IP(append([]byte(nil), elements[1].Value...)),
+		GenericTrap:  int(generic),
+		SpecificTrap: int(specific),
+		Timestamp:    uint32(timestamp),
+	}, nil
+}
+
+func unmarshalVariables(data []byte) ([]Variable, error) {
+	varbinds, err := decodeElements(data)
+	if err != nil {
+		return nil, err
+	}
+	variables := make([]Variable, 0, len(varbinds))
+	for _, varbind := range varbinds {
+		if varbind.Tag != tagSequence {
+			return nil, fmt.Errorf("malformed varbind")
+		}
+		oid, rest, err := expect(varbind.Value, tagOID, "varbind name")
+		if err != nil {
+			return nil, err
+		}
+		value, _, err := decodeElement(rest)
+		if err != nil {
+			return nil, fmt.Errorf("varbind value: %v", err)
+		}
+		variable, err := unmarshalVariable(oid.Value, value)
+		if err != nil {
+			return nil, err
+		}
+		variables = append(variables, variable)
+	}
+	return variables, nil
+}
+
+func unmarshalVariable(name []byte, value berElement) (Variable, error) {
+	oid, err := decodeOID(name)
+	if err != nil {
+		return Variable{}, err
+	}
+	variable := Variable{OID: oid, Type: Type(value.Tag)}
+	switch variable.Type {
+	case Integer:
+		variable.Value, err = decodeInteger(value.Value)
+	case OctetString, Opaque:
+		variable.Value = append([]byte(nil), value.Value...)
+	case Null, NoSuchObject, NoSuchInstance, EndOfMibView:
+	case ObjectID:
+		variable.Value, err = decodeOID(value.Value)
+	case IPAddress:
+		if len(value.Value) != 4 {
+			return variable, fmt.Errorf("%s: IpAddress of %d bytes", oid, len(value.Value))
+		}
+		variable.Value = net.IP(append([]byte(nil), value.Value...))
+	case Counter32, Gauge32, TimeTicks:
+		var v uint64
+		if v, err = decodeUnsigned(value.Value); err == nil {
+			if v > 0xffffffff {
+				return variable, fmt.Errorf("%s: %s out of range", oid, variable.Type)
+			}
+			variable.Value = uint32(v)
+		}
+	case Counter64:
+		variable.Value, err = decodeUnsigned(value.Value)
+	default:
+		return variable, fmt.Errorf("%s: unknown value type 0x%02x", oid, value.Tag)
+	}
+	if err != nil {
+		return variable, fmt.Errorf("%s: %v", oid, err)
+	}
+	return variable, nil
+}
+
+func (v Variable) marshal() ([]byte, error) {
+	name, err := encodeOID(v.OID)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	switch v.Type {
+	case Null, NoSuchObject, NoSuchInstance, EndOfMibView:
+		value = encodeTLV(byte(v.Type), nil)
+	case Integer:
+		n, ok := v.Value.(int64)
+		if !ok {
+			if i, isInt := v.Value.(int); isInt {
+				n, ok = int64(i), true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: INTEGER value must be an int64", v.OID)
+		}
+		value = encodeInteger(tagInteger, n)
+	case OctetString, Opaque:
+		switch b := v.Value.(type) {
+		case []byte:
+			value = encodeTLV(byte(v.Type), b)
+		case string:
+			value = encodeTLV(byte(v.Type), []byte(b))
+		default:
+			return nil, fmt.Errorf("%s: %s value must be bytes", v.OID, v.Type)
+		}
+	case ObjectID:
+		oid, ok := v.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: OBJECT IDENTIFIER value must be a string", v.OID)
+		}
+		if value, err = encodeOID(oid); err != nil {
+			return nil, err
+		}
+	case IPAddress:
+		ip, ok := v.Value.(net.IP)
+		if !ok || ip.To4() == nil {
+			return nil, fmt.Errorf("%s: IpAddress value must be an IPv4 net.IP", v.OID)
+		}
+		value = encodeTLV(byte(IPAddress), ip.To4())
+	case Counter32, Gauge32, TimeTicks, Counter64:
+		n, ok := v.Uint64()
+		if !ok || (v.Type != Counter64 && n > 0xffffffff) {
+			return nil, fmt.Errorf("%s: invalid %s value", v.OID, v.Type)
+		}
+		value = encodeUnsigned(byte(v.Type), n)
+	default:
+		return nil, fmt.Errorf("%s: cannot encode %s", v.OID, v.Type)
+	}
+	return encodeSequence(tagSequence, name, value), nil
+}
@@ -0,0 +1,208 @@
+package snmp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// getRequestPacket is a v2c GetRequest for sysDescr.0 with community public
+// and request ID 0x0a0b0c0d
+const getRequestPacket = "302902010104067075626c6963a01c02040a0b0c0d020100020100300e300c06082b060102010101000500"
+
+func TestMessageMarshal(t *testing.T) {
+	m := &Message{
+		Version:   Version2c,
+		Community: "public",
+		PDU: &PDU{
+			Type:      GetRequest,
+			RequestID: 0x0a0b0c0d,
+			Variables: []Variable{{OID: "1.3.6.1.2.1.1.1.0", Type: Null}},
+		},
+	}
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(data); got != getRequestPacket {
+		t.Fatalf("Marshal() = %s, want %s", got, getRequestPacket)
+	}
+
+	raw, _ := hex.DecodeString(getRequestPacket)
+	decoded, err := Unmarshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, m) {
+		t.Fatalf("Unmarshal() = %+v, want %+v", decoded, m)
+	}
+}
+
+func TestVariableRoundTrip(t *testing.T) {
+	variables := []Variable{
+		{OID: "1.3.6.1.2.1.1.1.0", Type: OctetString, Value: []byte("Linux router 5.10")},
+		{OID: "1.3.6.1.2.1.1.2.0", Type: ObjectID, Value: "1.3.6.1.4.1.8072.3.2.10"},
+		{OID: "1.3.6.1.2.1.1.3.0", Type: TimeTicks, Value: uint32(math.MaxUint32)},
+		{OID: "1.3.6.1.2.1.2.2.1.8.1", Type: Integer, Value: int64(1)},
+		{OID: "1.3.6.1.4.1.2021.13.16.2.1.3.1", Type: Integer, Value: int64(-40)},
+		{OID: "1.3.6.1.4.1.9999.1", Type: Integer, Value: int64(math.MinInt32)},
+		{OID: "1.3.6.1.4.1.9999.2", Type: Integer, Value: int64(math.MaxInt64)},
+		{OID: "1.3.6.1.2.1.2.2.1.10.1", Type: Counter32, Value: uint32(0x80000000)},
+		{OID: "1.3.6.1.2.1.2.2.1.5.1", Type: Gauge32, Value: uint32(1000000000)},
+		{OID: "1.3.6.1.2.1.31.1.1.1.6.1", Type: Counter64, Value: uint64(math.MaxUint64)},
+		{OID: "1.3.6.1.2.1.31.1.1.1.10.1", Type: Counter64, Value: uint64(1) << 32},
+		{OID: "1.3.6.1.2.1.31.1.1.1.15.1", Type: Counter64, Value: uint64(0)},
+		{OID: "1.3.6.1.2.1.4.20.1.1.10.0.0.1", Type: IPAddress, Value: net.IP{10, 0, 0, 1}},
+		{OID: "1.3.6.1.4.1.9999.3", Type: Opaque, Value: []byte{0x9f, 0x78, 0x04, 0x42, 0xf6, 0x00, 0x00}},
+		{OID: "1.3.6.1.4.1.9999.4", Type: OctetString, Value: []byte{}},
+		{OID: "1.3.6.1.4.1.9999.5", Type: Null},
+		{OID: "1.3.6.1.4.1.9999.6", Type: NoSuchObject},
+		{OID: "1.3.6.1.4.1.9999.7", Type: NoSuchInstance},
+		{OID: "1.3.6.1.4.1.9999.8", Type: EndOfMibView},
+	}
+	m := &Message{
+		Version:   Version2c,
+		Community: "private",
+		PDU: &PDU{
+			Type:        GetResponse,
+			RequestID:   -2147483648,
+			ErrorStatus: NoError,
+			Variables:   variables,
+		},
+	}
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Community != m.Community || decoded.PDU.RequestID != m.PDU.RequestID || len(decoded.PDU.Variables) != len(variables) {
+		t.Fatalf("Unmarshal() = %+v, want %+v", decoded, m)
+	}
+	for i, got := range decoded.PDU.Variables {
+		want := variables[i]
+		equal := got.OID == want.OID && got.Type == want.Type
+		if b, ok := want.Value.([]byte); ok {
+			gotBytes, isBytes := got.Value.([]byte)
+			equal = equal && isBytes && bytes.Equal(gotBytes, b)
+		} else {
+			equal = equal && reflect.DeepEqual(got.Value, want.Value)
+		}
+		if !equal {
+			t.Errorf("%s %s decoded as %s %#v, want %#v", want.OID, want.Type, got.Type, got.Value, want.Value)
+		}
+	}
+}
+
+func TestTrapV1RoundTrip(t *testing.T) {
+	m := &Message{
+		Version:   Version1,
+		Community: "public",
+		PDU: &PDU{
+			Type:         TrapV1,
+			Enterprise:   "1.3.6.1.4.1.9.1.1",
+			AgentAddress: net.IP{192, 168, 1, 1},
+			GenericTrap:  6,
+			SpecificTrap: 17,
+			Timestamp:    123456,
+			Variables:    []Variable{{OID: "1.3.6.1.2.1.2.2.1.1.3", Type: Integer, Value: int64(3)}},
+		},
+	}
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, m) {
+		t.Fatalf("Unmarshal() = %+v, want %+v", decoded.PDU, m.PDU)
+	}
+}
+
+func TestVariableMarshalErrors(t *testing.T) {
+	invalid := []Variable{
+		{OID: "1.3.6.1", Type: Integer, Value: "1"},
+		{OID: "1.3.6.1", Type: Counter32, Value: uint64(math.MaxUint32 + 1)},
+		{OID: "1.3.6.1", Type: Gauge32, Value: int64(-1)},
+		{OID: "1.3.6.1", Type: IPAddress, Value: net.ParseIP("2001:db8::1")},
+		{OID: "1.3.6.1", Type: ObjectID, Value: 1},
+		{OID: "1.3.6.1", Type: OctetString, Value: 1},
+		{OID: "bad", Type: Null},
+		{OID: "1.3.6.1", Type: Type(0x47)},
+	}
+	for _, v := range invalid {
+		if _, err := v.marshal(); err == nil {
+			t.Errorf("marshal(%+v) accepted an invalid varbind", v)
+		}
+	}
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	packet, _ := hex.DecodeString(getRequestPacket)
+	for n := 0; n < len(packet); n++ {
+		if _, err := Unmarshal(packet[:n]); err == nil {
+			t.Errorf("Unmarshal accepted the packet truncated to %d bytes", n)
+		}
+	}
+
+	// A length that still fits the outer sequence but not the element
+	corrupt := bytes.Replace(packet, []byte{0x04, 0x06, 'p'}, []byte{0x04, 0x60, 'p'}, 1)
+	if _, err := Unmarshal(corrupt); err == nil {
+		t.Error("Unmarshal accepted a community longer than the message")
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	// response wraps a raw varbind value in a v2c GetResponse
+	response := func(value string) string {
+		raw, _ := hex.DecodeString(value)
+		name, _ := encodeOID("1.3.6.1.2.1.1.1.0")
+		return hex.EncodeToString(encodeSequence(tagSequence,
+			encodeInteger(tagInteger, int64(Version2c)),
+			encodeTLV(tagOctetString, []byte("public")),
+			encodeSequence(byte(GetResponse),
+				encodeInteger(tagInteger, 1),
+				encodeInteger(tagInteger, 0),
+				encodeInteger(tagInteger, 0),
+				encodeSequence(tagSequence, encodeSequence(tagSequence, name, raw)),
+			),
+		))
+	}
+	tests := []struct {
+		name   string
+		packet string
+		err    string
+	}{
+		{"not a sequence", "0403616263", "unexpected tag"},
+		{"version 3", "3029020103" + getRequestPacket[10:], "unsupported SNMP message version 3"},
+		{"unknown PDU type", getRequestPacket[:26] + "af" + getRequestPacket[28:], "unknown PDU type"},
+		{"missing PDU", "300b0201010406707562" + "6c6963", "malformed SNMP message"},
+		{"IpAddress of five bytes", response("40050a00000101"), "IpAddress of 5 bytes"},
+		{"Counter32 over 32 bits", response("41050100000000"), "Counter32 out of range"},
+		{"Counter64 over 64 bits", response("460a01000000000000000000"), "invalid unsigned length"},
+		{"INTEGER over 64 bits", response("0209010000000000000000"), "invalid integer length"},
+		{"empty INTEGER", response("0200"), "invalid integer length"},
+		{"unknown value type", response("470100"), "unknown value type"},
+		{"truncated OID value", response("06022b86"), "truncated OID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := hex.DecodeString(tt.packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := Unmarshal(raw)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Unmarshal() = %+v, %v; want error containing %q", m, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package snmp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Well-known OIDs of the notification varbinds (RFC 3416, RFC 3584)
+const (
+	SysUpTimeOID = "1.3.6.1.2.1.1.3.0"
+	SnmpTrapOID  = "1.3.6.1.6.3.1.1.4.1.0"
+	snmpTrapsOID = "1.3.6.1.6.3.1.1.5"
+)
+
+// Notification is a received trap or inform in SNMPv2 form. v1 traps are
+// translated as RFC 3584 3.1 describes: generic traps map to the
+// snmpTraps OIDs and enterprise-specific ones to enterprise.0.specific.
+type Notification struct {
+	Source        *net.UDPAddr
+	Version       Version
+	Type          PDUType // TrapV1, TrapV2 or InformRequest
+	Community     string  // v1 and v2c
+	UserName      string  // v3
+	SecurityLevel SecurityLevel
+	ContextName   string
+	Uptime        uint32     // sysUpTime.0 of the sender
+	TrapOID       string     // snmpTrapOID.0
+	Enterprise    string     // v1 only
+	AgentAddress  net.IP     // v1 only
+	Variables     []Variable // without sysUpTime.0 and snmpTrapOID.0
+}
+
+// newNotification converts a trap or inform PDU
+func newNotification(source *net.UDPAddr, version Version, pdu *PDU) *Notification {
+	n := &Notification{Source: source, Version: version, Type: pdu.Type}
+	if pdu.Type == TrapV1 {
+		n.Uptime = pdu.Timestamp
+		n.Enterprise = pdu.Enterprise
+		n.AgentAddress = pdu.AgentAddress
+		if pdu.GenericTrap >= 0 && pdu.GenericTrap < 6 {
+			n.TrapOID = fmt.Sprintf("%s.%d", snmpTrapsOID, pdu.GenericTrap+1)
+		} else {
+			n.TrapOID = fmt.Sprintf("%s.0.%d", pdu.Enterprise, pdu.SpecificTrap)
+		}
+		n.Variables = pdu.Variables
+		return n
+	}
+	for _, v := range pdu.Variables {
+		switch {
+		case v.OID == SysUpTimeOID && v.Type == TimeTicks && n.TrapOID == "":
+			n.Uptime, _ = v.Value.(uint32)
+		case v.OID == SnmpTrapOID && v.Type == ObjectID && n.TrapOID == "":
+			n.TrapOID, _ = v.Value.(string)
+		default:
+			n.Variables = append(n.Variables, v)
+		}
+	}
+	return n
+}
+
+// TrapListener receives traps and informs on a UDP socket and acknowledges
+// informs. It is the authoritative engine for v3 informs; the time windows
+// of v3 trap senders are not tracked.
+type TrapListener struct {
+	// Communities lists the accepted v1 and v2c communities; any community
+	// is accepted when it is empty
+	Communities []string
+	// Users returns the USM user a v3 sender authenticates as, or nil to
+	// reject the message
+	Users func(source *net.UDPAddr, userName string) *User
+	// EngineID and EngineBoots identify the local engine to inform senders
+	EngineID    []byte
+	EngineBoots int32
+	// Handler is called for each accepted notification
+	Handler func(*Notification)
+	// ErrorHandler, when set, is told about dropped packets
+	ErrorHandler func(source *net.UDPAddr, err error)
+
+	conn      *net.UDPConn
+	startedAt time.Time
+	mu        sync.Mutex
+	stats     map[string]uint32 // USM report counters
+}
+
+// Listen opens the UDP socket, such as ":162"
+func (l *TrapListener) Listen(address string) error {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to open trap socket: %v", err)
+	}
+	l.conn = conn
+	l.startedAt = time.Now()
+	return nil
+}
+
+// Addr is the address the listener is bound to
+func (l *TrapListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Close stops Serve
+func (l *TrapListener) Close() error {
+	return l.conn.Close()
+}
+
+// Serve handles packets until the listener is closed
+func (l *TrapListener) Serve() error {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, source, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		if err := l.handle(source, append([]byte(nil), buf[:n]...)); err != nil && l.ErrorHandler != nil {
+			l.ErrorHandler(source, err)
+		}
+	}
+}
+
+// handle decodes one packet, replying to informs and discovery requests
+func (l *TrapListener) handle(source *net.UDPAddr, data []byte) error {
+	version, err := peekVersion(data)
+	if err != nil {
+		return err
+	}
+	if version == Version3 {
+		return l.handleV3(source, data)
+	}
+
+	m, err := Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	if !l.acceptsCommunity(m.Community) {
+		return fmt.Errorf("unknown community")
+	}
+	switch {
+	case m.Version == Version1 && m.PDU.Type == TrapV1:
+	case m.Version == Version2c && (m.PDU.Type == TrapV2 || m.PDU.Type == InformRequest):
+	default:
+		return fmt.Errorf("unexpected %s %s PDU", m.Version, m.PDU.Type)
+	}
+	if m.PDU.Type == InformRequest {
+		response, err := (&Message{Version: m.Version, Community: m.Community, PDU: informResponse(m.PDU)}).Marshal()
+		if err != nil {
+			return err
+		}
+		if _, err := l.conn.WriteToUDP(response, source); err != nil {
+			return err
+		}
+	}
+	n := newNotification(source, m.Version, m.PDU)
+	n.Community = m.Community
+	l.deliver(n)
+	return nil
+}
+
+// handleV3 authenticates a v3 message. Informs are checked against the
+// local engine ID and clock and answered, or met with the Report that lets
+// the sender discover or resynchronise the engine (RFC 3414 3.2).
+func (l *TrapListener) handleV3(source *net.UDPAddr, data []byte) error {
+	lookup := func(userName string) *User {
+		if l.Users == nil {
+			return nil
+		}
+		return l.Users(source, userName)
+	}
+	m, err := UnmarshalV3(data, lookup)
+	if err != nil {
+		return err
+	}
+	engineTime := int32(time.Since(l.startedAt) / time.Second)
+	switch m.PDU.Type {
+	case TrapV2:
+		if err := checkLevel(m, lookup(m.UserName)); err != nil {
+			return err
+		}
+	case InformRequest, GetRequest:
+		if string(m.EngineID) != string(l.EngineID) {
+			// Engine discovery: an empty unauthenticated request
+			return l.report(source, m, usmStatsUnknownEngineIDs, nil)
+		}
+		if m.PDU.Type != InformRequest {
+			return fmt.Errorf("unexpected %s from %q", m.PDU.Type, m.UserName)
+		}
+		user := lookup(m.UserName)
+		if err := checkLevel(m, user); err != nil {
+			return err
+		}
+		if m.Level() > NoAuthNoPriv && (m.EngineBoots != l.EngineBoots || abs(m.EngineTime-engineTime) > 150) {
+			return l.report(source, m, usmStatsNotInTimeWindows, user)
+		}
+		response, err := MarshalV3(&MessageV3{
+			MsgID:           m.MsgID,
+			Flags:           levelFlags(m.Level()),
+			EngineID:        l.EngineID,
+			EngineBoots:     l.EngineBoots,
+			EngineTime:      engineTime,
+			UserName:        m.UserName,
+			ContextEngineID: m.ContextEngineID,
+			ContextName:     m.ContextName,
+			PDU:             informResponse(m.PDU),
+		}, user)
+		if err != nil {
+			return err
+		}
+		if _, err := l.conn.WriteToUDP(response, source); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unexpected v3 %s PDU", m.PDU.Type)
+	}
+	n := newNotification(source, Version3, m.PDU)
+	n.UserName, n.SecurityLevel, n.ContextName = m.UserName, m.Level(), m.ContextName
+	l.deliver(n)
+	return nil
+}
+
+// checkLevel accepts a message only at the exact security level its user
+// is configured for, so a known user name alone cannot downgrade it
+func checkLevel(m *MessageV3, user *User) error {
+	if user == nil {
+		return fmt.Errorf("unknown user %q", m.UserName)
+	}
+	if m.Level() != user.Level {
+		return fmt.Errorf("%s message from %q, which is configured for %s", m.Level(), m.UserName, user.Level)
+	}
+	return nil
+}
+
+// report answers a v3 message with a Report carrying the counter oid. It
+// is authenticated with user when given, as a time window report must be.
+func (l *TrapListener) report(source *net.UDPAddr, m *MessageV3, oid string, user *User) error {
+	if !m.Reportable() {
+		return fmt.Errorf("%s from %s", reportNames[oid], source)
+	}
+	l.mu.Lock()
+	if l.stats == nil {
+		l.stats = make(map[string]uint32)
+	}
+	l.stats[oid]++
+	count := l.stats[oid]
+	l.mu.Unlock()
+
+	var flags byte
+	userName := ""
+	if user != nil {
+		flags, userName = flagAuth, user.UserName
+	}
+	report, err := MarshalV3(&MessageV3{
+		MsgID:           m.MsgID,
+		Flags:           flags,
+		EngineID:        l.EngineID,
+		EngineBoots:     l.EngineBoots,
+		EngineTime:      int32(time.Since(l.startedAt) / time.Second),
+		UserName:        userName,
+		ContextEngineID: l.EngineID,
+		PDU: &PDU{
+			Type:      Report,
+			RequestID: m.PDU.RequestID,
+			Variables: []Variable{{OID: oid, Type: Counter32, Value: count}},
+		},
+	}, user)
+	if err != nil {
+		return err
+	}
+	_, err = l.conn.WriteToUDP(report, source)
+	return err
+}
+
+func (l *TrapListener) acceptsCommunity(community string) bool {
+	if len(l.Communities) == 0 {
+		return true
+	}
+	for _, accepted := range l.Communities {
+		if community == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *TrapListener) deliver(n *Notification) {
+	if l.Handler != nil {
+		l.Handler(n)
+	}
+}
+
+// informResponse acknowledges an inform with its own varbinds (RFC 3416 4.2.7)
+func informResponse(inform *PDU) *PDU {
+	return &PDU{Type: GetResponse, RequestID: inform.RequestID, Variables: inform.Variables}
+}
+
+// peekVersion reads the version field of a message
+func peekVersion(data []byte) (Version, error) {
+	message, _, err := expect(data, tagSequence, "message")
+	if err != nil {
+		return 0, err
+	}
+	version, _, err := expect(message.Value, tagInteger, "version")
+	if err != nil {
+		return 0, err
+	}
+	v, err := decodeInteger(version.Value)
+	if err != nil {
+		return 0, err
+	}
+	return Version(v), nil
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,340 @@
+package snmp
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenerEngineID is the local engine of the test listener
+var listenerEngineID = []byte{0x80, 0x00, 0x1f, 0x88, 0x04, 't', 'e', 's', 't'}
+
+// trapTest runs a TrapListener on the loopback interface and a sender
+// socket connected to it
+type trapTest struct {
+	listener      *TrapListener
+	sender        *net.UDPConn
+	notifications chan *Notification
+	errors        chan error
+}
+
+func newTrapTest(t *testing.T, users ...*User) *trapTest {
+	t.Helper()
+	tt := &trapTest{
+		notifications: make(chan *Notification, 8),
+		errors:        make(chan error, 8),
+	}
+	tt.listener = &TrapListener{
+		Communities: []string{"public"},
+		Users: func(source *net.UDPAddr, userName string) *User {
+			for _, u := range users {
+				if u.UserName == userName {
+					return u
+				}
+			}
+			return nil
+		},
+		EngineID:     listenerEngineID,
+		EngineBoots:  3,
+		Handler:      func(n *Notification) { tt.notifications <- n },
+		ErrorHandler: func(source *net.UDPAddr, err error) { tt.errors <- err },
+	}
+	if err := tt.listener.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	go tt.listener.Serve()
+	t.Cleanup(func() { tt.listener.Close() })
+
+	sender, err := net.DialUDP("udp", nil, tt.listener.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sender.Close() })
+	tt.sender = sender
+	return tt
+}
+
+// send writes a packet and waits for the listener to deliver or drop it
+func (tt *trapTest) send(t *testing.T, data []byte) (*Notification, error) {
+	t.Helper()
+	if _, err := tt.sender.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-tt.notifications:
+		return n, nil
+	case err := <-tt.errors:
+		return nil, err
+	case <-time.After(2 * time.Second):
+		t.Fatal("the listener neither delivered nor dropped the packet")
+	}
+	return nil, nil
+}
+
+// reply reads the listener's answer to the last packet
+func (tt *trapTest) reply(t *testing.T) []byte {
+	t.Helper()
+	tt.sender.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, maxPacketSize)
+	n, err := tt.sender.Read(buf)
+	if err != nil {
+		t.Fatalf("no reply from the listener: %v", err)
+	}
+	return buf[:n]
+}
+
+// noReply checks that the listener sent nothing back
+func (tt *trapTest) noReply(t *testing.T) {
+	t.Helper()
+	tt.sender.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, err := tt.sender.Read(make([]byte, maxPacketSize)); err == nil {
+		t.Fatalf("the listener replied with %d bytes", n)
+	}
+}
+
+func notificationPDU(pduType PDUType, requestID int32) *PDU {
+	return &PDU{
+		Type:      pduType,
+		RequestID: requestID,
+		Variables: []Variable{
+			{OID: SysUpTimeOID, Type: TimeTicks, Value: uint32(4200)},
+			{OID: SnmpTrapOID, Type: ObjectID, Value: "1.3.6.1.6.3.1.1.5.3"},
+			{OID: "1.3.6.1.2.1.2.2.1.1.2", Type: Integer, Value: int64(2)},
+		},
+	}
+}
+
+func testUser(t *testing.T, level SecurityLevel) *User {
+	t.Helper()
+	s := Security{UserName: "monitor", Level: level}
+	if level >= AuthNoPriv {
+		s.AuthProtocol, s.AuthPassphrase = SHA, "authpassphrase"
+	}
+	if level == AuthPriv {
+		s.PrivProtocol, s.PrivPassphrase = AES, "privpassphrase"
+	}
+	user, err := NewUser(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestTrapListenerSecurityLevel(t *testing.T) {
+	senderEngineID := []byte{0x80, 0x00, 0x1f, 0x88, 0x04, 's', 'e', 'n', 'd'}
+	tests := []struct {
+		name       string
+		configured SecurityLevel
+		sent       SecurityLevel
+		accepted   bool
+	}{
+		{"authPriv", AuthPriv, AuthPriv, true},
+		{"authNoPriv", AuthNoPriv, AuthNoPriv, true},
+		{"noAuthNoPriv", NoAuthNoPriv, NoAuthNoPriv, true},
+		{"noAuthNoPriv for an authPriv user", AuthPriv, NoAuthNoPriv, false},
+		{"authNoPriv for an authPriv user", AuthPriv, AuthNoPriv, false},
+		{"noAuthNoPriv for an authNoPriv user", AuthNoPriv, NoAuthNoPriv, false},
+		{"authNoPriv for a noAuthNoPriv user", NoAuthNoPriv, AuthNoPriv, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			configured := testUser(t, tc.configured)
+			tt := newTrapTest(t, configured)
+			// The sender knows the user name and, at most, the passphrases
+			// of the level it sends at
+			sender := testUser(t, tc.sent)
+
+			for _, pduType := range []PDUType{TrapV2, InformRequest} {
+				engineID := senderEngineID
+				if pduType == InformRequest {
+					engineID = listenerEngineID
+				}
+				data, err := MarshalV3(&MessageV3{
+					MsgID:           7,
+					Flags:           levelFlags(tc.sent) | flagReportable,
+					EngineID:        engineID,
+					EngineBoots:     3,
+					EngineTime:      1,
+					UserName:        "monitor",
+					ContextEngineID: engineID,
+					PDU:             notificationPDU(pduType, 11),
+				}, sender)
+				if err != nil {
+					t.Fatal(err)
+				}
+				n, err := tt.send(t, data)
+				if !tc.accepted {
+					if err == nil {
+						t.Fatalf("%s at %s accepted for a user configured for %s", pduType, tc.sent, tc.configured)
+					}
+					tt.noReply(t)
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", pduType, err)
+				}
+				if n.UserName != "monitor" || n.SecurityLevel != tc.sent || n.TrapOID != "1.3.6.1.6.3.1.1.5.3" {
+					t.Fatalf("%s delivered as %+v", pduType, n)
+				}
+				if pduType == InformRequest {
+					tt.reply(t)
+				}
+			}
+		})
+	}
+
+	t.Run("unknown user", func(t *testing.T) {
+		tt := newTrapTest(t, testUser(t, NoAuthNoPriv))
+		data, err := MarshalV3(&MessageV3{
+			MsgID:    7,
+			EngineID: senderEngineID,
+			UserName: "intruder",
+			PDU:      notificationPDU(TrapV2, 11),
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tt.send(t, data); err == nil || !strings.Contains(err.Error(), "unknown user") {
+			t.Fatalf("trap from an unknown user = %v", err)
+		}
+	})
+}
+
+func TestTrapListenerInformAcknowledgement(t *testing.T) {
+	t.Run("v2c", func(t *testing.T) {
+		tt := newTrapTest(t)
+		inform := notificationPDU(InformRequest, 1234)
+		data, err := (&Message{Version: Version2c, Community: "public", PDU: inform}).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tt.send(t, data); err != nil {
+			t.Fatal(err)
+		}
+		response, err := Unmarshal(tt.reply(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Community != "public" || response.PDU.Type != GetResponse || response.PDU.RequestID != 1234 ||
+			len(response.PDU.Variables) != len(inform.Variables) {
+			t.Fatalf("inform acknowledged with %+v", response.PDU)
+		}
+
+		data, _ = (&Message{Version: Version2c, Community: "private", PDU: inform}).Marshal()
+		if _, err := tt.send(t, data); err == nil {
+			t.Fatal("inform with an unknown community accepted")
+		}
+		tt.noReply(t)
+	})
+
+	t.Run("v3", func(t *testing.T) {
+		user := testUser(t, AuthPriv)
+		tt := newTrapTest(t, user)
+		data, err := MarshalV3(&MessageV3{
+			MsgID:           99,
+			Flags:           flagAuth | flagPriv | flagReportable,
+			EngineID:        listenerEngineID,
+			EngineBoots:     3,
+			EngineTime:      0,
+			UserName:        "monitor",
+			ContextEngineID: listenerEngineID,
+			ContextName:     "vrf-mgmt",
+			PDU:             notificationPDU(InformRequest, 5678),
+		}, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := tt.send(t, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Type != InformRequest || n.ContextName != "vrf-mgmt" || n.Uptime != 4200 || len(n.Variables) != 1 {
+			t.Fatalf("inform delivered as %+v", n)
+		}
+
+		raw := tt.reply(t)
+		if bytes.Contains(raw, []byte("vrf-mgmt")) {
+			t.Fatal("the acknowledgement was sent in clear")
+		}
+		response, err := UnmarshalV3(raw, func(string) *User { return user })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.MsgID != 99 || response.Level() != AuthPriv || response.PDU.Type != GetResponse ||
+			response.PDU.RequestID != 5678 || !bytes.Equal(response.EngineID, listenerEngineID) {
+			t.Fatalf("inform acknowledged with %+v", response)
+		}
+	})
+}
+
+func TestTrapListenerReports(t *testing.T) {
+	user := testUser(t, AuthNoPriv)
+
+	t.Run("engine discovery", func(t *testing.T) {
+		tt := newTrapTest(t, user)
+		data, err := MarshalV3(&MessageV3{
+			MsgID: 1,
+			Flags: flagReportable,
+			PDU:   &PDU{Type: GetRequest, RequestID: 1},
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tt.sender.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		report, err := UnmarshalV3(tt.reply(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.PDU.Type != Report || report.Level() != NoAuthNoPriv || !bytes.Equal(report.EngineID, listenerEngineID) ||
+			report.EngineBoots != 3 || len(report.PDU.Variables) != 1 || report.PDU.Variables[0].OID != usmStatsUnknownEngineIDs {
+			t.Fatalf("discovery answered with %+v %+v", report, report.PDU)
+		}
+	})
+
+	t.Run("not in time window", func(t *testing.T) {
+		tt := newTrapTest(t, user)
+		inform := func(flags byte, boots int32) []byte {
+			data, err := MarshalV3(&MessageV3{
+				MsgID:           2,
+				Flags:           flags,
+				EngineID:        listenerEngineID,
+				EngineBoots:     boots,
+				EngineTime:      10000,
+				UserName:        "monitor",
+				ContextEngineID: listenerEngineID,
+				PDU:             notificationPDU(InformRequest, 2),
+			}, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		}
+
+		if _, err := tt.sender.Write(inform(flagAuth|flagReportable, 2)); err != nil {
+			t.Fatal(err)
+		}
+		report, err := UnmarshalV3(tt.reply(t), func(string) *User { return user })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.PDU.Type != Report || report.Level() != AuthNoPriv || report.EngineBoots != 3 ||
+			len(report.PDU.Variables) != 1 || report.PDU.Variables[0].OID != usmStatsNotInTimeWindows {
+			t.Fatalf("stale inform answered with %+v %+v", report, report.PDU)
+		}
+		select {
+		case n := <-tt.notifications:
+			t.Fatalf("stale inform delivered: %+v", n)
+		default:
+		}
+
+		// Without the reportable flag the inform is dropped silently
+		if _, err := tt.send(t, inform(flagAuth, 2)); err == nil || !strings.Contains(err.Error(), "usmStatsNotInTimeWindows") {
+			t.Fatalf("unreportable stale inform = %v", err)
+		}
+		tt.noReply(t)
+	})
+}
@@ -0,0 +1,367 @@
+package snmp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// SecurityLevel is the USM security level of a v3 message
+type SecurityLevel int
+
+const (
+	NoAuthNoPriv SecurityLevel = iota
+	AuthNoPriv
+	AuthPriv
+)
+
+func (l SecurityLevel) String() string {
+	switch l {
+	case NoAuthNoPriv:
+		return "noAuthNoPriv"
+	case AuthNoPriv:
+		return "authNoPriv"
+	case AuthPriv:
+		return "authPriv"
+	}
+	return fmt.Sprintf("SecurityLevel(%d)", int(l))
+}
+
+// ParseSecurityLevel accepts the net-snmp spellings, case-insensitively
+func ParseSecurityLevel(s string) (SecurityLevel, error) {
+	switch strings.ToLower(s) {
+	case "noauthnopriv", "":
+		return NoAuthNoPriv, nil
+	case "authnopriv":
+		return AuthNoPriv, nil
+	case "authpriv":
+		return AuthPriv, nil
+	}
+	return 0, fmt.Errorf("invalid security level %q", s)
+}
+
+// AuthProtocol is a USM authentication protocol
+type AuthProtocol string
+
+const (
+	MD5    AuthProtocol = "MD5"
+	SHA    AuthProtocol = "SHA"
+	SHA224 AuthProtocol = "SHA-224"
+	SHA256 AuthProtocol = "SHA-256"
+	SHA384 AuthProtocol = "SHA-384"
+	SHA512 AuthProtocol = "SHA-512"
+)
+
+// ParseAuthProtocol accepts MD5, SHA (SHA1) and the SHA-2 variants with or
+// without the dash
+func ParseAuthProtocol(s string) (AuthProtocol, error) {
+	switch strings.ReplaceAll(strings.ToUpper(s), "-", "") {
+	case "MD5":
+		return MD5, nil
+	case "SHA", "SHA1":
+		return SHA, nil
+	case "SHA224":
+		return SHA224, nil
+	case "SHA256":
+		return SHA256, nil
+	case "SHA384":
+		return SHA384, nil
+	case "SHA512":
+		return SHA512, nil
+	}
+	return "", fmt.Errorf("invalid auth protocol %q", s)
+}
+
+func (a AuthProtocol) hash() func() hash.Hash {
+	switch a {
+	case MD5:
+		return md5.New
+	case SHA:
+		return sha1.New
+	case SHA224:
+		return sha256.New224
+	case SHA256:
+		return sha256.New
+	case SHA384:
+		return sha512.New384
+	case SHA512:
+		return sha512.New
+	}
+	return nil
+}
+
+// macLength is the truncated HMAC length of RFC 3414 and RFC 7860
+func (a AuthProtocol) macLength() int {
+	switch a {
+	case MD5, SHA:
+		return 12
+	case SHA224:
+		return 16
+	case SHA256:
+		return 24
+	case SHA384:
+		return 32
+	case SHA512:
+		return 48
+	}
+	return 0
+}
+
+// PrivProtocol is a USM privacy protocol
+type PrivProtocol string
+
+const (
+	DES    PrivProtocol = "DES"
+	AES    PrivProtocol = "AES"
+	AES192 PrivProtocol = "AES-192"
+	AES256 PrivProtocol = "AES-256"
+)
+
+// ParsePrivProtocol accepts DES, AES (AES-128), AES-192 and AES-256 with or
+// without the dash
+func ParsePrivProtocol(s string) (PrivProtocol, error) {
+	switch strings.ReplaceAll(strings.ToUpper(s), "-", "") {
+	case "DES":
+		return DES, nil
+	case "AES", "AES128":
+		return AES, nil
+	case "AES192":
+		return AES192, nil
+	case "AES256":
+		return AES256, nil
+	}
+	return "", fmt.Errorf("invalid privacy protocol %q", s)
+}
+
+// keyLength is the localized key length the cipher needs; DES uses the
+// second half as the pre-IV
+func (p PrivProtocol) keyLength() int {
+	switch p {
+	case DES, AES:
+		return 16
+	case AES192:
+		return 24
+	case AES256:
+		return 32
+	}
+	return 0
+}
+
+// Security are the USM parameters of one user
+type Security struct {
+	UserName       string
+	Level          SecurityLevel
+	AuthProtocol   AuthProtocol
+	AuthPassphrase string
+	PrivProtocol   PrivProtocol
+	PrivPassphrase string
+}
+
+// Validate checks that the protocols and passphrases the level needs are set
+func (s *Security) Validate() error {
+	if s.UserName == "" {
+		return fmt.Errorf("security name is required")
+	}
+	if s.Level < NoAuthNoPriv || s.Level > AuthPriv {
+		return fmt.Errorf("invalid security level %d", int(s.Level))
+	}
+	if s.Level >= AuthNoPriv {
+		if s.AuthProtocol.hash() == nil {
+			return fmt.Errorf("invalid auth protocol %q", s.AuthProtocol)
+		}
+		if len(s.AuthPassphrase) < 8 {
+			return fmt.Errorf("auth passphrase must be at least 8 characters")
+		}
+	}
+	if s.Level == AuthPriv {
+		if s.PrivProtocol.keyLength() == 0 {
+			return fmt.Errorf("invalid privacy protocol %q", s.PrivProtocol)
+		}
+		if len(s.PrivPassphrase) < 8 {
+			return fmt.Errorf("privacy passphrase must be at least 8 characters")
+		}
+	}
+	return nil
+}
+
+// User is a USM user with its password-derived keys cached, so the
+// megabyte of hashing per passphrase happens once and localization once per
+// engine
+type User struct {
+	Security
+
+	authKu, privKu []byte
+	salt           uint64
+
+	mu       sync.Mutex
+	engineID string
+	authKey  []byte
+	privKey  []byte
+}
+
+// NewUser validates s and derives its keys
+func NewUser(s Security) (*User, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	u := &User{Security: s}
+	if s.Level >= AuthNoPriv {
+		u.authKu = passwordToKey(s.AuthProtocol.hash(), s.AuthPassphrase)
+	}
+	if s.Level == AuthPriv {
+		u.privKu = passwordToKey(s.AuthProtocol.hash(), s.PrivPassphrase)
+	}
+	var seed [8]byte
+	rand.Read(seed[:])
+	u.salt = binary.BigEndian.Uint64(seed[:])
+	return u, nil
+}
+
+// keys returns the auth and priv keys localized to engineID
+func (u *User) keys(engineID []byte) (authKey, privKey []byte) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.authKey != nil && u.engineID == string(engineID) {
+		return u.authKey, u.privKey
+	}
+	h := u.AuthProtocol.hash()
+	u.engineID = string(engineID)
+	u.authKey, u.privKey = nil, nil
+	if u.authKu != nil {
+		u.authKey = localizeKey(h, u.authKu, engineID)
+	}
+	if u.privKu != nil {
+		u.privKey = extendKey(h, localizeKey(h, u.privKu, engineID), u.PrivProtocol.keyLength())
+	}
+	return u.authKey, u.privKey
+}
+
+// passwordToKey is the password to key algorithm of RFC 3414 A.2: the
+// passphrase repeated over one megabyte, hashed
+func passwordToKey(newHash func() hash.Hash, password string) []byte {
+	h := newHash()
+	chunk := make([]byte, 64)
+	p := []byte(password)
+	for i := 0; i < 1048576; i += len(chunk) {
+		for j := range chunk {
+			chunk[j] = p[(i+j)%len(p)]
+		}
+		h.Write(chunk)
+	}
+	return h.Sum(nil)
+}
+
+// localizeKey binds a password key to one authoritative engine
+func localizeKey(newHash func() hash.Hash, key, engineID []byte) []byte {
+	h := newHash()
+	h.Write(key)
+	h.Write(engineID)
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// extendKey lengthens a localized key for AES-192/256 by appending hashes
+// of the key so far, as net-snmp does (draft-blumenthal-aes-usm)
+func extendKey(newHash func() hash.Hash, key []byte, length int) []byte {
+	for len(key) < length {
+		h := newHash()
+		h.Write(key)
+		key = append(key, h.Sum(nil)...)
+	}
+	return key[:length]
+}
+
+// mac computes the truncated HMAC of a whole message
+func (u *User) mac(authKey, message []byte) []byte {
+	h := hmac.New(u.AuthProtocol.hash(), authKey)
+	h.Write(message)
+	return h.Sum(nil)[:u.AuthProtocol.macLength()]
+}
+
+// encrypt returns the encrypted scoped PDU and the privacy parameters
+func (u *User) encrypt(privKey, plaintext []byte, boots, engineTime int32) ([]byte, []byte, error) {
+	salt := make([]byte, 8)
+	switch u.PrivProtocol {
+	case DES:
+		binary.BigEndian.PutUint32(salt, uint32(boots))
+		binary.BigEndian.PutUint32(salt[4:], uint32(atomic.AddUint64(&u.salt, 1)))
+		block, err := des.NewCipher(privKey[:8])
+		if err != nil {
+			return nil, nil, err
+		}
+		iv := make([]byte, 8)
+		for i := range iv {
+			iv[i] = privKey[8+i] ^ salt[i]
+		}
+		padded := append([]byte(nil), plaintext...)
+		if rem := len(padded) % des.BlockSize; rem != 0 {
+			padded = append(padded, make([]byte, des.BlockSize-rem)...)
+		}
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+		return padded, salt, nil
+	case AES, AES192, AES256:
+		binary.BigEndian.PutUint64(salt, atomic.AddUint64(&u.salt, 1))
+		block, err := aes.NewCipher(privKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		ciphertext := make([]byte, len(plaintext))
+		cipher.NewCFBEncrypter(block, aesIV(boots, engineTime, salt)).XORKeyStream(ciphertext, plaintext)
+		return ciphertext, salt, nil
+	}
+	return nil, nil, fmt.Errorf("invalid privacy protocol %q", u.PrivProtocol)
+}
+
+// decrypt reverses encrypt; DES output may carry trailing padding
+func (u *User) decrypt(privKey, ciphertext, salt []byte, boots, engineTime int32) ([]byte, error) {
+	if len(salt) != 8 {
+		return nil, fmt.Errorf("invalid privacy parameters length %d", len(salt))
+	}
+	switch u.PrivProtocol {
+	case DES:
+		if len(ciphertext)%des.BlockSize != 0 {
+			return nil, fmt.Errorf("DES ciphertext is not a multiple of the block size")
+		}
+		block, err := des.NewCipher(privKey[:8])
+		if err != nil {
+			return nil, err
+		}
+		iv := make([]byte, 8)
+		for i := range iv {
+			iv[i] = privKey[8+i] ^ salt[i]
+		}
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+		return plaintext, nil
+	case AES, AES192, AES256:
+		block, err := aes.NewCipher(privKey)
+		if err != nil {
+			return nil, err
+		}
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCFBDecrypter(block, aesIV(boots, engineTime, salt)).XORKeyStream(plaintext, ciphertext)
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("invalid privacy protocol %q", u.PrivProtocol)
+}
+
+// aesIV is engine boots, engine time and the salt (RFC 3826 3.1.2.1)
+func aesIV(boots, engineTime int32, salt []byte) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+	copy(iv[8:], salt)
+	return iv
+}
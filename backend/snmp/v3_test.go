@@ -0,0 +1,246 @@
+package snmp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// rfc3414EngineID is the engine ID of the RFC 3414 A.3 examples
+var rfc3414EngineID, _ = hex.DecodeString("000000000000000000000002")
+
+func TestPasswordToKeyRFC3414(t *testing.T) {
+	tests := []struct {
+		protocol  AuthProtocol
+		key       string // A.3 Ku
+		localized string // A.3 Kul
+	}{
+		{MD5, "9faf3283884e92834ebc9847d8edd963", "526f5eed9fcce26f8964c2930787d82b"},
+		{SHA, "9fb5cc0381497b3793528939ff788d5d79145211", "6695febc9288e36282235fc7151f128497b38f3f"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.protocol), func(t *testing.T) {
+			h := tt.protocol.hash()
+			key := passwordToKey(h, "maplesyrup")
+			if got := hex.EncodeToString(key); got != tt.key {
+				t.Fatalf("passwordToKey = %s, want %s", got, tt.key)
+			}
+			if got := hex.EncodeToString(localizeKey(h, key, rfc3414EngineID)); got != tt.localized {
+				t.Fatalf("localizeKey = %s, want %s", got, tt.localized)
+			}
+
+			user, err := NewUser(Security{UserName: "u", Level: AuthNoPriv, AuthProtocol: tt.protocol, AuthPassphrase: "maplesyrup"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if authKey, _ := user.keys(rfc3414EngineID); hex.EncodeToString(authKey) != tt.localized {
+				t.Fatalf("User.keys = %x, want %s", authKey, tt.localized)
+			}
+		})
+	}
+}
+
+func TestExtendKey(t *testing.T) {
+	key, _ := hex.DecodeString("526f5eed9fcce26f8964c2930787d82b")
+	extended := extendKey(MD5.hash(), append([]byte(nil), key...), 32)
+	if len(extended) != 32 || !bytes.Equal(extended[:16], key) {
+		t.Fatalf("extendKey = %x, want the key followed by its hash", extended)
+	}
+	h := MD5.hash()()
+	h.Write(key)
+	if !bytes.Equal(extended[16:], h.Sum(nil)) {
+		t.Fatalf("extendKey appended %x, want the hash of the key", extended[16:])
+	}
+	if got := extendKey(SHA.hash(), append([]byte(nil), key...), 16); !bytes.Equal(got, key) {
+		t.Fatalf("extendKey changed a key that is long enough: %x", got)
+	}
+}
+
+// v3TestMessage is an authenticated GetResponse from the RFC 3414 engine
+func v3TestMessage(flags byte) *MessageV3 {
+	return &MessageV3{
+		MsgID:           42,
+		Flags:           flags,
+		EngineID:        rfc3414EngineID,
+		EngineBoots:     7,
+		EngineTime:      123456,
+		UserName:        "monitor",
+		ContextEngineID: rfc3414EngineID,
+		ContextName:     "vrf-mgmt",
+		PDU: &PDU{
+			Type:      GetResponse,
+			RequestID: 1234,
+			Variables: []Variable{
+				{OID: "1.3.6.1.2.1.1.1.0", Type: OctetString, Value: []byte("Linux router")},
+				{OID: "1.3.6.1.2.1.31.1.1.1.6.1", Type: Counter64, Value: uint64(1) << 40},
+			},
+		},
+	}
+}
+
+func TestMessageV3RoundTrip(t *testing.T) {
+	var users []Security
+	for _, auth := range []AuthProtocol{MD5, SHA, SHA224, SHA256, SHA384, SHA512} {
+		users = append(users, Security{Level: AuthNoPriv, AuthProtocol: auth})
+		for _, priv := range []PrivProtocol{DES, AES, AES192, AES256} {
+			users = append(users, Security{Level: AuthPriv, AuthProtocol: auth, PrivProtocol: priv})
+		}
+	}
+	users = append(users, Security{Level: NoAuthNoPriv})
+
+	for _, security := range users {
+		name := fmt.Sprintf("%s/%s/%s", security.Level, security.AuthProtocol, security.PrivProtocol)
+		t.Run(name, func(t *testing.T) {
+			security.UserName = "monitor"
+			if security.Level >= AuthNoPriv {
+				security.AuthPassphrase = "authpassphrase"
+			}
+			if security.Level == AuthPriv {
+				security.PrivPassphrase = "privpassphrase"
+			}
+			user, err := NewUser(security)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := v3TestMessage(levelFlags(security.Level) | flagReportable)
+			data, err := MarshalV3(m, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if security.Level == AuthPriv && bytes.Contains(data, []byte("Linux router")) {
+				t.Fatal("the scoped PDU was sent in clear")
+			}
+
+			lookup := func(userName string) *User {
+				if userName == user.UserName {
+					return user
+				}
+				return nil
+			}
+			decoded, err := UnmarshalV3(data, lookup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Level() != security.Level || !decoded.Reportable() || decoded.MsgID != m.MsgID ||
+				decoded.EngineBoots != m.EngineBoots || decoded.EngineTime != m.EngineTime ||
+				decoded.UserName != m.UserName || decoded.ContextName != m.ContextName ||
+				!bytes.Equal(decoded.EngineID, m.EngineID) || !bytes.Equal(decoded.ContextEngineID, m.ContextEngineID) {
+				t.Fatalf("UnmarshalV3() = %+v, want %+v", decoded, m)
+			}
+			if len(decoded.PDU.Variables) != 2 || decoded.PDU.Variables[0].String() != "Linux router" ||
+				decoded.PDU.Variables[1].Value != uint64(1)<<40 {
+				t.Fatalf("UnmarshalV3() variables = %+v", decoded.PDU.Variables)
+			}
+
+			// Each message is encrypted with a fresh salt
+			if security.Level == AuthPriv {
+				again, err := MarshalV3(m, user)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Equal(again, data) {
+					t.Fatal("two messages were encrypted with the same salt")
+				}
+			}
+		})
+	}
+}
+
+func TestMessageV3AuthenticationOffset(t *testing.T) {
+	user, err := NewUser(Security{UserName: "monitor", Level: AuthPriv, AuthProtocol: SHA256,
+		AuthPassphrase: "authpassphrase", PrivProtocol: AES, PrivPassphrase: "privpassphrase"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalV3(v3TestMessage(flagAuth|flagPriv), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The MAC sits in msgAuthenticationParameters and covers the message
+	// with those bytes zeroed
+	authKey, _ := user.keys(rfc3414EngineID)
+	macLength := SHA256.macLength()
+	offset := -1
+	for i := 0; i+macLength <= len(data); i++ {
+		zeroed := append([]byte(nil), data...)
+		copy(zeroed[i:i+macLength], make([]byte, macLength))
+		if hmac.Equal(user.mac(authKey, zeroed), data[i:i+macLength]) {
+			offset = i
+			break
+		}
+	}
+	if offset < 2 || data[offset-2] != tagOctetString || int(data[offset-1]) != macLength {
+		t.Fatalf("MAC not found in an OCTET STRING of %d bytes (offset %d)", macLength, offset)
+	}
+
+	lookup := func(string) *User { return user }
+
+	// The offset is found however the packet sits in its buffer
+	buf := append(append(bytes.Repeat([]byte{0xee}, 17), data...), bytes.Repeat([]byte{0xee}, 64)...)
+	if _, err := UnmarshalV3(buf[17:17+len(data)], lookup); err != nil {
+		t.Fatalf("UnmarshalV3 of a packet inside a larger buffer: %v", err)
+	}
+	if _, err := UnmarshalV3(data, lookup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any changed byte, the MAC included, fails authentication
+	for _, i := range []int{offset, offset + macLength - 1, len(data) - 1, 20} {
+		tampered := append([]byte(nil), data...)
+		tampered[i] ^= 0x01
+		if _, err := UnmarshalV3(tampered, lookup); err == nil {
+			t.Errorf("UnmarshalV3 accepted the message with byte %d changed", i)
+		}
+	}
+
+	other, err := NewUser(Security{UserName: "monitor", Level: AuthPriv, AuthProtocol: SHA256,
+		AuthPassphrase: "otherpassphrase", PrivProtocol: AES, PrivPassphrase: "privpassphrase"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalV3(data, func(string) *User { return other }); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("UnmarshalV3 with the wrong passphrase = %v, want authentication failed", err)
+	}
+	if _, err := UnmarshalV3(data, func(string) *User { return nil }); err == nil || !strings.Contains(err.Error(), "unknown user") {
+		t.Errorf("UnmarshalV3 without the user = %v, want unknown user", err)
+	}
+}
+
+func TestMessageV3LevelChecks(t *testing.T) {
+	authOnly, err := NewUser(Security{UserName: "monitor", Level: AuthNoPriv, AuthProtocol: SHA, AuthPassphrase: "authpassphrase"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MarshalV3(v3TestMessage(flagAuth|flagPriv), authOnly); err == nil {
+		t.Error("MarshalV3 encrypted with a user without a privacy key")
+	}
+	if _, err := MarshalV3(v3TestMessage(flagAuth), nil); err == nil {
+		t.Error("MarshalV3 authenticated without a user")
+	}
+
+	data, err := MarshalV3(v3TestMessage(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalV3(data, nil); err != nil {
+		t.Errorf("UnmarshalV3 of a noAuthNoPriv message: %v", err)
+	}
+	for n := 0; n < len(data); n += 7 {
+		if _, err := UnmarshalV3(data[:n], nil); err == nil {
+			t.Errorf("UnmarshalV3 accepted the message truncated to %d bytes", n)
+		}
+	}
+	// msgFlags with privacy but no authentication (RFC 3412 7.2 h)
+	flags := bytes.Index(data, []byte{0x04, 0x01, 0x00, 0x02, 0x01, 0x03})
+	if flags < 0 {
+		t.Fatal("msgFlags not found")
+	}
+	data[flags+2] = flagPriv
+	if _, err := UnmarshalV3(data, nil); err == nil {
+		t.Error("UnmarshalV3 accepted privacy without authentication")
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"net"
+	"os"
 	"time"
 
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -13,9 +15,10 @@ type SSHClient struct {
 	Host     string
 	Port     int
 	Username string
-	Password string
-	KeyPath  string
-	client   *ssh.Client
+	Password   string
+	PrivateKey string // PEM encoded, takes precedence over KeyPath
+	KeyPath    string
+	client     *ssh.Client
 }
 
 // Connect establishes SSH connection
@@ -26,14 +29,24 @@ func (s *SSHClient) Connect() error {
 		Timeout:         30 * time.Second,
 	}
 
-	// Configure authentication
-	if s.Password != "" {
-		config.Auth = []ssh.AuthMethod{
-			ssh.Password(s.Password),
+	// Configure authentication; a private key is tried before the password
+	key := []byte(s.PrivateKey)
+	if len(key) == 0 && s.KeyPath != "" {
+		data, err := os.ReadFile(s.KeyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read SSH key: %v", err)
+		}
+		key = data
+	}
+	if len(key) > 0 {
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return fmt.Errorf("invalid SSH private key: %v", err)
 		}
-	} else if s.KeyPath != "" {
-		// TODO: Implement key-based authentication
-		return fmt.Errorf("key-based authentication not implemented yet")
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if s.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(s.Password))
 	}
 
 	// Connect to SSH server
@@ -67,6 +80,19 @@ func (s *SSHClient) Execute(command string) (string, error) {
 	return string(output), nil
 }
 
+// SFTP opens an SFTP session over the connection
+func (s *SSHClient) SFTP() (*sftp.Client, error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("SSH client not connected")
+	}
+
+	client, err := sftp.NewClient(s.client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SFTP session: %v", err)
+	}
+	return client, nil
+}
+
 // UploadFile uploads a file to the remote host
 func (s *SSHClient) UploadFile(localPath, remotePath string) error {
 	// TODO: Implement SCP file upload
@@ -124,8 +150,7 @@ func (ci *ComponentInstaller) InstallComponent(component Component) error {
 	defer ci.sshClient.Close()
 
 	// Check system architecture
-	arch, err := ci.sshClient.Execute("uname -m")
-	if err != nil {
+	if _, err := ci.sshClient.Execute("uname -m"); err != nil {
 		return fmt.Errorf("failed to detect architecture: %v", err)
 	}
 
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultTrapAlertName is the alert name template of rules that set none
+const defaultTrapAlertName = "{{trap}} on {{device}}"
+
+// trapTemplateRe matches the {{placeholder}} of an alert name template
+var trapTemplateRe = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_:.-]+)\s*\}\}`)
+
+// prepare validates a rule before it is saved. Trap OIDs given by name are
+// translated with the MIB store, and the severity defaults to warning.
+func (r *TrapAlertRule) prepare() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	switch r.Severity {
+	case "critical", "warning", "info":
+	default:
+		return fmt.Errorf("severity must be critical, warning or info")
+	}
+	if _, err := r.matches(); err != nil {
+		return err
+	}
+
+	var tree *mibTree
+	for _, oid := range []*string{&r.TrapOID, &r.ClearTrapOID} {
+		*oid = strings.TrimPrefix(strings.TrimSpace(*oid), ".")
+		if *oid == "" || isNumericOID(*oid) {
+			continue
+		}
+		if tree == nil {
+			var err error
+			if tree, err = loadMIBTree(); err != nil {
+				return err
+			}
+		}
+		translated, err := tree.Translate(*oid)
+		if err != nil {
+			return err
+		}
+		*oid = translated
+	}
+	if r.TrapOID == "" {
+		return fmt.Errorf("trap_oid is required")
+	}
+	if r.ClearTrapOID == r.TrapOID {
+		return fmt.Errorf("clear_trap_oid must differ from trap_oid")
+	}
+	return nil
+}
+
+// matches decodes the varbind conditions of a rule
+func (r *TrapAlertRule) matches() (map[string]string, error) {
+	conditions := map[string]string{}
+	if strings.TrimSpace(r.Match) == "" {
+		return conditions, nil
+	}
+	if err := json.Unmarshal([]byte(r.Match), &conditions); err != nil {
+		return nil, fmt.Errorf("match must be a JSON object of strings: %v", err)
+	}
+	return conditions, nil
+}
+
+// trapVarbinds looks up the decoded varbinds of a trap by object
+type trapVarbinds []mibValue
+
+// find returns the varbind for key: an object name such as ifIndex, a
+// MODULE::name, or a numeric OID the varbind is at or below
+func (vs trapVarbinds) find(key string) *mibValue {
+	key = strings.TrimPrefix(key, ".")
+	for i, v := range vs {
+		if isNumericOID(key) {
+			if v.OID == key || strings.HasPrefix(v.OID, key+".") {
+				return &vs[i]
+			}
+			continue
+		}
+		// Names never contain dots, so the instance follows the first one
+		// after the module
+		name := v.Name
+		offset := strings.LastIndex(name, "::") + 1
+		if dot := strings.IndexByte(name[offset:], '.'); dot >= 0 {
+			name = name[:offset+dot]
+		}
+		if name == key || (!strings.Contains(key, "::") && strings.HasSuffix(name, "::"+key)) {
+			return &vs[i]
+		}
+	}
+	return nil
+}
+
+// matchesValue reports whether a varbind has the wanted value, given as
+// the raw value, its display form or an enumeration label
+func (v *mibValue) matchesValue(want string) bool {
+	if fmt.Sprint(v.Value) == want || v.Display == want {
+		return true
+	}
+	if label, _, ok := strings.Cut(v.Display, "("); ok && strings.HasSuffix(v.Display, ")") {
+		return label == want
+	}
+	return false
+}
+
+// renderTrapTemplate fills in {{device}}, {{source}}, {{trap}} and
+// {{object}} placeholders, the latter with the display value of a varbind.
+// {{trap}} is the name of the rule's raising trap, so that an alert renders
+// the same for its clear trap. Placeholders that resolve to nothing are left
+// empty.
+func renderTrapTemplate(template, trapName string, trap *Trap, device *Device, varbinds trapVarbinds) string {
+	return strings.TrimSpace(trapTemplateRe.ReplaceAllStringFunc(template, func(placeholder string) string {
+		key := trapTemplateRe.FindStringSubmatch(placeholder)[1]
+		switch key {
+		case "device":
+			if device != nil {
+				return device.Name
+			}
+			return trap.Source
+		case "source":
+			return trap.Source
+		case "trap":
+			return trapName
+		}
+		if v := varbinds.find(key); v != nil {
+			return v.Display
+		}
+		return ""
+	}))
+}
+
+// applyTrapAlertRules raises alerts for the rules a stored trap triggers and
+// resolves those its clear trap pairs with. An alert belongs to a rule and
+// device; its rendered name tells instances apart, so a name template such
+// as "Link down on {{device}} port {{ifIndex}}" pairs linkUp with the
+// linkDown of the same port. tree names the raising traps of the rules.
+func applyTrapAlertRules(trap *Trap, tree *mibTree) {
+	var rules []TrapAlertRule
+	if err := db.Where("disabled = ? AND (trap_oid = ? OR clear_trap_oid = ?)", false, trap.TrapOID, trap.TrapOID).Order("id").Find(&rules).Error; err != nil {
+		log.Printf("Failed to load trap alert rules: %v", err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+	var varbinds trapVarbinds
+	if err := json.Unmarshal([]byte(trap.Variables), &varbinds); err != nil {
+		log.Printf("Failed to decode varbinds of trap %d: %v", trap.ID, err)
+		return
+	}
+	var device *Device
+	if trap.DeviceID != nil {
+		var d Device
+		if db.First(&d, *trap.DeviceID).Error == nil {
+			device = &d
+		}
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		template := rule.AlertName
+		if template == "" {
+			template = defaultTrapAlertName
+		}
+		trapName := tree.Name(rule.TrapOID)
+		name := renderTrapTemplate(template, trapName, trap, device, varbinds)
+		source := fmt.Sprintf("trap:%d", rule.ID)
+		active := func(tx *gorm.DB) *gorm.DB {
+			tx = tx.Where("source = ? AND name = ? AND status = ?", source, name, "active")
+			if trap.DeviceID != nil {
+				return tx.Where("device_id = ?", *trap.DeviceID)
+			}
+			return tx.Where("device_id IS NULL")
+		}
+
+		if trap.TrapOID == rule.ClearTrapOID {
+			now := time.Now()
+			err := db.Model(&Alert{}).Scopes(active).Updates(map[string]interface{}{
+				"status": "resolved", "resolved_at": &now, "updated_at": now,
+			}).Error
+			if err != nil {
+				log.Printf("Failed to resolve alerts of trap rule %s: %v", rule.Name, err)
+			}
+			continue
+		}
+
+		conditions, err := rule.matches()
+		if err != nil {
+			continue
+		}
+		matched := true
+		for key, want := range conditions {
+			if v := varbinds.find(key); v == nil || !v.matchesValue(want) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		// A repeated trap refreshes the alert it already raised
+		var alert Alert
+		if db.Scopes(active).First(&alert).Error == nil {
+			alert.Value, alert.UpdatedAt = trap.Name, time.Now()
+			db.Save(&alert)
+			continue
+		}
+		description := renderTrapTemplate(rule.Description, trapName, trap, device, varbinds)
+		if description == "" {
+			description = strings.Join(strings.Fields(trap.Description), " ")
+		}
+		alert = Alert{
+			Name:        name,
+			Description: description,
+			Severity:    rule.Severity,
+			Status:      "active",
+			Source:      source,
+			Value:       trap.Name,
+			DeviceID:    trap.DeviceID,
+			TriggeredAt: trap.ReceivedAt,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+		if err := db.Create(&alert).Error; err != nil {
+			log.Printf("Failed to raise alert for trap rule %s: %v", rule.Name, err)
+		}
+	}
+}
+
+// Trap alert rule API handlers
+
+func getTrapAlertRules(c *gin.Context) {
+	var rules []TrapAlertRule
+	db.Order("id").Find(&rules)
+	c.JSON(http.StatusOK, rules)
+}
+
+func createTrapAlertRule(c *gin.Context) {
+	var rule TrapAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := rule.prepare(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = time.Now()
+	if err := db.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func updateTrapAlertRule(c *gin.Context) {
+	var rule TrapAlertRule
+	if err := db.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trap alert rule not found"})
+		return
+	}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := rule.prepare(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule.UpdatedAt = time.Now()
+	if err := db.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func deleteTrapAlertRule(c *gin.Context) {
+	if err := db.Delete(&TrapAlertRule{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Trap alert rule deleted successfully"})
+}
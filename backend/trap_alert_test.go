@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"snmp-monitor-pro/snmp"
+)
+
+// linkTrap is a v2c linkDown or linkUp of an interface
+func linkTrap(trapOID string, ifIndex int64) *snmp.Notification {
+	return &snmp.Notification{
+		Source:  &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 162},
+		Version: snmp.Version2c,
+		Type:    snmp.TrapV2,
+		TrapOID: trapOID,
+		Variables: []snmp.Variable{
+			{OID: "1.3.6.1.2.1.2.2.1.1." + strconv.FormatInt(ifIndex, 10), Type: snmp.Integer, Value: ifIndex},
+			{OID: "1.3.6.1.2.1.2.2.1.8." + strconv.FormatInt(ifIndex, 10), Type: snmp.Integer, Value: int64(2)},
+		},
+	}
+}
+
+func TestTrapAlertRulesPairClearTraps(t *testing.T) {
+	const linkDown, linkUp = "1.3.6.1.6.3.1.1.5.3", "1.3.6.1.6.3.1.1.5.4"
+
+	tests := []struct {
+		name      string
+		alertName string
+		traps     []*snmp.Notification
+		active    []string
+		resolved  []string
+	}{
+		{
+			name:     "default template",
+			traps:    []*snmp.Notification{linkTrap(linkDown, 3), linkTrap(linkDown, 3), linkTrap(linkUp, 3)},
+			resolved: []string{"IF-MIB::linkDown on sw1"},
+		},
+		{
+			name:     "default template without clear",
+			traps:    []*snmp.Notification{linkTrap(linkDown, 3), linkTrap(linkDown, 4)},
+			active:   []string{"IF-MIB::linkDown on sw1"},
+			resolved: []string{},
+		},
+		{
+			name:      "per port template",
+			alertName: "Link down on {{device}} port {{ifIndex}}",
+			traps:     []*snmp.Notification{linkTrap(linkDown, 3), linkTrap(linkDown, 4), linkTrap(linkUp, 3)},
+			active:    []string{"Link down on sw1 port 4"},
+			resolved:  []string{"Link down on sw1 port 3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			tree := loadTestMIBTree(t)
+			db.Create(&Device{Name: "sw1", IP: "10.0.0.1", Type: "switch"})
+			rule := TrapAlertRule{Name: "link", TrapOID: "IF-MIB::linkDown", ClearTrapOID: "IF-MIB::linkUp", AlertName: tt.alertName}
+			if err := rule.prepare(); err != nil {
+				t.Fatal(err)
+			}
+			db.Create(&rule)
+
+			r := &trapReceiver{tree: tree, loadedAt: time.Now()}
+			for _, n := range tt.traps {
+				r.receive(n)
+			}
+
+			var alerts []Alert
+			db.Order("id").Find(&alerts)
+			var active, resolved []string
+			for _, alert := range alerts {
+				switch alert.Status {
+				case "active":
+					active = append(active, alert.Name)
+				case "resolved":
+					if alert.ResolvedAt == nil {
+						t.Errorf("alert %q resolved without resolved_at", alert.Name)
+					}
+					resolved = append(resolved, alert.Name)
+				}
+			}
+			if !slices.Equal(active, tt.active) || !slices.Equal(resolved, tt.resolved) {
+				t.Errorf("active %q, resolved %q; want %q, %q", active, resolved, tt.active, tt.resolved)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"snmp-monitor-pro/snmp"
+)
+
+// trapReceiverSettingKey is the Setting holding TrapReceiverSettings
+const trapReceiverSettingKey = "trap_receiver"
+
+// TrapReceiverSettings configures the SNMP trap and inform listener
+type TrapReceiverSettings struct {
+	Enabled     bool     `json:"enabled"`
+	Port        int      `json:"port"`
+	Communities []string `json:"communities"` // accepted v1/v2c communities, any when empty
+}
+
+// defaultTrapReceiverSettings returns the settings used until others are saved
+func defaultTrapReceiverSettings() TrapReceiverSettings {
+	return TrapReceiverSettings{Enabled: true, Port: 162, Communities: []string{}}
+}
+
+// Validate checks the port
+func (s TrapReceiverSettings) Validate() error {
+	if s.Port <= 0 || s.Port > 65535 {
+		return fmt.Errorf("invalid trap receiver port %d", s.Port)
+	}
+	return nil
+}
+
+// loadTrapReceiverSettings reads the receiver settings, falling back to the
+// defaults
+func loadTrapReceiverSettings() TrapReceiverSettings {
+	settings := defaultTrapReceiverSettings()
+	if !loadSetting(trapReceiverSettingKey, &settings) || settings.Validate() != nil {
+		return defaultTrapReceiverSettings()
+	}
+	return settings
+}
+
+// snmpEngineSettingKey is the Setting holding the local SNMPv3 engine. It is
+// managed by the server and read-only through the settings API.
+const snmpEngineSettingKey = "snmp_engine"
+
+// snmpEngine is the local engine v3 inform senders discover
+type snmpEngine struct {
+	EngineID string `json:"engine_id"` // hex
+	Boots    int32  `json:"boots"`
+}
+
+// bootSNMPEngine loads the local engine, creating its ID on first use, and
+// counts a boot as RFC 3414 requires for each restart of the engine
+func bootSNMPEngine() ([]byte, int32, error) {
+	var engine snmpEngine
+	loadSetting(snmpEngineSettingKey, &engine)
+	engineID, err := hex.DecodeString(engine.EngineID)
+	if err != nil || len(engineID) < 5 || len(engineID) > 32 {
+		// RFC 3411 format with random octets, in the net-snmp style
+		engineID = make([]byte, 13)
+		copy(engineID, []byte{0x80, 0x00, 0x1f, 0x88, 0x80})
+		if _, err := rand.Read(engineID[5:]); err != nil {
+			return nil, 0, err
+		}
+		engine = snmpEngine{EngineID: hex.EncodeToString(engineID)}
+	}
+	engine.Boots++
+	value, err := json.Marshal(engine)
+	if err != nil {
+		return nil, 0, err
+	}
+	setting := Setting{Key: snmpEngineSettingKey, Value: string(value), UpdatedAt: time.Now()}
+	if err := db.Save(&setting).Error; err != nil {
+		return nil, 0, err
+	}
+	return engineID, engine.Boots, nil
+}
+
+// trapMIBTreeTTL is how long the receiver decodes with one load of the MIB
+// store before picking up changes
+const trapMIBTreeTTL = time.Minute
+
+// trapReceiver turns notifications from the listener into Trap rows. Its
+// methods run on the listener goroutine only.
+type trapReceiver struct {
+	listener *snmp.TrapListener
+	tree     *mibTree
+	loadedAt time.Time
+	users    map[string]*snmp.User // by USM parameters, to derive keys once
+}
+
+var (
+	trapReceiverMu     sync.Mutex
+	activeTrapReceiver *trapReceiver
+)
+
+// StartTrapReceiver (re)starts the trap listener with the stored settings.
+// A port that cannot be bound is logged and leaves the receiver stopped.
+func StartTrapReceiver() {
+	trapReceiverMu.Lock()
+	defer trapReceiverMu.Unlock()
+	if activeTrapReceiver != nil {
+		activeTrapReceiver.listener.Close()
+		activeTrapReceiver = nil
+	}
+
+	settings := loadTrapReceiverSettings()
+	if !settings.Enabled {
+		return
+	}
+	engineID, boots, err := bootSNMPEngine()
+	if err != nil {
+		log.Printf("Failed to load SNMP engine: %v", err)
+		return
+	}
+	r := &trapReceiver{users: make(map[string]*snmp.User)}
+	r.listener = &snmp.TrapListener{
+		Communities: settings.Communities,
+		Users:       r.user,
+		EngineID:    engineID,
+		EngineBoots: boots,
+		Handler:     r.receive,
+	}
+	if err := r.listener.Listen(":" + strconv.Itoa(settings.Port)); err != nil {
+		log.Printf("Trap receiver not started: %v", err)
+		return
+	}
+	activeTrapReceiver = r
+	go func() {
+		if err := r.listener.Serve(); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Trap receiver stopped: %v", err)
+		}
+	}()
+}
+
+// user finds the USM user a v3 sender authenticates as among the v3
+// devices, preferring the device the notification comes from
+func (r *trapReceiver) user(source *net.UDPAddr, userName string) *snmp.User {
+	var devices []Device
+	db.Where("snmp_version = ? AND security_name = ?", "v3", userName).Find(&devices)
+	if len(devices) == 0 {
+		return nil
+	}
+	device := devices[0]
+	for _, d := range devices {
+		if d.IP == source.IP.String() {
+			device = d
+			break
+		}
+	}
+	security, err := deviceSecurity(device)
+	if err != nil {
+		return nil
+	}
+	key := fmt.Sprintf("%+v", *security)
+	if user := r.users[key]; user != nil {
+		return user
+	}
+	user, err := snmp.NewUser(*security)
+	if err != nil {
+		return nil
+	}
+	r.users[key] = user
+	return user
+}
+
+// mibTree returns the tree notifications are decoded with. Without a
+// usable MIB store varbinds are kept with their numeric OIDs.
+func (r *trapReceiver) mibTree() *mibTree {
+	if r.tree == nil || time.Since(r.loadedAt) > trapMIBTreeTTL {
+		tree, err := loadMIBTree()
+		if err != nil {
+			log.Printf("Failed to load MIB tree for traps: %v", err)
+			tree = &mibTree{}
+		}
+		r.tree, r.loadedAt = tree, time.Now()
+	}
+	return r.tree
+}
+
+// receive decodes a notification against its NOTIFICATION-TYPE or
+// TRAP-TYPE definition and stores it
+func (r *trapReceiver) receive(n *snmp.Notification) {
+	trap, err := r.decode(n)
+	if err != nil {
+		log.Printf("Failed to decode trap from %s: %v", n.Source, err)
+		return
+	}
+	if err := db.Create(trap).Error; err != nil {
+		log.Printf("Failed to store trap from %s: %v", n.Source, err)
+		return
+	}
+	applyTrapAlertRules(trap, r.mibTree())
+}
+
+// decode builds the Trap row of a notification and resolves the device
+// that sent it: by source address, or for v1 by the agent address a relay
+// passes on
+func (r *trapReceiver) decode(n *snmp.Notification) (*Trap, error) {
+	tree := r.mibTree()
+	trap := &Trap{
+		Source:       n.Source.IP.String(),
+		Version:      n.Version.String(),
+		PDUType:      "trap",
+		SecurityName: n.UserName,
+		TrapOID:      n.TrapOID,
+		Name:         tree.Name(n.TrapOID),
+		Enterprise:   n.Enterprise,
+		Uptime:       n.Uptime,
+		ReceivedAt:   time.Now(),
+	}
+	if n.Type == snmp.InformRequest {
+		trap.PDUType = "inform"
+	}
+	if n.AgentAddress != nil {
+		trap.AgentAddress = n.AgentAddress.String()
+	}
+	if node := tree.Lookup(n.TrapOID); node != nil && (node.Kind == "notification-type" || node.Kind == "trap-type") {
+		trap.Description = node.Description
+	}
+
+	values := make([]mibValue, 0, len(n.Variables))
+	for _, v := range n.Variables {
+		values = append(values, tree.FormatVariable(v))
+	}
+	variables, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	trap.Variables = string(variables)
+
+	var device Device
+	if err := db.Where("ip = ?", trap.Source).First(&device).Error; err == nil {
+		trap.DeviceID = &device.ID
+	} else if trap.AgentAddress != "" && db.Where("ip = ?", trap.AgentAddress).First(&device).Error == nil {
+		trap.DeviceID = &device.ID
+	}
+	return trap, nil
+}
+
+// Trap API handlers
+
+// getTraps lists received traps, newest first. It filters by device_id,
+// source, trap_oid, name (optionally MODULE::name) and a since/until
+// RFC 3339 time range, and pages like getMIBOids.
+func getTraps(c *gin.Context) {
+	var since, until time.Time
+	for param, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s: %v", param, err)})
+				return
+			}
+			*t = parsed
+		}
+	}
+	filter := func(tx *gorm.DB) *gorm.DB {
+		if deviceID := c.Query("device_id"); deviceID != "" {
+			tx = tx.Where("device_id = ?", deviceID)
+		}
+		if source := c.Query("source"); source != "" {
+			tx = tx.Where("source = ?", source)
+		}
+		if oid := strings.Trim(c.Query("trap_oid"), "."); oid != "" {
+			tx = tx.Where("trap_oid = ?", oid)
+		}
+		if name := c.Query("name"); name != "" {
+			if strings.Contains(name, "::") {
+				tx = tx.Where("name = ?", name)
+			} else {
+				tx = tx.Where("name LIKE ?", "%::"+name)
+			}
+		}
+		if !since.IsZero() {
+			tx = tx.Where("received_at >= ?", since)
+		}
+		if !until.IsZero() {
+			tx = tx.Where("received_at < ?", until)
+		}
+		return tx
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	var total int64
+	db.Model(&Trap{}).Scopes(filter).Count(&total)
+
+	var traps []Trap
+	db.Scopes(filter).Preload("Device").Order("id desc").Limit(limit).Offset((page - 1) * limit).Find(&traps)
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, traps)
+}
+
+func getTrap(c *gin.Context) {
+	var trap Trap
+	if err := db.Preload("Device").First(&trap, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trap not found"})
+		return
+	}
+	c.JSON(http.StatusOK, trap)
+}
+
+func deleteTrap(c *gin.Context) {
+	result := db.Delete(&Trap{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trap not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Trap deleted successfully"})
+}